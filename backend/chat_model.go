@@ -11,6 +11,7 @@ import (
 	"net/http"
 	"strings"
 
+	"github.com/LubyRuffy/gptb2o/telemetry"
 	einoModel "github.com/cloudwego/eino/components/model"
 	"github.com/cloudwego/eino/schema"
 )
@@ -32,8 +33,23 @@ type ChatModelConfig struct {
 	Instructions string
 	// ReasoningEffort 会透传到 backend `reasoning.effort`（如 low/medium/high）。
 	ReasoningEffort string
+	// OnRetry 可选，backend 返回 400 后按 reason 调整请求重试前调用，供 metrics 统计降级次数。
+	OnRetry func(ctx context.Context, reason RetryReason)
+	// Telemetry 可选，启用后为每次调用、每次 backend 尝试与 SSE 读取创建 span。
+	Telemetry *telemetry.Tracer
+	// Timeouts 可选，限制连接、首个事件、事件间隔与整个请求的耗时；超时返回 *StreamTimeoutError。
+	Timeouts StreamTimeouts
 }
 
+// RetryReason 标识 doStreamRequest 针对 backend 400 做的降级重试类型。
+type RetryReason string
+
+const (
+	RetryReasonCodeInterpreter RetryReason = "code_interpreter"
+	RetryReasonReasoningEffort RetryReason = "reasoning_effort"
+	RetryReasonSamplingParam   RetryReason = "sampling_param"
+)
+
 // ChatModel 是基于 ChatGPT Backend responses SSE 接口的 ToolCallingChatModel 实现。
 type ChatModel struct {
 	config          ChatModelConfig
@@ -147,6 +163,34 @@ func (m *ChatModel) WithToolCallHandler(handler func(*ToolCall)) *ChatModel {
 }
 
 func (m *ChatModel) doStreamRequest(ctx context.Context, input []*schema.Message, onDelta func(string) error) (string, []*ToolCall, *schema.TokenUsage, error) {
+	ctx, span := m.config.Telemetry.Start(ctx, telemetry.SpanChatModel, telemetry.SpanKindInternal,
+		telemetry.String(telemetry.AttrModel, m.config.Model),
+		telemetry.String(telemetry.AttrReasoningEffort, m.config.ReasoningEffort),
+	)
+	defer span.End()
+
+	ctx, cancel := WithRequestTimeout(ctx, m.config.Timeouts.Total)
+	defer cancel()
+	content, toolCalls, usage, err := m.doStreamRequestWithRetry(ctx, input, onDelta)
+	if err != nil {
+		if timeoutErr, ok := AsStreamTimeout(ctx, err); ok {
+			err = timeoutErr
+		}
+		span.RecordError(err)
+		return "", nil, nil, err
+	}
+	if usage != nil {
+		span.SetAttributes(usageAttributes(usage)...)
+	}
+	return content, toolCalls, usage, nil
+}
+
+func usageAttributes(usage *schema.TokenUsage) []telemetry.Attribute {
+	return telemetry.UsageAttributes(int64(usage.PromptTokens), int64(usage.CompletionTokens), int64(usage.CompletionTokensDetails.ReasoningTokens))
+}
+
+// doStreamRequestWithRetry 发起 backend 请求，并针对 backend 400 做最多一轮的降级重试。
+func (m *ChatModel) doStreamRequestWithRetry(ctx context.Context, input []*schema.Message, onDelta func(string) error) (string, []*ToolCall, *schema.TokenUsage, error) {
 	payload, err := m.buildRequestPayload(input)
 	if err != nil {
 		return "", nil, nil, err
@@ -156,8 +200,8 @@ func (m *ChatModel) doStreamRequest(ctx context.Context, input []*schema.Message
 	retriedWithoutCodeInterpreter := false
 	retriedReasoningEffort := false
 	retriedSamplingParams := make(map[string]bool, 2)
-	for {
-		content, toolCalls, usage, err := m.doStreamRequestOnce(ctx, currentPayload, onDelta)
+	for attempt := 1; ; attempt++ {
+		content, toolCalls, usage, err := m.doStreamRequestOnce(ctx, attempt, currentPayload, onDelta)
 		if err == nil {
 			return content, toolCalls, usage, nil
 		}
@@ -170,6 +214,7 @@ func (m *ChatModel) doStreamRequest(ctx context.Context, input []*schema.Message
 			if removed {
 				currentPayload.Tools = filteredTools
 				retriedWithoutCodeInterpreter = true
+				m.notifyRetry(ctx, RetryReasonCodeInterpreter)
 				continue
 			}
 		}
@@ -181,6 +226,7 @@ func (m *ChatModel) doStreamRequest(ctx context.Context, input []*schema.Message
 				IsUnsupportedReasoningEffortError(statusErr.message, currentEffort) {
 				currentPayload.Reasoning = &requestReasoning{Effort: fallbackEffort}
 				retriedReasoningEffort = true
+				m.notifyRetry(ctx, RetryReasonReasoningEffort)
 				continue
 			}
 		}
@@ -188,6 +234,7 @@ func (m *ChatModel) doStreamRequest(ctx context.Context, input []*schema.Message
 			if samplingParam := UnsupportedSamplingParam(statusErr.message); samplingParam != "" && !retriedSamplingParams[samplingParam] {
 				if removeSamplingParam(currentPayload, samplingParam) {
 					retriedSamplingParams[samplingParam] = true
+					m.notifyRetry(ctx, RetryReasonSamplingParam)
 					continue
 				}
 			}
@@ -196,6 +243,13 @@ func (m *ChatModel) doStreamRequest(ctx context.Context, input []*schema.Message
 	}
 }
 
+func (m *ChatModel) notifyRetry(ctx context.Context, reason RetryReason) {
+	telemetry.SpanFromContext(ctx).AddEvent("retry", telemetry.String(telemetry.AttrRetryReason, string(reason)))
+	if m.config.OnRetry != nil {
+		m.config.OnRetry(ctx, reason)
+	}
+}
+
 type backendRequestStatusError struct {
 	status  int
 	message string
@@ -211,13 +265,31 @@ func (e *backendRequestStatusError) Error() string {
 	return fmt.Sprintf("backend request failed with status %d: %s", e.status, strings.TrimSpace(e.message))
 }
 
-func (m *ChatModel) doStreamRequestOnce(ctx context.Context, payload *requestPayload, onDelta func(string) error) (string, []*ToolCall, *schema.TokenUsage, error) {
+func (m *ChatModel) doStreamRequestOnce(ctx context.Context, attempt int, payload *requestPayload, onDelta func(string) error) (content string, toolCalls []*ToolCall, usage *schema.TokenUsage, err error) {
+	effort := ""
+	if payload.Reasoning != nil {
+		effort = payload.Reasoning.Effort
+	}
+	ctx, span := m.config.Telemetry.Start(ctx, telemetry.SpanBackendAttempt, telemetry.SpanKindClient,
+		telemetry.String(telemetry.AttrHTTPMethod, http.MethodPost),
+		telemetry.String(telemetry.AttrURLFull, m.config.BackendURL),
+		telemetry.String(telemetry.AttrModel, payload.Model),
+		telemetry.String(telemetry.AttrReasoningEffort, effort),
+		telemetry.Int(telemetry.AttrAttempt, attempt),
+	)
+	defer func() {
+		span.RecordError(err)
+		span.End()
+	}()
+
 	bodyBytes, err := json.Marshal(payload)
 	if err != nil {
 		return "", nil, nil, fmt.Errorf("failed to encode backend request: %w", err)
 	}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, m.config.BackendURL, bytes.NewReader(bodyBytes))
+	reqCtx, watchdog := NewStreamWatchdog(ctx, m.config.Timeouts)
+	defer watchdog.Stop()
+	req, err := http.NewRequestWithContext(reqCtx, http.MethodPost, m.config.BackendURL, bytes.NewReader(bodyBytes))
 	if err != nil {
 		return "", nil, nil, fmt.Errorf("failed to build backend request: %w", err)
 	}
@@ -233,19 +305,28 @@ func (m *ChatModel) doStreamRequestOnce(ctx context.Context, payload *requestPay
 
 	resp, err := m.config.HTTPClient.Do(req)
 	if err != nil {
-		return "", nil, nil, fmt.Errorf("backend request failed: %w", err)
+		return "", nil, nil, fmt.Errorf("backend request failed: %w", watchdog.Err(err))
 	}
+	resp.Body = watchdog.WatchBody(resp.Body)
 	defer resp.Body.Close()
+	span.SetAttributes(telemetry.Int(telemetry.AttrHTTPStatusCode, resp.StatusCode))
 
 	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusBadRequest {
 		body, _ := io.ReadAll(io.LimitReader(resp.Body, 8<<10))
 		return "", nil, nil, &backendRequestStatusError{status: resp.StatusCode, message: strings.TrimSpace(string(body))}
 	}
 
-	content, toolCalls, usage, err := readBackendSSE(ctx, resp.Body, onDelta, m.toolCallHandler)
+	streamCtx, streamSpan := m.config.Telemetry.Start(ctx, telemetry.SpanSSEStream, telemetry.SpanKindInternal)
+	content, toolCalls, usage, err = readBackendSSE(streamCtx, resp.Body, onDelta, m.toolCallHandler)
 	if err != nil {
+		streamSpan.RecordError(err)
+		streamSpan.End()
 		return "", nil, nil, err
 	}
+	if usage != nil {
+		streamSpan.SetAttributes(usageAttributes(usage)...)
+	}
+	streamSpan.End()
 	return content, toolCalls, usage, nil
 }
 
@@ -869,6 +950,9 @@ func applyResponseUsage(raw map[string]any, usage *schema.TokenUsage, hasUsage *
 	usage.PromptTokens = parsed
 	usage.CompletionTokens = completion
 	usage.TotalTokens = total
+	if details, ok := rawUsage["output_tokens_details"].(map[string]any); ok {
+		usage.CompletionTokensDetails.ReasoningTokens = extractIntField(details, "reasoning_tokens")
+	}
 	*hasUsage = true
 }
 
@@ -905,9 +989,10 @@ func finalizeUsage(usage *schema.TokenUsage, hasUsage bool) *schema.TokenUsage {
 		return nil
 	}
 	return &schema.TokenUsage{
-		PromptTokens:     usage.PromptTokens,
-		CompletionTokens: usage.CompletionTokens,
-		TotalTokens:      usage.TotalTokens,
+		PromptTokens:            usage.PromptTokens,
+		CompletionTokens:        usage.CompletionTokens,
+		TotalTokens:             usage.TotalTokens,
+		CompletionTokensDetails: usage.CompletionTokensDetails,
 	}
 }
 
@@ -9,6 +9,7 @@ import (
 	"strings"
 	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/cloudwego/eino/schema"
 	"github.com/stretchr/testify/require"
@@ -723,6 +724,7 @@ func TestDoStreamRequest_RetryReasoningEffortXHigh(t *testing.T) {
 	var calls int32
 	var firstEffort string
 	var secondEffort string
+	var retries []RetryReason
 
 	backendSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		defer r.Body.Close()
@@ -761,6 +763,9 @@ func TestDoStreamRequest_RetryReasoningEffortXHigh(t *testing.T) {
 		HTTPClient:      backendSrv.Client(),
 		Originator:      "test-agent",
 		ReasoningEffort: "xhigh",
+		OnRetry: func(_ context.Context, reason RetryReason) {
+			retries = append(retries, reason)
+		},
 	})
 	require.NoError(t, err)
 
@@ -772,12 +777,14 @@ func TestDoStreamRequest_RetryReasoningEffortXHigh(t *testing.T) {
 	require.Equal(t, int32(2), atomic.LoadInt32(&calls))
 	require.Equal(t, "xhigh", firstEffort)
 	require.Equal(t, "high", secondEffort)
+	require.Equal(t, []RetryReason{RetryReasonReasoningEffort}, retries)
 }
 
 func TestDoStreamRequest_RetryWithoutUnsupportedTemperature(t *testing.T) {
 	var calls int32
 	var firstHasTemperature bool
 	var secondHasTemperature bool
+	var retries []RetryReason
 
 	backendSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		defer r.Body.Close()
@@ -814,6 +821,9 @@ func TestDoStreamRequest_RetryWithoutUnsupportedTemperature(t *testing.T) {
 		HTTPClient:  backendSrv.Client(),
 		Originator:  "test-agent",
 		Temperature: &temp,
+		OnRetry: func(_ context.Context, reason RetryReason) {
+			retries = append(retries, reason)
+		},
 	})
 	require.NoError(t, err)
 
@@ -825,6 +835,7 @@ func TestDoStreamRequest_RetryWithoutUnsupportedTemperature(t *testing.T) {
 	require.Equal(t, int32(2), atomic.LoadInt32(&calls))
 	require.True(t, firstHasTemperature)
 	require.False(t, secondHasTemperature)
+	require.Equal(t, []RetryReason{RetryReasonSamplingParam}, retries)
 }
 
 func TestDoStreamRequest_RetryWithoutUnsupportedTopP(t *testing.T) {
@@ -879,3 +890,80 @@ func TestDoStreamRequest_RetryWithoutUnsupportedTopP(t *testing.T) {
 	require.True(t, firstHasTopP)
 	require.False(t, secondHasTopP)
 }
+
+func TestChatModel_StreamTimeouts(t *testing.T) {
+	release := make(chan struct{})
+	backendSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		flusher := w.(http.Flusher)
+		switch r.URL.Path {
+		case "/connect":
+			<-release
+			return
+		case "/first_event":
+			w.Header().Set("Content-Type", "text/event-stream")
+			flusher.Flush()
+		case "/idle", "/total":
+			w.Header().Set("Content-Type", "text/event-stream")
+			for i := 0; i < 3; i++ {
+				fmt.Fprint(w, "data: {\"type\":\"response.output_text.delta\",\"delta\":\"x\"}\n\n")
+				flusher.Flush()
+				if r.URL.Path == "/idle" {
+					break
+				}
+				time.Sleep(20 * time.Millisecond)
+			}
+		}
+		<-release
+	}))
+	t.Cleanup(backendSrv.Close)
+	t.Cleanup(func() { close(release) })
+
+	timeouts := StreamTimeouts{Connect: 50 * time.Millisecond, FirstEvent: 50 * time.Millisecond, Idle: 50 * time.Millisecond}
+	cases := []struct {
+		path     string
+		timeouts StreamTimeouts
+		kind     StreamTimeoutKind
+	}{
+		{path: "/connect", timeouts: timeouts, kind: StreamTimeoutConnect},
+		{path: "/first_event", timeouts: timeouts, kind: StreamTimeoutFirstEvent},
+		// 未设置 FirstEvent 时，发出响应头后不再发送数据的 backend 由 Idle 兜底。
+		{path: "/first_event", timeouts: StreamTimeouts{Idle: 50 * time.Millisecond}, kind: StreamTimeoutFirstEvent},
+		{path: "/idle", timeouts: timeouts, kind: StreamTimeoutIdle},
+		// 每 20ms 一个事件不会触发 idle，但整个请求超过 Total。
+		{path: "/total", timeouts: StreamTimeouts{Idle: time.Second, Total: 50 * time.Millisecond}, kind: StreamTimeoutTotal},
+	}
+	for _, tc := range cases {
+		m, err := NewChatModel(ChatModelConfig{
+			Model:       "gpt-5.5",
+			BackendURL:  backendSrv.URL + tc.path,
+			AccessToken: "token",
+			Timeouts:    tc.timeouts,
+		})
+		require.NoError(t, err)
+
+		sr, err := m.Stream(context.Background(), []*schema.Message{schema.UserMessage("hi")})
+		require.NoError(t, err)
+		var recvErr error
+		for recvErr == nil {
+			_, recvErr = sr.Recv()
+		}
+		var timeoutErr *StreamTimeoutError
+		require.ErrorAs(t, recvErr, &timeoutErr, tc.path)
+		require.Equal(t, tc.kind, timeoutErr.Kind, tc.path)
+		require.Contains(t, timeoutErr.Code(), string(tc.kind))
+	}
+}
+
+func TestStreamWatchdog_DisabledAndParentCancel(t *testing.T) {
+	ctx, w := NewStreamWatchdog(context.Background(), StreamTimeouts{Total: time.Second})
+	require.Nil(t, w)
+	require.Equal(t, context.Background(), ctx)
+	w.Stop()
+
+	parent, cancel := context.WithCancel(context.Background())
+	_, w = NewStreamWatchdog(parent, StreamTimeouts{Idle: time.Minute})
+	cancel()
+	// 客户端断开等非超时取消不会被当作超时。
+	require.ErrorIs(t, w.Err(context.Canceled), context.Canceled)
+	w.Stop()
+}
@@ -0,0 +1,193 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// StreamTimeouts 限制一次 backend 流式请求各阶段的耗时，0 表示不限制。
+type StreamTimeouts struct {
+	// Connect 是发出请求到收到响应头的最长时间（含 DNS、TCP/TLS 握手与 backend 排队）。
+	Connect time.Duration
+	// FirstEvent 是收到响应头后等待首个 SSE 数据的最长时间；为 0 时沿用 Idle，
+	// 避免 backend 发出响应头后一直不发数据时无人计时。
+	FirstEvent time.Duration
+	// Idle 是相邻两次收到 SSE 数据的最长间隔，用于发现中途停止发送的 backend。
+	Idle time.Duration
+	// Total 是整个请求（含降级重试与读完整个流）的最长时间，由调用方通过 WithRequestTimeout 施加。
+	Total time.Duration
+}
+
+func (t StreamTimeouts) enabled() bool {
+	return t.Connect > 0 || t.FirstEvent > 0 || t.Idle > 0
+}
+
+func (t StreamTimeouts) firstEvent() time.Duration {
+	if t.FirstEvent > 0 {
+		return t.FirstEvent
+	}
+	return t.Idle
+}
+
+// StreamTimeoutKind 标识触发的是哪一种超时。
+type StreamTimeoutKind string
+
+const (
+	StreamTimeoutConnect    StreamTimeoutKind = "connect"
+	StreamTimeoutFirstEvent StreamTimeoutKind = "first_event"
+	StreamTimeoutIdle       StreamTimeoutKind = "idle"
+	StreamTimeoutTotal      StreamTimeoutKind = "total"
+)
+
+// StreamTimeoutError 是 backend 请求因 StreamTimeouts 被中止时返回的错误，可用 errors.As 识别。
+type StreamTimeoutError struct {
+	Kind    StreamTimeoutKind
+	Timeout time.Duration
+}
+
+func (e *StreamTimeoutError) Error() string {
+	switch e.Kind {
+	case StreamTimeoutConnect:
+		return fmt.Sprintf("backend connect timeout: no response headers within %s", e.Timeout)
+	case StreamTimeoutFirstEvent:
+		return fmt.Sprintf("backend first event timeout: no stream data within %s", e.Timeout)
+	case StreamTimeoutIdle:
+		return fmt.Sprintf("backend stream idle timeout: no stream data for %s", e.Timeout)
+	default:
+		return fmt.Sprintf("backend request timeout: not finished within %s", e.Timeout)
+	}
+}
+
+// Code 返回写给客户端的错误码，例如 backend_idle_timeout。
+func (e *StreamTimeoutError) Code() string {
+	return "backend_" + string(e.Kind) + "_timeout"
+}
+
+// AsStreamTimeout 在 err 或 ctx 的取消原因是 *StreamTimeoutError 时返回它。
+func AsStreamTimeout(ctx context.Context, err error) (*StreamTimeoutError, bool) {
+	var timeoutErr *StreamTimeoutError
+	if errors.As(err, &timeoutErr) {
+		return timeoutErr, true
+	}
+	if err != nil && ctx != nil && errors.As(context.Cause(ctx), &timeoutErr) {
+		return timeoutErr, true
+	}
+	return nil, false
+}
+
+// WithRequestTimeout 返回在 timeout 后以 *StreamTimeoutError 取消的 ctx；timeout<=0 时不设置期限。
+func WithRequestTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeoutCause(ctx, timeout, &StreamTimeoutError{Kind: StreamTimeoutTotal, Timeout: timeout})
+}
+
+// StreamWatchdog 按阶段监控一次 backend 尝试：发出请求到收到响应头为 connect，之后等待首个数据为 first_event，
+// 再之后每次收到数据重新计时 idle。超时时以 *StreamTimeoutError 取消请求 ctx，阻塞中的 Do/Read 随之返回。
+// nil 的 *StreamWatchdog 可安全使用，不做任何限制。
+type StreamWatchdog struct {
+	ctx      context.Context
+	timeouts StreamTimeouts
+	cancel   context.CancelCauseFunc
+
+	mu    sync.Mutex
+	timer *time.Timer
+	kind  StreamTimeoutKind
+	done  bool
+}
+
+// NewStreamWatchdog 返回受 t 约束的 ctx，用它发起 backend 请求；请求结束后调用 Stop（包装过的 body 在 Close 时自动 Stop）。
+// 未设置 Connect/FirstEvent/Idle 时返回原 ctx 与 nil。
+func NewStreamWatchdog(ctx context.Context, t StreamTimeouts) (context.Context, *StreamWatchdog) {
+	if !t.enabled() {
+		return ctx, nil
+	}
+	ctx, cancel := context.WithCancelCause(ctx)
+	w := &StreamWatchdog{ctx: ctx, timeouts: t, cancel: cancel}
+	w.arm(StreamTimeoutConnect, t.Connect)
+	return ctx, w
+}
+
+// arm 切换到 kind 阶段并重新计时；timeout<=0 表示该阶段不限制。
+func (w *StreamWatchdog) arm(kind StreamTimeoutKind, timeout time.Duration) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.done {
+		return
+	}
+	if w.timer != nil && w.kind == kind {
+		w.timer.Reset(timeout)
+		return
+	}
+	if w.timer != nil {
+		w.timer.Stop()
+		w.timer = nil
+	}
+	w.kind = kind
+	if timeout > 0 {
+		err := &StreamTimeoutError{Kind: kind, Timeout: timeout}
+		w.timer = time.AfterFunc(timeout, func() { w.cancel(err) })
+	}
+}
+
+// WatchBody 标记已收到响应头，并返回在每次读到数据时重新计时的 body；
+// 超时后 Read 返回 *StreamTimeoutError，Close 时自动 Stop。
+func (w *StreamWatchdog) WatchBody(body io.ReadCloser) io.ReadCloser {
+	if w == nil {
+		return body
+	}
+	w.arm(StreamTimeoutFirstEvent, w.timeouts.firstEvent())
+	return &watchedBody{ReadCloser: body, watchdog: w}
+}
+
+// Err 在请求因超时被取消时把 err 换成 *StreamTimeoutError，其余情况原样返回。
+func (w *StreamWatchdog) Err(err error) error {
+	if w == nil || err == nil {
+		return err
+	}
+	if timeoutErr, ok := AsStreamTimeout(w.ctx, err); ok {
+		return timeoutErr
+	}
+	return err
+}
+
+// Stop 停止计时并释放 ctx。
+func (w *StreamWatchdog) Stop() {
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	w.done = true
+	if w.timer != nil {
+		w.timer.Stop()
+	}
+	w.mu.Unlock()
+	w.cancel(context.Canceled)
+}
+
+type watchedBody struct {
+	io.ReadCloser
+	watchdog *StreamWatchdog
+}
+
+func (b *watchedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 {
+		b.watchdog.arm(StreamTimeoutIdle, b.watchdog.timeouts.Idle)
+	}
+	if err != nil && !errors.Is(err, io.EOF) {
+		err = b.watchdog.Err(err)
+	}
+	return n, err
+}
+
+func (b *watchedBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.watchdog.Stop()
+	return err
+}
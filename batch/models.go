@@ -0,0 +1,126 @@
+package batch
+
+import "time"
+
+// MessageBatch 的处理状态，取值与 Anthropic Message Batches API 的 processing_status 一致。
+const (
+	MessageBatchInProgress = "in_progress"
+	MessageBatchCanceling  = "canceling"
+	MessageBatchEnded      = "ended"
+)
+
+// MessageBatchRequest 的状态。pending/running 为内部中间态，其余与 Anthropic result.type 一致。
+const (
+	RequestPending   = "pending"
+	RequestRunning   = "running"
+	RequestSucceeded = "succeeded"
+	RequestErrored   = "errored"
+	RequestCanceled  = "canceled"
+	RequestExpired   = "expired"
+)
+
+type MessageBatch struct {
+	ID                uint   `gorm:"primaryKey"`
+	BatchID           string `gorm:"uniqueIndex;size:128;not null"`
+	ProcessingStatus  string `gorm:"index;size:32;not null"`
+	CreatedAt         time.Time
+	ExpiresAt         time.Time `gorm:"not null"`
+	CancelInitiatedAt *time.Time
+	EndedAt           *time.Time
+	UpdatedAt         time.Time
+}
+
+type MessageBatchRequest struct {
+	ID         uint   `gorm:"primaryKey"`
+	BatchID    string `gorm:"index;size:128;not null"`
+	Seq        int    `gorm:"not null"`
+	CustomID   string `gorm:"size:256;not null"`
+	Params     string `gorm:"type:text;not null"`
+	Status     string `gorm:"index;size:32;not null"`
+	Result     string `gorm:"type:text"`
+	StartedAt  *time.Time
+	FinishedAt *time.Time
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+// RequestCounts 对应 Anthropic 的 request_counts；processing 包含 pending 与 running。
+type RequestCounts struct {
+	Processing int `json:"processing"`
+	Succeeded  int `json:"succeeded"`
+	Errored    int `json:"errored"`
+	Canceled   int `json:"canceled"`
+	Expired    int `json:"expired"`
+}
+
+// File 的 purpose。batch 为客户端上传的输入，batch_output 为生成的输出/错误文件。
+const (
+	FilePurposeBatch       = "batch"
+	FilePurposeBatchOutput = "batch_output"
+)
+
+// OpenAIBatch 的状态，取值与 OpenAI Batch API 的 status 一致。
+const (
+	OpenAIBatchFailed     = "failed"
+	OpenAIBatchInProgress = "in_progress"
+	OpenAIBatchFinalizing = "finalizing"
+	OpenAIBatchCompleted  = "completed"
+	OpenAIBatchExpired    = "expired"
+	OpenAIBatchCancelling = "cancelling"
+	OpenAIBatchCancelled  = "cancelled"
+)
+
+type File struct {
+	ID        uint   `gorm:"primaryKey"`
+	FileID    string `gorm:"uniqueIndex;size:128;not null"`
+	Purpose   string `gorm:"index;size:32;not null"`
+	Filename  string `gorm:"size:512"`
+	Bytes     int64
+	Content   []byte `gorm:"type:blob"`
+	CreatedAt time.Time
+}
+
+type OpenAIBatch struct {
+	ID               uint   `gorm:"primaryKey"`
+	BatchID          string `gorm:"uniqueIndex;size:128;not null"`
+	Endpoint         string `gorm:"size:128;not null"`
+	InputFileID      string `gorm:"size:128;not null"`
+	CompletionWindow string `gorm:"size:16"`
+	Status           string `gorm:"index;size:32;not null"`
+	ErrorsJSON       string `gorm:"type:text"`
+	MetadataJSON     string `gorm:"type:text"`
+	OutputFileID     string `gorm:"size:128"`
+	ErrorFileID      string `gorm:"size:128"`
+	CreatedAt        time.Time
+	ExpiresAt        time.Time `gorm:"not null"`
+	InProgressAt     *time.Time
+	FinalizingAt     *time.Time
+	CompletedAt      *time.Time
+	FailedAt         *time.Time
+	ExpiredAt        *time.Time
+	CancellingAt     *time.Time
+	CancelledAt      *time.Time
+	UpdatedAt        time.Time
+}
+
+type OpenAIBatchRequest struct {
+	ID       uint   `gorm:"primaryKey"`
+	BatchID  string `gorm:"index;size:128;not null"`
+	Seq      int    `gorm:"not null"`
+	CustomID string `gorm:"size:256;not null"`
+	Body     string `gorm:"type:text;not null"`
+	Status   string `gorm:"index;size:32;not null"`
+	// Output 为写入 output/error 文件的整行 JSON。
+	Output     string `gorm:"type:text"`
+	StartedAt  *time.Time
+	FinishedAt *time.Time
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+// OpenAIRequestCounts 对应 OpenAI batch 的 request_counts。
+type OpenAIRequestCounts struct {
+	Total     int `json:"total"`
+	Completed int `json:"completed"`
+	Failed    int `json:"failed"`
+}
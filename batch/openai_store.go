@@ -0,0 +1,430 @@
+package batch
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func (s *Store) CreateFile(f File) error {
+	if s == nil || s.db == nil {
+		return fmt.Errorf("batch store is nil")
+	}
+	if strings.TrimSpace(f.FileID) == "" {
+		return fmt.Errorf("file_id is required")
+	}
+	f.Bytes = int64(len(f.Content))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.db.Create(&f).Error
+}
+
+// GetFile 返回文件元信息，不加载内容。
+func (s *Store) GetFile(fileID string) (File, error) {
+	if s == nil || s.db == nil {
+		return File{}, fmt.Errorf("batch store is nil")
+	}
+	var f File
+	err := s.db.Omit("content").Where("file_id = ?", fileID).Take(&f).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return File{}, ErrNotFound
+	}
+	return f, err
+}
+
+func (s *Store) GetFileContent(fileID string) (File, error) {
+	if s == nil || s.db == nil {
+		return File{}, fmt.Errorf("batch store is nil")
+	}
+	var f File
+	err := s.db.Where("file_id = ?", fileID).Take(&f).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return File{}, ErrNotFound
+	}
+	return f, err
+}
+
+// ListFiles 按创建时间倒序返回文件；purpose 为空时不过滤，after 为上一页最后一个 file_id。
+func (s *Store) ListFiles(purpose string, limit int, after string) ([]File, bool, error) {
+	if s == nil || s.db == nil {
+		return nil, false, fmt.Errorf("batch store is nil")
+	}
+	query := s.db.Model(&File{}).Omit("content")
+	if purpose != "" {
+		query = query.Where("purpose = ?", purpose)
+	}
+	if after != "" {
+		cursor, err := s.GetFile(after)
+		if err != nil {
+			return nil, false, err
+		}
+		query = query.Where("id < ?", cursor.ID)
+	}
+	var files []File
+	hasMore, err := findNewestPage(query, limit, &files)
+	return files, hasMore, err
+}
+
+func (s *Store) DeleteFile(fileID string) error {
+	if s == nil || s.db == nil {
+		return fmt.Errorf("batch store is nil")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	res := s.db.Where("file_id = ?", fileID).Delete(&File{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *Store) CreateOpenAIBatch(b OpenAIBatch, requests []OpenAIBatchRequest) error {
+	if s == nil || s.db == nil {
+		return fmt.Errorf("batch store is nil")
+	}
+	if strings.TrimSpace(b.BatchID) == "" {
+		return fmt.Errorf("batch_id is required")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&b).Error; err != nil {
+			return err
+		}
+		if len(requests) == 0 {
+			return nil
+		}
+		for i := range requests {
+			requests[i].ID = 0
+			requests[i].BatchID = b.BatchID
+			requests[i].Seq = i
+			if requests[i].Status == "" {
+				requests[i].Status = RequestPending
+			}
+		}
+		return tx.CreateInBatches(requests, 200).Error
+	})
+}
+
+func (s *Store) GetOpenAIBatch(batchID string) (OpenAIBatch, error) {
+	if s == nil || s.db == nil {
+		return OpenAIBatch{}, fmt.Errorf("batch store is nil")
+	}
+	var b OpenAIBatch
+	err := s.db.Where("batch_id = ?", batchID).Take(&b).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return OpenAIBatch{}, ErrNotFound
+	}
+	return b, err
+}
+
+// ListOpenAIBatches 按创建时间倒序返回 batch，after 为上一页最后一个 batch_id。
+func (s *Store) ListOpenAIBatches(limit int, after string) ([]OpenAIBatch, bool, error) {
+	if s == nil || s.db == nil {
+		return nil, false, fmt.Errorf("batch store is nil")
+	}
+	query := s.db.Model(&OpenAIBatch{})
+	if after != "" {
+		cursor, err := s.GetOpenAIBatch(after)
+		if err != nil {
+			return nil, false, err
+		}
+		query = query.Where("id < ?", cursor.ID)
+	}
+	var batches []OpenAIBatch
+	hasMore, err := findNewestPage(query, limit, &batches)
+	return batches, hasMore, err
+}
+
+func (s *Store) CountOpenAIBatchRequests(batchID string) (OpenAIRequestCounts, error) {
+	if s == nil || s.db == nil {
+		return OpenAIRequestCounts{}, fmt.Errorf("batch store is nil")
+	}
+	var rows []struct {
+		Status string
+		N      int
+	}
+	if err := s.db.Model(&OpenAIBatchRequest{}).
+		Select("status, COUNT(*) AS n").
+		Where("batch_id = ?", batchID).
+		Group("status").
+		Scan(&rows).Error; err != nil {
+		return OpenAIRequestCounts{}, err
+	}
+	var counts OpenAIRequestCounts
+	for _, row := range rows {
+		counts.Total += row.N
+		switch row.Status {
+		case RequestSucceeded:
+			counts.Completed += row.N
+		case RequestErrored:
+			counts.Failed += row.N
+		}
+	}
+	return counts, nil
+}
+
+func (s *Store) ListOpenAIBatchRequests(batchID string) ([]OpenAIBatchRequest, error) {
+	if s == nil || s.db == nil {
+		return nil, fmt.Errorf("batch store is nil")
+	}
+	var requests []OpenAIBatchRequest
+	if err := s.db.Where("batch_id = ?", batchID).
+		Order("seq ASC").
+		Find(&requests).Error; err != nil {
+		return nil, err
+	}
+	return requests, nil
+}
+
+// ClaimOpenAIBatchRequest 取出最早一个待处理请求并标记为 running。onClaim 非 nil 时在释放 store 锁之前以该请求调用，
+// 调用方借此登记进行中的请求，保证随后到来的取消一定能看到它。
+func (s *Store) ClaimOpenAIBatchRequest(now time.Time, onClaim func(OpenAIBatchRequest)) (OpenAIBatchRequest, bool, error) {
+	if s == nil || s.db == nil {
+		return OpenAIBatchRequest{}, false, fmt.Errorf("batch store is nil")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var req OpenAIBatchRequest
+	err := s.db.Where("status = ?", RequestPending).
+		Where("batch_id IN (?)", s.db.Model(&OpenAIBatch{}).
+			Select("batch_id").
+			Where("status = ?", OpenAIBatchInProgress)).
+		Order("id ASC").
+		Limit(1).
+		Take(&req).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return OpenAIBatchRequest{}, false, nil
+	}
+	if err != nil {
+		return OpenAIBatchRequest{}, false, err
+	}
+	if err := s.db.Model(&OpenAIBatchRequest{}).
+		Where("id = ?", req.ID).
+		Updates(map[string]any{"status": RequestRunning, "started_at": &now}).Error; err != nil {
+		return OpenAIBatchRequest{}, false, err
+	}
+	req.Status = RequestRunning
+	req.StartedAt = &now
+	if onClaim != nil {
+		onClaim(req)
+	}
+	return req, true, nil
+}
+
+// FinishOpenAIBatchRequest 记录请求结果；只有仍处于 running 的请求会被更新。
+func (s *Store) FinishOpenAIBatchRequest(id uint, status string, output string, now time.Time) error {
+	if s == nil || s.db == nil {
+		return fmt.Errorf("batch store is nil")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.db.Model(&OpenAIBatchRequest{}).
+		Where("id = ? AND status = ?", id, RequestRunning).
+		Updates(map[string]any{"status": status, "output": output, "finished_at": &now}).Error
+}
+
+// CancelOpenAIBatch 将 batch 置为 cancelling，并把尚未开始的请求直接标记为 canceled。
+func (s *Store) CancelOpenAIBatch(batchID string, now time.Time) (OpenAIBatch, error) {
+	if s == nil || s.db == nil {
+		return OpenAIBatch{}, fmt.Errorf("batch store is nil")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var b OpenAIBatch
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("batch_id = ?", batchID).Take(&b).Error; err != nil {
+			return err
+		}
+		if b.Status != OpenAIBatchInProgress {
+			return nil
+		}
+		if err := tx.Model(&OpenAIBatchRequest{}).
+			Where("batch_id = ? AND status = ?", batchID, RequestPending).
+			Updates(map[string]any{"status": RequestCanceled, "finished_at": &now}).Error; err != nil {
+			return err
+		}
+		b.Status = OpenAIBatchCancelling
+		b.CancellingAt = &now
+		return tx.Model(&OpenAIBatch{}).
+			Where("id = ?", b.ID).
+			Updates(map[string]any{"status": b.Status, "cancelling_at": &now}).Error
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return OpenAIBatch{}, ErrNotFound
+	}
+	return b, err
+}
+
+// ExpireOpenAIBatches 把超出 completion window 的 batch 中尚未开始的请求标记为 expired，返回受影响的 batch_id。
+func (s *Store) ExpireOpenAIBatches(now time.Time) ([]string, error) {
+	if s == nil || s.db == nil {
+		return nil, fmt.Errorf("batch store is nil")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var batchIDs []string
+	if err := s.db.Model(&OpenAIBatch{}).
+		Where("status = ? AND expired_at IS NULL AND expires_at <= ?", OpenAIBatchInProgress, now).
+		Pluck("batch_id", &batchIDs).Error; err != nil {
+		return nil, err
+	}
+	if len(batchIDs) == 0 {
+		return nil, nil
+	}
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&OpenAIBatchRequest{}).
+			Where("batch_id IN ? AND status = ?", batchIDs, RequestPending).
+			Updates(map[string]any{"status": RequestExpired, "finished_at": &now}).Error; err != nil {
+			return err
+		}
+		return tx.Model(&OpenAIBatch{}).
+			Where("batch_id IN ?", batchIDs).
+			Update("expired_at", &now).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return batchIDs, nil
+}
+
+// BeginFinalizeOpenAIBatch 在 batch 内没有 pending/running 请求时把它置为 finalizing。
+// 返回 true 表示调用方获得了生成输出文件并调用 CompleteOpenAIBatch 的权利。
+func (s *Store) BeginFinalizeOpenAIBatch(batchID string, now time.Time) (OpenAIBatch, bool, error) {
+	if s == nil || s.db == nil {
+		return OpenAIBatch{}, false, fmt.Errorf("batch store is nil")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var remaining int64
+	if err := s.db.Model(&OpenAIBatchRequest{}).
+		Where("batch_id = ? AND status IN ?", batchID, []string{RequestPending, RequestRunning}).
+		Count(&remaining).Error; err != nil {
+		return OpenAIBatch{}, false, err
+	}
+	if remaining > 0 {
+		return OpenAIBatch{}, false, nil
+	}
+	res := s.db.Model(&OpenAIBatch{}).
+		Where("batch_id = ? AND status IN ?", batchID, []string{OpenAIBatchInProgress, OpenAIBatchCancelling}).
+		Updates(map[string]any{"status": OpenAIBatchFinalizing, "finalizing_at": &now})
+	if res.Error != nil || res.RowsAffected == 0 {
+		return OpenAIBatch{}, false, res.Error
+	}
+	var b OpenAIBatch
+	if err := s.db.Where("batch_id = ?", batchID).Take(&b).Error; err != nil {
+		return OpenAIBatch{}, false, err
+	}
+	return b, true, nil
+}
+
+// CompleteOpenAIBatch 写入输出/错误文件并把 batch 置为终态；文件可为 nil。
+func (s *Store) CompleteOpenAIBatch(batchID string, status string, outputFile *File, errorFile *File, now time.Time) error {
+	if s == nil || s.db == nil {
+		return fmt.Errorf("batch store is nil")
+	}
+	updates := map[string]any{"status": status}
+	switch status {
+	case OpenAIBatchCompleted:
+		updates["completed_at"] = &now
+	case OpenAIBatchCancelled:
+		updates["cancelled_at"] = &now
+	case OpenAIBatchExpired:
+		// expired_at 在过期时已写入。
+	default:
+		return fmt.Errorf("unexpected final batch status %q", status)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		for _, f := range []*File{outputFile, errorFile} {
+			if f == nil {
+				continue
+			}
+			f.Bytes = int64(len(f.Content))
+			if err := tx.Create(f).Error; err != nil {
+				return err
+			}
+		}
+		if outputFile != nil {
+			updates["output_file_id"] = outputFile.FileID
+		}
+		if errorFile != nil {
+			updates["error_file_id"] = errorFile.FileID
+		}
+		return tx.Model(&OpenAIBatch{}).
+			Where("batch_id = ? AND status = ?", batchID, OpenAIBatchFinalizing).
+			Updates(updates).Error
+	})
+}
+
+// RecoverOpenAIBatches 用于进程重启：running 请求重新排队，cancelling batch 的剩余请求标记为 canceled，
+// 中断在 finalizing 的 batch 回退到之前的状态。返回仍需检查是否可以收尾的 batch_id。
+func (s *Store) RecoverOpenAIBatches(now time.Time) ([]string, error) {
+	if s == nil || s.db == nil {
+		return nil, fmt.Errorf("batch store is nil")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var batchIDs []string
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&OpenAIBatchRequest{}).
+			Where("status = ?", RequestRunning).
+			Updates(map[string]any{"status": RequestPending, "started_at": nil}).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&OpenAIBatch{}).
+			Where("status = ? AND cancelling_at IS NOT NULL", OpenAIBatchFinalizing).
+			Update("status", OpenAIBatchCancelling).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&OpenAIBatch{}).
+			Where("status = ?", OpenAIBatchFinalizing).
+			Update("status", OpenAIBatchInProgress).Error; err != nil {
+			return err
+		}
+		cancelling := tx.Model(&OpenAIBatch{}).
+			Select("batch_id").
+			Where("status = ?", OpenAIBatchCancelling)
+		if err := tx.Model(&OpenAIBatchRequest{}).
+			Where("status = ? AND batch_id IN (?)", RequestPending, cancelling).
+			Updates(map[string]any{"status": RequestCanceled, "finished_at": &now}).Error; err != nil {
+			return err
+		}
+		return tx.Model(&OpenAIBatch{}).
+			Where("status IN ?", []string{OpenAIBatchInProgress, OpenAIBatchCancelling}).
+			Pluck("batch_id", &batchIDs).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return batchIDs, nil
+}
+
+func findNewestPage[T any](query *gorm.DB, limit int, out *[]T) (bool, error) {
+	if limit <= 0 {
+		limit = 20
+	}
+	if err := query.Order("id DESC").Limit(limit + 1).Find(out).Error; err != nil {
+		return false, err
+	}
+	hasMore := len(*out) > limit
+	if hasMore {
+		*out = (*out)[:limit]
+	}
+	return hasMore, nil
+}
@@ -0,0 +1,398 @@
+package batch
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+// ErrNotFound 表示指定的 batch 不存在。
+var ErrNotFound = errors.New("batch not found")
+
+// ErrWorkersAttached 表示 Store 上已有一组同类 worker。
+var ErrWorkersAttached = errors.New("batch workers already attached to this store")
+
+type Store struct {
+	db *gorm.DB
+	mu sync.Mutex
+
+	closeOnce sync.Once
+	done      chan struct{}
+	// workers 记录已登记的 worker 组，见 AttachWorkers。
+	workers map[string]bool
+}
+
+func OpenStore(path string) (*Store, error) {
+	path = strings.TrimSpace(path)
+	if path == "" {
+		return nil, fmt.Errorf("batch db path is required")
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("create batch db dir: %w", err)
+	}
+
+	db, err := gorm.Open(sqlite.Open(path), &gorm.Config{
+		Logger: gormlogger.Default.LogMode(gormlogger.Silent),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("open batch db: %w", err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, fmt.Errorf("open batch db: %w", err)
+	}
+	// worker 与 HTTP handler 会并发读写；单连接可以避免 SQLite 的 database is locked。
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(&MessageBatch{}, &MessageBatchRequest{}, &File{}, &OpenAIBatch{}, &OpenAIBatchRequest{}); err != nil {
+		return nil, fmt.Errorf("migrate batch db: %w", err)
+	}
+	return &Store{db: db, done: make(chan struct{})}, nil
+}
+
+// Done 在 Close 后关闭，后台 worker 以此作为退出信号。
+func (s *Store) Done() <-chan struct{} {
+	return s.done
+}
+
+// AttachWorkers 为 Store 登记名为 name 的一组 worker。遗留请求的恢复与领取都假定每类请求只有一组执行方，
+// 同一个 Store 上重复登记同名 worker 返回 ErrWorkersAttached，调用方应共用首次构造的 handler。
+func (s *Store) AttachWorkers(name string) error {
+	if s == nil || s.db == nil {
+		return fmt.Errorf("batch store is nil")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.workers[name] {
+		return fmt.Errorf("%s: %w", name, ErrWorkersAttached)
+	}
+	if s.workers == nil {
+		s.workers = make(map[string]bool)
+	}
+	s.workers[name] = true
+	return nil
+}
+
+func (s *Store) Close() error {
+	if s == nil || s.db == nil {
+		return nil
+	}
+	s.closeOnce.Do(func() { close(s.done) })
+	sqlDB, err := s.db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
+}
+
+func (s *Store) CreateMessageBatch(b MessageBatch, requests []MessageBatchRequest) error {
+	if s == nil || s.db == nil {
+		return fmt.Errorf("batch store is nil")
+	}
+	if strings.TrimSpace(b.BatchID) == "" {
+		return fmt.Errorf("batch_id is required")
+	}
+	if len(requests) == 0 {
+		return fmt.Errorf("requests is required")
+	}
+	if b.ProcessingStatus == "" {
+		b.ProcessingStatus = MessageBatchInProgress
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&b).Error; err != nil {
+			return err
+		}
+		for i := range requests {
+			requests[i].ID = 0
+			requests[i].BatchID = b.BatchID
+			requests[i].Seq = i
+			if requests[i].Status == "" {
+				requests[i].Status = RequestPending
+			}
+		}
+		return tx.CreateInBatches(requests, 200).Error
+	})
+}
+
+func (s *Store) GetMessageBatch(batchID string) (MessageBatch, error) {
+	if s == nil || s.db == nil {
+		return MessageBatch{}, fmt.Errorf("batch store is nil")
+	}
+	var b MessageBatch
+	err := s.db.Where("batch_id = ?", batchID).Take(&b).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return MessageBatch{}, ErrNotFound
+	}
+	return b, err
+}
+
+func (s *Store) CountMessageBatchRequests(batchID string) (RequestCounts, error) {
+	if s == nil || s.db == nil {
+		return RequestCounts{}, fmt.Errorf("batch store is nil")
+	}
+	var rows []struct {
+		Status string
+		N      int
+	}
+	if err := s.db.Model(&MessageBatchRequest{}).
+		Select("status, COUNT(*) AS n").
+		Where("batch_id = ?", batchID).
+		Group("status").
+		Scan(&rows).Error; err != nil {
+		return RequestCounts{}, err
+	}
+	var counts RequestCounts
+	for _, row := range rows {
+		switch row.Status {
+		case RequestPending, RequestRunning:
+			counts.Processing += row.N
+		case RequestSucceeded:
+			counts.Succeeded += row.N
+		case RequestErrored:
+			counts.Errored += row.N
+		case RequestCanceled:
+			counts.Canceled += row.N
+		case RequestExpired:
+			counts.Expired += row.N
+		}
+	}
+	return counts, nil
+}
+
+// ListOptions 描述 batch 列表的分页参数；结果按创建时间倒序。
+type ListOptions struct {
+	Limit int
+	// BeforeID 返回比该 batch 更新的一页。
+	BeforeID string
+	// AfterID 返回比该 batch 更早的一页。
+	AfterID string
+}
+
+func (s *Store) ListMessageBatches(opts ListOptions) ([]MessageBatch, bool, error) {
+	if s == nil || s.db == nil {
+		return nil, false, fmt.Errorf("batch store is nil")
+	}
+	limit := opts.Limit
+	if limit <= 0 {
+		limit = 20
+	}
+
+	query := s.db.Model(&MessageBatch{})
+	ascending := false
+	switch {
+	case opts.AfterID != "":
+		cursor, err := s.GetMessageBatch(opts.AfterID)
+		if err != nil {
+			return nil, false, err
+		}
+		query = query.Where("id < ?", cursor.ID)
+	case opts.BeforeID != "":
+		cursor, err := s.GetMessageBatch(opts.BeforeID)
+		if err != nil {
+			return nil, false, err
+		}
+		query = query.Where("id > ?", cursor.ID)
+		ascending = true
+	}
+	order := "id DESC"
+	if ascending {
+		order = "id ASC"
+	}
+
+	var batches []MessageBatch
+	if err := query.Order(order).Limit(limit + 1).Find(&batches).Error; err != nil {
+		return nil, false, err
+	}
+	hasMore := len(batches) > limit
+	if hasMore {
+		batches = batches[:limit]
+	}
+	if ascending {
+		for i, j := 0, len(batches)-1; i < j; i, j = i+1, j-1 {
+			batches[i], batches[j] = batches[j], batches[i]
+		}
+	}
+	return batches, hasMore, nil
+}
+
+func (s *Store) ListMessageBatchRequests(batchID string) ([]MessageBatchRequest, error) {
+	if s == nil || s.db == nil {
+		return nil, fmt.Errorf("batch store is nil")
+	}
+	var requests []MessageBatchRequest
+	if err := s.db.Where("batch_id = ?", batchID).
+		Order("seq ASC").
+		Find(&requests).Error; err != nil {
+		return nil, err
+	}
+	return requests, nil
+}
+
+// ClaimMessageBatchRequest 取出最早一个待处理请求并标记为 running。onClaim 非 nil 时在释放 store 锁之前以该请求调用，
+// 调用方借此登记进行中的请求，保证随后到来的取消一定能看到它。
+func (s *Store) ClaimMessageBatchRequest(now time.Time, onClaim func(MessageBatchRequest)) (MessageBatchRequest, bool, error) {
+	if s == nil || s.db == nil {
+		return MessageBatchRequest{}, false, fmt.Errorf("batch store is nil")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var req MessageBatchRequest
+	err := s.db.Where("status = ?", RequestPending).
+		Where("batch_id IN (?)", s.db.Model(&MessageBatch{}).
+			Select("batch_id").
+			Where("processing_status = ?", MessageBatchInProgress)).
+		Order("id ASC").
+		Limit(1).
+		Take(&req).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return MessageBatchRequest{}, false, nil
+	}
+	if err != nil {
+		return MessageBatchRequest{}, false, err
+	}
+	if err := s.db.Model(&MessageBatchRequest{}).
+		Where("id = ?", req.ID).
+		Updates(map[string]any{"status": RequestRunning, "started_at": &now}).Error; err != nil {
+		return MessageBatchRequest{}, false, err
+	}
+	req.Status = RequestRunning
+	req.StartedAt = &now
+	if onClaim != nil {
+		onClaim(req)
+	}
+	return req, true, nil
+}
+
+// FinishMessageBatchRequest 记录请求结果；只有仍处于 running 的请求会被更新。
+func (s *Store) FinishMessageBatchRequest(id uint, status string, result string, now time.Time) error {
+	if s == nil || s.db == nil {
+		return fmt.Errorf("batch store is nil")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.db.Model(&MessageBatchRequest{}).
+		Where("id = ? AND status = ?", id, RequestRunning).
+		Updates(map[string]any{"status": status, "result": result, "finished_at": &now}).Error
+}
+
+// CancelMessageBatch 将 batch 置为 canceling，并把尚未开始的请求直接标记为 canceled。
+// 已经在跑的请求由调用方负责中断。
+func (s *Store) CancelMessageBatch(batchID string, now time.Time) (MessageBatch, error) {
+	if s == nil || s.db == nil {
+		return MessageBatch{}, fmt.Errorf("batch store is nil")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var b MessageBatch
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("batch_id = ?", batchID).Take(&b).Error; err != nil {
+			return err
+		}
+		if b.ProcessingStatus != MessageBatchInProgress {
+			return nil
+		}
+		if err := tx.Model(&MessageBatchRequest{}).
+			Where("batch_id = ? AND status = ?", batchID, RequestPending).
+			Updates(map[string]any{"status": RequestCanceled, "finished_at": &now}).Error; err != nil {
+			return err
+		}
+		b.ProcessingStatus = MessageBatchCanceling
+		b.CancelInitiatedAt = &now
+		return tx.Model(&MessageBatch{}).
+			Where("id = ?", b.ID).
+			Updates(map[string]any{"processing_status": b.ProcessingStatus, "cancel_initiated_at": &now}).Error
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return MessageBatch{}, ErrNotFound
+	}
+	return b, err
+}
+
+// ExpireMessageBatches 把已过期 batch 中尚未开始的请求标记为 expired，返回受影响的 batch_id。
+func (s *Store) ExpireMessageBatches(now time.Time) ([]string, error) {
+	if s == nil || s.db == nil {
+		return nil, fmt.Errorf("batch store is nil")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var batchIDs []string
+	if err := s.db.Model(&MessageBatch{}).
+		Where("processing_status = ? AND expires_at <= ?", MessageBatchInProgress, now).
+		Pluck("batch_id", &batchIDs).Error; err != nil {
+		return nil, err
+	}
+	if len(batchIDs) == 0 {
+		return nil, nil
+	}
+	if err := s.db.Model(&MessageBatchRequest{}).
+		Where("batch_id IN ? AND status = ?", batchIDs, RequestPending).
+		Updates(map[string]any{"status": RequestExpired, "finished_at": &now}).Error; err != nil {
+		return nil, err
+	}
+	return batchIDs, nil
+}
+
+// EndMessageBatchIfDone 在 batch 内没有 pending/running 请求时将其置为 ended。
+func (s *Store) EndMessageBatchIfDone(batchID string, now time.Time) (bool, error) {
+	if s == nil || s.db == nil {
+		return false, fmt.Errorf("batch store is nil")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var remaining int64
+	if err := s.db.Model(&MessageBatchRequest{}).
+		Where("batch_id = ? AND status IN ?", batchID, []string{RequestPending, RequestRunning}).
+		Count(&remaining).Error; err != nil {
+		return false, err
+	}
+	if remaining > 0 {
+		return false, nil
+	}
+	res := s.db.Model(&MessageBatch{}).
+		Where("batch_id = ? AND processing_status <> ?", batchID, MessageBatchEnded).
+		Updates(map[string]any{"processing_status": MessageBatchEnded, "ended_at": &now})
+	return res.RowsAffected > 0, res.Error
+}
+
+// RecoverMessageBatches 用于进程重启：上次未跑完的 running 请求重新放回队列；
+// 已在 canceling 中的 batch 则直接把剩余请求标记为 canceled 并收尾。
+func (s *Store) RecoverMessageBatches(now time.Time) error {
+	if s == nil || s.db == nil {
+		return fmt.Errorf("batch store is nil")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&MessageBatchRequest{}).
+			Where("status = ?", RequestRunning).
+			Updates(map[string]any{"status": RequestPending, "started_at": nil}).Error; err != nil {
+			return err
+		}
+		canceling := tx.Model(&MessageBatch{}).
+			Select("batch_id").
+			Where("processing_status = ?", MessageBatchCanceling)
+		if err := tx.Model(&MessageBatchRequest{}).
+			Where("status = ? AND batch_id IN (?)", RequestPending, canceling).
+			Updates(map[string]any{"status": RequestCanceled, "finished_at": &now}).Error; err != nil {
+			return err
+		}
+		return tx.Model(&MessageBatch{}).
+			Where("processing_status = ?", MessageBatchCanceling).
+			Updates(map[string]any{"processing_status": MessageBatchEnded, "ended_at": &now}).Error
+	})
+}
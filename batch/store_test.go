@@ -0,0 +1,218 @@
+package batch
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func openTestStore(t *testing.T, path string) *Store {
+	t.Helper()
+	store, err := OpenStore(path)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = store.Close() })
+	return store
+}
+
+func newTestBatch(id string, now time.Time) MessageBatch {
+	return MessageBatch{BatchID: id, CreatedAt: now, ExpiresAt: now.Add(24 * time.Hour)}
+}
+
+func TestStore_ClaimFinishAndEnd(t *testing.T) {
+	t.Parallel()
+
+	store := openTestStore(t, filepath.Join(t.TempDir(), "batch.db"))
+	now := time.Now()
+	require.NoError(t, store.CreateMessageBatch(newTestBatch("msgbatch_1", now), []MessageBatchRequest{
+		{CustomID: "a", Params: `{}`},
+		{CustomID: "b", Params: `{}`},
+	}))
+
+	first, ok, err := store.ClaimMessageBatchRequest(now, nil)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, "a", first.CustomID)
+	require.Equal(t, RequestRunning, first.Status)
+
+	second, ok, err := store.ClaimMessageBatchRequest(now, nil)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, "b", second.CustomID)
+
+	_, ok, err = store.ClaimMessageBatchRequest(now, nil)
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	require.NoError(t, store.FinishMessageBatchRequest(first.ID, RequestSucceeded, `{"type":"succeeded"}`, now))
+	ended, err := store.EndMessageBatchIfDone("msgbatch_1", now)
+	require.NoError(t, err)
+	require.False(t, ended)
+
+	require.NoError(t, store.FinishMessageBatchRequest(second.ID, RequestErrored, `{"type":"errored"}`, now))
+	ended, err = store.EndMessageBatchIfDone("msgbatch_1", now)
+	require.NoError(t, err)
+	require.True(t, ended)
+
+	got, err := store.GetMessageBatch("msgbatch_1")
+	require.NoError(t, err)
+	require.Equal(t, MessageBatchEnded, got.ProcessingStatus)
+	require.NotNil(t, got.EndedAt)
+
+	counts, err := store.CountMessageBatchRequests("msgbatch_1")
+	require.NoError(t, err)
+	require.Equal(t, RequestCounts{Succeeded: 1, Errored: 1}, counts)
+}
+
+func TestStore_CancelMarksPendingRequests(t *testing.T) {
+	t.Parallel()
+
+	store := openTestStore(t, filepath.Join(t.TempDir(), "batch.db"))
+	now := time.Now()
+	require.NoError(t, store.CreateMessageBatch(newTestBatch("msgbatch_1", now), []MessageBatchRequest{
+		{CustomID: "a", Params: `{}`},
+		{CustomID: "b", Params: `{}`},
+	}))
+	running, ok, err := store.ClaimMessageBatchRequest(now, nil)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	got, err := store.CancelMessageBatch("msgbatch_1", now)
+	require.NoError(t, err)
+	require.Equal(t, MessageBatchCanceling, got.ProcessingStatus)
+	require.NotNil(t, got.CancelInitiatedAt)
+
+	counts, err := store.CountMessageBatchRequests("msgbatch_1")
+	require.NoError(t, err)
+	require.Equal(t, RequestCounts{Processing: 1, Canceled: 1}, counts)
+
+	require.NoError(t, store.FinishMessageBatchRequest(running.ID, RequestCanceled, "", now))
+	ended, err := store.EndMessageBatchIfDone("msgbatch_1", now)
+	require.NoError(t, err)
+	require.True(t, ended)
+
+	_, err = store.CancelMessageBatch("msgbatch_missing", now)
+	require.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestStore_RecoverAndExpire(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "batch.db")
+	store, err := OpenStore(path)
+	require.NoError(t, err)
+	now := time.Now()
+	require.NoError(t, store.CreateMessageBatch(newTestBatch("msgbatch_1", now), []MessageBatchRequest{
+		{CustomID: "a", Params: `{}`},
+	}))
+	_, ok, err := store.ClaimMessageBatchRequest(now, nil)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.NoError(t, store.Close())
+
+	store = openTestStore(t, path)
+	require.NoError(t, store.RecoverMessageBatches(now))
+	req, ok, err := store.ClaimMessageBatchRequest(now, nil)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, "a", req.CustomID)
+	require.NoError(t, store.RecoverMessageBatches(now))
+
+	expired, err := store.ExpireMessageBatches(now.Add(25 * time.Hour))
+	require.NoError(t, err)
+	require.Equal(t, []string{"msgbatch_1"}, expired)
+	counts, err := store.CountMessageBatchRequests("msgbatch_1")
+	require.NoError(t, err)
+	require.Equal(t, RequestCounts{Expired: 1}, counts)
+}
+
+func TestStore_ListMessageBatchesPagination(t *testing.T) {
+	t.Parallel()
+
+	store := openTestStore(t, filepath.Join(t.TempDir(), "batch.db"))
+	now := time.Now()
+	for _, id := range []string{"b1", "b2", "b3"} {
+		require.NoError(t, store.CreateMessageBatch(newTestBatch(id, now), []MessageBatchRequest{{CustomID: "a", Params: `{}`}}))
+	}
+
+	page, hasMore, err := store.ListMessageBatches(ListOptions{Limit: 2})
+	require.NoError(t, err)
+	require.True(t, hasMore)
+	require.Equal(t, []string{"b3", "b2"}, batchIDs(page))
+
+	page, hasMore, err = store.ListMessageBatches(ListOptions{Limit: 2, AfterID: "b2"})
+	require.NoError(t, err)
+	require.False(t, hasMore)
+	require.Equal(t, []string{"b1"}, batchIDs(page))
+
+	page, hasMore, err = store.ListMessageBatches(ListOptions{Limit: 2, BeforeID: "b1"})
+	require.NoError(t, err)
+	require.False(t, hasMore)
+	require.Equal(t, []string{"b3", "b2"}, batchIDs(page))
+}
+
+func batchIDs(batches []MessageBatch) []string {
+	ids := make([]string, 0, len(batches))
+	for _, b := range batches {
+		ids = append(ids, b.BatchID)
+	}
+	return ids
+}
+
+func TestStore_OpenAIBatchFinalizeOnce(t *testing.T) {
+	t.Parallel()
+
+	store := openTestStore(t, filepath.Join(t.TempDir(), "batch.db"))
+	now := time.Now()
+	require.NoError(t, store.CreateOpenAIBatch(OpenAIBatch{
+		BatchID:     "batch_1",
+		Endpoint:    "/v1/chat/completions",
+		InputFileID: "file-1",
+		Status:      OpenAIBatchInProgress,
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(24 * time.Hour),
+	}, []OpenAIBatchRequest{{CustomID: "a", Body: `{}`}}))
+
+	req, ok, err := store.ClaimOpenAIBatchRequest(now, nil)
+	require.NoError(t, err)
+	require.True(t, ok)
+	_, ok, err = store.BeginFinalizeOpenAIBatch("batch_1", now)
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	require.NoError(t, store.FinishOpenAIBatchRequest(req.ID, RequestSucceeded, `{"custom_id":"a"}`, now))
+	_, ok, err = store.BeginFinalizeOpenAIBatch("batch_1", now)
+	require.NoError(t, err)
+	require.True(t, ok)
+	_, ok, err = store.BeginFinalizeOpenAIBatch("batch_1", now)
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	output := &File{FileID: "file-out", Purpose: FilePurposeBatchOutput, Content: []byte("{}\n"), CreatedAt: now}
+	require.NoError(t, store.CompleteOpenAIBatch("batch_1", OpenAIBatchCompleted, output, nil, now))
+
+	got, err := store.GetOpenAIBatch("batch_1")
+	require.NoError(t, err)
+	require.Equal(t, OpenAIBatchCompleted, got.Status)
+	require.Equal(t, "file-out", got.OutputFileID)
+	require.NotNil(t, got.CompletedAt)
+
+	f, err := store.GetFile("file-out")
+	require.NoError(t, err)
+	require.EqualValues(t, 3, f.Bytes)
+	require.Empty(t, f.Content)
+
+	counts, err := store.CountOpenAIBatchRequests("batch_1")
+	require.NoError(t, err)
+	require.Equal(t, OpenAIRequestCounts{Total: 1, Completed: 1}, counts)
+}
+
+func TestStore_AttachWorkersOncePerKind(t *testing.T) {
+	t.Parallel()
+
+	store := openTestStore(t, filepath.Join(t.TempDir(), "batch.db"))
+	require.NoError(t, store.AttachWorkers("message batches"))
+	require.NoError(t, store.AttachWorkers("openai batches"))
+	require.ErrorIs(t, store.AttachWorkers("message batches"), ErrWorkersAttached)
+}
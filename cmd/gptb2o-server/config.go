@@ -0,0 +1,595 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/LubyRuffy/gptb2o"
+	"github.com/LubyRuffy/gptb2o/openaihttp"
+	"gopkg.in/yaml.v3"
+)
+
+// configFlagFields 把配置文件中的标量字段映射到同名语义的命令行 flag，文件值经 flag.Set 解析，
+// 与命令行共用同一套类型校验。reloadable 为 true 的字段在 SIGHUP / 文件变化时热更新。
+var configFlagFields = []struct {
+	path       string
+	flag       string
+	reloadable bool
+}{
+	{path: "server.listen", flag: "listen"},
+	{path: "server.base_path", flag: "base-path"},
+	{path: "server.shutdown_timeout", flag: "shutdown-timeout"},
+	{path: "server.tls_cert", flag: "tls-cert"},
+	{path: "server.tls_key", flag: "tls-key"},
+	{path: "server.tls_client_ca", flag: "tls-client-ca"},
+	{path: "server.unix_socket_mode", flag: "unix-socket-mode"},
+	{path: "server.ws_allowed_origins", flag: "ws-allowed-origins"},
+	{path: "server.log_level", flag: "log-level", reloadable: true},
+	{path: "server.debug_ui", flag: "debug-ui"},
+	{path: "server.metrics", flag: "metrics"},
+	{path: "backend.url", flag: "backend-url"},
+	{path: "backend.auth_source", flag: "auth-source"},
+	{path: "backend.originator", flag: "originator"},
+	{path: "backend.probe_ttl", flag: "backend-probe-ttl"},
+	{path: "backend.models_url", flag: "models-url"},
+	{path: "backend.models_ttl", flag: "models-ttl"},
+	{path: "backend.connect_timeout", flag: "backend-connect-timeout"},
+	{path: "backend.first_event_timeout", flag: "backend-first-event-timeout"},
+	{path: "backend.idle_timeout", flag: "backend-idle-timeout"},
+	{path: "backend.request_timeout", flag: "backend-request-timeout"},
+	{path: "defaults.reasoning_effort", flag: "reasoning-effort", reloadable: true},
+	{path: "trace.sink", flag: "trace-sink"},
+	{path: "trace.db_path", flag: "trace-db-path"},
+	{path: "trace.jsonl_path", flag: "trace-jsonl-path"},
+	{path: "trace.jsonl_max_mb", flag: "trace-jsonl-max-mb"},
+	{path: "trace.jsonl_max_files", flag: "trace-jsonl-max-files"},
+	{path: "trace.memory_interactions", flag: "trace-memory-interactions"},
+	{path: "trace.max_body_bytes", flag: "trace-max-body-bytes"},
+	{path: "trace.max_age", flag: "trace-max-age"},
+	{path: "trace.success_max_age", flag: "trace-success-max-age"},
+	{path: "trace.max_interactions", flag: "trace-max-interactions"},
+	{path: "trace.max_db_mb", flag: "trace-max-db-mb"},
+	{path: "trace.prune_interval", flag: "trace-prune-interval"},
+	{path: "batch.db_path", flag: "batch-db-path"},
+	{path: "batch.concurrency", flag: "batch-concurrency"},
+	{path: "admission.max_concurrent", flag: "max-concurrent"},
+	{path: "admission.max_queued", flag: "max-queued"},
+	{path: "admission.max_queue_wait", flag: "max-queue-wait"},
+	{path: "otlp.endpoint", flag: "otlp-endpoint"},
+	{path: "otlp.service_name", flag: "otlp-service-name"},
+}
+
+// validReasoningEfforts 是配置文件中允许的 reasoning effort 取值。
+var validReasoningEfforts = []string{"none", "minimal", "low", "medium", "high", "xhigh"}
+
+// configFlagValue 是配置文件中一个映射到 flag 的字段值。
+type configFlagValue struct {
+	path       string
+	flag       string
+	value      string
+	reloadable bool
+}
+
+// serverConfig 是解析并校验后的配置文件。
+type serverConfig struct {
+	flags    []configFlagValue
+	settings openaihttp.Settings
+}
+
+// configError 指出配置文件中出错的字段路径，例如 api_keys[1].key。
+type configError struct {
+	path string
+	line int
+	msg  string
+}
+
+func (e *configError) Error() string {
+	if e.line > 0 {
+		return fmt.Sprintf("%s (line %d): %s", e.path, e.line, e.msg)
+	}
+	return fmt.Sprintf("%s: %s", e.path, e.msg)
+}
+
+func fieldErrorf(path string, node *yaml.Node, format string, args ...any) error {
+	line := 0
+	if node != nil {
+		line = node.Line
+	}
+	return &configError{path: path, line: line, msg: fmt.Sprintf(format, args...)}
+}
+
+// loadConfigFile 读取 YAML 配置文件，展开 ${VAR} / ${VAR:-default} 环境变量并校验全部字段。
+func loadConfigFile(path string) (*serverConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read config: %w", err)
+	}
+	cfg, err := parseConfig(data)
+	if err != nil {
+		return nil, fmt.Errorf("config %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+func parseConfig(data []byte) (*serverConfig, error) {
+	cfg := &serverConfig{}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return cfg, nil
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	if len(doc.Content) == 0 {
+		return cfg, nil
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, fieldErrorf("(root)", root, "must be a mapping")
+	}
+
+	fieldsByPath := make(map[string]int, len(configFlagFields))
+	sections := make(map[string]bool)
+	for i, f := range configFlagFields {
+		fieldsByPath[f.path] = i
+		sections[strings.SplitN(f.path, ".", 2)[0]] = true
+	}
+
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		key, value := root.Content[i].Value, root.Content[i+1]
+		switch {
+		case key == "api_keys":
+			keys, err := parseAPIKeys(value)
+			if err != nil {
+				return nil, err
+			}
+			cfg.settings.APIKeys = keys
+		case key == "models":
+			if err := parseModels(value, &cfg.settings); err != nil {
+				return nil, err
+			}
+		case sections[key]:
+			if value.Kind != yaml.MappingNode {
+				if value.Tag == "!!null" {
+					continue
+				}
+				return nil, fieldErrorf(key, value, "must be a mapping")
+			}
+			for j := 0; j+1 < len(value.Content); j += 2 {
+				path := key + "." + value.Content[j].Value
+				idx, ok := fieldsByPath[path]
+				if !ok {
+					return nil, fieldErrorf(path, value.Content[j], "unknown field")
+				}
+				s, err := scalarValue(path, value.Content[j+1])
+				if err != nil {
+					return nil, err
+				}
+				if err := validateFlagValue(path, value.Content[j+1], s); err != nil {
+					return nil, err
+				}
+				f := configFlagFields[idx]
+				cfg.flags = append(cfg.flags, configFlagValue{path: path, flag: f.flag, value: s, reloadable: f.reloadable})
+			}
+		default:
+			return nil, fieldErrorf(key, root.Content[i], "unknown field")
+		}
+	}
+	return cfg, nil
+}
+
+// scalarValue 返回标量节点展开环境变量后的值；映射或序列会被拒绝。
+func scalarValue(path string, node *yaml.Node) (string, error) {
+	if node.Kind != yaml.ScalarNode {
+		return "", fieldErrorf(path, node, "must be a scalar value")
+	}
+	if node.Tag == "!!null" {
+		return "", nil
+	}
+	s, err := expandEnv(node.Value)
+	if err != nil {
+		return "", fieldErrorf(path, node, "%v", err)
+	}
+	return s, nil
+}
+
+// validateFlagValue 校验 flag 本身不做约束的取值；数值与时长交给 flag.Set 解析。
+func validateFlagValue(path string, node *yaml.Node, value string) error {
+	switch path {
+	case "server.log_level":
+		if _, err := parseLogLevel(value); err != nil {
+			return fieldErrorf(path, node, "%v", err)
+		}
+	case "defaults.reasoning_effort":
+		return validateReasoningEffort(path, node, value)
+	case "server.unix_socket_mode":
+		if _, err := parseSocketMode(value); err != nil {
+			return fieldErrorf(path, node, "%v", err)
+		}
+	}
+	return nil
+}
+
+func validateReasoningEffort(path string, node *yaml.Node, value string) error {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if value == "" {
+		return nil
+	}
+	for _, effort := range validReasoningEfforts {
+		if value == effort {
+			return nil
+		}
+	}
+	return fieldErrorf(path, node, "invalid reasoning effort %q: want %s", value, strings.Join(validReasoningEfforts, "|"))
+}
+
+func parseAPIKeys(node *yaml.Node) ([]openaihttp.APIKey, error) {
+	if node.Tag == "!!null" {
+		return nil, nil
+	}
+	if node.Kind != yaml.SequenceNode {
+		return nil, fieldErrorf("api_keys", node, "must be a list")
+	}
+	keys := make([]openaihttp.APIKey, 0, len(node.Content))
+	seenNames := make(map[string]bool)
+	seenKeys := make(map[string]bool)
+	for i, item := range node.Content {
+		base := fmt.Sprintf("api_keys[%d]", i)
+		if item.Kind != yaml.MappingNode {
+			return nil, fieldErrorf(base, item, "must be a mapping with name and key")
+		}
+		var key openaihttp.APIKey
+		for j := 0; j+1 < len(item.Content); j += 2 {
+			path := base + "." + item.Content[j].Value
+			s, err := scalarValue(path, item.Content[j+1])
+			if err != nil {
+				return nil, err
+			}
+			switch item.Content[j].Value {
+			case "name":
+				key.Name = strings.TrimSpace(s)
+			case "key":
+				key.Key = strings.TrimSpace(s)
+			default:
+				return nil, fieldErrorf(path, item.Content[j], "unknown field")
+			}
+		}
+		if key.Key == "" {
+			return nil, fieldErrorf(base+".key", item, "must not be empty")
+		}
+		if key.Name == "" {
+			key.Name = base
+		}
+		if seenNames[key.Name] {
+			return nil, fieldErrorf(base+".name", item, "duplicate name %q", key.Name)
+		}
+		if seenKeys[key.Key] {
+			return nil, fieldErrorf(base+".key", item, "duplicate key")
+		}
+		seenNames[key.Name] = true
+		seenKeys[key.Key] = true
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// parseModels 解析 models 段并构建模型 registry：catalog 中与内置模型同 ID 的条目覆盖内置定义，其余追加在后；
+// 用户别名先于内置别名匹配；reasoning_effort 覆盖对应模型的默认 effort。
+func parseModels(node *yaml.Node, settings *openaihttp.Settings) error {
+	if node.Tag == "!!null" {
+		return nil
+	}
+	if node.Kind != yaml.MappingNode {
+		return fieldErrorf("models", node, "must be a mapping")
+	}
+	builtin := true
+	var (
+		catalog []gptb2o.ModelInfo
+		aliases []stringMapEntry
+		efforts []stringMapEntry
+	)
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		section, value := node.Content[i].Value, node.Content[i+1]
+		path := "models." + section
+		var err error
+		switch section {
+		case "builtin":
+			builtin, err = boolValue(path, value)
+		case "catalog":
+			catalog, err = parseModelCatalog(path, value)
+		case "aliases":
+			aliases, err = stringMap(path, value)
+		case "reasoning_effort":
+			efforts, err = stringMap(path, value)
+		default:
+			return fieldErrorf(path, node.Content[i], "unknown field")
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	var models []gptb2o.ModelInfo
+	if builtin {
+		models = gptb2o.BuiltinModels()
+	}
+	index := make(map[string]int, len(models)+len(catalog))
+	for i, m := range models {
+		index[m.ID] = i
+	}
+	for _, m := range catalog {
+		if j, ok := index[m.ID]; ok {
+			models[j] = m
+			continue
+		}
+		index[m.ID] = len(models)
+		models = append(models, m)
+	}
+	if len(models) == 0 {
+		return fieldErrorf("models.catalog", node, "must not be empty when models.builtin is false")
+	}
+
+	for _, e := range efforts {
+		j, ok := index[gptb2o.NormalizeModelID(e.key)]
+		if !ok {
+			return fieldErrorf(e.path, e.node, "unknown model %q", e.key)
+		}
+		if err := validateReasoningEffort(e.path, e.node, e.value); err != nil {
+			return err
+		}
+		models[j].ReasoningEffort = strings.ToLower(e.value)
+	}
+
+	modelAliases := make([]gptb2o.ModelAlias, 0, len(aliases))
+	for _, e := range aliases {
+		if _, ok := index[gptb2o.NormalizeModelID(e.value)]; !ok {
+			return fieldErrorf(e.path, e.node, "unknown target model %q", e.value)
+		}
+		modelAliases = append(modelAliases, gptb2o.ModelAlias{Pattern: e.key, Target: e.value})
+	}
+	if builtin {
+		modelAliases = append(modelAliases, gptb2o.BuiltinModelAliases()...)
+	}
+
+	registry, err := gptb2o.NewModelRegistry(models, modelAliases)
+	if err != nil {
+		return fieldErrorf("models", node, "%v", err)
+	}
+	settings.Models = registry
+	return nil
+}
+
+// parseModelCatalog 解析 models.catalog 列表；capabilities 中未写出的能力默认为 true。
+func parseModelCatalog(path string, node *yaml.Node) ([]gptb2o.ModelInfo, error) {
+	if node.Tag == "!!null" {
+		return nil, nil
+	}
+	if node.Kind != yaml.SequenceNode {
+		return nil, fieldErrorf(path, node, "must be a list")
+	}
+	models := make([]gptb2o.ModelInfo, 0, len(node.Content))
+	seen := make(map[string]bool)
+	for i, item := range node.Content {
+		base := fmt.Sprintf("%s[%d]", path, i)
+		if item.Kind != yaml.MappingNode {
+			return nil, fieldErrorf(base, item, "must be a mapping with id")
+		}
+		m := gptb2o.ModelInfo{Capabilities: gptb2o.ModelCapabilities{Tools: true, Vision: true, XHigh: true}}
+		for j := 0; j+1 < len(item.Content); j += 2 {
+			field, value := item.Content[j].Value, item.Content[j+1]
+			fieldPath := base + "." + field
+			if field == "capabilities" {
+				if err := parseModelCapabilities(fieldPath, value, &m.Capabilities); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			s, err := scalarValue(fieldPath, value)
+			if err != nil {
+				return nil, err
+			}
+			s = strings.TrimSpace(s)
+			switch field {
+			case "id":
+				m.ID = gptb2o.NormalizeModelID(s)
+			case "name":
+				m.Name = s
+			case "reasoning_effort":
+				if err := validateReasoningEffort(fieldPath, value, s); err != nil {
+					return nil, err
+				}
+				m.ReasoningEffort = strings.ToLower(s)
+			case "context_window":
+				n, err := strconv.Atoi(s)
+				if err != nil || n < 0 {
+					return nil, fieldErrorf(fieldPath, value, "must be a non-negative integer")
+				}
+				m.ContextWindow = n
+			default:
+				return nil, fieldErrorf(fieldPath, item.Content[j], "unknown field")
+			}
+		}
+		if m.ID == "" {
+			return nil, fieldErrorf(base+".id", item, "must not be empty")
+		}
+		if seen[m.ID] {
+			return nil, fieldErrorf(base+".id", item, "duplicate model %q", m.ID)
+		}
+		seen[m.ID] = true
+		models = append(models, m)
+	}
+	return models, nil
+}
+
+func parseModelCapabilities(path string, node *yaml.Node, caps *gptb2o.ModelCapabilities) error {
+	if node.Tag == "!!null" {
+		return nil
+	}
+	if node.Kind != yaml.MappingNode {
+		return fieldErrorf(path, node, "must be a mapping")
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		field := node.Content[i].Value
+		v, err := boolValue(path+"."+field, node.Content[i+1])
+		if err != nil {
+			return err
+		}
+		switch field {
+		case "tools":
+			caps.Tools = v
+		case "vision":
+			caps.Vision = v
+		case "xhigh":
+			caps.XHigh = v
+		default:
+			return fieldErrorf(path+"."+field, node.Content[i], "unknown field")
+		}
+	}
+	return nil
+}
+
+func boolValue(path string, node *yaml.Node) (bool, error) {
+	s, err := scalarValue(path, node)
+	if err != nil {
+		return false, err
+	}
+	v, err := strconv.ParseBool(strings.TrimSpace(s))
+	if err != nil {
+		return false, fieldErrorf(path, node, "must be true or false")
+	}
+	return v, nil
+}
+
+type stringMapEntry struct {
+	path  string
+	key   string
+	value string
+	node  *yaml.Node
+}
+
+// stringMap 解析 string -> string 映射，键名写入字段路径，例如 models.aliases["fast"]。
+func stringMap(path string, node *yaml.Node) ([]stringMapEntry, error) {
+	if node.Tag == "!!null" {
+		return nil, nil
+	}
+	if node.Kind != yaml.MappingNode {
+		return nil, fieldErrorf(path, node, "must be a mapping")
+	}
+	entries := make([]stringMapEntry, 0, len(node.Content)/2)
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key := strings.TrimSpace(node.Content[i].Value)
+		entryPath := fmt.Sprintf("%s[%q]", path, key)
+		if key == "" {
+			return nil, fieldErrorf(entryPath, node.Content[i], "key must not be empty")
+		}
+		value, err := scalarValue(entryPath, node.Content[i+1])
+		if err != nil {
+			return nil, err
+		}
+		value = strings.TrimSpace(value)
+		if value == "" {
+			return nil, fieldErrorf(entryPath, node.Content[i+1], "must not be empty")
+		}
+		entries = append(entries, stringMapEntry{path: entryPath, key: key, value: value, node: node.Content[i+1]})
+	}
+	return entries, nil
+}
+
+// expandEnv 展开 ${VAR} 与 ${VAR:-default}；$$ 表示字面量 $，其余 $ 原样保留。
+// 引用未设置且没有默认值的变量视为错误，避免 API key 等字段被静默置空。
+func expandEnv(s string) (string, error) {
+	if !strings.Contains(s, "$") {
+		return s, nil
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '$' || i+1 >= len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+		switch s[i+1] {
+		case '$':
+			b.WriteByte('$')
+			i++
+		case '{':
+			end := strings.IndexByte(s[i+2:], '}')
+			if end < 0 {
+				return "", fmt.Errorf("unterminated ${ in %q", s)
+			}
+			expr := s[i+2 : i+2+end]
+			name, def, hasDefault := strings.Cut(expr, ":-")
+			if name == "" {
+				return "", fmt.Errorf("empty variable name in %q", s)
+			}
+			value, ok := os.LookupEnv(name)
+			switch {
+			case ok && value != "":
+				b.WriteString(value)
+			case hasDefault:
+				b.WriteString(def)
+			case ok:
+			default:
+				return "", fmt.Errorf("environment variable %s is not set", name)
+			}
+			i += 2 + end
+		default:
+			b.WriteByte('$')
+		}
+	}
+	return b.String(), nil
+}
+
+// applyToFlags 把配置文件中的值写入 flagSet；命令行显式传入的 flag 优先，不会被覆盖。
+func (c *serverConfig) applyToFlags(flagSet *flag.FlagSet, explicit map[string]bool) error {
+	for _, f := range c.flags {
+		if explicit[f.flag] {
+			continue
+		}
+		if err := flagSet.Set(f.flag, f.value); err != nil {
+			return &configError{path: f.path, msg: fmt.Sprintf("invalid value %q: %v", f.value, err)}
+		}
+	}
+	return nil
+}
+
+// flagValue 返回配置文件中 flag 对应的值。
+func (c *serverConfig) flagValue(name string) (string, bool) {
+	for _, f := range c.flags {
+		if f.flag == name {
+			return f.value, true
+		}
+	}
+	return "", false
+}
+
+// restartRequiredChanges 返回相对 old 发生变化、但只能重启生效的字段路径。
+func (c *serverConfig) restartRequiredChanges(old *serverConfig) []string {
+	values := func(cfg *serverConfig) map[string]string {
+		m := make(map[string]string)
+		for _, f := range cfg.flags {
+			if !f.reloadable {
+				m[f.path] = f.value
+			}
+		}
+		return m
+	}
+	oldValues, newValues := values(old), values(c)
+	var changed []string
+	for path, v := range newValues {
+		if ov, ok := oldValues[path]; !ok || ov != v {
+			changed = append(changed, path)
+		}
+	}
+	for path := range oldValues {
+		if _, ok := newValues[path]; !ok {
+			changed = append(changed, path)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/LubyRuffy/gptb2o"
+)
+
+func TestParseConfig_AppliesFlagsAndSettings(t *testing.T) {
+	t.Setenv("GPTB2O_TEST_ALICE_KEY", "sk-alice")
+	t.Setenv("GPTB2O_TEST_EMPTY", "")
+
+	cfg, err := parseConfig([]byte(`
+server:
+  listen: 0.0.0.0:8080
+  shutdown_timeout: 45s
+  log_level: warn
+backend:
+  originator: ${GPTB2O_TEST_EMPTY:-my_client}
+defaults:
+  reasoning_effort: high
+trace:
+  sink: memory
+api_keys:
+  - name: alice
+    key: ${GPTB2O_TEST_ALICE_KEY}
+  - key: literal-$$-key
+models:
+  catalog:
+    - id: gpt-6-preview
+      name: GPT-6 Preview
+      context_window: 400000
+      capabilities: {xhigh: false}
+  aliases:
+    fast: gpt-5.4-mini
+    claude-sonnet-*: gpt-6-preview
+  reasoning_effort:
+    gpt-5.4: xhigh
+`))
+	if err != nil {
+		t.Fatalf("parseConfig() error = %v", err)
+	}
+
+	flagSet := flag.NewFlagSet("test", flag.ContinueOnError)
+	listen := flagSet.String("listen", "127.0.0.1:12345", "")
+	shutdown := flagSet.Duration("shutdown-timeout", 30*time.Second, "")
+	logLevel := flagSet.String("log-level", "info", "")
+	originator := flagSet.String("originator", "", "")
+	effort := flagSet.String("reasoning-effort", "", "")
+	sink := flagSet.String("trace-sink", "sqlite", "")
+	if err := flagSet.Parse([]string{"--trace-sink", "jsonl"}); err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if err := cfg.applyToFlags(flagSet, map[string]bool{"trace-sink": true}); err != nil {
+		t.Fatalf("applyToFlags() error = %v", err)
+	}
+	if *listen != "0.0.0.0:8080" || *shutdown != 45*time.Second || *logLevel != "warn" || *originator != "my_client" || *effort != "high" {
+		t.Fatalf("flags not applied: listen=%q shutdown=%s log=%q originator=%q effort=%q", *listen, *shutdown, *logLevel, *originator, *effort)
+	}
+	if *sink != "jsonl" {
+		t.Fatalf("explicit --trace-sink overridden by config: %q", *sink)
+	}
+
+	keys := cfg.settings.APIKeys
+	if len(keys) != 2 || keys[0].Name != "alice" || keys[0].Key != "sk-alice" || keys[1].Name != "api_keys[1]" || keys[1].Key != "literal-$-key" {
+		t.Fatalf("unexpected api keys: %+v", keys)
+	}
+	models := cfg.settings.Models
+	if models == nil {
+		t.Fatalf("models registry not built")
+	}
+	if m, ok := models.Resolve("fast"); !ok || m.ID != "gpt-5.4-mini" {
+		t.Fatalf("Resolve(fast) = %+v, %v", m, ok)
+	}
+	if m, ok := models.Resolve("claude-sonnet-4-5"); !ok || m.ID != "gpt-6-preview" {
+		t.Fatalf("Resolve(claude-sonnet-4-5) = %+v, %v", m, ok)
+	}
+	// 内置别名排在用户别名之后，仍然生效。
+	if m, ok := models.Resolve("claude-opus-4-1"); !ok || m.ID != "gpt-5.5" {
+		t.Fatalf("Resolve(claude-opus-4-1) = %+v, %v", m, ok)
+	}
+	if m, _ := models.Lookup("gpt-5.4"); m.ReasoningEffort != "xhigh" {
+		t.Fatalf("gpt-5.4 reasoning effort = %q", m.ReasoningEffort)
+	}
+	m, ok := models.Lookup("gpt-6-preview")
+	if !ok || m.Name != "GPT-6 Preview" || m.ContextWindow != 400000 || !m.Capabilities.Tools || m.Capabilities.XHigh {
+		t.Fatalf("unexpected catalog model: %+v", m)
+	}
+	if got := len(models.Models()); got != len(gptb2o.BuiltinModels())+1 {
+		t.Fatalf("len(Models()) = %d", got)
+	}
+}
+
+func TestParseConfig_ErrorsNameTheField(t *testing.T) {
+	t.Setenv("GPTB2O_TEST_UNSET", "")
+	_ = os.Unsetenv("GPTB2O_TEST_UNSET")
+
+	cases := []struct {
+		name string
+		yaml string
+		want string
+	}{
+		{name: "unknown section", yaml: "sever:\n  listen: x\n", want: "sever (line 1): unknown field"},
+		{name: "unknown field", yaml: "server:\n  lisen: x\n", want: "server.lisen (line 2): unknown field"},
+		{name: "bad log level", yaml: "server:\n  log_level: loud\n", want: "server.log_level (line 2): invalid log level"},
+		{name: "bad effort", yaml: "defaults:\n  reasoning_effort: max\n", want: "defaults.reasoning_effort (line 2): invalid reasoning effort"},
+		{name: "empty key", yaml: "api_keys:\n  - {name: a, key: k1}\n  - name: b\n    key: \"\"\n", want: "api_keys[1].key (line 3): must not be empty"},
+		{name: "duplicate name", yaml: "api_keys:\n  - {name: a, key: k1}\n  - {name: a, key: k2}\n", want: `api_keys[1].name (line 3): duplicate name "a"`},
+		{name: "missing env", yaml: "api_keys:\n  - key: ${GPTB2O_TEST_UNSET}\n", want: "api_keys[0].key (line 2): environment variable GPTB2O_TEST_UNSET is not set"},
+		{name: "bad alias target", yaml: "models:\n  aliases:\n    fast: gpt-9\n", want: `models.aliases["fast"] (line 3): unknown target model "gpt-9"`},
+		{name: "bad effort model", yaml: "models:\n  reasoning_effort:\n    gpt-9: high\n", want: `models.reasoning_effort["gpt-9"] (line 3): unknown model "gpt-9"`},
+		{name: "catalog without id", yaml: "models:\n  catalog:\n    - name: x\n", want: "models.catalog[0].id (line 3): must not be empty"},
+		{name: "bad capability", yaml: "models:\n  catalog:\n    - {id: x, capabilities: {tools: maybe}}\n", want: "models.catalog[0].capabilities.tools (line 3): must be true or false"},
+		{name: "empty catalog", yaml: "models:\n  builtin: false\n", want: "models.catalog (line 2): must not be empty when models.builtin is false"},
+		{name: "bad socket mode", yaml: "server:\n  unix_socket_mode: rw\n", want: "server.unix_socket_mode (line 2): invalid --unix-socket-mode"},
+		{name: "nested value", yaml: "server:\n  listen: [a, b]\n", want: "server.listen (line 2): must be a scalar value"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := parseConfig([]byte(tc.yaml))
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Fatalf("parseConfig() error = %v, want %q", err, tc.want)
+			}
+		})
+	}
+
+	cfg, err := parseConfig([]byte("server:\n  shutdown_timeout: soon\n"))
+	if err != nil {
+		t.Fatalf("parseConfig() error = %v", err)
+	}
+	flagSet := flag.NewFlagSet("test", flag.ContinueOnError)
+	flagSet.Duration("shutdown-timeout", time.Second, "")
+	err = cfg.applyToFlags(flagSet, nil)
+	if err == nil || !strings.HasPrefix(err.Error(), `server.shutdown_timeout: invalid value "soon"`) {
+		t.Fatalf("applyToFlags() error = %v", err)
+	}
+}
+
+func TestConfigReloader_ReloadsSafeSubset(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "gptb2o.yaml")
+	writeConfig := func(content string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatalf("WriteFile() error = %v", err)
+		}
+	}
+	writeConfig("server:\n  log_level: info\ndefaults:\n  reasoning_effort: low\napi_keys:\n  - {name: alice, key: sk-alice}\n")
+	cfg, err := loadConfigFile(path)
+	if err != nil {
+		t.Fatalf("loadConfigFile() error = %v", err)
+	}
+	// 命令行显式传入的 --log-level 在热更新后仍然优先。
+	r, err := newConfigReloader(path, cfg, map[string]bool{"log-level": true}, "", "debug")
+	if err != nil {
+		t.Fatalf("newConfigReloader() error = %v", err)
+	}
+	if got := r.settings.Load(); len(got.APIKeys) != 1 || got.ReasoningEffort != "low" {
+		t.Fatalf("unexpected initial settings: %+v", got)
+	}
+
+	writeConfig("server:\n  listen: 0.0.0.0:9999\n  log_level: error\ndefaults:\n  reasoning_effort: high\napi_keys:\n  - {name: bob, key: sk-bob}\nmodels:\n  aliases:\n    fast: gpt-5.4-mini\n")
+	if !r.changed() {
+		t.Fatalf("changed() = false after rewriting config")
+	}
+	if err := r.reload(); err != nil {
+		t.Fatalf("reload() error = %v", err)
+	}
+	got := r.settings.Load()
+	if len(got.APIKeys) != 1 || got.APIKeys[0].Name != "bob" || got.ReasoningEffort != "high" || got.Models == nil {
+		t.Fatalf("settings not reloaded: %+v", got)
+	}
+	if logLevel(r.logLevel.Load()) != logLevelDebug {
+		t.Fatalf("explicit --log-level overridden by reload: %d", r.logLevel.Load())
+	}
+	if m, ok := got.Models.Resolve("fast"); !ok || m.ID != "gpt-5.4-mini" {
+		t.Fatalf("reloaded alias fast = %+v, %v", m, ok)
+	}
+	if _, ok := gptb2o.DefaultModelRegistry().Resolve("fast"); ok {
+		t.Fatalf("reload must not change the builtin model registry")
+	}
+	if r.changed() {
+		t.Fatalf("changed() = true right after reload")
+	}
+
+	// 校验失败时保留上一次生效的配置。
+	writeConfig("api_keys:\n  - name: broken\n")
+	if err := r.reload(); err == nil || !strings.Contains(err.Error(), "api_keys[0].key") {
+		t.Fatalf("reload() error = %v, want api_keys[0].key", err)
+	}
+	if got := r.settings.Load(); len(got.APIKeys) != 1 || got.APIKeys[0].Name != "bob" {
+		t.Fatalf("invalid reload replaced settings: %+v", got)
+	}
+}
+
+func TestServerConfig_RestartRequiredChanges(t *testing.T) {
+	t.Parallel()
+
+	old, err := parseConfig([]byte("server:\n  listen: a:1\n  log_level: info\ntrace:\n  sink: sqlite\n"))
+	if err != nil {
+		t.Fatalf("parseConfig() error = %v", err)
+	}
+	next, err := parseConfig([]byte("server:\n  listen: b:1\n  log_level: debug\nbatch:\n  concurrency: 8\n"))
+	if err != nil {
+		t.Fatalf("parseConfig() error = %v", err)
+	}
+	got := strings.Join(next.restartRequiredChanges(old), ",")
+	if got != "batch.concurrency,server.listen,trace.sink" {
+		t.Fatalf("restartRequiredChanges() = %q", got)
+	}
+}
+
+func TestRun_ConfigReloaderErrorNamesTheFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "gptb2o.yaml")
+	if err := os.WriteFile(path, []byte("server:\n  log_level: info\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	err := run([]string{"--config", path, "--log-level", "loud"}, io.Discard)
+	if err == nil || !strings.HasPrefix(err.Error(), "config "+path+": ") || !strings.Contains(err.Error(), `invalid log level "loud"`) {
+		t.Fatalf("run() error = %v", err)
+	}
+}
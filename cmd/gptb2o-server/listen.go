@@ -0,0 +1,208 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// unixListenPrefix 是 --listen 的 Unix domain socket 写法，例如 unix:///run/gptb2o.sock。
+const unixListenPrefix = "unix://"
+
+// listenOptions 描述 gptb2o-server 的监听方式：TCP 或 Unix socket，可选 TLS 与客户端证书校验。
+type listenOptions struct {
+	addr        string
+	tlsCert     string
+	tlsKey      string
+	tlsClientCA string
+	// socketMode 是 Unix socket 文件权限，只对 unix:// 生效。
+	socketMode os.FileMode
+}
+
+// unixSocketPath 返回 unix:// 写法中的 socket 路径；不是 Unix socket 时 ok 为 false。
+func (o listenOptions) unixSocketPath() (path string, ok bool) {
+	addr := strings.TrimSpace(o.addr)
+	if !strings.HasPrefix(addr, unixListenPrefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(addr, unixListenPrefix), true
+}
+
+func (o listenOptions) tlsEnabled() bool {
+	return strings.TrimSpace(o.tlsCert) != "" || strings.TrimSpace(o.tlsKey) != ""
+}
+
+// parseSocketMode 解析八进制权限，例如 0600、660。
+func parseSocketMode(s string) (os.FileMode, error) {
+	mode, err := strconv.ParseUint(strings.TrimSpace(s), 8, 32)
+	if err != nil || mode > 0o777 {
+		return 0, fmt.Errorf("invalid --unix-socket-mode %q: want octal permissions such as 0600", s)
+	}
+	return os.FileMode(mode), nil
+}
+
+// openListener 按 opts 打开监听：unix:// 路径创建 socket 并设置权限，其余按 TCP 地址监听；
+// 配置了证书时在其上叠加 TLS。
+func openListener(opts listenOptions) (net.Listener, error) {
+	tlsConfig, err := serverTLSConfig(opts)
+	if err != nil {
+		return nil, err
+	}
+	var ln net.Listener
+	if path, ok := opts.unixSocketPath(); ok {
+		ln, err = listenUnix(path, opts.socketMode)
+	} else {
+		ln, err = net.Listen("tcp", strings.TrimSpace(opts.addr))
+	}
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig != nil {
+		ln = tls.NewListener(ln, tlsConfig)
+	}
+	return ln, nil
+}
+
+// listenUnix 创建 Unix socket；上次异常退出遗留的 socket 文件在确认无人监听后删除。
+// 关闭 listener 时 socket 文件会被自动删除。
+func listenUnix(path string, mode os.FileMode) (net.Listener, error) {
+	if path == "" {
+		return nil, fmt.Errorf("invalid --listen %q: missing socket path", unixListenPrefix)
+	}
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("listen %s: file exists and is not a socket", path)
+		}
+		if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+			_ = conn.Close()
+			return nil, fmt.Errorf("listen %s: socket is already in use", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("remove stale socket %s: %w", path, err)
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		_ = ln.Close()
+		return nil, fmt.Errorf("chmod socket %s: %w", path, err)
+	}
+	return ln, nil
+}
+
+// serverTLSConfig 在设置了 --tls-cert/--tls-key 时返回 TLS 配置；设置 --tls-client-ca 时要求并校验客户端证书。
+func serverTLSConfig(opts listenOptions) (*tls.Config, error) {
+	certFile, keyFile, caFile := strings.TrimSpace(opts.tlsCert), strings.TrimSpace(opts.tlsKey), strings.TrimSpace(opts.tlsClientCA)
+	if certFile == "" && keyFile == "" {
+		if caFile != "" {
+			return nil, fmt.Errorf("--tls-client-ca requires --tls-cert and --tls-key")
+		}
+		return nil, nil
+	}
+	if certFile == "" || keyFile == "" {
+		return nil, fmt.Errorf("--tls-cert and --tls-key must be set together")
+	}
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("load tls certificate: %w", err)
+	}
+	cfg := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+	}
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("read tls client ca: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("read tls client ca %s: no PEM certificates found", caFile)
+		}
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return cfg, nil
+}
+
+// localClient 是启动日志里示例命令使用的客户端连接方式。
+type localClient struct {
+	// baseURL 不含 BasePath，例如 http://127.0.0.1:12345、https://127.0.0.1:12345 或 Unix socket 时的 http://localhost。
+	baseURL string
+	// curlArgs 是 curl 示例需要的额外参数（含结尾空格），例如 --unix-socket 或客户端证书。
+	curlArgs string
+	// notes 是额外的客户端配置提示。
+	notes []string
+}
+
+func newLocalClient(opts listenOptions) localClient {
+	scheme := "http"
+	if opts.tlsEnabled() {
+		scheme = "https"
+	}
+	var c localClient
+	if path, ok := opts.unixSocketPath(); ok {
+		// Unix socket 上的 HTTP 请求仍需要 Host，约定使用 localhost。
+		c.baseURL = scheme + "://localhost"
+		c.curlArgs = "--unix-socket " + path + " "
+		c.notes = append(c.notes,
+			fmt.Sprintf("unix socket: %s (mode %#o); only clients that can dial a unix socket can connect, e.g. curl --unix-socket, httpx.HTTPTransport(uds=...)", path, opts.socketMode),
+			"Claude Code and most OpenAI SDKs need TCP: run a local TCP listener or a forwarder such as socat when they must connect")
+	} else {
+		c.baseURL = scheme + "://" + addrForLocalClient(opts.addr)
+	}
+	if opts.tlsEnabled() {
+		cert := strings.TrimSpace(opts.tlsCert)
+		c.notes = append(c.notes, fmt.Sprintf("tls: if %s is self-signed, trust it with curl --cacert %s, NODE_EXTRA_CA_CERTS=%s (Claude Code) or SSL_CERT_FILE=%s (Python SDKs)", cert, cert, cert, cert))
+		if ca := strings.TrimSpace(opts.tlsClientCA); ca != "" {
+			c.curlArgs += "--cert client.pem --key client-key.pem "
+			c.notes = append(c.notes, fmt.Sprintf("mtls: clients must present a certificate signed by %s", ca))
+		}
+	}
+	return c
+}
+
+// addrForLocalClient 把监听地址转换为本机客户端可用的地址：`--listen :12345`/`0.0.0.0:12345`/`[::]:12345`
+// 绑定全部网卡，示例中使用 127.0.0.1；Unix socket 返回 localhost（配合 --unix-socket 使用）。
+func addrForLocalClient(listen string) string {
+	listen = strings.TrimSpace(listen)
+	if strings.HasPrefix(listen, unixListenPrefix) {
+		return "localhost"
+	}
+	host, port, ok := splitHostPortLoose(listen)
+	if !ok {
+		return listen
+	}
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "127.0.0.1"
+	}
+	return net.JoinHostPort(host, port)
+}
+
+func splitHostPortLoose(addr string) (host, port string, ok bool) {
+	host, port, err := net.SplitHostPort(addr)
+	if err == nil {
+		return host, port, true
+	}
+	// Accept bracketless IPv6 like "::1:8080" by splitting on the last ':' if port is numeric.
+	last := strings.LastIndex(addr, ":")
+	if last <= 0 || last+1 >= len(addr) {
+		return "", "", false
+	}
+	host = addr[:last]
+	port = addr[last+1:]
+	if _, err := strconv.Atoi(port); err != nil {
+		return "", "", false
+	}
+	return host, port, true
+}
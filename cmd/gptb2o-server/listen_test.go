@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func serveOK(t *testing.T, ln net.Listener) {
+	t.Helper()
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "ok")
+	})}
+	go func() { _ = srv.Serve(ln) }()
+	t.Cleanup(func() { _ = srv.Close() })
+}
+
+func TestOpenListener_UnixSocket(t *testing.T) {
+	// macOS 的 sun_path 上限较短，使用 /tmp 下的短目录而不是 t.TempDir()。
+	dir, err := os.MkdirTemp("", "gptb2o")
+	if err != nil {
+		t.Fatalf("MkdirTemp() error = %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+	path := filepath.Join(dir, "g.sock")
+	opts := listenOptions{addr: "unix://" + path, socketMode: 0o660}
+
+	ln, err := openListener(opts)
+	if err != nil {
+		t.Fatalf("openListener() error = %v", err)
+	}
+	serveOK(t, ln)
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Stat() error = %v", err)
+	}
+	if info.Mode().Perm() != 0o660 || info.Mode()&os.ModeSocket == 0 {
+		t.Fatalf("socket mode = %v, want socket 0660", info.Mode())
+	}
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", path)
+		},
+	}}
+	resp, err := client.Get(newLocalClient(opts).baseURL + "/healthz")
+	if err != nil {
+		t.Fatalf("GET over unix socket error = %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if string(body) != "ok" {
+		t.Fatalf("body = %q, want ok", body)
+	}
+
+	if _, err := openListener(opts); err == nil || !strings.Contains(err.Error(), "already in use") {
+		t.Fatalf("second openListener() error = %v, want already in use", err)
+	}
+	if err := ln.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("socket file should be removed on close, Stat() error = %v", err)
+	}
+
+	if err := os.WriteFile(path, []byte("x"), 0o600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	if _, err := openListener(opts); err == nil || !strings.Contains(err.Error(), "not a socket") {
+		t.Fatalf("openListener() over regular file error = %v", err)
+	}
+}
+
+type testCert struct {
+	cert    *x509.Certificate
+	key     *ecdsa.PrivateKey
+	certPEM []byte
+	keyPEM  []byte
+}
+
+func newTestCert(t *testing.T, cn string, parent *testCert, usage x509.ExtKeyUsage) *testCert {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+	}
+	signer, signerKey := tmpl, key
+	if parent == nil {
+		tmpl.IsCA = true
+		tmpl.BasicConstraintsValid = true
+	} else {
+		tmpl.ExtKeyUsage = []x509.ExtKeyUsage{usage}
+		tmpl.IPAddresses = []net.IP{net.ParseIP("127.0.0.1")}
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatalf("CreateCertificate() error = %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("ParseCertificate() error = %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("MarshalECPrivateKey() error = %v", err)
+	}
+	return &testCert{
+		cert:    cert,
+		key:     key,
+		certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		keyPEM:  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+	}
+}
+
+func TestOpenListener_MutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, data []byte) string {
+		t.Helper()
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, data, 0o600); err != nil {
+			t.Fatalf("WriteFile() error = %v", err)
+		}
+		return path
+	}
+	ca := newTestCert(t, "gptb2o test ca", nil, 0)
+	server := newTestCert(t, "127.0.0.1", ca, x509.ExtKeyUsageServerAuth)
+	client := newTestCert(t, "alice", ca, x509.ExtKeyUsageClientAuth)
+
+	opts := listenOptions{
+		addr:        "127.0.0.1:0",
+		tlsCert:     write("server.pem", server.certPEM),
+		tlsKey:      write("server-key.pem", server.keyPEM),
+		tlsClientCA: write("ca.pem", ca.certPEM),
+	}
+	ln, err := openListener(opts)
+	if err != nil {
+		t.Fatalf("openListener() error = %v", err)
+	}
+	serveOK(t, ln)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	get := func(certs []tls.Certificate) error {
+		c := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots, Certificates: certs}}}
+		resp, err := c.Get("https://" + ln.Addr().String() + "/healthz")
+		if err != nil {
+			return err
+		}
+		_ = resp.Body.Close()
+		return nil
+	}
+	if err := get(nil); err == nil {
+		t.Fatalf("request without client certificate should fail")
+	}
+	pair, err := tls.X509KeyPair(client.certPEM, client.keyPEM)
+	if err != nil {
+		t.Fatalf("X509KeyPair() error = %v", err)
+	}
+	if err := get([]tls.Certificate{pair}); err != nil {
+		t.Fatalf("request with client certificate error = %v", err)
+	}
+}
+
+func TestServerTLSConfig_Errors(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		opts listenOptions
+		want string
+	}{
+		{opts: listenOptions{tlsCert: "c.pem"}, want: "must be set together"},
+		{opts: listenOptions{tlsClientCA: "ca.pem"}, want: "requires --tls-cert"},
+		{opts: listenOptions{tlsCert: "missing.pem", tlsKey: "missing-key.pem"}, want: "load tls certificate"},
+	}
+	for _, tc := range cases {
+		if _, err := serverTLSConfig(tc.opts); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Fatalf("serverTLSConfig(%+v) error = %v, want %q", tc.opts, err, tc.want)
+		}
+	}
+	if _, err := parseSocketMode("rw"); err == nil {
+		t.Fatalf("parseSocketMode(rw) should fail")
+	}
+}
+
+func TestNewLocalClient(t *testing.T) {
+	t.Parallel()
+
+	c := newLocalClient(listenOptions{addr: "0.0.0.0:8443", tlsCert: "cert.pem", tlsKey: "key.pem", tlsClientCA: "ca.pem"})
+	if c.baseURL != "https://127.0.0.1:8443" || c.curlArgs != "--cert client.pem --key client-key.pem " {
+		t.Fatalf("tls client = %+v", c)
+	}
+	if notes := strings.Join(c.notes, "\n"); !strings.Contains(notes, "NODE_EXTRA_CA_CERTS=cert.pem") || !strings.Contains(notes, "signed by ca.pem") {
+		t.Fatalf("tls notes = %q", notes)
+	}
+
+	c = newLocalClient(listenOptions{addr: "unix:///run/gptb2o.sock", socketMode: 0o600})
+	if c.baseURL != "http://localhost" || c.curlArgs != "--unix-socket /run/gptb2o.sock " {
+		t.Fatalf("unix client = %+v", c)
+	}
+	if notes := strings.Join(c.notes, "\n"); !strings.Contains(notes, "(mode 0600)") {
+		t.Fatalf("unix notes = %q", notes)
+	}
+
+	if c := newLocalClient(listenOptions{addr: ":12345"}); c.baseURL != "http://127.0.0.1:12345" || c.curlArgs != "" || len(c.notes) != 0 {
+		t.Fatalf("plain client = %+v", c)
+	}
+}
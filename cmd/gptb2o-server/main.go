@@ -6,22 +6,33 @@ import (
 	"fmt"
 	"io"
 	"log"
-	"net"
 	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
-	"strconv"
+	"runtime/debug"
 	"strings"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/LubyRuffy/gptb2o"
 	"github.com/LubyRuffy/gptb2o/auth"
+	"github.com/LubyRuffy/gptb2o/batch"
+	"github.com/LubyRuffy/gptb2o/metrics"
 	"github.com/LubyRuffy/gptb2o/openaihttp"
+	"github.com/LubyRuffy/gptb2o/telemetry"
 	"github.com/LubyRuffy/gptb2o/trace"
 	"github.com/gin-gonic/gin"
 )
 
-var defaultTraceDBPath = filepath.Join("artifacts", "traces", "gptb2o-trace.db")
+// version 可在构建时通过 -ldflags "-X main.version=v1.2.3" 注入；为空时回退到 go module 版本。
+var version = ""
+
+var (
+	defaultTraceDBPath    = filepath.Join("artifacts", "traces", "gptb2o-trace.db")
+	defaultTraceJSONLPath = filepath.Join("artifacts", "traces", "gptb2o-trace.jsonl")
+)
 
 func main() {
 	if err := run(os.Args[1:], os.Stdout); err != nil {
@@ -31,58 +42,204 @@ func main() {
 }
 
 func run(args []string, stdout io.Writer) error {
+	if len(args) > 0 && args[0] == "trace" {
+		return runTrace(args[1:], stdout)
+	}
+
 	var (
 		flagSet         = flag.NewFlagSet("gptb2o-server", flag.ContinueOnError)
+		configPath      = flagSet.String("config", "", "YAML config file; flags given on the command line override it")
 		listen          = flagSet.String("listen", "127.0.0.1:12345", "listen address")
 		basePath        = flagSet.String("base-path", "/v1", "base path prefix")
 		backendURL      = flagSet.String("backend-url", "", "chatgpt backend responses url (default: https://chatgpt.com/backend-api/codex/responses)")
 		authSource      = flagSet.String("auth-source", "codex", "auth source: codex|opencode|env|auto")
 		originator      = flagSet.String("originator", "", "Originator/User-Agent header (default: codex_cli_rs)")
 		reasoningEffort = flagSet.String("reasoning-effort", "", "default reasoning effort forwarded to backend (none|low|medium|high|xhigh; backend default: medium)")
+		traceSinkKind   = flagSet.String("trace-sink", "sqlite", "trace storage backend: sqlite|jsonl|memory")
 		traceDBPath     = flagSet.String("trace-db-path", defaultTraceDBPath, "sqlite path for full-chain tracing")
+		traceJSONLPath  = flagSet.String("trace-jsonl-path", defaultTraceJSONLPath, "jsonl file for --trace-sink jsonl")
+		traceJSONLMaxMB = flagSet.Int64("trace-jsonl-max-mb", 100, "rotate the jsonl trace file after this many MiB")
+		traceJSONLFiles = flagSet.Int("trace-jsonl-max-files", 5, "rotated jsonl trace files to keep")
+		traceMemoryMax  = flagSet.Int("trace-memory-interactions", 1000, "interactions kept by --trace-sink memory")
 		traceMaxBody    = flagSet.Int("trace-max-body-bytes", 64<<10, "max body bytes stored per trace event")
 		showInteraction = flagSet.String("show-interaction", "", "print a traced interaction by id and exit")
+		showFormat      = flagSet.String("format", "transcript", "output format for --show-interaction: transcript|raw|json")
+		traceMaxAge     = flagSet.Duration("trace-max-age", 0, "delete traced interactions older than this duration (0 keeps forever)")
+		traceSuccessAge = flagSet.Duration("trace-success-max-age", 0, "delete successful traced interactions older than this duration; failed ones follow --trace-max-age")
+		traceMaxRows    = flagSet.Int("trace-max-interactions", 0, "keep only the newest N traced interactions (0 = unlimited)")
+		traceMaxDBMB    = flagSet.Int64("trace-max-db-mb", 0, "cap trace data size in MiB, pruning oldest interactions first (0 = unlimited)")
+		tracePruneEvery = flagSet.Duration("trace-prune-interval", 10*time.Minute, "how often the trace janitor enforces retention")
+		batchDBPath     = flagSet.String("batch-db-path", "", "sqlite path for message/openai batches and files (empty disables the batch routes)")
+		batchWorkers    = flagSet.Int("batch-concurrency", 4, "max concurrent requests executed for message batches")
+		debugUI         = flagSet.Bool("debug-ui", false, "serve the trace browser at "+trace.DefaultUIPath+" (exposes full request/response bodies)")
+		enableMetrics   = flagSet.Bool("metrics", true, "serve Prometheus metrics at "+metrics.DefaultPath)
+		otlpEndpoint    = flagSet.String("otlp-endpoint", os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"), "OTLP/HTTP collector for OpenTelemetry spans, e.g. http://127.0.0.1:4318 (empty disables; default: $OTEL_EXPORTER_OTLP_ENDPOINT)")
+		otlpService     = flagSet.String("otlp-service-name", "gptb2o-server", "service.name reported on exported spans")
+		shutdownTimeout = flagSet.Duration("shutdown-timeout", 30*time.Second, "on SIGINT/SIGTERM, wait this long for active streams before aborting them")
+		backendProbeTTL = flagSet.Duration("backend-probe-ttl", 0, "probe backend reachability in /readyz and cache the result for this long (0 disables)")
+		tlsCert         = flagSet.String("tls-cert", "", "serve HTTPS with this PEM certificate (requires --tls-key)")
+		tlsKey          = flagSet.String("tls-key", "", "PEM private key for --tls-cert")
+		tlsClientCA     = flagSet.String("tls-client-ca", "", "require client certificates signed by this PEM CA bundle (mTLS)")
+		socketModeText  = flagSet.String("unix-socket-mode", "0600", "file permissions for --listen unix:///path sockets (octal)")
+		wsOrigins       = flagSet.String("ws-allowed-origins", "", "comma-separated browser origins allowed to open the /v1/responses WebSocket besides same-host pages, e.g. https://app.example (* allows any)")
+		maxConcurrent   = flagSet.Int("max-concurrent", 0, "max concurrent chat/responses/messages requests sent to the backend (0 = unlimited)")
+		maxQueued       = flagSet.Int("max-queued", 64, "requests allowed to wait for a --max-concurrent slot; more are rejected immediately")
+		maxQueueWait    = flagSet.Duration("max-queue-wait", openaihttp.DefaultMaxQueueWait, "reject queued requests with 529/503 after waiting this long")
+		modelsURL       = flagSet.String("models-url", "", "discover account models from this backend endpoint and merge them into /v1/models, e.g. "+gptb2o.DefaultModelsURL+" (empty disables)")
+		modelsTTL       = flagSet.Duration("models-ttl", openaihttp.DefaultModelsTTL, "cache discovered backend models for this long")
+		connectTimeout  = flagSet.Duration("backend-connect-timeout", 0, "fail a backend request that gets no response headers within this long (0 disables)")
+		firstEventWait  = flagSet.Duration("backend-first-event-timeout", 0, "fail a backend stream that sends no data within this long after the headers (0 uses --backend-idle-timeout)")
+		idleTimeout     = flagSet.Duration("backend-idle-timeout", 0, "fail a backend stream that stops sending data for this long (0 disables)")
+		requestTimeout  = flagSet.Duration("backend-request-timeout", 0, "fail a backend request, including reading its stream, after this long (0 disables)")
+		logLevelName    = flagSet.String("log-level", "info", "access log level: debug|info|warn|error")
+		configPoll      = flagSet.Duration("config-poll-interval", 2*time.Second, "check --config for changes this often and hot-reload it (0 reloads only on SIGHUP)")
 	)
 	flagSet.SetOutput(io.Discard)
 	if err := flagSet.Parse(args); err != nil {
 		return err
 	}
 
-	tracePath := strings.TrimSpace(*traceDBPath)
-	if tracePath == "" {
-		tracePath = defaultTraceDBPath
+	var reloader *configReloader
+	if path := strings.TrimSpace(*configPath); path != "" {
+		fileCfg, err := loadConfigFile(path)
+		if err != nil {
+			return err
+		}
+		explicit := make(map[string]bool)
+		flagSet.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+		if err := fileCfg.applyToFlags(flagSet, explicit); err != nil {
+			return fmt.Errorf("config %s: %w", path, err)
+		}
+		reloader, err = newConfigReloader(path, fileCfg, explicit, *reasoningEffort, *logLevelName)
+		if err != nil {
+			return fmt.Errorf("config %s: %w", path, err)
+		}
 	}
-
-	store, err := trace.OpenStore(tracePath)
+	socketMode, err := parseSocketMode(*socketModeText)
 	if err != nil {
 		return err
 	}
-	defer func() { _ = store.Close() }()
-
-	tracer := trace.NewTracer(store, trace.TracerOptions{MaxBodyBytes: *traceMaxBody})
-	if interactionID := strings.TrimSpace(*showInteraction); interactionID != "" {
-		interaction, events, err := store.GetInteraction(interactionID)
+	listenOpts := listenOptions{
+		addr:        *listen,
+		tlsCert:     *tlsCert,
+		tlsKey:      *tlsKey,
+		tlsClientCA: *tlsClientCA,
+		socketMode:  socketMode,
+	}
+	if _, err := serverTLSConfig(listenOpts); err != nil {
+		return err
+	}
+	accessLogLevel := &atomic.Int32{}
+	if reloader != nil {
+		accessLogLevel = reloader.logLevel
+	} else {
+		level, err := parseLogLevel(*logLevelName)
 		if err != nil {
-			return err
+			return fmt.Errorf("invalid log-level: %w", err)
 		}
-		_, err = io.WriteString(stdout, trace.FormatInteractionReport(interaction, events))
+		accessLogLevel.Store(int32(level))
+	}
+
+	sinkKind := strings.TrimSpace(*traceSinkKind)
+	interactionID := strings.TrimSpace(*showInteraction)
+	if interactionID != "" && sinkKind == "memory" {
+		return fmt.Errorf("--show-interaction needs a persistent --trace-sink (sqlite|jsonl)")
+	}
+	sink, traceLocation, err := openTraceSink(traceSinkOptions{
+		kind:       sinkKind,
+		dbPath:     *traceDBPath,
+		jsonlPath:  *traceJSONLPath,
+		jsonlBytes: *traceJSONLMaxMB << 20,
+		jsonlFiles: *traceJSONLFiles,
+		memoryMax:  *traceMemoryMax,
+	})
+	if err != nil {
 		return err
 	}
+	defer func() { _ = sink.Close() }()
+
+	tracer := trace.NewTracer(sink, trace.TracerOptions{MaxBodyBytes: *traceMaxBody})
+	if interactionID != "" {
+		return writeInteraction(stdout, sink, interactionID, strings.TrimSpace(*showFormat))
+	}
+
+	// 保留策略只作用于 SQLite；jsonl 按文件滚动，memory 按容量淘汰。
+	if store, ok := sink.(*trace.Store); ok {
+		store.StartJanitor(trace.RetentionPolicy{
+			MaxAge:          *traceMaxAge,
+			SuccessMaxAge:   *traceSuccessAge,
+			MaxInteractions: *traceMaxRows,
+			MaxDBBytes:      *traceMaxDBMB << 20,
+		}, *tracePruneEvery)
+	}
 
 	provider, err := auth.NewProvider(*authSource)
 	if err != nil {
 		return fmt.Errorf("invalid auth-source: %w", err)
 	}
 
+	var batches *batch.Store
+	if path := strings.TrimSpace(*batchDBPath); path != "" {
+		batches, err = batch.OpenStore(path)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = batches.Close() }()
+	}
+
+	var serverMetrics *metrics.Metrics
+	if *enableMetrics {
+		serverMetrics = metrics.New()
+	}
+
+	var spanTracer *telemetry.Tracer
+	if endpoint := strings.TrimSpace(*otlpEndpoint); endpoint != "" {
+		spanTracer, err = telemetry.NewTracer(telemetry.TracerOptions{Endpoint: endpoint, ServiceName: strings.TrimSpace(*otlpService)})
+		if err != nil {
+			return fmt.Errorf("invalid otlp-endpoint: %w", err)
+		}
+		defer func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			_ = spanTracer.Shutdown(ctx)
+		}()
+	}
+
 	r := gin.New()
-	r.Use(gin.Logger(), gin.Recovery())
+	r.Use(accessLogger(accessLogLevel), gin.Recovery())
+
+	// 使用配置文件时，默认 effort 由可热更新的 Settings 提供。
+	defaultEffort := *reasoningEffort
+	var settings *openaihttp.SettingsStore
+	if reloader != nil {
+		settings = reloader.settings
+		defaultEffort = ""
+	}
 
 	err = openaihttp.RegisterGinRoutes(r, openaihttp.Config{
-		BasePath:        *basePath,
-		BackendURL:      *backendURL,
-		Originator:      *originator,
-		ReasoningEffort: *reasoningEffort,
-		Tracer:          tracer,
+		BasePath:                *basePath,
+		BackendURL:              *backendURL,
+		Originator:              *originator,
+		ReasoningEffort:         defaultEffort,
+		Tracer:                  tracer,
+		Metrics:                 serverMetrics,
+		Telemetry:               spanTracer,
+		Batches:                 batches,
+		BatchConcurrency:        *batchWorkers,
+		Version:                 buildVersion(),
+		AuthSource:              *authSource,
+		BackendProbeTTL:         *backendProbeTTL,
+		Settings:                settings,
+		ModelsURL:               *modelsURL,
+		ModelsTTL:               *modelsTTL,
+		MaxConcurrentRequests:   *maxConcurrent,
+		MaxQueuedRequests:       *maxQueued,
+		MaxQueueWait:            *maxQueueWait,
+		WebSocketAllowedOrigins: splitCommaList(*wsOrigins),
+		ConnectTimeout:          *connectTimeout,
+		FirstEventTimeout:       *firstEventWait,
+		IdleTimeout:             *idleTimeout,
+		RequestTimeout:          *requestTimeout,
 		AuthProvider: func(ctx context.Context) (string, string, error) {
 			return provider.Auth(ctx)
 		},
@@ -90,6 +247,15 @@ func run(args []string, stdout io.Writer) error {
 	if err != nil {
 		return fmt.Errorf("register routes failed: %w", err)
 	}
+	// trace 页面与指标同 /debug/info 一样，配置了 API key 时需要鉴权。
+	if *debugUI {
+		ui := gin.WrapH(settings.RequireAPIKey(trace.NewUIHandler(sink, trace.DefaultUIPath)))
+		r.GET(trace.DefaultUIPath, ui)
+		r.GET(trace.DefaultUIPath+"/*path", ui)
+	}
+	if serverMetrics != nil {
+		r.GET(metrics.DefaultPath, gin.WrapH(settings.RequireAPIKey(serverMetrics.Handler())))
+	}
 
 	srv := &http.Server{
 		Addr:              *listen,
@@ -97,49 +263,109 @@ func run(args []string, stdout io.Writer) error {
 		ReadHeaderTimeout: 10 * time.Second,
 	}
 
-	// `--listen :12345`/`0.0.0.0:12345`/`[::]:12345` binds to all interfaces; for curl examples
-	// we prefer a localhost address that works for most users.
-	exampleAddr := addrForLocalClient(*listen)
-	log.Printf("gptb2o server listening on http://%s%s", exampleAddr, *basePath)
-	log.Printf("try: curl http://%s%s/models", exampleAddr, *basePath)
-	log.Printf("try: curl http://%s%s/responses -H 'Content-Type: application/json' -d '{\"model\":\"%s\",\"input\":\"hi\",\"stream\":false}'", exampleAddr, *basePath, gptb2o.DefaultModelFullID)
-	log.Printf("OpenAI SDK base_url: http://%s%s", exampleAddr, *basePath)
-	log.Printf("try: curl http://%s%s/messages -H 'Content-Type: application/json' -d '{\"model\":\"%s\",\"messages\":[{\"role\":\"user\",\"content\":\"hi\"}],\"stream\":false}'", exampleAddr, *basePath, gptb2o.DefaultModelFullID)
-	log.Printf("Claude Code base_url: http://%s%s", exampleAddr, *basePath)
-	log.Printf("trace db: %s", tracePath)
+	client := newLocalClient(listenOpts)
+	apiURL := client.baseURL + *basePath
+	log.Printf("gptb2o server listening on %s", apiURL)
+	log.Printf("try: curl %s%s/models", client.curlArgs, apiURL)
+	log.Printf("try: curl %s%s/responses -H 'Content-Type: application/json' -d '{\"model\":\"%s\",\"input\":\"hi\",\"stream\":false}'", client.curlArgs, apiURL, gptb2o.DefaultModelFullID)
+	log.Printf("OpenAI SDK base_url: %s", apiURL)
+	log.Printf("try: curl %s%s/messages -H 'Content-Type: application/json' -d '{\"model\":\"%s\",\"messages\":[{\"role\":\"user\",\"content\":\"hi\"}],\"stream\":false}'", client.curlArgs, apiURL, gptb2o.DefaultModelFullID)
+	log.Printf("Claude Code base_url: %s", apiURL)
+	for _, note := range client.notes {
+		log.Print(note)
+	}
+	log.Printf("trace sink: %s", traceLocation)
+	log.Printf("health: %s%s (liveness), %s%s (readiness)", client.baseURL, openaihttp.HealthzPath, client.baseURL, openaihttp.ReadyzPath)
+	log.Printf("debug info: %s%s", client.baseURL, openaihttp.DebugInfoPath)
+	if *debugUI {
+		log.Printf("trace ui: %s%s/ (shows full request/response bodies; keep it on a trusted network)", client.baseURL, trace.DefaultUIPath)
+	}
+	if serverMetrics != nil {
+		log.Printf("metrics: %s%s", client.baseURL, metrics.DefaultPath)
+	}
+	if spanTracer != nil {
+		log.Printf("otlp traces: %s", spanTracer.Endpoint())
+	}
+	if batches != nil {
+		log.Printf("batch db: %s", strings.TrimSpace(*batchDBPath))
+	}
+	if *maxConcurrent > 0 {
+		log.Printf("admission: %d concurrent requests, queue %d, max wait %s", *maxConcurrent, *maxQueued, *maxQueueWait)
+	}
+	if url := strings.TrimSpace(*modelsURL); url != "" {
+		log.Printf("model discovery: %s (refresh every %s)", url, *modelsTTL)
+	}
 
-	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+	ln, err := openListener(listenOpts)
+	if err != nil {
 		return err
 	}
-	return nil
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if reloader != nil {
+		log.Printf("config: %s (hot-reloads api_keys, models, defaults and log_level on change or SIGHUP)", reloader.path)
+		go reloader.run(ctx, *configPoll)
+	}
+	return serveUntilDone(ctx, srv, ln, *shutdownTimeout)
 }
 
-func addrForLocalClient(listen string) string {
-	listen = strings.TrimSpace(listen)
-	host, port, ok := splitHostPortLoose(listen)
-	if !ok {
-		return listen
+// buildVersion 返回 -ldflags 注入的版本号，否则使用 go install 记录的 module 版本。
+func buildVersion() string {
+	if version != "" {
+		return version
 	}
-	if host == "" || host == "0.0.0.0" || host == "::" {
-		host = "127.0.0.1"
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" {
+		return info.Main.Version
 	}
-	return net.JoinHostPort(host, port)
+	return "dev"
 }
 
-func splitHostPortLoose(addr string) (host, port string, ok bool) {
-	host, port, err := net.SplitHostPort(addr)
-	if err == nil {
-		return host, port, true
-	}
-	// Accept bracketless IPv6 like "::1:8080" by splitting on the last ':' if port is numeric.
-	last := strings.LastIndex(addr, ":")
-	if last <= 0 || last+1 >= len(addr) {
-		return "", "", false
+type traceSinkOptions struct {
+	kind       string
+	dbPath     string
+	jsonlPath  string
+	jsonlBytes int64
+	jsonlFiles int
+	memoryMax  int
+}
+
+// openTraceSink 按 --trace-sink 打开 trace 存储，并返回用于启动日志的位置描述。
+func openTraceSink(opts traceSinkOptions) (trace.Sink, string, error) {
+	switch opts.kind {
+	case "", "sqlite":
+		path := strings.TrimSpace(opts.dbPath)
+		if path == "" {
+			path = defaultTraceDBPath
+		}
+		store, err := trace.OpenStore(path)
+		if err != nil {
+			return nil, "", err
+		}
+		return store, "sqlite " + path, nil
+	case "jsonl":
+		path := strings.TrimSpace(opts.jsonlPath)
+		if path == "" {
+			path = defaultTraceJSONLPath
+		}
+		sink, err := trace.OpenJSONLSink(trace.JSONLSinkOptions{Path: path, MaxBytes: opts.jsonlBytes, MaxFiles: opts.jsonlFiles})
+		if err != nil {
+			return nil, "", err
+		}
+		return sink, "jsonl " + path, nil
+	case "memory":
+		return trace.NewMemorySink(opts.memoryMax), "memory (no disk writes)", nil
+	default:
+		return nil, "", fmt.Errorf("invalid --trace-sink %q: want sqlite|jsonl|memory", opts.kind)
 	}
-	host = addr[:last]
-	port = addr[last+1:]
-	if _, err := strconv.Atoi(port); err != nil {
-		return "", "", false
+}
+
+// splitCommaList 把逗号分隔的 flag 值拆成去空白的非空项。
+func splitCommaList(v string) []string {
+	var out []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
 	}
-	return host, port, true
+	return out
 }
@@ -2,8 +2,10 @@ package main
 
 import (
 	"bytes"
+	"io"
 	"net/http"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -22,6 +24,7 @@ func TestAddrForLocalClient(t *testing.T) {
 		{in: "[::]:12345", want: "127.0.0.1:12345"},
 		{in: "127.0.0.1:12345", want: "127.0.0.1:12345"},
 		{in: "[::1]:12345", want: "[::1]:12345"},
+		{in: "unix:///run/gptb2o.sock", want: "localhost"},
 	}
 
 	for _, tc := range cases {
@@ -181,3 +184,107 @@ func TestRun_ShowInteraction_IncludesRecoverySummary(t *testing.T) {
 		t.Fatalf("run() output missing recovery_summary, got:\n%s", got)
 	}
 }
+
+func TestRun_ShowInteraction_Formats(t *testing.T) {
+	t.Parallel()
+
+	dbPath := filepath.Join(t.TempDir(), "trace.db")
+	store, err := trace.OpenStore(dbPath)
+	if err != nil {
+		t.Fatalf("OpenStore() error = %v", err)
+	}
+	t.Cleanup(func() {
+		if closeErr := store.Close(); closeErr != nil {
+			t.Fatalf("Close() error = %v", closeErr)
+		}
+	})
+
+	if err := store.StartInteraction(trace.Interaction{
+		InteractionID: "ia_cli_format",
+		Method:        http.MethodPost,
+		Path:          "/v1/messages",
+		ClientAPI:     "claude",
+		StartedAt:     time.Now(),
+	}); err != nil {
+		t.Fatalf("StartInteraction() error = %v", err)
+	}
+	if err := store.AppendEvent(trace.InteractionEvent{
+		InteractionID: "ia_cli_format",
+		Kind:          trace.EventClientResponse,
+		StatusCode:    http.StatusOK,
+		ContentType:   "text/event-stream",
+		Body:          "event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"index\":0,\"delta\":{\"type\":\"text_delta\",\"text\":\"joined answer\"}}\n\nevent: message_delta\ndata: {\"type\":\"message_delta\",\"delta\":{\"stop_reason\":\"end_turn\"}}\n\n",
+	}); err != nil {
+		t.Fatalf("AppendEvent() error = %v", err)
+	}
+
+	cases := []struct {
+		format string
+		want   string
+	}{
+		{format: "transcript", want: "stop_reason: end_turn"},
+		{format: "raw", want: "event: content_block_delta"},
+		{format: "json", want: `"stop_reason": "end_turn"`},
+	}
+	for _, tc := range cases {
+		var stdout bytes.Buffer
+		if err := run([]string{"--trace-db-path", dbPath, "--show-interaction", "ia_cli_format", "--format", tc.format}, &stdout); err != nil {
+			t.Fatalf("run(--format %s) error = %v", tc.format, err)
+		}
+		if !strings.Contains(stdout.String(), tc.want) {
+			t.Fatalf("--format %s output missing %q, got:\n%s", tc.format, tc.want, stdout.String())
+		}
+	}
+
+	if err := run([]string{"--trace-db-path", dbPath, "--show-interaction", "ia_cli_format", "--format", "yaml"}, io.Discard); err == nil {
+		t.Fatalf("run() with invalid --format should fail")
+	}
+}
+
+func TestRun_ShowInteraction_JSONLSink(t *testing.T) {
+	t.Parallel()
+
+	jsonlPath := filepath.Join(t.TempDir(), "trace.jsonl")
+	sink, err := trace.OpenJSONLSink(trace.JSONLSinkOptions{Path: jsonlPath})
+	if err != nil {
+		t.Fatalf("OpenJSONLSink() error = %v", err)
+	}
+	sink.StartInteractionAsync(trace.Interaction{
+		InteractionID: "ia_jsonl_1",
+		Method:        http.MethodPost,
+		Path:          "/v1/responses",
+		ClientAPI:     "openai",
+		Model:         "gpt-5.4",
+	})
+	sink.AppendEventAsync(trace.InteractionEvent{
+		InteractionID: "ia_jsonl_1",
+		Kind:          trace.EventClientRequest,
+		Summary:       "client request",
+	})
+	sink.FinishInteractionAsync("ia_jsonl_1", http.StatusOK, "")
+	if err := sink.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	var stdout bytes.Buffer
+	if err := run([]string{
+		"--trace-sink", "jsonl",
+		"--trace-jsonl-path", jsonlPath,
+		"--show-interaction", "ia_jsonl_1",
+		"--format", "raw",
+	}, &stdout); err != nil {
+		t.Fatalf("run() error = %v", err)
+	}
+	if got := stdout.String(); !strings.Contains(got, "interaction_id: ia_jsonl_1") {
+		t.Fatalf("run() output = %q, want interaction header", got)
+	}
+
+	err = run([]string{"--trace-sink", "memory", "--show-interaction", "ia_jsonl_1"}, io.Discard)
+	if err == nil || !strings.Contains(err.Error(), "persistent --trace-sink") {
+		t.Fatalf("run() error = %v, want persistent sink error", err)
+	}
+	err = run([]string{"--trace-sink", "redis", "--show-interaction", "ia_jsonl_1"}, io.Discard)
+	if err == nil || !strings.Contains(err.Error(), "invalid --trace-sink") {
+		t.Fatalf("run() error = %v, want invalid sink error", err)
+	}
+}
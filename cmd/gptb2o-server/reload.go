@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/LubyRuffy/gptb2o"
+	"github.com/LubyRuffy/gptb2o/metrics"
+	"github.com/LubyRuffy/gptb2o/openaihttp"
+	"github.com/gin-gonic/gin"
+)
+
+// logLevel 控制 HTTP 访问日志的详细程度；启动、停机与错误日志不受影响。
+type logLevel int32
+
+const (
+	logLevelDebug logLevel = iota
+	logLevelInfo
+	logLevelWarn
+	logLevelError
+)
+
+func parseLogLevel(s string) (logLevel, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "debug":
+		return logLevelDebug, nil
+	case "", "info":
+		return logLevelInfo, nil
+	case "warn", "warning":
+		return logLevelWarn, nil
+	case "error":
+		return logLevelError, nil
+	default:
+		return 0, fmt.Errorf("invalid log level %q: want debug|info|warn|error", s)
+	}
+}
+
+// probePaths 是健康检查与指标抓取路径，只在 debug 级别记录访问日志。
+var probePaths = map[string]bool{
+	openaihttp.HealthzPath: true,
+	openaihttp.ReadyzPath:  true,
+	metrics.DefaultPath:    true,
+}
+
+// accessLogger 返回按当前 log level 过滤的 gin 访问日志中间件：
+// debug 记录全部请求；info 跳过探活与指标抓取；warn 只记录 4xx/5xx；error 只记录 5xx。
+func accessLogger(level *atomic.Int32) gin.HandlerFunc {
+	return gin.LoggerWithConfig(gin.LoggerConfig{
+		Skip: func(c *gin.Context) bool {
+			switch logLevel(level.Load()) {
+			case logLevelDebug:
+				return false
+			case logLevelInfo:
+				return probePaths[c.Request.URL.Path]
+			case logLevelWarn:
+				return c.Writer.Status() < 400
+			default:
+				return c.Writer.Status() < 500
+			}
+		},
+	})
+}
+
+// configReloader 在 SIGHUP 或配置文件内容变化时重新加载可热更新的字段：
+// api_keys、models（目录、别名与按模型 effort）、defaults.reasoning_effort 与 server.log_level。
+// 新文件校验失败时保留旧配置；其余字段变化只记录日志，需重启生效。
+type configReloader struct {
+	path     string
+	explicit map[string]bool
+	// cliEffort / cliLogLevel 是命令行显式传入的值，优先于配置文件。
+	cliEffort   string
+	cliLogLevel string
+	settings    *openaihttp.SettingsStore
+	logLevel    *atomic.Int32
+
+	current *serverConfig
+	modTime time.Time
+	size    int64
+}
+
+func newConfigReloader(path string, cfg *serverConfig, explicit map[string]bool, cliEffort, cliLogLevel string) (*configReloader, error) {
+	r := &configReloader{
+		path:        path,
+		explicit:    explicit,
+		cliEffort:   cliEffort,
+		cliLogLevel: cliLogLevel,
+		settings:    openaihttp.NewSettingsStore(openaihttp.Settings{}),
+		logLevel:    &atomic.Int32{},
+	}
+	if info, err := os.Stat(path); err == nil {
+		r.modTime, r.size = info.ModTime(), info.Size()
+	}
+	if err := r.apply(cfg); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// apply 把 cfg 中可热更新的字段写入 SettingsStore 与 log level。
+func (r *configReloader) apply(cfg *serverConfig) error {
+	settings := cfg.settings
+	settings.ReasoningEffort, _ = cfg.flagValue("reasoning-effort")
+	if r.explicit["reasoning-effort"] {
+		settings.ReasoningEffort = r.cliEffort
+	}
+	levelName, _ := cfg.flagValue("log-level")
+	if r.explicit["log-level"] {
+		levelName = r.cliLogLevel
+	}
+	level, err := parseLogLevel(levelName)
+	if err != nil {
+		return err
+	}
+	r.settings.Store(settings)
+	r.logLevel.Store(int32(level))
+	r.current = cfg
+	return nil
+}
+
+// reload 重新读取配置文件；失败时返回错误并保持当前配置不变。
+func (r *configReloader) reload() error {
+	if info, err := os.Stat(r.path); err == nil {
+		r.modTime, r.size = info.ModTime(), info.Size()
+	}
+	cfg, err := loadConfigFile(r.path)
+	if err != nil {
+		return err
+	}
+	previous := r.current
+	if err := r.apply(cfg); err != nil {
+		return err
+	}
+	for _, path := range cfg.restartRequiredChanges(previous) {
+		log.Printf("config: %s changed; restart gptb2o-server to apply it", path)
+	}
+	models := cfg.settings.Models
+	if models == nil {
+		models = gptb2o.DefaultModelRegistry()
+	}
+	log.Printf("config reloaded from %s (api_keys=%d, models=%d, model aliases=%d)", r.path, len(cfg.settings.APIKeys), len(models.Models()), len(models.Aliases()))
+	return nil
+}
+
+// changed 报告配置文件的修改时间或大小是否与上次加载时不同。
+func (r *configReloader) changed() bool {
+	info, err := os.Stat(r.path)
+	if err != nil {
+		return false
+	}
+	return !info.ModTime().Equal(r.modTime) || info.Size() != r.size
+}
+
+// run 监听 SIGHUP，并按 pollInterval 轮询文件变化（0 表示只响应 SIGHUP），直到 ctx 结束。
+func (r *configReloader) run(ctx context.Context, pollInterval time.Duration) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	var tick <-chan time.Time
+	if pollInterval > 0 {
+		ticker := time.NewTicker(pollInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+		case <-tick:
+			if !r.changed() {
+				continue
+			}
+		}
+		if err := r.reload(); err != nil {
+			log.Printf("config reload failed, keeping previous config: %v", err)
+		}
+	}
+}
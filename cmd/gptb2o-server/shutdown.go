@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/LubyRuffy/gptb2o/openaihttp"
+)
+
+// abortGracePeriod 是排空超时、取消请求 context 之后，等待 handler 写完 error 事件并结束 trace 的时长。
+const abortGracePeriod = 5 * time.Second
+
+// activeRequests 统计进行中的请求，包括 http.Server.Shutdown 不会等待的 WebSocket 等 hijack 连接。
+type activeRequests struct {
+	wg    sync.WaitGroup
+	count atomic.Int64
+}
+
+func (a *activeRequests) wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		a.wg.Add(1)
+		a.count.Add(1)
+		defer func() {
+			a.count.Add(-1)
+			a.wg.Done()
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// wait 阻塞到所有请求结束或 ctx 到期；到期时返回 ctx.Err()。
+func (a *activeRequests) wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		a.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// serveUntilDone 在 ln 上运行 srv，直到 ctx 结束（收到 SIGINT/SIGTERM）后优雅停机：
+// 先停止接受新连接并最多等待 drainTimeout 让进行中的流自然结束；超时后以 openaihttp.ErrServerShuttingDown
+// 取消所有请求 context，使客户端收到 overloaded / server shutting down 的 error 事件，trace 正常结束 interaction。
+// 返回后调用方再关闭 trace 与 batch 存储。
+func serveUntilDone(ctx context.Context, srv *http.Server, ln net.Listener, drainTimeout time.Duration) error {
+	baseCtx, abort := context.WithCancelCause(context.Background())
+	defer abort(nil)
+	// drain 在停机开始时关闭，通知 Responses WebSocket 等 hijack 长连接尽快收尾；Shutdown 不会等待或关闭它们。
+	drain := make(chan struct{})
+	baseCtx = openaihttp.ContextWithDrain(baseCtx, drain)
+	srv.BaseContext = func(net.Listener) context.Context { return baseCtx }
+	active := &activeRequests{}
+	srv.Handler = active.wrap(srv.Handler)
+
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- srv.Serve(ln) }()
+
+	select {
+	case err := <-serveErr:
+		if errors.Is(err, http.ErrServerClosed) {
+			return nil
+		}
+		return err
+	case <-ctx.Done():
+	}
+
+	log.Printf("shutting down: waiting up to %s for %d active request(s)", drainTimeout, active.count.Load())
+	close(drain)
+	drainCtx, cancel := context.WithTimeout(context.Background(), drainTimeout)
+	defer cancel()
+	err := srv.Shutdown(drainCtx)
+	if err == nil {
+		err = active.wait(drainCtx)
+	}
+	if err != nil {
+		log.Printf("shutdown deadline reached, aborting %d active request(s)", active.count.Load())
+		abort(openaihttp.ErrServerShuttingDown)
+		graceCtx, graceCancel := context.WithTimeout(context.Background(), abortGracePeriod)
+		defer graceCancel()
+		if err := active.wait(graceCtx); err != nil {
+			log.Printf("%d request(s) still running after abort, closing connections", active.count.Load())
+		}
+		_ = srv.Close()
+	}
+	<-serveErr
+	log.Printf("server stopped")
+	return nil
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/LubyRuffy/gptb2o/openaihttp"
+	"github.com/LubyRuffy/gptb2o/trace"
+	"github.com/gorilla/websocket"
+)
+
+// startDrainTestServer 启动一个 backend 替身：先写出一段文本增量，然后阻塞到 release 关闭或请求被取消。
+func startDrainTestServer(t *testing.T, drainTimeout time.Duration) (addr string, sink *trace.MemorySink, stop context.CancelFunc, release chan struct{}, done chan error) {
+	t.Helper()
+	release = make(chan struct{})
+	backendSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "event: response.output_text.delta\ndata: {\"type\":\"response.output_text.delta\",\"delta\":\"hello\"}\n\n")
+		w.(http.Flusher).Flush()
+		select {
+		case <-release:
+			fmt.Fprint(w, "event: response.completed\ndata: {\"type\":\"response.completed\",\"response\":{\"usage\":{\"input_tokens\":1,\"output_tokens\":1}}}\n\n")
+		case <-r.Context().Done():
+		}
+	}))
+	t.Cleanup(backendSrv.Close)
+
+	sink = trace.NewMemorySink(10)
+	handler, err := openaihttp.NewHandler(openaihttp.Config{
+		BackendURL: backendSrv.URL,
+		Tracer:     trace.NewTracer(sink, trace.TracerOptions{}),
+		AuthProvider: func(ctx context.Context) (string, string, error) {
+			return "token", "", nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewHandler: %v", err)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+
+	ctx, stop := context.WithCancel(context.Background())
+	t.Cleanup(stop)
+	done = make(chan error, 1)
+	go func() { done <- serveUntilDone(ctx, &http.Server{Handler: handler}, ln, drainTimeout) }()
+	return ln.Addr().String(), sink, stop, release, done
+}
+
+// openClaudeStream 发起流式 /v1/messages，读到第一个文本增量后返回剩余的响应体。
+func openClaudeStream(t *testing.T, addr string) (*http.Response, *bufio.Reader) {
+	t.Helper()
+	resp, err := http.Post("http://"+addr+"/v1/messages", "application/json",
+		strings.NewReader(`{"model":"gpt-5.4","max_tokens":64,"stream":true,"messages":[{"role":"user","content":"hi"}]}`))
+	if err != nil {
+		t.Fatalf("post: %v", err)
+	}
+	t.Cleanup(func() { _ = resp.Body.Close() })
+	reader := bufio.NewReader(resp.Body)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("stream ended before first delta: %v", err)
+		}
+		if strings.Contains(line, "text_delta") {
+			return resp, reader
+		}
+	}
+}
+
+func waitServeDone(t *testing.T, done chan error) {
+	t.Helper()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("serveUntilDone: %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatalf("serveUntilDone did not return")
+	}
+}
+
+func TestServeUntilDone_AbortsStreamsAfterDeadline(t *testing.T) {
+	t.Parallel()
+
+	addr, sink, stop, _, done := startDrainTestServer(t, 200*time.Millisecond)
+	resp, reader := openClaudeStream(t, addr)
+	interactionID := resp.Header.Get(trace.InteractionIDHeader)
+
+	stop()
+	rest, _ := io.ReadAll(reader)
+	waitServeDone(t, done)
+
+	body := string(rest)
+	if !strings.Contains(body, "event: error") || !strings.Contains(body, `"type":"overloaded_error"`) || !strings.Contains(body, openaihttp.ErrServerShuttingDown.Error()) {
+		t.Fatalf("stream tail missing shutdown error event: %q", body)
+	}
+	interaction, _, err := sink.GetInteraction(interactionID)
+	if err != nil {
+		t.Fatalf("GetInteraction: %v", err)
+	}
+	if interaction.FinishedAt == nil || !strings.Contains(interaction.ErrorSummary, "overloaded_error") {
+		t.Fatalf("interaction not finished with shutdown error: finished_at=%v error_summary=%q", interaction.FinishedAt, interaction.ErrorSummary)
+	}
+	if _, err := net.DialTimeout("tcp", addr, time.Second); err == nil {
+		t.Fatalf("listener still accepting connections after shutdown")
+	}
+}
+
+func TestServeUntilDone_LetsStreamsFinishBeforeDeadline(t *testing.T) {
+	t.Parallel()
+
+	addr, _, stop, release, done := startDrainTestServer(t, 10*time.Second)
+	_, reader := openClaudeStream(t, addr)
+
+	stop()
+	// 停机期间进行中的流不受影响，backend 结束后客户端收到完整的 message_stop。
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+	rest, _ := io.ReadAll(reader)
+	waitServeDone(t, done)
+
+	body := string(rest)
+	if strings.Contains(body, "event: error") || !strings.Contains(body, "event: message_stop") {
+		t.Fatalf("unexpected stream tail during graceful drain: %q", body)
+	}
+}
+
+func TestServeUntilDone_ClosesIdleWebSocketPromptly(t *testing.T) {
+	t.Parallel()
+
+	addr, _, stop, _, done := startDrainTestServer(t, 10*time.Second)
+	conn, _, err := websocket.DefaultDialer.Dial("ws://"+addr+"/v1/responses", nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+
+	start := time.Now()
+	stop()
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, _, err = conn.ReadMessage()
+	if !websocket.IsCloseError(err, websocket.CloseGoingAway) {
+		t.Fatalf("read error = %v, want going away close frame", err)
+	}
+	waitServeDone(t, done)
+	// 空闲连接不应拖住排空期（10s）。
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("drain took %s with an idle WebSocket client", elapsed)
+	}
+}
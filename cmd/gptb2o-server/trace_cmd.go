@@ -0,0 +1,418 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/LubyRuffy/gptb2o/trace"
+)
+
+const traceUsage = "usage: gptb2o-server trace <list|search|prune|export|replay> [flags]"
+
+// runTrace 处理 `gptb2o-server trace ...` 子命令。
+func runTrace(args []string, stdout io.Writer) error {
+	if len(args) == 0 {
+		return fmt.Errorf("%s", traceUsage)
+	}
+	switch args[0] {
+	case "list":
+		return runTraceList(args[1:], stdout, false)
+	case "search":
+		return runTraceList(args[1:], stdout, true)
+	case "prune":
+		return runTracePrune(args[1:], stdout)
+	case "export":
+		return runTraceExport(args[1:], stdout)
+	case "replay":
+		return runTraceReplay(args[1:], stdout)
+	default:
+		return fmt.Errorf("unknown trace command %q; %s", args[0], traceUsage)
+	}
+}
+
+// traceFilterFlags 是 list / search / export 共用的过滤参数。
+type traceFilterFlags struct {
+	since      *string
+	until      *string
+	clientAPI  *string
+	model      *string
+	status     *int
+	errorsOnly *bool
+	recovery   *bool
+	text       *string
+	limit      *int
+}
+
+func addTraceFilterFlags(flagSet *flag.FlagSet, defaultLimit int) *traceFilterFlags {
+	return &traceFilterFlags{
+		since:      flagSet.String("since", "", "only interactions started at or after this time (RFC3339, 2006-01-02 or a duration like 2h)"),
+		until:      flagSet.String("until", "", "only interactions started before this time (same formats as --since)"),
+		clientAPI:  flagSet.String("client-api", "", "filter by client api: openai|claude"),
+		model:      flagSet.String("model", "", "filter by model (substring match)"),
+		status:     flagSet.Int("status", 0, "filter by final http status code"),
+		errorsOnly: flagSet.Bool("errors", false, "only interactions with a non-empty error_summary"),
+		recovery:   flagSet.Bool("recovery", false, "only interactions with a non-empty recovery_summary"),
+		text:       flagSet.String("text", "", "free text searched in event bodies and summaries"),
+		limit:      flagSet.Int("limit", defaultLimit, "max interactions to return"),
+	}
+}
+
+func (f *traceFilterFlags) filter(now time.Time, text string) (trace.InteractionFilter, error) {
+	sinceTime, err := trace.ParseFilterTime(*f.since, now)
+	if err != nil {
+		return trace.InteractionFilter{}, fmt.Errorf("invalid --since: %w", err)
+	}
+	untilTime, err := trace.ParseFilterTime(*f.until, now)
+	if err != nil {
+		return trace.InteractionFilter{}, fmt.Errorf("invalid --until: %w", err)
+	}
+	return trace.InteractionFilter{
+		Since:       sinceTime,
+		Until:       untilTime,
+		ClientAPI:   *f.clientAPI,
+		Model:       *f.model,
+		StatusCode:  *f.status,
+		HasError:    *f.errorsOnly,
+		HasRecovery: *f.recovery,
+		Text:        text,
+		Limit:       *f.limit,
+	}, nil
+}
+
+// runTraceList 实现 trace list / trace search；search 额外接受一个位置参数作为全文搜索关键字。
+func runTraceList(args []string, stdout io.Writer, search bool) error {
+	var (
+		flagSet     = flag.NewFlagSet("gptb2o-server trace", flag.ContinueOnError)
+		traceDBPath = flagSet.String("trace-db-path", defaultTraceDBPath, "sqlite path for full-chain tracing")
+		filterFlags = addTraceFilterFlags(flagSet, 20)
+		format      = flagSet.String("format", "table", "output format: table|json")
+	)
+	flagSet.SetOutput(io.Discard)
+	positional, err := parseInterspersed(flagSet, args)
+	if err != nil {
+		return err
+	}
+
+	query := strings.TrimSpace(*filterFlags.text)
+	if search {
+		if rest := strings.TrimSpace(strings.Join(positional, " ")); rest != "" {
+			query = rest
+		}
+		if query == "" {
+			return fmt.Errorf("usage: gptb2o-server trace search <text> [flags]")
+		}
+	}
+
+	filter, err := filterFlags.filter(time.Now(), query)
+	if err != nil {
+		return err
+	}
+	outputFormat := strings.TrimSpace(*format)
+	if outputFormat != "table" && outputFormat != "json" {
+		return fmt.Errorf("invalid --format %q: want table|json", outputFormat)
+	}
+
+	store, err := openTraceStore(*traceDBPath)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = store.Close() }()
+
+	items, err := store.ListInteractions(filter)
+	if err != nil {
+		return err
+	}
+
+	if outputFormat == "json" {
+		return writeTraceListJSON(stdout, items)
+	}
+	return writeTraceListTable(stdout, items)
+}
+
+// runTraceExport 把指定或筛选出的 interaction 导出为 HAR / JSONL，可选按正则擦除内容。
+func runTraceExport(args []string, stdout io.Writer) error {
+	var (
+		ids           []string
+		scrub         []*regexp.Regexp
+		redactHeaders []string
+		flagSet       = flag.NewFlagSet("gptb2o-server trace export", flag.ContinueOnError)
+		traceDBPath   = flagSet.String("trace-db-path", defaultTraceDBPath, "sqlite path for full-chain tracing")
+		filterFlags   = addTraceFilterFlags(flagSet, 100)
+		format        = flagSet.String("format", "har", "output format: har|jsonl|recordings")
+		output        = flagSet.String("output", "", "write to this file instead of stdout")
+		omitBodies    = flagSet.Bool("omit-bodies", false, "drop request/response bodies and keep metadata only")
+	)
+	flagSet.Func("id", "interaction id to export (repeatable or comma separated)", func(v string) error {
+		for _, id := range strings.Split(v, ",") {
+			if id = strings.TrimSpace(id); id != "" {
+				ids = append(ids, id)
+			}
+		}
+		return nil
+	})
+	flagSet.Func("scrub", "regexp whose matches are replaced with [SCRUBBED] in bodies, urls and summaries (repeatable)", func(v string) error {
+		re, err := regexp.Compile(v)
+		if err != nil {
+			return err
+		}
+		scrub = append(scrub, re)
+		return nil
+	})
+	flagSet.Func("redact-header", "extra header name to redact (repeatable)", func(v string) error {
+		redactHeaders = append(redactHeaders, v)
+		return nil
+	})
+	flagSet.SetOutput(io.Discard)
+	if err := flagSet.Parse(args); err != nil {
+		return err
+	}
+	exportFormat := trace.ExportFormat(strings.TrimSpace(*format))
+	if exportFormat != trace.ExportHAR && exportFormat != trace.ExportJSONL && exportFormat != trace.ExportRecordings {
+		return fmt.Errorf("invalid --format %q: want har|jsonl|recordings", exportFormat)
+	}
+
+	filtered := false
+	flagSet.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "since", "until", "client-api", "model", "status", "errors", "recovery", "text":
+			filtered = true
+		}
+	})
+	if len(ids) == 0 && !filtered {
+		return fmt.Errorf("usage: gptb2o-server trace export --id <interaction_id> | <filter flags> [--format har|jsonl|recordings]")
+	}
+
+	store, err := openTraceStore(*traceDBPath)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = store.Close() }()
+
+	if len(ids) == 0 {
+		filter, err := filterFlags.filter(time.Now(), strings.TrimSpace(*filterFlags.text))
+		if err != nil {
+			return err
+		}
+		items, err := store.ListInteractions(filter)
+		if err != nil {
+			return err
+		}
+		for _, item := range items {
+			ids = append(ids, item.InteractionID)
+		}
+	}
+
+	w := stdout
+	if path := strings.TrimSpace(*output); path != "" {
+		file, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = file.Close() }()
+		w = file
+	}
+	return store.Export(w, ids, trace.ExportOptions{
+		Format:        exportFormat,
+		RedactHeaders: redactHeaders,
+		Scrub:         scrub,
+		OmitBodies:    *omitBodies,
+	})
+}
+
+func openTraceStore(path string) (*trace.Store, error) {
+	path = strings.TrimSpace(path)
+	if path == "" {
+		path = defaultTraceDBPath
+	}
+	return trace.OpenStore(path)
+}
+
+// runTracePrune 按保留策略一次性清理 trace 库，默认随后执行 VACUUM 缩小文件。
+func runTracePrune(args []string, stdout io.Writer) error {
+	var (
+		flagSet         = flag.NewFlagSet("gptb2o-server trace prune", flag.ContinueOnError)
+		traceDBPath     = flagSet.String("trace-db-path", defaultTraceDBPath, "sqlite path for full-chain tracing")
+		maxAge          = flagSet.Duration("max-age", 0, "delete interactions older than this duration (e.g. 168h)")
+		successMaxAge   = flagSet.Duration("success-max-age", 0, "delete successful interactions older than this duration; failed ones follow --max-age")
+		maxInteractions = flagSet.Int("max-interactions", 0, "keep only the newest N interactions")
+		maxDBMB         = flagSet.Int64("max-db-mb", 0, "delete oldest interactions until the data fits in this many MiB")
+		vacuum          = flagSet.Bool("vacuum", true, "run VACUUM after pruning to shrink the file")
+	)
+	flagSet.SetOutput(io.Discard)
+	if err := flagSet.Parse(args); err != nil {
+		return err
+	}
+	policy := trace.RetentionPolicy{
+		MaxAge:          *maxAge,
+		SuccessMaxAge:   *successMaxAge,
+		MaxInteractions: *maxInteractions,
+		MaxDBBytes:      *maxDBMB << 20,
+	}
+	if policy.IsZero() && !*vacuum {
+		return fmt.Errorf("nothing to do: set --max-age, --success-max-age, --max-interactions, --max-db-mb or --vacuum")
+	}
+
+	store, err := openTraceStore(*traceDBPath)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = store.Close() }()
+
+	before, err := store.FileBytes()
+	if err != nil {
+		return err
+	}
+	res, err := store.Prune(policy, time.Now())
+	if err != nil {
+		return err
+	}
+	if *vacuum {
+		if err := store.Vacuum(); err != nil {
+			return fmt.Errorf("vacuum trace db: %w", err)
+		}
+	}
+	after, err := store.FileBytes()
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(stdout, "pruned interactions=%d events=%d size=%d->%d bytes\n", res.Interactions, res.Events, before, after)
+	return err
+}
+
+// writeInteraction 按 --format 打印单个 interaction：transcript 为重组后的精简回放，
+// raw 为包含原始 headers/body 的完整报告，json 附带每条响应事件的 transcript。
+func writeInteraction(stdout io.Writer, sink trace.Sink, interactionID string, format string) error {
+	switch format {
+	case "", "transcript", "raw", "json":
+	default:
+		return fmt.Errorf("invalid --format %q: want transcript|raw|json", format)
+	}
+	interaction, events, err := sink.GetInteraction(interactionID)
+	if err != nil {
+		return err
+	}
+	switch format {
+	case "raw":
+		_, err = io.WriteString(stdout, trace.FormatInteractionReport(interaction, events))
+	case "json":
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(trace.NewInteractionJSON(interaction, events))
+	default:
+		_, err = io.WriteString(stdout, trace.FormatInteractionTranscript(interaction, events))
+	}
+	return err
+}
+
+// parseInterspersed 允许位置参数与 flag 混排，例如 `trace search timeout --errors`。
+func parseInterspersed(flagSet *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := flagSet.Parse(args); err != nil {
+			return nil, err
+		}
+		args = flagSet.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+type traceListRow struct {
+	InteractionID   string     `json:"interaction_id"`
+	Method          string     `json:"method"`
+	Path            string     `json:"path"`
+	ClientAPI       string     `json:"client_api"`
+	Model           string     `json:"model"`
+	Stream          bool       `json:"stream"`
+	StatusCode      int        `json:"status_code"`
+	ErrorSummary    string     `json:"error_summary,omitempty"`
+	RecoverySummary string     `json:"recovery_summary,omitempty"`
+	StartedAt       time.Time  `json:"started_at"`
+	FinishedAt      *time.Time `json:"finished_at,omitempty"`
+	DurationMs      *int64     `json:"duration_ms,omitempty"`
+}
+
+func newTraceListRow(item trace.Interaction) traceListRow {
+	row := traceListRow{
+		InteractionID:   item.InteractionID,
+		Method:          item.Method,
+		Path:            item.Path,
+		ClientAPI:       item.ClientAPI,
+		Model:           item.Model,
+		Stream:          item.Stream,
+		StatusCode:      item.StatusCode,
+		ErrorSummary:    item.ErrorSummary,
+		RecoverySummary: item.RecoverySummary,
+		StartedAt:       item.StartedAt,
+		FinishedAt:      item.FinishedAt,
+	}
+	if item.FinishedAt != nil {
+		ms := item.FinishedAt.Sub(item.StartedAt).Milliseconds()
+		row.DurationMs = &ms
+	}
+	return row
+}
+
+func writeTraceListJSON(w io.Writer, items []trace.Interaction) error {
+	rows := make([]traceListRow, 0, len(items))
+	for _, item := range items {
+		rows = append(rows, newTraceListRow(item))
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(rows)
+}
+
+func writeTraceListTable(w io.Writer, items []trace.Interaction) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "STARTED_AT\tINTERACTION_ID\tCLIENT\tMODEL\tSTATUS\tDURATION\tPATH\tSUMMARY")
+	for _, item := range items {
+		row := newTraceListRow(item)
+		duration := "-"
+		if row.DurationMs != nil {
+			duration = fmt.Sprintf("%dms", *row.DurationMs)
+		}
+		summary := strings.TrimSpace(strings.Join(nonEmpty(row.ErrorSummary, row.RecoverySummary), " | "))
+		_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d\t%s\t%s %s\t%s\n",
+			row.StartedAt.Local().Format("2006-01-02 15:04:05"),
+			row.InteractionID,
+			row.ClientAPI,
+			row.Model,
+			row.StatusCode,
+			duration,
+			row.Method,
+			row.Path,
+			truncateTraceCell(summary, 80),
+		)
+	}
+	return tw.Flush()
+}
+
+func nonEmpty(values ...string) []string {
+	out := make([]string, 0, len(values))
+	for _, v := range values {
+		if strings.TrimSpace(v) != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+func truncateTraceCell(s string, max int) string {
+	s = strings.ReplaceAll(s, "\n", " ")
+	runes := []rune(s)
+	if len(runes) <= max {
+		return s
+	}
+	return string(runes[:max]) + "..."
+}
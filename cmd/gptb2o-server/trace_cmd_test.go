@@ -0,0 +1,252 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/LubyRuffy/gptb2o/trace"
+)
+
+func seedTraceCLIStore(t *testing.T) string {
+	t.Helper()
+
+	dbPath := filepath.Join(t.TempDir(), "trace.db")
+	store, err := trace.OpenStore(dbPath)
+	if err != nil {
+		t.Fatalf("OpenStore() error = %v", err)
+	}
+	defer func() {
+		if closeErr := store.Close(); closeErr != nil {
+			t.Fatalf("Close() error = %v", closeErr)
+		}
+	}()
+
+	seed := []struct {
+		id     string
+		api    string
+		status int
+		errSum string
+		body   string
+	}{
+		{id: "ia_ok", api: "openai", status: http.StatusOK, body: `{"input":"plain request"}`},
+		{id: "ia_fail", api: "claude", status: http.StatusBadGateway, errSum: "api_error: upstream timeout", body: `{"messages":"needle here"}`},
+	}
+	for i, s := range seed {
+		if err := store.StartInteraction(trace.Interaction{
+			InteractionID: s.id,
+			Method:        http.MethodPost,
+			Path:          "/v1/messages",
+			ClientAPI:     s.api,
+			Model:         "gpt-5.4",
+			StartedAt:     time.Now().Add(time.Duration(i) * time.Second),
+		}); err != nil {
+			t.Fatalf("StartInteraction() error = %v", err)
+		}
+		if err := store.AppendEvent(trace.InteractionEvent{
+			InteractionID: s.id,
+			Seq:           1,
+			Kind:          trace.EventClientRequest,
+			Body:          s.body,
+		}); err != nil {
+			t.Fatalf("AppendEvent() error = %v", err)
+		}
+		if err := store.FinishInteraction(s.id, s.status, s.errSum); err != nil {
+			t.Fatalf("FinishInteraction() error = %v", err)
+		}
+	}
+	return dbPath
+}
+
+func TestRun_TraceList_Table(t *testing.T) {
+	t.Parallel()
+
+	dbPath := seedTraceCLIStore(t)
+	var stdout bytes.Buffer
+	if err := run([]string{"trace", "list", "--trace-db-path", dbPath, "--errors"}, &stdout); err != nil {
+		t.Fatalf("run() error = %v", err)
+	}
+	got := stdout.String()
+	if !strings.Contains(got, "INTERACTION_ID") || !strings.Contains(got, "ia_fail") {
+		t.Fatalf("trace list output missing failed interaction, got:\n%s", got)
+	}
+	if strings.Contains(got, "ia_ok") {
+		t.Fatalf("trace list --errors should skip successful interaction, got:\n%s", got)
+	}
+	if !strings.Contains(got, "api_error: upstream timeout") {
+		t.Fatalf("trace list output missing error_summary, got:\n%s", got)
+	}
+}
+
+func TestRun_TraceSearch_JSON(t *testing.T) {
+	t.Parallel()
+
+	dbPath := seedTraceCLIStore(t)
+	var stdout bytes.Buffer
+	if err := run([]string{"trace", "search", "needle", "--trace-db-path", dbPath, "--format", "json"}, &stdout); err != nil {
+		t.Fatalf("run() error = %v", err)
+	}
+	var rows []struct {
+		InteractionID string `json:"interaction_id"`
+		StatusCode    int    `json:"status_code"`
+		DurationMs    *int64 `json:"duration_ms"`
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &rows); err != nil {
+		t.Fatalf("json output invalid: %v\n%s", err, stdout.String())
+	}
+	if len(rows) != 1 || rows[0].InteractionID != "ia_fail" || rows[0].StatusCode != http.StatusBadGateway {
+		t.Fatalf("unexpected search rows: %+v", rows)
+	}
+	if rows[0].DurationMs == nil {
+		t.Fatalf("duration_ms should be set for finished interaction")
+	}
+
+	if err := run([]string{"trace", "search", "--trace-db-path", dbPath}, &stdout); err == nil {
+		t.Fatalf("trace search without text should fail")
+	}
+}
+
+func TestRun_TracePrune_KeepsFailedInteractions(t *testing.T) {
+	t.Parallel()
+
+	dbPath := seedTraceCLIStore(t)
+	var stdout bytes.Buffer
+	if err := run([]string{"trace", "prune", "--trace-db-path", dbPath, "--success-max-age", "1ns"}, &stdout); err != nil {
+		t.Fatalf("run() error = %v", err)
+	}
+	if !strings.Contains(stdout.String(), "pruned interactions=1 events=1") {
+		t.Fatalf("unexpected prune output: %s", stdout.String())
+	}
+
+	stdout.Reset()
+	if err := run([]string{"trace", "list", "--trace-db-path", dbPath, "--format", "json"}, &stdout); err != nil {
+		t.Fatalf("run() error = %v", err)
+	}
+	if strings.Contains(stdout.String(), "ia_ok") || !strings.Contains(stdout.String(), "ia_fail") {
+		t.Fatalf("prune should keep only failed interaction, got:\n%s", stdout.String())
+	}
+}
+
+func TestRun_TraceExport_HARToFile(t *testing.T) {
+	t.Parallel()
+
+	dbPath := seedTraceCLIStore(t)
+	outPath := filepath.Join(t.TempDir(), "export.har")
+	var stdout bytes.Buffer
+	if err := run([]string{"trace", "export", "--trace-db-path", dbPath, "--errors", "--output", outPath, "--scrub", "needle"}, &stdout); err != nil {
+		t.Fatalf("run() error = %v", err)
+	}
+	data, err := os.ReadFile(outPath)
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	if !strings.Contains(string(data), "ia_fail") || strings.Contains(string(data), "ia_ok") {
+		t.Fatalf("export should contain only the failed interaction, got:\n%s", data)
+	}
+	if strings.Contains(string(data), "needle") || !strings.Contains(string(data), "[SCRUBBED]") {
+		t.Fatalf("export should scrub matched content, got:\n%s", data)
+	}
+
+	stdout.Reset()
+	if err := run([]string{"trace", "export", "--trace-db-path", dbPath, "--id", "ia_ok", "--format", "jsonl"}, &stdout); err != nil {
+		t.Fatalf("run() error = %v", err)
+	}
+	if lines := strings.Split(strings.TrimSpace(stdout.String()), "\n"); len(lines) != 1 || !strings.Contains(lines[0], `"interaction_id":"ia_ok"`) {
+		t.Fatalf("unexpected jsonl export: %s", stdout.String())
+	}
+
+	if err := run([]string{"trace", "export", "--trace-db-path", dbPath}, &stdout); err == nil {
+		t.Fatalf("trace export without --id or filters should fail")
+	}
+}
+
+func TestRun_TraceReplay_DiffsAgainstStandInBackend(t *testing.T) {
+	t.Setenv("GPTB2O_ACCESS_TOKEN", "token")
+
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = io.WriteString(w, "data: {\"type\":\"response.output_text.delta\",\"delta\":\"new answer\"}\n\n")
+		_, _ = io.WriteString(w, "data: {\"type\":\"response.completed\",\"response\":{\"status\":\"completed\"}}\n\n")
+	}))
+	t.Cleanup(backend.Close)
+
+	dbPath := filepath.Join(t.TempDir(), "trace.db")
+	store, err := trace.OpenStore(dbPath)
+	if err != nil {
+		t.Fatalf("OpenStore() error = %v", err)
+	}
+	seed := []struct {
+		id        string
+		truncated bool
+	}{{id: "ia_replay_src"}, {id: "ia_replay_truncated", truncated: true}}
+	for _, s := range seed {
+		if err := store.StartInteraction(trace.Interaction{InteractionID: s.id, Method: http.MethodPost, Path: "/v1/chat/completions", ClientAPI: "openai", StatusCode: http.StatusOK}); err != nil {
+			t.Fatalf("StartInteraction() error = %v", err)
+		}
+		if err := store.AppendEvent(trace.InteractionEvent{
+			InteractionID: s.id,
+			Kind:          trace.EventClientRequest,
+			Method:        http.MethodPost,
+			Path:          "/v1/chat/completions",
+			URL:           "/v1/chat/completions",
+			HeadersJSON:   `{"Authorization":["[REDACTED]"],"Content-Type":["application/json"]}`,
+			Body:          `{"model":"gpt-5.4","messages":[{"role":"user","content":"hi"}],"stream":true}`,
+			BodyTruncated: s.truncated,
+		}); err != nil {
+			t.Fatalf("AppendEvent() error = %v", err)
+		}
+		if err := store.AppendEvent(trace.InteractionEvent{
+			InteractionID: s.id,
+			Kind:          trace.EventClientResponse,
+			StatusCode:    http.StatusOK,
+			ContentType:   "text/event-stream",
+			Body:          "data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\"old answer\"}}]}\n\ndata: {\"choices\":[{\"index\":0,\"delta\":{},\"finish_reason\":\"stop\"}]}\n\ndata: [DONE]\n\n",
+		}); err != nil {
+			t.Fatalf("AppendEvent() error = %v", err)
+		}
+		if err := store.FinishInteraction(s.id, http.StatusOK, ""); err != nil {
+			t.Fatalf("FinishInteraction() error = %v", err)
+		}
+	}
+	if err := store.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	var stdout bytes.Buffer
+	args := []string{"trace", "replay", "ia_replay_src", "--trace-db-path", dbPath, "--backend-url", backend.URL, "--auth-source", "env", "--format", "json"}
+	if err := run(args, &stdout); err != nil {
+		t.Fatalf("run() error = %v", err)
+	}
+	var diff trace.InteractionDiff
+	if err := json.Unmarshal(stdout.Bytes(), &diff); err != nil {
+		t.Fatalf("json output invalid: %v\n%s", err, stdout.String())
+	}
+	if diff.StatusChanged || !diff.TextChanged || diff.Replay.Text != "new answer" || diff.TextDivergeAt != 0 {
+		t.Fatalf("unexpected diff: %+v", diff)
+	}
+
+	store, err = trace.OpenStore(dbPath)
+	if err != nil {
+		t.Fatalf("OpenStore() error = %v", err)
+	}
+	defer func() { _ = store.Close() }()
+	replay, _, err := store.GetInteraction(diff.Replay.InteractionID)
+	if err != nil {
+		t.Fatalf("GetInteraction() error = %v", err)
+	}
+	if replay.ReplayOf != "ia_replay_src" {
+		t.Fatalf("replay_of = %q, want ia_replay_src", replay.ReplayOf)
+	}
+
+	err = run([]string{"trace", "replay", "ia_replay_truncated", "--trace-db-path", dbPath, "--backend-url", backend.URL, "--auth-source", "env"}, &stdout)
+	if err == nil || !strings.Contains(err.Error(), "truncated") {
+		t.Fatalf("replay of truncated request should fail, got %v", err)
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"github.com/LubyRuffy/gptb2o/auth"
+	"github.com/LubyRuffy/gptb2o/openaihttp"
+	"github.com/LubyRuffy/gptb2o/trace"
+)
+
+// replayEndpoints 用于从原始 path 推回 base path，兼容以非默认 --base-path 记录的 trace。
+var replayEndpoints = []string{"/chat/completions", "/responses", "/messages/count_tokens", "/messages"}
+
+// replaySkippedHeaders 不随重放转发：由 http 包或本次请求重新生成。
+var replaySkippedHeaders = map[string]struct{}{
+	"Content-Length":  {},
+	"Accept-Encoding": {},
+	"Connection":      {},
+	"Host":            {},
+}
+
+// runTraceReplay 用当前的 openaihttp handler 重放已记录的 client_request，并把新旧结果做结构化对比。
+func runTraceReplay(args []string, stdout io.Writer) error {
+	var (
+		flagSet         = flag.NewFlagSet("gptb2o-server trace replay", flag.ContinueOnError)
+		traceDBPath     = flagSet.String("trace-db-path", defaultTraceDBPath, "sqlite path for full-chain tracing")
+		backendURL      = flagSet.String("backend-url", "", "chatgpt backend responses url (default: https://chatgpt.com/backend-api/codex/responses)")
+		authSource      = flagSet.String("auth-source", "codex", "auth source: codex|opencode|env|auto")
+		originator      = flagSet.String("originator", "", "Originator/User-Agent header (default: codex_cli_rs)")
+		reasoningEffort = flagSet.String("reasoning-effort", "", "default reasoning effort forwarded to backend")
+		timeout         = flagSet.Duration("timeout", 10*time.Minute, "max duration of the replayed request")
+		format          = flagSet.String("format", "text", "diff output format: text|json")
+	)
+	flagSet.SetOutput(io.Discard)
+	positional, err := parseInterspersed(flagSet, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return fmt.Errorf("usage: gptb2o-server trace replay <interaction_id> [flags]")
+	}
+	originalID := strings.TrimSpace(positional[0])
+	outputFormat := strings.TrimSpace(*format)
+	if outputFormat != "text" && outputFormat != "json" {
+		return fmt.Errorf("invalid --format %q: want text|json", outputFormat)
+	}
+
+	store, err := openTraceStore(*traceDBPath)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = store.Close() }()
+
+	original, originalEvents, err := store.GetInteraction(originalID)
+	if err != nil {
+		return fmt.Errorf("load interaction %s: %w", originalID, err)
+	}
+	request, err := trace.ReplayableRequest(originalEvents)
+	if err != nil {
+		return fmt.Errorf("interaction %s cannot be replayed: %w", originalID, err)
+	}
+	basePath, ok := replayBasePath(request.Path)
+	if !ok {
+		return fmt.Errorf("interaction %s cannot be replayed: unsupported path %q", originalID, request.Path)
+	}
+
+	provider, err := auth.NewProvider(*authSource)
+	if err != nil {
+		return fmt.Errorf("invalid auth-source: %w", err)
+	}
+	handler, err := openaihttp.NewHandler(openaihttp.Config{
+		BasePath:        basePath,
+		BackendURL:      *backendURL,
+		Originator:      *originator,
+		ReasoningEffort: *reasoningEffort,
+		Tracer:          trace.NewTracer(store, trace.TracerOptions{MaxBodyBytes: len(request.Body) + (64 << 10)}),
+		AuthProvider: func(ctx context.Context) (string, string, error) {
+			return provider.Auth(ctx)
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(trace.ContextWithReplayOf(context.Background(), originalID), *timeout)
+	defer cancel()
+	target := request.URL
+	if target == "" {
+		target = request.Path
+	}
+	req, err := http.NewRequestWithContext(ctx, request.Method, target, strings.NewReader(request.Body))
+	if err != nil {
+		return err
+	}
+	var headers http.Header
+	if strings.TrimSpace(request.HeadersJSON) != "" {
+		if err := json.Unmarshal([]byte(request.HeadersJSON), &headers); err != nil {
+			return fmt.Errorf("decode recorded headers: %w", err)
+		}
+	}
+	for key, values := range headers {
+		if _, skip := replaySkippedHeaders[http.CanonicalHeaderKey(key)]; skip {
+			continue
+		}
+		for _, value := range values {
+			// 已脱敏的头（如 Authorization）不转发，鉴权统一走 --auth-source。
+			if value != "[REDACTED]" {
+				req.Header.Add(key, value)
+			}
+		}
+	}
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+	replayID := recorder.Header().Get(trace.InteractionIDHeader)
+	if replayID == "" {
+		return fmt.Errorf("replay did not produce a traced interaction (status %d)", recorder.Code)
+	}
+	store.Flush()
+	replay, replayEvents, err := store.GetInteraction(replayID)
+	if err != nil {
+		return fmt.Errorf("load replay interaction %s: %w", replayID, err)
+	}
+
+	diff := trace.DiffInteractions(trace.OutcomeOf(original, originalEvents), trace.OutcomeOf(replay, replayEvents))
+	if outputFormat == "json" {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(diff)
+	}
+	_, err = io.WriteString(stdout, trace.FormatInteractionDiff(diff))
+	return err
+}
+
+func replayBasePath(path string) (string, bool) {
+	for _, endpoint := range replayEndpoints {
+		if strings.HasSuffix(path, endpoint) {
+			return strings.TrimSuffix(path, endpoint), true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,178 @@
+// Package metrics 提供 gptb2o-server 的 Prometheus 指标：请求量与时延、首 token 时间、
+// backend 降级重试、token 用量、活跃流与流中途错误。
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultPath 是 gptb2o-server 暴露指标的默认路径。
+const DefaultPath = "/metrics"
+
+// 路由标签取值，对应四个会调用 backend 的入口。
+const (
+	RouteChatCompletions = "chat_completions"
+	RouteResponses       = "responses"
+	RouteMessages        = "messages"
+	RouteCountTokens     = "count_tokens"
+)
+
+// Token 类型标签取值。
+const (
+	TokenTypeInput     = "input"
+	TokenTypeOutput    = "output"
+	TokenTypeReasoning = "reasoning"
+)
+
+var (
+	// latencyBuckets 覆盖非流式短请求到长时间推理（最长 10 分钟）。
+	latencyBuckets = []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300, 600}
+	ttftBuckets    = []float64{0.1, 0.25, 0.5, 1, 2, 3, 5, 10, 20, 30, 60}
+)
+
+// Labels 是一次请求的公共标签；Model 应已归一化为受支持的模型 ID，避免标签基数失控。
+type Labels struct {
+	Route     string
+	Model     string
+	ClientAPI string
+}
+
+type labelsContextKey struct{}
+
+// ContextWithLabels 把请求标签放入 context，供 backend transport 与重试回调读取。
+func ContextWithLabels(ctx context.Context, labels Labels) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return context.WithValue(ctx, labelsContextKey{}, labels)
+}
+
+func LabelsFromContext(ctx context.Context) (Labels, bool) {
+	if ctx == nil {
+		return Labels{}, false
+	}
+	labels, ok := ctx.Value(labelsContextKey{}).(Labels)
+	return labels, ok
+}
+
+// Metrics 是 gptb2o 的指标集合。nil *Metrics 的方法均为空操作，调用方无需判空。
+type Metrics struct {
+	registry *Registry
+
+	requests        *CounterVec
+	requestDuration *HistogramVec
+	firstToken      *HistogramVec
+	backendRetries  *CounterVec
+	tokens          *CounterVec
+	activeStreams   *GaugeVec
+	streamErrors    *CounterVec
+
+	traceDropped atomic.Pointer[func() uint64]
+}
+
+func New() *Metrics {
+	r := NewRegistry()
+	m := &Metrics{
+		registry: r,
+		requests: r.NewCounterVec("gptb2o_requests_total",
+			"Completed client requests by route, model, client API and HTTP status.",
+			"route", "model", "client_api", "status"),
+		requestDuration: r.NewHistogramVec("gptb2o_request_duration_seconds",
+			"Client request latency from receipt to the last response byte.",
+			latencyBuckets, "route", "model", "client_api"),
+		firstToken: r.NewHistogramVec("gptb2o_time_to_first_token_seconds",
+			"Time from request receipt to the first text delta written to the client.",
+			ttftBuckets, "route", "model", "client_api"),
+		backendRetries: r.NewCounterVec("gptb2o_backend_retries_total",
+			"Backend requests retried after a 400, by fallback reason.",
+			"route", "model", "reason"),
+		tokens: r.NewCounterVec("gptb2o_tokens_total",
+			"Tokens reported in backend response usage, by type (input, output, reasoning).",
+			"route", "model", "client_api", "type"),
+		activeStreams: r.NewGaugeVec("gptb2o_active_streams",
+			"Streaming client requests currently in flight.",
+			"route", "model", "client_api"),
+		streamErrors: r.NewCounterVec("gptb2o_stream_errors_total",
+			"SSE `event: error` events written to clients mid-stream.",
+			"route", "model", "client_api"),
+	}
+	r.NewCounterFunc("gptb2o_trace_dropped_writes_total",
+		"Trace writes dropped because the write queue was full, the write failed or the sink was closed.",
+		m.traceDroppedWrites)
+	return m
+}
+
+// Handler 返回 /metrics 的 http.Handler。
+func (m *Metrics) Handler() http.Handler {
+	if m == nil {
+		return http.NotFoundHandler()
+	}
+	return m.registry.Handler()
+}
+
+// TrackTraceDroppedWrites 让 gptb2o_trace_dropped_writes_total 读取 fn 的返回值，通常传入 trace sink 的 DroppedWrites。
+func (m *Metrics) TrackTraceDroppedWrites(fn func() uint64) {
+	if m == nil || fn == nil {
+		return
+	}
+	m.traceDropped.Store(&fn)
+}
+
+func (m *Metrics) traceDroppedWrites() float64 {
+	if fn := m.traceDropped.Load(); fn != nil {
+		return float64((*fn)())
+	}
+	return 0
+}
+
+// StreamStarted 在流式请求开始时调用，须与 StreamFinished 成对出现。
+func (m *Metrics) StreamStarted(labels Labels) {
+	if m == nil {
+		return
+	}
+	m.activeStreams.Inc(labels.Route, labels.Model, labels.ClientAPI)
+}
+
+func (m *Metrics) StreamFinished(labels Labels) {
+	if m == nil {
+		return
+	}
+	m.activeStreams.Dec(labels.Route, labels.Model, labels.ClientAPI)
+}
+
+// RequestFinished 记录一次请求的状态码与总时延；firstToken < 0 表示未观测到文本增量。
+func (m *Metrics) RequestFinished(labels Labels, status int, duration time.Duration, firstToken time.Duration, streamErrors int) {
+	if m == nil {
+		return
+	}
+	m.requests.Inc(labels.Route, labels.Model, labels.ClientAPI, strconv.Itoa(status))
+	m.requestDuration.Observe(duration.Seconds(), labels.Route, labels.Model, labels.ClientAPI)
+	if firstToken >= 0 {
+		m.firstToken.Observe(firstToken.Seconds(), labels.Route, labels.Model, labels.ClientAPI)
+	}
+	if streamErrors > 0 {
+		m.streamErrors.Add(float64(streamErrors), labels.Route, labels.Model, labels.ClientAPI)
+	}
+}
+
+// BackendRetry 记录一次 backend 降级重试，reason 取 backend.RetryReason 的值。
+func (m *Metrics) BackendRetry(labels Labels, reason string) {
+	if m == nil {
+		return
+	}
+	m.backendRetries.Inc(labels.Route, labels.Model, reason)
+}
+
+// Tokens 累加 backend usage 中的 token 数。
+func (m *Metrics) Tokens(labels Labels, input, output, reasoning int64) {
+	if m == nil {
+		return
+	}
+	m.tokens.Add(float64(input), labels.Route, labels.Model, labels.ClientAPI, TokenTypeInput)
+	m.tokens.Add(float64(output), labels.Route, labels.Model, labels.ClientAPI, TokenTypeOutput)
+	m.tokens.Add(float64(reasoning), labels.Route, labels.Model, labels.ClientAPI, TokenTypeReasoning)
+}
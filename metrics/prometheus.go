@@ -0,0 +1,268 @@
+package metrics
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ContentType 是 Prometheus text exposition format 0.0.4 的响应类型。
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Registry 按注册顺序输出指标族。只实现 gptb2o 需要的 counter / gauge / histogram，
+// 避免为一个 /metrics 端点引入 client_golang 及其依赖。
+type Registry struct {
+	mu       sync.Mutex
+	families []*vec
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+type metricKind string
+
+const (
+	kindCounter   metricKind = "counter"
+	kindGauge     metricKind = "gauge"
+	kindHistogram metricKind = "histogram"
+)
+
+// vec 是一个指标族，按标签值组合保存 series；三种指标类型共用。
+type vec struct {
+	name    string
+	help    string
+	kind    metricKind
+	labels  []string
+	buckets []float64
+	// valueFunc 非 nil 时该指标族没有标签，输出时调用它取值。
+	valueFunc func() float64
+
+	mu     sync.Mutex
+	series map[string]*series
+}
+
+type series struct {
+	labelValues []string
+	value       float64
+	// 以下字段仅 histogram 使用；bucketCounts 为非累计计数，输出时再累加。
+	bucketCounts []uint64
+	sum          float64
+	count        uint64
+}
+
+func (r *Registry) register(name, help string, kind metricKind, buckets []float64, labels []string) *vec {
+	v := &vec{
+		name:    name,
+		help:    help,
+		kind:    kind,
+		labels:  append([]string(nil), labels...),
+		buckets: buckets,
+		series:  make(map[string]*series),
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, existing := range r.families {
+		if existing.name == name {
+			panic(fmt.Sprintf("metrics: duplicate metric %q", name))
+		}
+	}
+	r.families = append(r.families, v)
+	return v
+}
+
+// with 返回标签值对应的 series，调用方持有 v.mu。标签数不符属于编程错误，直接 panic。
+func (v *vec) with(values []string) *series {
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", v.name, len(v.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+	s, ok := v.series[key]
+	if !ok {
+		s = &series{labelValues: append([]string(nil), values...)}
+		if v.kind == kindHistogram {
+			s.bucketCounts = make([]uint64, len(v.buckets))
+		}
+		v.series[key] = s
+	}
+	return s
+}
+
+func (v *vec) add(delta float64, values []string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.with(values).value += delta
+}
+
+// CounterVec 是只增不减的计数器族。
+type CounterVec struct{ v *vec }
+
+func (r *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	return &CounterVec{v: r.register(name, help, kindCounter, nil, labels)}
+}
+
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.v.add(1, labelValues)
+}
+
+// Add 累加 delta；负数会被忽略，counter 不允许减少。
+func (c *CounterVec) Add(delta float64, labelValues ...string) {
+	if delta < 0 {
+		return
+	}
+	c.v.add(delta, labelValues)
+}
+
+// NewCounterFunc 注册一个无标签的 counter，输出时调用 fn 取值，用于转发其他组件自行维护的累计计数。
+func (r *Registry) NewCounterFunc(name, help string, fn func() float64) {
+	v := r.register(name, help, kindCounter, nil, nil)
+	v.mu.Lock()
+	v.valueFunc = fn
+	v.mu.Unlock()
+}
+
+// GaugeVec 是可增可减的瞬时值族。
+type GaugeVec struct{ v *vec }
+
+func (r *Registry) NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	return &GaugeVec{v: r.register(name, help, kindGauge, nil, labels)}
+}
+
+func (g *GaugeVec) Inc(labelValues ...string) { g.v.add(1, labelValues) }
+
+func (g *GaugeVec) Dec(labelValues ...string) { g.v.add(-1, labelValues) }
+
+// HistogramVec 是按固定上界分桶的直方图族。
+type HistogramVec struct{ v *vec }
+
+// NewHistogramVec 创建直方图族；buckets 为递增的上界，+Inf 桶自动追加。
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	sorted := append([]float64(nil), buckets...)
+	sort.Float64s(sorted)
+	return &HistogramVec{v: r.register(name, help, kindHistogram, sorted, labels)}
+}
+
+func (h *HistogramVec) Observe(value float64, labelValues ...string) {
+	h.v.mu.Lock()
+	defer h.v.mu.Unlock()
+	s := h.v.with(labelValues)
+	if idx := sort.SearchFloat64s(h.v.buckets, value); idx < len(h.v.buckets) {
+		s.bucketCounts[idx]++
+	}
+	s.sum += value
+	s.count++
+}
+
+// WriteText 以 Prometheus 文本格式写出全部指标；同一指标族内的 series 按标签值排序，输出稳定。
+func (r *Registry) WriteText(w io.Writer) error {
+	r.mu.Lock()
+	families := append([]*vec(nil), r.families...)
+	r.mu.Unlock()
+
+	bw := bufio.NewWriter(w)
+	for _, v := range families {
+		v.writeText(bw)
+	}
+	return bw.Flush()
+}
+
+func (v *vec) writeText(w *bufio.Writer) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n", v.name, escapeHelp(v.help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", v.name, v.kind)
+	if v.valueFunc != nil {
+		fmt.Fprintf(w, "%s %s\n", v.name, formatFloat(v.valueFunc()))
+		return
+	}
+	keys := make([]string, 0, len(v.series))
+	for key := range v.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		s := v.series[key]
+		if v.kind != kindHistogram {
+			fmt.Fprintf(w, "%s%s %s\n", v.name, formatLabels(v.labels, s.labelValues, "", ""), formatFloat(s.value))
+			continue
+		}
+		var cumulative uint64
+		for i, upper := range v.buckets {
+			cumulative += s.bucketCounts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", v.name, formatLabels(v.labels, s.labelValues, "le", formatFloat(upper)), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", v.name, formatLabels(v.labels, s.labelValues, "le", "+Inf"), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", v.name, formatLabels(v.labels, s.labelValues, "", ""), formatFloat(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", v.name, formatLabels(v.labels, s.labelValues, "", ""), s.count)
+	}
+}
+
+// Handler 返回输出全部指标的 http.Handler，可直接挂到 GET /metrics。
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		var buf bytes.Buffer
+		if err := r.WriteText(&buf); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", ContentType)
+		_, _ = w.Write(buf.Bytes())
+	})
+}
+
+func formatLabels(names, values []string, extraName, extraValue string) string {
+	if len(names) == 0 && extraName == "" {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(name)
+		b.WriteString(`="`)
+		b.WriteString(escapeLabelValue(values[i]))
+		b.WriteByte('"')
+	}
+	if extraName != "" {
+		if len(names) > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(extraName)
+		b.WriteString(`="`)
+		b.WriteString(extraValue)
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+var (
+	labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	helpEscaper       = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+)
+
+func escapeLabelValue(s string) string { return labelValueEscaper.Replace(s) }
+
+func escapeHelp(s string) string { return helpEscaper.Replace(s) }
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	case math.IsNaN(f):
+		return "NaN"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
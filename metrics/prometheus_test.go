@@ -0,0 +1,78 @@
+package metrics
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistry_WriteText(t *testing.T) {
+	t.Parallel()
+
+	r := NewRegistry()
+	counter := r.NewCounterVec("demo_total", "Demo counter.", "kind")
+	gauge := r.NewGaugeVec("demo_active", "Demo gauge.")
+	histogram := r.NewHistogramVec("demo_seconds", "Demo histogram.", []float64{1, 0.5}, "route")
+
+	counter.Inc(`a"b\c`)
+	counter.Add(2, "z")
+	counter.Add(-5, "z")
+	gauge.Inc()
+	gauge.Inc()
+	gauge.Dec()
+	histogram.Observe(0.5, "x")
+	histogram.Observe(0.7, "x")
+	histogram.Observe(3, "x")
+
+	var buf bytes.Buffer
+	require.NoError(t, r.WriteText(&buf))
+	require.Equal(t, `# HELP demo_total Demo counter.
+# TYPE demo_total counter
+demo_total{kind="a\"b\\c"} 1
+demo_total{kind="z"} 2
+# HELP demo_active Demo gauge.
+# TYPE demo_active gauge
+demo_active 1
+# HELP demo_seconds Demo histogram.
+# TYPE demo_seconds histogram
+demo_seconds_bucket{route="x",le="0.5"} 1
+demo_seconds_bucket{route="x",le="1"} 2
+demo_seconds_bucket{route="x",le="+Inf"} 3
+demo_seconds_sum{route="x"} 4.2
+demo_seconds_count{route="x"} 3
+`, buf.String())
+
+	require.Panics(t, func() { counter.Inc("a", "b") })
+	require.Panics(t, func() { r.NewGaugeVec("demo_active", "dup") })
+}
+
+func TestMetrics_NilIsNoop(t *testing.T) {
+	t.Parallel()
+
+	var m *Metrics
+	labels := Labels{Route: RouteMessages, Model: "gpt-5.5", ClientAPI: "claude"}
+	m.StreamStarted(labels)
+	m.StreamFinished(labels)
+	m.RequestFinished(labels, 200, 0, -1, 1)
+	m.BackendRetry(labels, "sampling_param")
+	m.Tokens(labels, 1, 2, 3)
+	m.TrackTraceDroppedWrites(func() uint64 { return 1 })
+	require.NotNil(t, m.Handler())
+}
+
+func TestMetrics_TraceDroppedWrites(t *testing.T) {
+	t.Parallel()
+
+	m := New()
+	var buf bytes.Buffer
+	require.NoError(t, m.registry.WriteText(&buf))
+	require.Contains(t, buf.String(), "# TYPE gptb2o_trace_dropped_writes_total counter\ngptb2o_trace_dropped_writes_total 0\n")
+
+	dropped := uint64(0)
+	m.TrackTraceDroppedWrites(func() uint64 { return dropped })
+	dropped = 3
+	buf.Reset()
+	require.NoError(t, m.registry.WriteText(&buf))
+	require.Contains(t, buf.String(), "gptb2o_trace_dropped_writes_total 3\n")
+}
@@ -5,6 +5,8 @@ import "strings"
 const (
 	// DefaultBackendURL 是 ChatGPT Backend responses SSE 接口的默认地址。
 	DefaultBackendURL = "https://chatgpt.com/backend-api/codex/responses"
+	// DefaultModelsURL 是 Codex CLI 查询账号可用模型列表的 backend 地址。
+	DefaultModelsURL = "https://chatgpt.com/backend-api/codex/models"
 	// DefaultOriginator 会同时用于 Originator 与 User-Agent。
 	DefaultOriginator = "codex_cli_rs"
 
@@ -19,41 +21,18 @@ const (
 	DefaultModelFullID = ModelNamespace + DefaultModelID
 )
 
-type presetModelDef struct {
-	ID   string
-	Name string
-}
-
-// 使用固定顺序，确保客户端“默认选中第一项”时稳定得到 DefaultModelID。
-var presetModelDefs = []presetModelDef{
-	{ID: "gpt-5.5", Name: "GPT-5.5"},
-	{ID: "gpt-5.4", Name: "GPT-5.4"},
-	{ID: "gpt-5.4-mini", Name: "GPT-5.4 Mini"},
-	{ID: "gpt-5.3-codex-spark", Name: "GPT-5.3 Codex Spark"},
-	{ID: "gpt-5.3-codex", Name: "GPT-5.3 Codex"},
-	{ID: "gpt-5.2-codex", Name: "GPT-5.2 Codex"},
-	{ID: "gpt-5.2", Name: "GPT-5.2"},
-}
-
-var presetModelNameByID = func() map[string]string {
-	out := make(map[string]string, len(presetModelDefs))
-	for _, m := range presetModelDefs {
-		out[m.ID] = m.Name
-	}
-	return out
-}()
-
 type PresetModel struct {
 	ID   string
 	Name string
 }
 
-// PresetModels 返回内置的模型列表（用于 /v1/models 输出）。
-// 返回的 ID 使用 ModelNamespace。
+// PresetModels 返回内置模型列表，返回的 ID 使用 ModelNamespace。
+// 自定义模型目录请直接使用对应 ModelRegistry 的方法。
 func PresetModels() []PresetModel {
-	out := make([]PresetModel, 0, len(presetModelDefs))
-	for _, m := range presetModelDefs {
-		out = append(out, PresetModel{ID: ModelNamespace + m.ID, Name: m.Name})
+	models := defaultModelRegistry.Models()
+	out := make([]PresetModel, 0, len(models))
+	for _, m := range models {
+		out = append(out, PresetModel{ID: m.FullID(), Name: m.Name})
 	}
 	return out
 }
@@ -77,14 +56,17 @@ func NormalizeModelID(modelID string) string {
 	}
 }
 
-// IsSupportedModelID 判断是否为受支持的模型 ID（支持带 namespace/prefix 的写法）。
+// IsSupportedModelID 判断是否为内置模型 ID（支持带 namespace/prefix 的写法），不解析别名。
 func IsSupportedModelID(modelID string) bool {
-	trimmed := strings.TrimSpace(modelID)
-	if trimmed == "" {
+	if strings.TrimSpace(modelID) == "" {
 		return false
 	}
-
-	normalized := NormalizeModelID(trimmed)
-	_, ok := presetModelNameByID[normalized]
+	_, ok := defaultModelRegistry.Lookup(modelID)
 	return ok
 }
+
+// ResolveModelID 按内置 registry 解析别名与模型 ID，返回 backend 需要的真实模型 ID。
+func ResolveModelID(model string) (string, bool) {
+	m, ok := defaultModelRegistry.Resolve(model)
+	return m.ID, ok
+}
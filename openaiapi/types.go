@@ -111,6 +111,17 @@ type OpenAIModel struct {
 	Object  string `json:"object"`
 	Created int64  `json:"created"`
 	OwnedBy string `json:"owned_by"`
+	// 以下为 gptb2o 扩展字段，来自模型目录；OpenAI SDK 会忽略未知字段。
+	DisplayName   string                   `json:"display_name,omitempty"`
+	ContextWindow int                      `json:"context_window,omitempty"`
+	Capabilities  *OpenAIModelCapabilities `json:"capabilities,omitempty"`
+}
+
+// OpenAIModelCapabilities 是 /v1/models 中 gptb2o 扩展的模型能力字段。
+type OpenAIModelCapabilities struct {
+	Tools  bool `json:"tools"`
+	Vision bool `json:"vision"`
+	XHigh  bool `json:"xhigh"`
 }
 
 // OpenAIModelList OpenAI 模型列表响应。
@@ -0,0 +1,270 @@
+package openaihttp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/LubyRuffy/gptb2o/metrics"
+)
+
+// DefaultMaxQueueWait 是启用并发限制且未设置 MaxQueueWait 时，请求在队列中的最长等待时间。
+const DefaultMaxQueueWait = 30 * time.Second
+
+// StatusClaudeOverloaded 是 Anthropic API 在过载时返回的非标准状态码，Claude Code 会按可重试错误处理。
+const StatusClaudeOverloaded = 529
+
+var (
+	errAdmissionQueueFull    = errors.New("too many concurrent requests: admission queue is full")
+	errAdmissionQueueTimeout = errors.New("too many concurrent requests: timed out waiting in the admission queue")
+)
+
+// admissionController 限制同时进入 backend 的请求数。超出上限的请求按公平键（入站 API key 名称，
+// 其次是 Claude metadata.user_id / OpenAI user）分组排队，释放名额时在各组之间轮转，
+// 避免单个客户端的大量并发请求（例如多个 Claude Code teammate）饿死其他客户端。
+type admissionController struct {
+	limit    int
+	maxQueue int
+	maxWait  time.Duration
+
+	mu     sync.Mutex
+	active int
+	queued int
+	queues map[string][]*admissionWaiter
+	// order 是当前有排队请求的公平键，next 指向下一个获得名额的键。
+	order []string
+	next  int
+
+	rejectedFull    int64
+	rejectedTimeout int64
+}
+
+type admissionWaiter struct {
+	key     string
+	ready   chan struct{}
+	granted bool
+}
+
+func newAdmissionController(limit, maxQueue int, maxWait time.Duration) *admissionController {
+	if limit <= 0 {
+		return nil
+	}
+	if maxQueue < 0 {
+		maxQueue = 0
+	}
+	if maxWait <= 0 {
+		maxWait = DefaultMaxQueueWait
+	}
+	return &admissionController{
+		limit:    limit,
+		maxQueue: maxQueue,
+		maxWait:  maxWait,
+		queues:   make(map[string][]*admissionWaiter),
+	}
+}
+
+// acquire 获取一个处理名额，成功时返回释放函数。队列已满、等待超时或 ctx 结束时返回错误。
+func (a *admissionController) acquire(ctx context.Context, key string) (func(), error) {
+	a.mu.Lock()
+	if a.active < a.limit && a.queued == 0 {
+		a.active++
+		a.mu.Unlock()
+		return a.releaseFunc(), nil
+	}
+	if a.queued >= a.maxQueue {
+		a.rejectedFull++
+		a.mu.Unlock()
+		return nil, errAdmissionQueueFull
+	}
+	w := &admissionWaiter{key: key, ready: make(chan struct{})}
+	if len(a.queues[key]) == 0 {
+		a.order = append(a.order, key)
+	}
+	a.queues[key] = append(a.queues[key], w)
+	a.queued++
+	a.mu.Unlock()
+
+	timer := time.NewTimer(a.maxWait)
+	defer timer.Stop()
+	var err error
+	select {
+	case <-w.ready:
+		return a.releaseFunc(), nil
+	case <-timer.C:
+		err = errAdmissionQueueTimeout
+	case <-ctx.Done():
+		err = context.Cause(ctx)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if w.granted {
+		// 超时与获得名额同时发生时以获得名额为准，避免名额泄漏。
+		return a.releaseFunc(), nil
+	}
+	a.removeWaiterLocked(w)
+	if errors.Is(err, errAdmissionQueueTimeout) {
+		a.rejectedTimeout++
+	}
+	return nil, err
+}
+
+func (a *admissionController) releaseFunc() func() {
+	var once sync.Once
+	return func() { once.Do(a.release) }
+}
+
+// release 把名额直接交给下一个公平键的队首请求；没有排队请求时归还名额。
+func (a *admissionController) release() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if len(a.order) == 0 {
+		a.active--
+		return
+	}
+	if a.next >= len(a.order) {
+		a.next = 0
+	}
+	key := a.order[a.next]
+	queue := a.queues[key]
+	w := queue[0]
+	if len(queue) == 1 {
+		delete(a.queues, key)
+		a.order = append(a.order[:a.next], a.order[a.next+1:]...)
+	} else {
+		a.queues[key] = queue[1:]
+		a.next++
+	}
+	a.queued--
+	w.granted = true
+	close(w.ready)
+}
+
+func (a *admissionController) removeWaiterLocked(w *admissionWaiter) {
+	queue := a.queues[w.key]
+	for i, candidate := range queue {
+		if candidate != w {
+			continue
+		}
+		queue = append(queue[:i], queue[i+1:]...)
+		a.queued--
+		break
+	}
+	if len(queue) > 0 {
+		a.queues[w.key] = queue
+		return
+	}
+	delete(a.queues, w.key)
+	for i, key := range a.order {
+		if key != w.key {
+			continue
+		}
+		a.order = append(a.order[:i], a.order[i+1:]...)
+		if i < a.next {
+			a.next--
+		}
+		break
+	}
+}
+
+type admissionStatus struct {
+	MaxConcurrent   int    `json:"max_concurrent"`
+	MaxQueued       int    `json:"max_queued"`
+	MaxQueueWait    string `json:"max_queue_wait"`
+	Active          int    `json:"active"`
+	Queued          int    `json:"queued"`
+	QueuedKeys      int    `json:"queued_keys"`
+	RejectedFull    int64  `json:"rejected_queue_full"`
+	RejectedTimeout int64  `json:"rejected_timeout"`
+}
+
+// status 返回当前并发与排队情况，用于 /debug/info。
+func (a *admissionController) status() admissionStatus {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return admissionStatus{
+		MaxConcurrent:   a.limit,
+		MaxQueued:       a.maxQueue,
+		MaxQueueWait:    a.maxWait.String(),
+		Active:          a.active,
+		Queued:          a.queued,
+		QueuedKeys:      len(a.order),
+		RejectedFull:    a.rejectedFull,
+		RejectedTimeout: a.rejectedTimeout,
+	}
+}
+
+// admissionRoutes 是受并发限制的入口；count_tokens 在本地估算、batch 有独立的 worker 并发，不参与排队。
+var admissionRoutes = map[string]bool{
+	metrics.RouteChatCompletions: true,
+	metrics.RouteResponses:       true,
+	metrics.RouteMessages:        true,
+}
+
+// wrapWithAdmission 在 handler 执行期间占用一个名额（流式请求直到流结束）。
+// 排队失败时 Claude 入口返回 529 overloaded_error，OpenAI 入口返回 503。a 为 nil 时原样返回 handler。
+func wrapWithAdmission(a *admissionController, route string, handler http.HandlerFunc) http.HandlerFunc {
+	if a == nil || handler == nil || !admissionRoutes[route] {
+		return handler
+	}
+	claude := route == metrics.RouteMessages
+	return func(w http.ResponseWriter, r *http.Request) {
+		release, err := a.acquire(r.Context(), admissionKey(r))
+		if err != nil {
+			writeAdmissionError(w, r, claude, err)
+			return
+		}
+		defer release()
+		handler(w, r)
+	}
+}
+
+// admissionKey 返回公平键：优先使用通过校验的入站 API key 名称，其次是请求体中的
+// Claude metadata.user_id 或 OpenAI user；都没有时所有请求共用一个匿名分组。
+func admissionKey(r *http.Request) string {
+	if name := apiKeyNameFromContext(r.Context()); name != "" {
+		return "key:" + name
+	}
+	bodyBytes, err := io.ReadAll(r.Body)
+	_ = r.Body.Close()
+	if err != nil {
+		bodyBytes = nil
+	}
+	r.Body = io.NopCloser(bytes.NewReader(bodyBytes))
+
+	var payload struct {
+		User     string `json:"user"`
+		Metadata struct {
+			UserID string `json:"user_id"`
+		} `json:"metadata"`
+	}
+	_ = json.Unmarshal(bodyBytes, &payload)
+	if id := strings.TrimSpace(payload.Metadata.UserID); id != "" {
+		return "user:" + id
+	}
+	if user := strings.TrimSpace(payload.User); user != "" {
+		return "user:" + user
+	}
+	return ""
+}
+
+func writeAdmissionError(w http.ResponseWriter, r *http.Request, claude bool, err error) {
+	switch {
+	case isServerShuttingDown(r.Context()):
+		err = ErrServerShuttingDown
+	case r.Context().Err() != nil:
+		// 客户端在排队期间断开，不再写响应。
+		return
+	}
+	if claude {
+		writeClaudeTypedError(w, StatusClaudeOverloaded, err.Error())
+		return
+	}
+	writeOpenAIError(w, http.StatusServiceUnavailable, err.Error())
+}
@@ -0,0 +1,150 @@
+package openaihttp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdmissionController_RoundRobinAcrossKeys(t *testing.T) {
+	a := newAdmissionController(1, 10, time.Minute)
+	release, err := a.acquire(context.Background(), "a")
+	require.NoError(t, err)
+
+	granted := make(chan string, 8)
+	releases := make(map[string]chan struct{})
+	enqueue := func(key, name string) {
+		done := make(chan struct{})
+		releases[name] = done
+		queued := a.status().Queued
+		go func() {
+			rel, err := a.acquire(context.Background(), key)
+			if err != nil {
+				granted <- "error: " + err.Error()
+				return
+			}
+			granted <- name
+			<-done
+			rel()
+		}()
+		require.Eventually(t, func() bool { return a.status().Queued == queued+1 }, time.Second, time.Millisecond)
+	}
+	// key a 先排了 3 个请求，key b 后到的 1 个请求不必等 a 全部完成。
+	enqueue("a", "a1")
+	enqueue("a", "a2")
+	enqueue("a", "a3")
+	enqueue("b", "b1")
+	require.Equal(t, 2, a.status().QueuedKeys)
+
+	release()
+	var order []string
+	for i := 0; i < 4; i++ {
+		name := <-granted
+		order = append(order, name)
+		require.Equal(t, 1, a.status().Active)
+		close(releases[name])
+	}
+	require.Equal(t, []string{"a1", "b1", "a2", "a3"}, order)
+	require.Eventually(t, func() bool { return a.status().Active == 0 }, time.Second, time.Millisecond)
+	require.Equal(t, 0, a.status().Queued)
+}
+
+func TestAdmissionController_QueueFullAndTimeout(t *testing.T) {
+	a := newAdmissionController(1, 1, 50*time.Millisecond)
+	release, err := a.acquire(context.Background(), "")
+	require.NoError(t, err)
+	defer release()
+
+	timedOut := make(chan error, 1)
+	go func() {
+		_, err := a.acquire(context.Background(), "")
+		timedOut <- err
+	}()
+	require.Eventually(t, func() bool { return a.status().Queued == 1 }, time.Second, time.Millisecond)
+	_, err = a.acquire(context.Background(), "other")
+	require.ErrorIs(t, err, errAdmissionQueueFull)
+	require.ErrorIs(t, <-timedOut, errAdmissionQueueTimeout)
+
+	// 客户端在排队时断开：移出队列，不计入超时。
+	ctx, cancel := context.WithCancel(context.Background())
+	cancelled := make(chan error, 1)
+	go func() {
+		_, err := a.acquire(ctx, "")
+		cancelled <- err
+	}()
+	require.Eventually(t, func() bool { return a.status().Queued == 1 }, time.Second, time.Millisecond)
+	cancel()
+	require.ErrorIs(t, <-cancelled, context.Canceled)
+
+	status := a.status()
+	require.Equal(t, 1, status.Active)
+	require.Equal(t, 0, status.Queued)
+	require.EqualValues(t, 1, status.RejectedFull)
+	require.EqualValues(t, 1, status.RejectedTimeout)
+}
+
+func TestAdmission_RejectsWithOverloadedAndReportsQueue(t *testing.T) {
+	started := make(chan struct{}, 1)
+	unblock := make(chan struct{})
+	backendSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-unblock
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: {\"type\":\"response.output_text.delta\",\"delta\":\"ok\"}\n\n")
+		fmt.Fprint(w, "data: {\"type\":\"response.completed\",\"response\":{\"id\":\"resp_1\",\"object\":\"response\"}}\n\n")
+	}))
+	t.Cleanup(backendSrv.Close)
+
+	h, err := NewHandler(Config{
+		BackendURL:            backendSrv.URL,
+		MaxConcurrentRequests: 1,
+		MaxQueuedRequests:     1,
+		MaxQueueWait:          20 * time.Millisecond,
+		AuthProvider:          func(ctx context.Context) (string, string, error) { return "token", "", nil },
+	})
+	require.NoError(t, err)
+	serve := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return w
+	}
+
+	firstDone := make(chan *httptest.ResponseRecorder, 1)
+	go func() {
+		firstDone <- serve(http.MethodPost, "/v1/messages", `{"model":"sonnet","max_tokens":16,"stream":true,"metadata":{"user_id":"teammate-1"},"messages":[{"role":"user","content":"hi"}]}`)
+	}()
+	<-started
+
+	w := serve(http.MethodPost, "/v1/messages", `{"model":"sonnet","max_tokens":16,"metadata":{"user_id":"teammate-2"},"messages":[{"role":"user","content":"hi"}]}`)
+	require.Equal(t, StatusClaudeOverloaded, w.Code)
+	require.Contains(t, w.Body.String(), `"type":"overloaded_error"`)
+	require.Contains(t, w.Body.String(), "timed out waiting in the admission queue")
+
+	w = serve(http.MethodPost, "/v1/chat/completions", `{"model":"gpt-5.5","messages":[{"role":"user","content":"hi"}]}`)
+	require.Equal(t, http.StatusServiceUnavailable, w.Code)
+	require.Contains(t, w.Body.String(), "too many concurrent requests")
+
+	// count_tokens 不占用名额。
+	w = serve(http.MethodPost, "/v1/messages/count_tokens", `{"model":"sonnet","messages":[{"role":"user","content":"hi"}]}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	w = serve(http.MethodGet, DebugInfoPath, "")
+	var info debugInfoResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &info))
+	require.NotNil(t, info.Admission)
+	require.Equal(t, 1, info.Admission.MaxConcurrent)
+	require.Equal(t, 1, info.Admission.Active)
+	require.EqualValues(t, 2, info.Admission.RejectedTimeout)
+
+	close(unblock)
+	first := <-firstDone
+	require.Equal(t, http.StatusOK, first.Code)
+	require.Contains(t, first.Body.String(), "message_stop")
+}
@@ -0,0 +1,63 @@
+package openaihttp
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// maxUsageLineTailBytes 为超长 SSE 行保留的尾部长度；response.completed 中 usage 位于 output 之后，
+// 保留行尾即可解析到 usage，而不必缓存整段输出。
+const maxUsageLineTailBytes = 64 << 10
+
+type backendUsage struct {
+	InputTokens         int64 `json:"input_tokens"`
+	OutputTokens        int64 `json:"output_tokens"`
+	OutputTokensDetails struct {
+		ReasoningTokens int64 `json:"reasoning_tokens"`
+	} `json:"output_tokens_details"`
+}
+
+// backendUsageScanner 逐行扫描透传中的 backend SSE，保留最后一次出现的非空 response.usage。
+// metrics 与 telemetry 用它在不解析整段输出的前提下拿到 token 用量。
+type backendUsageScanner struct {
+	line  []byte
+	usage *backendUsage
+}
+
+func (s *backendUsageScanner) Write(p []byte) {
+	for len(p) > 0 {
+		idx := bytes.IndexByte(p, '\n')
+		if idx < 0 {
+			s.appendLine(p)
+			return
+		}
+		s.appendLine(p[:idx])
+		s.endLine()
+		p = p[idx+1:]
+	}
+}
+
+func (s *backendUsageScanner) appendLine(p []byte) {
+	s.line = append(s.line, p...)
+	if len(s.line) > 2*maxUsageLineTailBytes {
+		s.line = append(s.line[:0], s.line[len(s.line)-maxUsageLineTailBytes:]...)
+	}
+}
+
+func (s *backendUsageScanner) endLine() {
+	line := s.line
+	s.line = s.line[:0]
+	// JSON 字符串中的引号会被转义，原样出现的 "usage": 只可能是字段名。
+	idx := bytes.LastIndex(line, []byte(`"usage":`))
+	if idx < 0 {
+		return
+	}
+	var usage backendUsage
+	if err := json.NewDecoder(bytes.NewReader(line[idx+len(`"usage":`):])).Decode(&usage); err != nil {
+		return
+	}
+	if usage.InputTokens == 0 && usage.OutputTokens == 0 {
+		return
+	}
+	s.usage = &usage
+}
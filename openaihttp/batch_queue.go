@@ -0,0 +1,199 @@
+package openaihttp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	batchPollInterval       = time.Second
+	defaultBatchConcurrency = 4
+)
+
+// batchQueue 是 Claude / OpenAI batch 共用的 worker 池。
+// 待办项保存在 batch.Store 中，worker 轮询领取；新提交时通过 notify 立即唤醒。
+type batchQueue struct {
+	concurrency int
+	wake        chan struct{}
+
+	mu       sync.Mutex
+	inflight map[string]map[uint]*batchInflight
+}
+
+func newBatchQueue(concurrency int) *batchQueue {
+	if concurrency <= 0 {
+		concurrency = defaultBatchConcurrency
+	}
+	return &batchQueue{
+		concurrency: concurrency,
+		wake:        make(chan struct{}, 1),
+		inflight:    make(map[string]map[uint]*batchInflight),
+	}
+}
+
+// start 启动 worker。next 领取并执行一个待办项，没有待办时返回 false；done 关闭后 worker 退出。
+func (q *batchQueue) start(done <-chan struct{}, next func(ctx context.Context) bool) {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-done
+		cancel()
+	}()
+	for i := 0; i < q.concurrency; i++ {
+		go q.worker(ctx, next)
+	}
+}
+
+func (q *batchQueue) notify() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (q *batchQueue) worker(ctx context.Context, next func(ctx context.Context) bool) {
+	timer := time.NewTimer(batchPollInterval)
+	defer timer.Stop()
+	for {
+		if ctx.Err() != nil {
+			return
+		}
+		if next(ctx) {
+			continue
+		}
+
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(batchPollInterval)
+		select {
+		case <-ctx.Done():
+			return
+		case <-q.wake:
+		case <-timer.C:
+		}
+	}
+}
+
+// batchInflight 是一个已领取请求的取消句柄。请求在领取时即登记，开始执行后再 bind 执行用的 cancel；
+// 两者之间到来的取消在 bind 时立即生效，不会漏掉刚被领取的请求。
+type batchInflight struct {
+	mu       sync.Mutex
+	canceled bool
+	cancel   context.CancelFunc
+}
+
+func (f *batchInflight) bind(cancel context.CancelFunc) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.cancel = cancel
+	if f.canceled {
+		cancel()
+	}
+}
+
+func (f *batchInflight) abort() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.canceled = true
+	if f.cancel != nil {
+		f.cancel()
+	}
+}
+
+// wasCanceled 报告请求是否因 batch 取消而被中断。
+func (f *batchInflight) wasCanceled() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.canceled
+}
+
+// track 登记一个已领取的请求；应在领取请求的 store 事务内调用，保证 cancelInflight 能看到它。
+func (q *batchQueue) track(batchID string, id uint) *batchInflight {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.inflight[batchID] == nil {
+		q.inflight[batchID] = make(map[uint]*batchInflight)
+	}
+	inflight := &batchInflight{}
+	q.inflight[batchID][id] = inflight
+	return inflight
+}
+
+func (q *batchQueue) untrack(batchID string, id uint) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	delete(q.inflight[batchID], id)
+	if len(q.inflight[batchID]) == 0 {
+		delete(q.inflight, batchID)
+	}
+}
+
+func (q *batchQueue) cancelInflight(batchID string) {
+	q.mu.Lock()
+	inflights := make([]*batchInflight, 0, len(q.inflight[batchID]))
+	for _, inflight := range q.inflight[batchID] {
+		inflights = append(inflights, inflight)
+	}
+	q.mu.Unlock()
+	for _, inflight := range inflights {
+		inflight.abort()
+	}
+}
+
+// forceNonStreamBody 把请求体中的 stream 置为 false：batch 只保存最终响应。
+func forceNonStreamBody(raw []byte) ([]byte, error) {
+	var params map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &params); err != nil {
+		return nil, err
+	}
+	if params == nil {
+		return nil, fmt.Errorf("request body must be a JSON object")
+	}
+	params["stream"] = json.RawMessage("false")
+	return json.Marshal(params)
+}
+
+// serveBatchRequest 在进程内调用在线接口的 handler，保证 batch 与在线请求走同一套逻辑。
+func serveBatchRequest(ctx context.Context, handler http.HandlerFunc, path string, body []byte) (int, []byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, path, bytes.NewReader(body))
+	if err != nil {
+		return 0, nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	rec := &batchResponseWriter{header: make(http.Header)}
+	handler(rec, req)
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	return rec.status, bytes.TrimSpace(rec.body.Bytes()), nil
+}
+
+// batchResponseWriter 在内存中收集进程内调用的响应，记录状态码与响应体。
+type batchResponseWriter struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (w *batchResponseWriter) Header() http.Header { return w.header }
+
+func (w *batchResponseWriter) WriteHeader(statusCode int) {
+	if w.status == 0 {
+		w.status = statusCode
+	}
+}
+
+func (w *batchResponseWriter) Write(p []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	return w.body.Write(p)
+}
+
+func (w *batchResponseWriter) Flush() {}
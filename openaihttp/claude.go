@@ -11,6 +11,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/LubyRuffy/gptb2o"
 	"github.com/LubyRuffy/gptb2o/backend"
 	"github.com/LubyRuffy/gptb2o/openaiapi"
 	"github.com/cloudwego/eino/schema"
@@ -20,13 +21,16 @@ import (
 type claudeCompatConfig struct {
 	Now          func() time.Time
 	NewChatModel func(ctx context.Context, modelID string, tools []openaiapi.OpenAITool, toolCallHandler func(*backend.ToolCall)) (chatModel, error)
-	WriteJSON    func(w http.ResponseWriter, data interface{})
-	WriteError   func(w http.ResponseWriter, statusCode int, message string)
+	// Models 可选，返回当前模型目录；为 nil 时使用 gptb2o.DefaultModelRegistry。
+	Models     func() *gptb2o.ModelRegistry
+	WriteJSON  func(w http.ResponseWriter, data interface{})
+	WriteError func(w http.ResponseWriter, statusCode int, message string)
 }
 
 type claudeCompatHandler struct {
 	now          func() time.Time
 	newChatModel func(ctx context.Context, modelID string, tools []openaiapi.OpenAITool, toolCallHandler func(*backend.ToolCall)) (chatModel, error)
+	models       func() *gptb2o.ModelRegistry
 	writeJSON    func(w http.ResponseWriter, data interface{})
 	writeError   func(w http.ResponseWriter, statusCode int, message string)
 }
@@ -165,9 +169,13 @@ func newClaudeCompatHandler(cfg claudeCompatConfig) (*claudeCompatHandler, error
 	if cfg.WriteError == nil {
 		return nil, fmt.Errorf("WriteError is required")
 	}
+	if cfg.Models == nil {
+		cfg.Models = gptb2o.DefaultModelRegistry
+	}
 	return &claudeCompatHandler{
 		now:          cfg.Now,
 		newChatModel: cfg.NewChatModel,
+		models:       cfg.Models,
 		writeJSON:    cfg.WriteJSON,
 		writeError:   cfg.WriteError,
 	}, nil
@@ -255,11 +263,16 @@ func (h *claudeCompatHandler) handleMessages(w http.ResponseWriter, r *http.Requ
 
 	debugClaudeTaskToolSchema(toolsReq)
 
-	modelID, err := resolveClaudeModelID(req.Model)
-	if err != nil {
-		h.writeError(w, http.StatusBadRequest, err.Error())
+	modelInfo, ok := h.models().Resolve(req.Model)
+	if !ok {
+		h.writeError(w, http.StatusBadRequest, "unsupported model")
+		return
+	}
+	if err := toolsUnsupportedError(modelInfo, len(toolsReq)); err != nil {
+		h.writeError(w, httpStatusFromError(err), httpMessageFromError(err))
 		return
 	}
+	modelID := modelInfo.ID
 
 	tools, err := convertClaudeTools(toolsReq)
 	if err != nil {
@@ -277,7 +290,7 @@ func (h *claudeCompatHandler) handleMessages(w http.ResponseWriter, r *http.Requ
 	inputTokens := prepared.inputTokens
 	outputEffort := ""
 	if req.OutputConfig != nil {
-		outputEffort = normalizeReasoningEffort(req.OutputConfig.Effort)
+		outputEffort = effortForModel(modelInfo, normalizeReasoningEffort(req.OutputConfig.Effort))
 	}
 
 	if req.Stream {
@@ -324,6 +337,14 @@ func (h *claudeCompatHandler) handleMessages(w http.ResponseWriter, r *http.Requ
 
 	respMsg, err := chatModel.Generate(r.Context(), chatInput)
 	if err != nil {
+		if isServerShuttingDown(r.Context()) {
+			h.writeError(w, http.StatusServiceUnavailable, ErrServerShuttingDown.Error())
+			return
+		}
+		if timeoutErr, ok := backend.AsStreamTimeout(r.Context(), err); ok {
+			writeClaudeTypedError(w, http.StatusGatewayTimeout, timeoutErr.Error())
+			return
+		}
 		h.writeError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
@@ -485,8 +506,8 @@ func (h *claudeCompatHandler) handleCountTokens(w http.ResponseWriter, r *http.R
 		h.writeError(w, http.StatusBadRequest, "messages is required")
 		return
 	}
-	if _, err := resolveClaudeModelID(req.Model); err != nil {
-		h.writeError(w, http.StatusBadRequest, err.Error())
+	if _, ok := h.models().Resolve(req.Model); !ok {
+		h.writeError(w, http.StatusBadRequest, "unsupported model")
 		return
 	}
 
@@ -532,6 +553,10 @@ func (h *claudeCompatHandler) writeMessagesStream(
 
 	sr, err := chatModel.Stream(ctx, chatInput)
 	if err != nil {
+		if isServerShuttingDown(ctx) {
+			h.writeError(w, http.StatusServiceUnavailable, ErrServerShuttingDown.Error())
+			return
+		}
 		h.writeError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
@@ -539,6 +564,11 @@ func (h *claudeCompatHandler) writeMessagesStream(
 
 	firstMsg, firstRecvErr := sr.Recv()
 	if firstRecvErr != nil && !errors.Is(firstRecvErr, io.EOF) {
+		if timeoutErr, ok := backend.AsStreamTimeout(ctx, firstRecvErr); ok {
+			writeClaudeTypedError(w, http.StatusGatewayTimeout, timeoutErr.Error())
+			return
+		}
+		firstRecvErr = shutdownAwareError(ctx, firstRecvErr)
 		h.writeError(w, httpStatusFromError(firstRecvErr), httpMessageFromError(firstRecvErr))
 		return
 	}
@@ -570,8 +600,7 @@ func (h *claudeCompatHandler) writeMessagesStream(
 
 	stopTriggered := false
 	outputChars := 0
-	textBuf := ""
-	maxStopLen := maxClaudeStopSequenceLen(stopSequences)
+	stopMatcher := newStopSequenceMatcher(stopSequences)
 	maxChars := 0
 	if maxTokens > 0 {
 		maxChars = maxTokens * 4
@@ -588,7 +617,10 @@ func (h *claudeCompatHandler) writeMessagesStream(
 		textBlockOpen = false
 	}
 
+	// 停机排空超时导致的中断以 overloaded_error 告知客户端，Claude Code 会按可重试错误处理；
+	// backend 超时以 timeout_error 告知。
 	writeStreamError := func(err error) {
+		err = timeoutAwareError(ctx, shutdownAwareError(ctx, err))
 		closeTextBlock()
 		writeClaudeSSEEvent(w, flusher, "error", map[string]any{
 			"type": "error",
@@ -633,86 +665,53 @@ func (h *claudeCompatHandler) writeMessagesStream(
 		outputChars += len(delta)
 	}
 
+	triggerStop := func(reason string, seq *string) {
+		stopReason = reason
+		stopSequence = seq
+		stopTriggered = true
+		if cancel != nil {
+			cancel()
+		}
+	}
+
+	// emitWithinMaxTokens 在超出 max_tokens 字符预算时截断输出并以 max_tokens 收束。
+	emitWithinMaxTokens := func(text string) bool {
+		if maxChars <= 0 || outputChars+len(text) <= maxChars {
+			emitTextDelta(text)
+			return true
+		}
+		if allowed := runeStartBefore(text, maxChars-outputChars); allowed > 0 {
+			emitTextDelta(text[:allowed])
+		}
+		triggerStop("max_tokens", nil)
+		return false
+	}
+
 	emitTextSafe := func(delta string) {
 		// Claude 的流式输出允许出现仅包含空白的 delta（例如换行/缩进）。
 		// 这里不能 TrimSpace，否则会丢失模型输出。
 		if delta == "" || stopTriggered {
 			return
 		}
-		textBuf += delta
-		for {
-			if stopTriggered {
-				return
-			}
-
-			if maxChars > 0 && outputChars+len(textBuf) > maxChars {
-				allowed := maxChars - outputChars
-				if allowed > 0 {
-					emitTextDelta(textBuf[:allowed])
-				}
-				textBuf = ""
-				stopReason = "max_tokens"
-				stopSequence = nil
-				stopTriggered = true
-				if cancel != nil {
-					cancel()
-				}
-				return
-			}
-
-			if idx, seq, ok := findFirstClaudeStopSequence(textBuf, stopSequences); ok {
-				if idx > 0 {
-					emitTextDelta(textBuf[:idx])
-				}
-				textBuf = ""
-				stopReason = "stop_sequence"
-				stopSequence = &seq
-				stopTriggered = true
-				if cancel != nil {
-					cancel()
-				}
-				return
-			}
-
-			if maxStopLen <= 1 {
-				if textBuf != "" {
-					emitTextDelta(textBuf)
-					textBuf = ""
-				}
-				return
-			}
-
-			safeLen := len(textBuf) - (maxStopLen - 1)
-			if safeLen <= 0 {
-				return
-			}
-			emitTextDelta(textBuf[:safeLen])
-			textBuf = textBuf[safeLen:]
+		safe, matched := stopMatcher.push(delta)
+		if maxChars > 0 && outputChars+len(safe)+stopMatcher.pending() > maxChars {
+			// 被扣留的尾巴也计入预算，避免超出 max_tokens 后仍继续消耗 backend token。
+			emitWithinMaxTokens(safe + stopMatcher.flush())
+			return
+		}
+		emitTextDelta(safe)
+		if matched {
+			seq, _ := stopMatcher.stopSequence()
+			triggerStop("stop_sequence", &seq)
 		}
 	}
 
 	flushAllTextBuf := func() {
-		if textBuf == "" || stopTriggered {
-			textBuf = ""
-			return
-		}
-		// 这里的 textBuf 仅是“可能构成 stop sequence 的尾巴”，流结束/切换块时应直接输出。
-		if maxChars > 0 && outputChars+len(textBuf) > maxChars {
-			allowed := maxChars - outputChars
-			if allowed > 0 {
-				emitTextDelta(textBuf[:allowed])
-			}
-			textBuf = ""
-			stopReason = "max_tokens"
-			stopSequence = nil
-			stopTriggered = true
-			if cancel != nil {
-				cancel()
-			}
+		if stopTriggered {
 			return
 		}
-		emitTextDelta(textBuf)
-		textBuf = ""
+		// 这里的尾巴仅是“可能构成 stop sequence 的前缀”，流结束/切换块时应直接输出。
+		emitWithinMaxTokens(stopMatcher.flush())
 	}
 
 	flushToolCalls := func() {
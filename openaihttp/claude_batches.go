@@ -0,0 +1,443 @@
+package openaihttp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/LubyRuffy/gptb2o/batch"
+	"github.com/google/uuid"
+)
+
+const (
+	claudeBatchMaxRequests    = 100000
+	claudeBatchMaxCustomIDLen = 64
+	claudeBatchMaxListLimit   = 1000
+	claudeBatchTTL            = 24 * time.Hour
+)
+
+// ClaudeMessageBatchHandlers 对应 Anthropic Message Batches API 的各个端点。
+// Get/Results/Cancel 通过 r.PathValue("batch_id") 读取 batch id。
+type ClaudeMessageBatchHandlers struct {
+	Create  http.HandlerFunc
+	List    http.HandlerFunc
+	Get     http.HandlerFunc
+	Results http.HandlerFunc
+	Cancel  http.HandlerFunc
+}
+
+type claudeBatchCreateRequest struct {
+	Requests []claudeBatchRequestItem `json:"requests"`
+}
+
+type claudeBatchRequestItem struct {
+	CustomID string          `json:"custom_id"`
+	Params   json.RawMessage `json:"params"`
+}
+
+type claudeMessageBatch struct {
+	ID                string              `json:"id"`
+	Type              string              `json:"type"`
+	ProcessingStatus  string              `json:"processing_status"`
+	RequestCounts     batch.RequestCounts `json:"request_counts"`
+	EndedAt           *string             `json:"ended_at"`
+	CreatedAt         string              `json:"created_at"`
+	ExpiresAt         string              `json:"expires_at"`
+	ArchivedAt        *string             `json:"archived_at"`
+	CancelInitiatedAt *string             `json:"cancel_initiated_at"`
+	ResultsURL        *string             `json:"results_url"`
+}
+
+type claudeMessageBatchList struct {
+	Data    []claudeMessageBatch `json:"data"`
+	HasMore bool                 `json:"has_more"`
+	FirstID *string              `json:"first_id"`
+	LastID  *string              `json:"last_id"`
+}
+
+type claudeBatchResultLine struct {
+	CustomID string          `json:"custom_id"`
+	Result   json.RawMessage `json:"result"`
+}
+
+// claudeBatchRunner 持有 batch 的 HTTP 端点与后台 worker。
+// 每个请求都原样交给 /v1/messages 的 handler 执行（强制 stream=false），保证与在线请求行为一致。
+type claudeBatchRunner struct {
+	store    *batch.Store
+	messages http.HandlerFunc
+	basePath string
+	now      func() time.Time
+	queue    *batchQueue
+}
+
+// ClaudeMessageBatchesHandlers 返回 /v1/messages/batches 的各个 handler，并在 Batches store 上恢复遗留请求、启动 worker。
+// 每个 store 只能构造一次：worker 使用本次的模型、鉴权与 trace 配置，再次构造返回 batch.ErrWorkersAttached。
+func ClaudeMessageBatchesHandlers(cfg Config) (ClaudeMessageBatchHandlers, error) {
+	resolved, err := resolveConfig(cfg)
+	if err != nil {
+		return ClaudeMessageBatchHandlers{}, err
+	}
+	if resolved.Batches == nil {
+		return ClaudeMessageBatchHandlers{}, fmt.Errorf("Batches store is required")
+	}
+	h, err := newClaudeCompatHandler(claudeCompatConfig{
+		Now:          time.Now,
+		NewChatModel: newChatModelFactory(resolved),
+		Models:       resolved.Settings.models,
+		WriteJSON:    writeJSON,
+		WriteError:   writeClaudeError,
+	})
+	if err != nil {
+		return ClaudeMessageBatchHandlers{}, err
+	}
+
+	runner := newClaudeBatchRunner(resolved.Batches, wrapWithTracer(resolved.Tracer, h.handleMessages), resolved.BasePath, resolved.BatchConcurrency)
+	if err := runner.start(); err != nil {
+		return ClaudeMessageBatchHandlers{}, err
+	}
+	return ClaudeMessageBatchHandlers{
+		Create:  wrapWithTracer(resolved.Tracer, runner.handleCreate),
+		List:    wrapWithTracer(resolved.Tracer, runner.handleList),
+		Get:     wrapWithTracer(resolved.Tracer, runner.handleGet),
+		Results: wrapWithTracer(resolved.Tracer, runner.handleResults),
+		Cancel:  wrapWithTracer(resolved.Tracer, runner.handleCancel),
+	}, nil
+}
+
+func newClaudeBatchRunner(store *batch.Store, messages http.HandlerFunc, basePath string, concurrency int) *claudeBatchRunner {
+	return &claudeBatchRunner{
+		store:    store,
+		messages: messages,
+		basePath: normalizeBasePath(basePath),
+		now:      time.Now,
+		queue:    newBatchQueue(concurrency),
+	}
+}
+
+// start 恢复上次进程遗留的请求，并启动固定数量的 worker；store 关闭后 worker 退出。
+func (b *claudeBatchRunner) start() error {
+	if err := b.store.AttachWorkers("message batches"); err != nil {
+		return err
+	}
+	if err := b.store.RecoverMessageBatches(b.now()); err != nil {
+		return fmt.Errorf("recover message batches: %w", err)
+	}
+	b.queue.start(b.store.Done(), b.next)
+	return nil
+}
+
+func (b *claudeBatchRunner) next(ctx context.Context) bool {
+	b.expireDueBatches()
+	var inflight *batchInflight
+	req, ok, err := b.store.ClaimMessageBatchRequest(b.now(), func(req batch.MessageBatchRequest) {
+		inflight = b.queue.track(req.BatchID, req.ID)
+	})
+	if err != nil && ctx.Err() == nil {
+		log.Printf("[gptb2o][batches] claim request failed: %v", err)
+	}
+	if !ok {
+		return false
+	}
+	// 还有积压时唤醒其他空闲 worker。
+	b.queue.notify()
+	b.run(ctx, req, inflight)
+	return true
+}
+
+func (b *claudeBatchRunner) expireDueBatches() {
+	batchIDs, err := b.store.ExpireMessageBatches(b.now())
+	if err != nil {
+		return
+	}
+	for _, batchID := range batchIDs {
+		b.endIfDone(batchID)
+	}
+}
+
+func (b *claudeBatchRunner) endIfDone(batchID string) {
+	if _, err := b.store.EndMessageBatchIfDone(batchID, b.now()); err != nil {
+		log.Printf("[gptb2o][batches] end batch failed: batch=%s err=%v", batchID, err)
+	}
+}
+
+func (b *claudeBatchRunner) run(ctx context.Context, req batch.MessageBatchRequest, inflight *batchInflight) {
+	defer b.queue.untrack(req.BatchID, req.ID)
+	reqCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	inflight.bind(cancel)
+
+	status, result := b.execute(reqCtx, req)
+	if ctx.Err() != nil {
+		// 进程退出导致的中断不落结果，重启后由 RecoverMessageBatches 重新排队。
+		return
+	}
+	if inflight.wasCanceled() {
+		status, result = batch.RequestCanceled, `{"type":"canceled"}`
+	}
+	if err := b.store.FinishMessageBatchRequest(req.ID, status, result, b.now()); err != nil {
+		log.Printf("[gptb2o][batches] save result failed: batch=%s custom_id=%s err=%v", req.BatchID, req.CustomID, err)
+		return
+	}
+	b.endIfDone(req.BatchID)
+}
+
+func (b *claudeBatchRunner) execute(ctx context.Context, req batch.MessageBatchRequest) (string, string) {
+	body, err := forceNonStreamBody([]byte(req.Params))
+	if err != nil {
+		return batch.RequestErrored, claudeBatchErroredResult(http.StatusBadRequest, "params must be a JSON object")
+	}
+	code, respBody, err := serveBatchRequest(ctx, b.messages, joinPath(b.basePath, "/messages"), body)
+	if err != nil {
+		return batch.RequestErrored, claudeBatchErroredResult(http.StatusInternalServerError, err.Error())
+	}
+
+	if code == http.StatusOK && json.Valid(respBody) {
+		return batch.RequestSucceeded, `{"type":"succeeded","message":` + string(respBody) + `}`
+	}
+	if json.Valid(respBody) {
+		return batch.RequestErrored, `{"type":"errored","error":` + string(respBody) + `}`
+	}
+	return batch.RequestErrored, claudeBatchErroredResult(code, string(respBody))
+}
+
+func claudeBatchErroredResult(status int, message string) string {
+	var payload struct {
+		Type  string `json:"type"`
+		Error struct {
+			Type  string `json:"type"`
+			Error struct {
+				Type    string `json:"type"`
+				Message string `json:"message"`
+			} `json:"error"`
+		} `json:"error"`
+	}
+	payload.Type = batch.RequestErrored
+	payload.Error.Type = "error"
+	payload.Error.Error.Type = claudeErrorTypeForStatus(status)
+	payload.Error.Error.Message = message
+	data, _ := json.Marshal(payload)
+	return string(data)
+}
+
+func (b *claudeBatchRunner) handleCreate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeClaudeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	var req claudeBatchCreateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeClaudeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if len(req.Requests) == 0 {
+		writeClaudeError(w, http.StatusBadRequest, "requests is required")
+		return
+	}
+	if len(req.Requests) > claudeBatchMaxRequests {
+		writeClaudeError(w, http.StatusBadRequest, fmt.Sprintf("requests supports at most %d items", claudeBatchMaxRequests))
+		return
+	}
+
+	items := make([]batch.MessageBatchRequest, 0, len(req.Requests))
+	seen := make(map[string]struct{}, len(req.Requests))
+	for i, item := range req.Requests {
+		customID := strings.TrimSpace(item.CustomID)
+		if customID == "" || len(customID) > claudeBatchMaxCustomIDLen {
+			writeClaudeError(w, http.StatusBadRequest, fmt.Sprintf("requests[%d].custom_id must be 1-%d characters", i, claudeBatchMaxCustomIDLen))
+			return
+		}
+		if _, ok := seen[customID]; ok {
+			writeClaudeError(w, http.StatusBadRequest, fmt.Sprintf("duplicate custom_id %q", customID))
+			return
+		}
+		seen[customID] = struct{}{}
+		params := bytes.TrimSpace(item.Params)
+		if len(params) == 0 || params[0] != '{' {
+			writeClaudeError(w, http.StatusBadRequest, fmt.Sprintf("requests[%d].params must be an object", i))
+			return
+		}
+		items = append(items, batch.MessageBatchRequest{
+			CustomID: customID,
+			Params:   string(params),
+		})
+	}
+
+	now := b.now()
+	record := batch.MessageBatch{
+		BatchID:          "msgbatch_" + strings.ReplaceAll(uuid.NewString(), "-", ""),
+		ProcessingStatus: batch.MessageBatchInProgress,
+		CreatedAt:        now,
+		ExpiresAt:        now.Add(claudeBatchTTL),
+	}
+	if err := b.store.CreateMessageBatch(record, items); err != nil {
+		writeClaudeError(w, http.StatusInternalServerError, "failed to create batch")
+		return
+	}
+	b.queue.notify()
+	b.writeBatch(w, record.BatchID)
+}
+
+func (b *claudeBatchRunner) handleGet(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeClaudeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	b.writeBatch(w, strings.TrimSpace(r.PathValue("batch_id")))
+}
+
+func (b *claudeBatchRunner) handleList(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeClaudeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	query := r.URL.Query()
+	opts := batch.ListOptions{
+		Limit:    20,
+		BeforeID: strings.TrimSpace(query.Get("before_id")),
+		AfterID:  strings.TrimSpace(query.Get("after_id")),
+	}
+	if raw := strings.TrimSpace(query.Get("limit")); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit < 1 || limit > claudeBatchMaxListLimit {
+			writeClaudeError(w, http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", claudeBatchMaxListLimit))
+			return
+		}
+		opts.Limit = limit
+	}
+	if opts.BeforeID != "" && opts.AfterID != "" {
+		writeClaudeError(w, http.StatusBadRequest, "before_id and after_id cannot both be set")
+		return
+	}
+
+	records, hasMore, err := b.store.ListMessageBatches(opts)
+	if errors.Is(err, batch.ErrNotFound) {
+		writeClaudeError(w, http.StatusBadRequest, "pagination cursor not found")
+		return
+	}
+	if err != nil {
+		writeClaudeError(w, http.StatusInternalServerError, "failed to list batches")
+		return
+	}
+
+	resp := claudeMessageBatchList{Data: make([]claudeMessageBatch, 0, len(records)), HasMore: hasMore}
+	for _, record := range records {
+		item, err := b.batchResponse(record)
+		if err != nil {
+			writeClaudeError(w, http.StatusInternalServerError, "failed to list batches")
+			return
+		}
+		resp.Data = append(resp.Data, item)
+	}
+	if len(resp.Data) > 0 {
+		resp.FirstID = &resp.Data[0].ID
+		resp.LastID = &resp.Data[len(resp.Data)-1].ID
+	}
+	writeJSON(w, resp)
+}
+
+func (b *claudeBatchRunner) handleCancel(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeClaudeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	batchID := strings.TrimSpace(r.PathValue("batch_id"))
+	if _, err := b.store.CancelMessageBatch(batchID, b.now()); err != nil {
+		b.writeLookupError(w, err)
+		return
+	}
+	b.queue.cancelInflight(batchID)
+	b.endIfDone(batchID)
+	b.writeBatch(w, batchID)
+}
+
+func (b *claudeBatchRunner) handleResults(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeClaudeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	batchID := strings.TrimSpace(r.PathValue("batch_id"))
+	record, err := b.store.GetMessageBatch(batchID)
+	if err != nil {
+		b.writeLookupError(w, err)
+		return
+	}
+	if record.ProcessingStatus != batch.MessageBatchEnded {
+		writeClaudeError(w, http.StatusBadRequest, "batch results are not available until processing has ended")
+		return
+	}
+	requests, err := b.store.ListMessageBatchRequests(batchID)
+	if err != nil {
+		writeClaudeError(w, http.StatusInternalServerError, "failed to load batch results")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-jsonl")
+	enc := json.NewEncoder(w)
+	for _, req := range requests {
+		result := req.Result
+		if result == "" {
+			// 取消/过期的请求没有执行结果，只需要类型。
+			result = `{"type":"` + req.Status + `"}`
+		}
+		_ = enc.Encode(claudeBatchResultLine{CustomID: req.CustomID, Result: json.RawMessage(result)})
+	}
+}
+
+func (b *claudeBatchRunner) writeBatch(w http.ResponseWriter, batchID string) {
+	record, err := b.store.GetMessageBatch(batchID)
+	if err != nil {
+		b.writeLookupError(w, err)
+		return
+	}
+	resp, err := b.batchResponse(record)
+	if err != nil {
+		writeClaudeError(w, http.StatusInternalServerError, "failed to load batch")
+		return
+	}
+	writeJSON(w, resp)
+}
+
+func (b *claudeBatchRunner) writeLookupError(w http.ResponseWriter, err error) {
+	if errors.Is(err, batch.ErrNotFound) {
+		writeClaudeError(w, http.StatusNotFound, "batch not found")
+		return
+	}
+	writeClaudeError(w, http.StatusInternalServerError, "failed to load batch")
+}
+
+func (b *claudeBatchRunner) batchResponse(record batch.MessageBatch) (claudeMessageBatch, error) {
+	counts, err := b.store.CountMessageBatchRequests(record.BatchID)
+	if err != nil {
+		return claudeMessageBatch{}, err
+	}
+	resp := claudeMessageBatch{
+		ID:                record.BatchID,
+		Type:              "message_batch",
+		ProcessingStatus:  record.ProcessingStatus,
+		RequestCounts:     counts,
+		EndedAt:           formatOptionalTime(record.EndedAt),
+		CreatedAt:         record.CreatedAt.UTC().Format(time.RFC3339),
+		ExpiresAt:         record.ExpiresAt.UTC().Format(time.RFC3339),
+		CancelInitiatedAt: formatOptionalTime(record.CancelInitiatedAt),
+	}
+	if record.ProcessingStatus == batch.MessageBatchEnded {
+		resultsURL := joinPath(b.basePath, "/messages/batches/"+record.BatchID+"/results")
+		resp.ResultsURL = &resultsURL
+	}
+	return resp, nil
+}
+
+func formatOptionalTime(t *time.Time) *string {
+	if t == nil || t.IsZero() {
+		return nil
+	}
+	s := t.UTC().Format(time.RFC3339)
+	return &s
+}
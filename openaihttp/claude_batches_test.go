@@ -0,0 +1,284 @@
+package openaihttp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/LubyRuffy/gptb2o/backend"
+	"github.com/LubyRuffy/gptb2o/batch"
+	"github.com/LubyRuffy/gptb2o/openaiapi"
+	"github.com/cloudwego/eino/schema"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestClaudeBatchRunner(t *testing.T, store *batch.Store, messages http.HandlerFunc) *claudeBatchRunner {
+	t.Helper()
+	runner := newClaudeBatchRunner(store, messages, "/v1", 2)
+	require.NoError(t, runner.start())
+	return runner
+}
+
+func stubClaudeMessagesHandler(t *testing.T, reply string) http.HandlerFunc {
+	t.Helper()
+	h, err := newClaudeCompatHandler(claudeCompatConfig{
+		Now: time.Now,
+		NewChatModel: func(ctx context.Context, modelID string, tools []openaiapi.OpenAITool, toolCallHandler func(*backend.ToolCall)) (chatModel, error) {
+			return &stubChatModel{generateResp: schema.AssistantMessage(reply, nil)}, nil
+		},
+		WriteJSON:  writeJSON,
+		WriteError: writeClaudeError,
+	})
+	require.NoError(t, err)
+	return h.handleMessages
+}
+
+func createClaudeBatch(t *testing.T, runner *claudeBatchRunner, body string) claudeMessageBatch {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/v1/messages/batches", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	runner.handleCreate(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var created claudeMessageBatch
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	return created
+}
+
+func getClaudeBatch(t *testing.T, runner *claudeBatchRunner, batchID string) claudeMessageBatch {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/v1/messages/batches/"+batchID, nil)
+	req.SetPathValue("batch_id", batchID)
+	w := httptest.NewRecorder()
+	runner.handleGet(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var got claudeMessageBatch
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &got))
+	return got
+}
+
+func waitClaudeBatchEnded(t *testing.T, runner *claudeBatchRunner, batchID string) claudeMessageBatch {
+	t.Helper()
+	var got claudeMessageBatch
+	require.Eventually(t, func() bool {
+		got = getClaudeBatch(t, runner, batchID)
+		return got.ProcessingStatus == batch.MessageBatchEnded
+	}, 5*time.Second, 10*time.Millisecond)
+	return got
+}
+
+func readClaudeBatchResults(t *testing.T, runner *claudeBatchRunner, batchID string) map[string]map[string]any {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/v1/messages/batches/"+batchID+"/results", nil)
+	req.SetPathValue("batch_id", batchID)
+	w := httptest.NewRecorder()
+	runner.handleResults(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	results := make(map[string]map[string]any)
+	for _, line := range strings.Split(strings.TrimSpace(w.Body.String()), "\n") {
+		var item struct {
+			CustomID string         `json:"custom_id"`
+			Result   map[string]any `json:"result"`
+		}
+		require.NoError(t, json.Unmarshal([]byte(line), &item))
+		results[item.CustomID] = item.Result
+	}
+	return results
+}
+
+func TestClaudeMessageBatches_CreateRunAndResults(t *testing.T) {
+	store, err := batch.OpenStore(filepath.Join(t.TempDir(), "batch.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = store.Close() })
+	runner := newTestClaudeBatchRunner(t, store, stubClaudeMessagesHandler(t, "pong"))
+
+	created := createClaudeBatch(t, runner, `{"requests":[
+		{"custom_id":"ok","params":{"model":"gpt-5.4","max_tokens":64,"stream":true,"messages":[{"role":"user","content":"hi"}]}},
+		{"custom_id":"bad","params":{"model":"gpt-5.4","messages":[{"role":"user","content":"hi"}]}}
+	]}`)
+	require.True(t, strings.HasPrefix(created.ID, "msgbatch_"))
+	require.Equal(t, "message_batch", created.Type)
+	require.Nil(t, created.ResultsURL)
+
+	ended := waitClaudeBatchEnded(t, runner, created.ID)
+	require.Equal(t, batch.RequestCounts{Succeeded: 1, Errored: 1}, ended.RequestCounts)
+	require.NotNil(t, ended.EndedAt)
+	require.NotNil(t, ended.ResultsURL)
+	require.Equal(t, "/v1/messages/batches/"+created.ID+"/results", *ended.ResultsURL)
+
+	results := readClaudeBatchResults(t, runner, created.ID)
+	require.Equal(t, "succeeded", results["ok"]["type"])
+	message := results["ok"]["message"].(map[string]any)
+	require.Equal(t, "message", message["type"])
+	require.Equal(t, "pong", message["content"].([]any)[0].(map[string]any)["text"])
+
+	require.Equal(t, "errored", results["bad"]["type"])
+	errBody := results["bad"]["error"].(map[string]any)
+	require.Equal(t, "invalid_request_error", errBody["error"].(map[string]any)["type"])
+}
+
+func TestClaudeMessageBatches_CreateValidation(t *testing.T) {
+	store, err := batch.OpenStore(filepath.Join(t.TempDir(), "batch.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = store.Close() })
+	runner := newTestClaudeBatchRunner(t, store, stubClaudeMessagesHandler(t, "pong"))
+
+	for _, body := range []string{
+		`{"requests":[]}`,
+		`{"requests":[{"custom_id":"","params":{}}]}`,
+		`{"requests":[{"custom_id":"a","params":{}},{"custom_id":"a","params":{}}]}`,
+		`{"requests":[{"custom_id":"a","params":"x"}]}`,
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/v1/messages/batches", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		runner.handleCreate(w, req)
+		require.Equal(t, http.StatusBadRequest, w.Code, body)
+	}
+}
+
+func TestClaudeMessageBatches_CancelInterruptsRunningRequests(t *testing.T) {
+	store, err := batch.OpenStore(filepath.Join(t.TempDir(), "batch.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = store.Close() })
+
+	started := make(chan struct{}, 4)
+	runner := newTestClaudeBatchRunner(t, store, func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-r.Context().Done()
+		writeClaudeError(w, http.StatusInternalServerError, r.Context().Err().Error())
+	})
+
+	created := createClaudeBatch(t, runner, `{"requests":[
+		{"custom_id":"a","params":{}},
+		{"custom_id":"b","params":{}},
+		{"custom_id":"c","params":{}}
+	]}`)
+	<-started
+	<-started
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/messages/batches/"+created.ID+"/cancel", nil)
+	req.SetPathValue("batch_id", created.ID)
+	w := httptest.NewRecorder()
+	runner.handleCancel(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var canceling claudeMessageBatch
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &canceling))
+	require.NotNil(t, canceling.CancelInitiatedAt)
+
+	ended := waitClaudeBatchEnded(t, runner, created.ID)
+	require.Equal(t, batch.RequestCounts{Canceled: 3}, ended.RequestCounts)
+	for _, result := range readClaudeBatchResults(t, runner, created.ID) {
+		require.Equal(t, "canceled", result["type"])
+	}
+}
+
+func TestClaudeMessageBatches_ResumesAfterRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "batch.db")
+	store, err := batch.OpenStore(path)
+	require.NoError(t, err)
+	now := time.Now()
+	require.NoError(t, store.CreateMessageBatch(batch.MessageBatch{
+		BatchID:   "msgbatch_restart",
+		CreatedAt: now,
+		ExpiresAt: now.Add(time.Hour),
+	}, []batch.MessageBatchRequest{
+		{CustomID: "a", Params: `{"model":"gpt-5.4","max_tokens":64,"messages":[{"role":"user","content":"hi"}]}`},
+	}))
+	// 模拟上一个进程领取后崩溃。
+	_, ok, err := store.ClaimMessageBatchRequest(now, nil)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.NoError(t, store.Close())
+
+	store, err = batch.OpenStore(path)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = store.Close() })
+	runner := newTestClaudeBatchRunner(t, store, stubClaudeMessagesHandler(t, "again"))
+
+	ended := waitClaudeBatchEnded(t, runner, "msgbatch_restart")
+	require.Equal(t, batch.RequestCounts{Succeeded: 1}, ended.RequestCounts)
+}
+
+func TestClaudeMessageBatches_ListAndNotFound(t *testing.T) {
+	store, err := batch.OpenStore(filepath.Join(t.TempDir(), "batch.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = store.Close() })
+	runner := newTestClaudeBatchRunner(t, store, stubClaudeMessagesHandler(t, "pong"))
+
+	first := createClaudeBatch(t, runner, `{"requests":[{"custom_id":"a","params":{}}]}`)
+	second := createClaudeBatch(t, runner, `{"requests":[{"custom_id":"a","params":{}}]}`)
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/messages/batches?limit=1", nil)
+	w := httptest.NewRecorder()
+	runner.handleList(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	var list claudeMessageBatchList
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	require.True(t, list.HasMore)
+	require.Len(t, list.Data, 1)
+	require.Equal(t, second.ID, list.Data[0].ID)
+
+	req = httptest.NewRequest(http.MethodGet, "/v1/messages/batches?limit=1&after_id="+second.ID, nil)
+	w = httptest.NewRecorder()
+	runner.handleList(w, req)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	require.False(t, list.HasMore)
+	require.Equal(t, first.ID, list.Data[0].ID)
+
+	req = httptest.NewRequest(http.MethodGet, "/v1/messages/batches/msgbatch_missing", bytes.NewReader(nil))
+	req.SetPathValue("batch_id", "msgbatch_missing")
+	w = httptest.NewRecorder()
+	runner.handleGet(w, req)
+	require.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestBatchQueue_CancelBetweenClaimAndRun(t *testing.T) {
+	store, err := batch.OpenStore(filepath.Join(t.TempDir(), "batch.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = store.Close() })
+	now := time.Now()
+	require.NoError(t, store.CreateMessageBatch(batch.MessageBatch{
+		BatchID:   "msgbatch_claimed",
+		CreatedAt: now,
+		ExpiresAt: now.Add(time.Hour),
+	}, []batch.MessageBatchRequest{{CustomID: "a", Params: `{}`}}))
+
+	queue := newBatchQueue(1)
+	var inflight *batchInflight
+	req, ok, err := store.ClaimMessageBatchRequest(now, func(req batch.MessageBatchRequest) {
+		inflight = queue.track(req.BatchID, req.ID)
+	})
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.NotNil(t, inflight)
+
+	// 领取之后、开始执行之前到来的取消也必须生效。
+	queue.cancelInflight(req.BatchID)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	inflight.bind(cancel)
+	require.Error(t, ctx.Err())
+	require.True(t, inflight.wasCanceled())
+}
+
+func TestClaudeMessageBatchesHandlers_RejectsSecondConstructionOnSameStore(t *testing.T) {
+	store, err := batch.OpenStore(filepath.Join(t.TempDir(), "batch.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = store.Close() })
+	cfg := Config{
+		Batches:      store,
+		AuthProvider: func(ctx context.Context) (string, string, error) { return "token", "", nil },
+	}
+
+	_, err = ClaudeMessageBatchesHandlers(cfg)
+	require.NoError(t, err)
+	// 第二次构造会带着另一份配置启动重复的 worker，必须显式拒绝而不是静默沿用第一份配置。
+	_, err = ClaudeMessageBatchesHandlers(cfg)
+	require.ErrorIs(t, err, batch.ErrWorkersAttached)
+}
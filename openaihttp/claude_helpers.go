@@ -8,7 +8,6 @@ import (
 	"os"
 	"strings"
 
-	"github.com/LubyRuffy/gptb2o"
 	"github.com/LubyRuffy/gptb2o/backend"
 	"github.com/cloudwego/eino/schema"
 )
@@ -293,40 +292,6 @@ func debugClaudeTaskToolCall(name string, callID string, args string, status str
 	log.Printf("[gptb2o][claude-tools] bootstrap call: tool=%s id=%s status=%s args=%q", strings.TrimSpace(name), strings.TrimSpace(callID), strings.TrimSpace(status), trimmed)
 }
 
-func normalizeClaudeModel(model string) string {
-	trimmed := strings.TrimSpace(model)
-	if trimmed == "" {
-		return ""
-	}
-	lower := strings.ToLower(trimmed)
-	// Claude Code CLI 支持简写别名（例如 --model sonnet/opus/haiku）。
-	// 我们将其映射到内部可用的模型，确保 CLI 直接使用别名也能跑通。
-	switch lower {
-	case "sonnet", "opus":
-		return gptb2o.DefaultModelFullID
-	case "haiku":
-		return gptb2o.ModelNamespace + "gpt-5.4-mini"
-	}
-	if strings.HasPrefix(lower, "claude-haiku") {
-		return gptb2o.ModelNamespace + "gpt-5.4-mini"
-	}
-	if strings.HasPrefix(lower, "claude-") {
-		return gptb2o.DefaultModelFullID
-	}
-	if strings.HasPrefix(trimmed, gptb2o.ModelNamespace) || strings.HasPrefix(trimmed, gptb2o.LegacyModelNamespace) {
-		return trimmed
-	}
-	return gptb2o.ModelNamespace + trimmed
-}
-
-func resolveClaudeModelID(model string) (string, error) {
-	candidate := normalizeClaudeModel(model)
-	if !gptb2o.IsSupportedModelID(candidate) {
-		return "", fmt.Errorf("unsupported model")
-	}
-	return gptb2o.NormalizeModelID(candidate), nil
-}
-
 func writeClaudeError(w http.ResponseWriter, statusCode int, message string) {
 	type claudeErrBody struct {
 		Type  string `json:"type"`
@@ -349,6 +314,16 @@ func writeClaudeError(w http.ResponseWriter, statusCode int, message string) {
 	_ = json.NewEncoder(w).Encode(body)
 }
 
+// writeClaudeTypedError 与 writeClaudeError 相同，但 error.type 按状态码选择（如 401 authentication_error、529 overloaded_error）。
+func writeClaudeTypedError(w http.ResponseWriter, statusCode int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"type":  "error",
+		"error": map[string]string{"type": claudeErrorTypeForStatus(statusCode), "message": message},
+	})
+}
+
 // stripJSONField removes a top-level field from a JSON object string.
 // Returns the original string if parsing fails or the field is absent.
 func stripJSONField(jsonStr string, field string) string {
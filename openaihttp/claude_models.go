@@ -41,30 +41,25 @@ func isClaudeAPIRequest(r *http.Request) bool {
 	return strings.Contains(ua, "claude")
 }
 
-func claudeModelDisplayName(modelID string) string {
+// claudeModelDisplayName 优先返回目录中的模型展示名；精确别名（如 sonnet）首字母大写展示。
+func claudeModelDisplayName(models *gptb2o.ModelRegistry, modelID string) string {
 	trimmed := strings.TrimSpace(modelID)
 	if trimmed == "" {
 		return "Model"
 	}
-	switch strings.ToLower(trimmed) {
-	case "sonnet":
-		return "Sonnet"
-	case "opus":
-		return "Opus"
-	case "haiku":
-		return "Haiku"
+	if m, ok := models.Lookup(trimmed); ok {
+		return m.Name
 	}
-
-	normalized := gptb2o.NormalizeModelID(trimmed)
-	for _, m := range gptb2o.PresetModels() {
-		if strings.EqualFold(strings.TrimSpace(m.ID), trimmed) || strings.EqualFold(gptb2o.NormalizeModelID(m.ID), normalized) {
-			return m.Name
+	lower := strings.ToLower(trimmed)
+	for _, a := range models.Aliases() {
+		if !a.IsPattern() && a.Pattern == lower {
+			return strings.ToUpper(lower[:1]) + lower[1:]
 		}
 	}
 	return trimmed
 }
 
-func claudeModelInfoForID(modelID string) claudeModelInfo {
+func claudeModelInfoForID(models *gptb2o.ModelRegistry, modelID string) claudeModelInfo {
 	modelID = strings.TrimSpace(modelID)
 	if decoded, err := url.PathUnescape(modelID); err == nil && strings.TrimSpace(decoded) != "" {
 		modelID = decoded
@@ -72,12 +67,12 @@ func claudeModelInfoForID(modelID string) claudeModelInfo {
 	return claudeModelInfo{
 		Type:        "model",
 		ID:          modelID,
-		DisplayName: claudeModelDisplayName(modelID),
+		DisplayName: claudeModelDisplayName(models, modelID),
 		CreatedAt:   claudeModelEpochCreatedAt,
 	}
 }
 
-func claudeModelsList() []claudeModelInfo {
+func claudeModelsList(models *gptb2o.ModelRegistry) []claudeModelInfo {
 	out := make([]claudeModelInfo, 0, 8)
 	seen := make(map[string]struct{}, 32)
 	add := func(id string) {
@@ -90,28 +85,34 @@ func claudeModelsList() []claudeModelInfo {
 			return
 		}
 		seen[key] = struct{}{}
-		out = append(out, claudeModelInfoForID(id))
+		out = append(out, claudeModelInfoForID(models, id))
 	}
 
-	// Claude Code CLI 常用别名，优先置顶。
-	add("sonnet")
-	add("opus")
-	add("haiku")
-
-	for _, m := range gptb2o.PresetModels() {
-		add(m.ID)
+	// 精确别名（Claude Code CLI 常用的 sonnet/opus/haiku 与配置的自定义别名）优先置顶。
+	for _, a := range models.Aliases() {
+		if !a.IsPattern() {
+			add(a.Pattern)
+		}
+	}
+	for _, m := range models.Models() {
+		add(m.FullID())
 	}
 	return out
 }
 
+// ClaudeModelsListHandler 按 gptb2o.DefaultModelRegistry 输出 Claude 格式的模型列表。
 func ClaudeModelsListHandler() http.HandlerFunc {
+	return claudeModelsListHandler(gptb2o.DefaultModelRegistry)
+}
+
+func claudeModelsListHandler(models func() *gptb2o.ModelRegistry) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet {
 			writeClaudeError(w, http.StatusMethodNotAllowed, "method not allowed")
 			return
 		}
 
-		data := claudeModelsList()
+		data := claudeModelsList(models())
 		firstID := ""
 		lastID := ""
 		if len(data) > 0 {
@@ -700,10 +700,19 @@ func mustRawJSONString(t *testing.T, s string) json.RawMessage {
 	return b
 }
 
-func TestNormalizeClaudeModel_Aliases(t *testing.T) {
-	require.Equal(t, gptb2o.DefaultModelFullID, normalizeClaudeModel("sonnet"))
-	require.Equal(t, gptb2o.DefaultModelFullID, normalizeClaudeModel("OPUS"))
-	require.Equal(t, gptb2o.ModelNamespace+"gpt-5.4-mini", normalizeClaudeModel("haiku"))
+func TestDefaultModelRegistry_ClaudeAliases(t *testing.T) {
+	models := gptb2o.DefaultModelRegistry()
+	for alias, want := range map[string]string{
+		"sonnet":                    gptb2o.DefaultModelID,
+		"OPUS":                      gptb2o.DefaultModelID,
+		"haiku":                     "gpt-5.4-mini",
+		"claude-haiku-4-5-20251001": "gpt-5.4-mini",
+		"claude-sonnet-4-5":         gptb2o.DefaultModelID,
+	} {
+		info, ok := models.Resolve(alias)
+		require.True(t, ok, alias)
+		require.Equal(t, want, info.ID, alias)
+	}
 }
 
 func TestToolCallArgumentsForClaudeStream_RequiresCompletedAndJSONObject(t *testing.T) {
@@ -901,3 +910,33 @@ func TestClaudeMessages_Stream_MaxTokens(t *testing.T) {
 	require.Equal(t, "abcd", gotText.String())
 	require.Equal(t, "max_tokens", stopReason)
 }
+
+func TestClaudeMessages_Stream_MaxTokensKeepsRunesWhole(t *testing.T) {
+	h, err := newClaudeCompatHandler(claudeCompatConfig{
+		Now: time.Now,
+		NewChatModel: func(ctx context.Context, modelID string, tools []openaiapi.OpenAITool, toolCallHandler func(*backend.ToolCall)) (chatModel, error) {
+			return &stubChatModel{streamMsgs: []*schema.Message{{Content: "ab"}, {Content: "你好"}}}, nil
+		},
+		WriteJSON:  writeJSON,
+		WriteError: writeClaudeError,
+	})
+	require.NoError(t, err)
+
+	// max_tokens=1 折算为 4 字节预算，"ab" 之后只剩 2 字节，不足以容纳一个汉字。
+	body := []byte(`{"model":"gpt-5.4","messages":[{"role":"user","content":"hello"}],"stream":true,"max_tokens":1}`)
+	req := httptest.NewRequest(http.MethodPost, "/v1/messages", bytes.NewReader(body))
+	w := httptest.NewRecorder()
+
+	h.handleMessages(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NotContains(t, w.Body.String(), `\ufffd`)
+
+	var gotText strings.Builder
+	for _, ev := range parseClaudeSSEEvents(t, w.Body.String()) {
+		if ev.Name == "content_block_delta" {
+			delta, _ := ev.Data["delta"].(map[string]any)
+			gotText.WriteString(stringValue(delta["text"]))
+		}
+	}
+	require.Equal(t, "ab", gotText.String())
+}
@@ -72,58 +72,11 @@ func normalizeClaudeStopSequences(raw []string) []string {
 	if len(raw) == 0 {
 		return nil
 	}
-	out := make([]string, 0, len(raw))
-	seen := make(map[string]struct{}, len(raw))
+	trimmed := make([]string, 0, len(raw))
 	for _, s := range raw {
-		trimmed := strings.TrimSpace(s)
-		if trimmed == "" {
-			continue
-		}
-		if _, ok := seen[trimmed]; ok {
-			continue
-		}
-		seen[trimmed] = struct{}{}
-		out = append(out, trimmed)
-	}
-	if len(out) == 0 {
-		return nil
-	}
-	return out
-}
-
-func maxClaudeStopSequenceLen(stopSequences []string) int {
-	maxLen := 0
-	for _, s := range stopSequences {
-		if len(s) > maxLen {
-			maxLen = len(s)
-		}
-	}
-	return maxLen
-}
-
-func findFirstClaudeStopSequence(s string, stopSequences []string) (int, string, bool) {
-	if s == "" || len(stopSequences) == 0 {
-		return 0, "", false
-	}
-	bestIdx := -1
-	bestSeq := ""
-	for _, seq := range stopSequences {
-		if seq == "" {
-			continue
-		}
-		idx := strings.Index(s, seq)
-		if idx < 0 {
-			continue
-		}
-		if bestIdx < 0 || idx < bestIdx || (idx == bestIdx && len(seq) > len(bestSeq)) {
-			bestIdx = idx
-			bestSeq = seq
-		}
-	}
-	if bestIdx < 0 {
-		return 0, "", false
+		trimmed = append(trimmed, strings.TrimSpace(s))
 	}
-	return bestIdx, bestSeq, true
+	return normalizeStopSequences(trimmed)
 }
 
 func limitClaudeText(text string, stopSequences []string, maxTokens int) (string, string, *string) {
@@ -132,7 +85,7 @@ func limitClaudeText(text string, stopSequences []string, maxTokens int) (string
 		return "", "", nil
 	}
 
-	stopIdx, stopSeq, hasStop := findFirstClaudeStopSequence(text, stopSequences)
+	stopIdx, stopSeq, hasStop := findFirstStopSequence(text, stopSequences)
 	cut := len(text)
 	reason := ""
 	var seqPtr *string
@@ -49,6 +49,8 @@ type compatConfig struct {
 	WriteJSON         func(w http.ResponseWriter, data interface{})
 	WriteOpenAIError  func(w http.ResponseWriter, statusCode int, message string)
 	NewChatModel      func(ctx context.Context, modelID string, tools []openaiapi.OpenAITool, toolCallHandler func(*backend.ToolCall)) (chatModel, error)
+	// Models 可选，返回当前模型目录；为 nil 时使用 gptb2o.DefaultModelRegistry。
+	Models            func() *gptb2o.ModelRegistry
 	SystemFingerprint string
 }
 
@@ -58,6 +60,7 @@ type compatHandler struct {
 	writeJSON         func(w http.ResponseWriter, data interface{})
 	writeOpenAIError  func(w http.ResponseWriter, statusCode int, message string)
 	newChatModel      func(ctx context.Context, modelID string, tools []openaiapi.OpenAITool, toolCallHandler func(*backend.ToolCall)) (chatModel, error)
+	models            func() *gptb2o.ModelRegistry
 	systemFingerprint string
 }
 
@@ -80,12 +83,16 @@ func newCompatHandler(cfg compatConfig) (*compatHandler, error) {
 	if strings.TrimSpace(cfg.SystemFingerprint) == "" {
 		cfg.SystemFingerprint = defaultSystemFingerprint
 	}
+	if cfg.Models == nil {
+		cfg.Models = gptb2o.DefaultModelRegistry
+	}
 	return &compatHandler{
 		now:               cfg.Now,
 		newChatCompletion: cfg.NewChatCompletion,
 		writeJSON:         cfg.WriteJSON,
 		writeOpenAIError:  cfg.WriteOpenAIError,
 		newChatModel:      cfg.NewChatModel,
+		models:            cfg.Models,
 		systemFingerprint: cfg.SystemFingerprint,
 	}, nil
 }
@@ -96,15 +103,22 @@ func (h *compatHandler) handleModels(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	presetModels := gptb2o.PresetModels()
-	modelsList := make([]openaiapi.OpenAIModel, 0, len(presetModels))
+	models := h.models().Models()
+	modelsList := make([]openaiapi.OpenAIModel, 0, len(models))
 	now := h.now().Unix()
-	for _, m := range presetModels {
+	for _, m := range models {
 		modelsList = append(modelsList, openaiapi.OpenAIModel{
-			ID:      m.ID,
-			Object:  "model",
-			Created: now,
-			OwnedBy: "chatgpt-backend",
+			ID:            m.FullID(),
+			Object:        "model",
+			Created:       now,
+			OwnedBy:       "chatgpt-backend",
+			DisplayName:   m.Name,
+			ContextWindow: m.ContextWindow,
+			Capabilities: &openaiapi.OpenAIModelCapabilities{
+				Tools:  m.Capabilities.Tools,
+				Vision: m.Capabilities.Vision,
+				XHigh:  m.Capabilities.XHigh,
+			},
 		})
 	}
 
@@ -130,22 +144,32 @@ func (h *compatHandler) handleChatCompletions(w http.ResponseWriter, r *http.Req
 		h.writeOpenAIError(w, http.StatusBadRequest, "model is required")
 		return
 	}
-	if !gptb2o.IsSupportedModelID(req.Model) {
+	modelInfo, ok := h.models().Resolve(req.Model)
+	if !ok {
 		h.writeOpenAIError(w, http.StatusBadRequest, "unsupported model")
 		return
 	}
+	if err := toolsUnsupportedError(modelInfo, len(req.Tools)); err != nil {
+		h.writeOpenAIError(w, httpStatusFromError(err), httpMessageFromError(err))
+		return
+	}
 
 	messages, err := convertOpenAIChatMessages(req.Messages)
 	if err != nil {
 		h.writeOpenAIError(w, http.StatusBadRequest, err.Error())
 		return
 	}
+	stopSequences, err := parseOpenAIStopSequences(req.Stop)
+	if err != nil {
+		h.writeOpenAIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
 
-	modelID := gptb2o.NormalizeModelID(req.Model)
+	modelID := modelInfo.ID
 	chatID := h.newChatCompletion()
 
 	if req.Stream {
-		h.handleStreamResponse(w, r, chatID, req.Model, modelID, messages, req.Tools)
+		h.handleStreamResponse(w, r, chatID, req.Model, modelID, messages, req.Tools, stopSequences)
 		return
 	}
 
@@ -157,6 +181,14 @@ func (h *compatHandler) handleChatCompletions(w http.ResponseWriter, r *http.Req
 
 	respMsg, err := chatModel.Generate(r.Context(), messages)
 	if err != nil {
+		if isServerShuttingDown(r.Context()) {
+			h.writeOpenAIError(w, http.StatusServiceUnavailable, ErrServerShuttingDown.Error())
+			return
+		}
+		if timeoutErr, ok := backend.AsStreamTimeout(r.Context(), err); ok {
+			h.writeOpenAIError(w, http.StatusGatewayTimeout, timeoutErr.Error())
+			return
+		}
 		h.writeOpenAIError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
@@ -165,6 +197,7 @@ func (h *compatHandler) handleChatCompletions(w http.ResponseWriter, r *http.Req
 	if respMsg != nil {
 		content = respMsg.Content
 	}
+	content, _, _ = truncateAtStopSequence(content, stopSequences)
 	finishReason := "stop"
 
 	completion := openaiapi.OpenAIChatCompletion{
@@ -195,6 +228,7 @@ func (h *compatHandler) handleStreamResponse(
 	chatID, modelName, modelID string,
 	messages []*schema.Message,
 	tools []openaiapi.OpenAITool,
+	stopSequences []string,
 ) {
 	w.Header().Set("Content-Type", "text/event-stream")
 	w.Header().Set("Cache-Control", "no-cache")
@@ -207,8 +241,12 @@ func (h *compatHandler) handleStreamResponse(
 		return
 	}
 
+	// 命中 stop sequence 后取消 backend 请求，避免继续消耗 token。
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
 	toolCallChan := make(chan *backend.ToolCall, 16)
-	chatModel, err := h.newChatModel(r.Context(), modelID, tools, func(call *backend.ToolCall) {
+	chatModel, err := h.newChatModel(ctx, modelID, tools, func(call *backend.ToolCall) {
 		if call == nil {
 			return
 		}
@@ -223,11 +261,12 @@ func (h *compatHandler) handleStreamResponse(
 		return
 	}
 
-	sr, err := chatModel.Stream(r.Context(), messages)
+	sr, err := chatModel.Stream(ctx, messages)
 	if err != nil {
 		h.writeOpenAIError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
+	defer sr.Close()
 	flusher.Flush()
 
 	toolCallIndexMap := make(map[string]int)
@@ -268,21 +307,43 @@ func (h *compatHandler) handleStreamResponse(
 		}
 	}
 
+	writeContent := func(content string) {
+		if content == "" {
+			return
+		}
+		chunk := openaiapi.ToChatChunk(chatID, modelName, content, nil, h.systemFingerprint)
+		data, _ := json.Marshal(chunk)
+		fmt.Fprintf(w, "data: %s\n\n", data)
+		flusher.Flush()
+	}
+
+	stopMatcher := newStopSequenceMatcher(stopSequences)
 	for {
 		flushToolCalls()
 		msg, err := sr.Recv()
 		if err != nil {
 			flushToolCalls()
+			if isServerShuttingDown(ctx) {
+				writeOpenAIStreamError(w, flusher, http.StatusServiceUnavailable, ErrServerShuttingDown.Error())
+				return
+			}
+			if timeoutErr, ok := backend.AsStreamTimeout(ctx, err); ok {
+				writeOpenAIStreamError(w, flusher, http.StatusGatewayTimeout, timeoutErr.Error())
+				return
+			}
 			break
 		}
 		if msg == nil || msg.Content == "" {
 			continue
 		}
-		chunk := openaiapi.ToChatChunk(chatID, modelName, msg.Content, nil, h.systemFingerprint)
-		data, _ := json.Marshal(chunk)
-		fmt.Fprintf(w, "data: %s\n\n", data)
-		flusher.Flush()
+		content, stopped := stopMatcher.push(msg.Content)
+		writeContent(content)
+		if stopped {
+			cancel()
+			break
+		}
 	}
+	writeContent(stopMatcher.flush())
 	flushToolCalls()
 
 	finishReason := "stop"
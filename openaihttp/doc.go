@@ -2,13 +2,21 @@
 //
 // 该包对外只暴露：
 // - net/http 形式的 handlers（models/chat.completions/responses）
-// - Gin 路由注册方法
+// - 注册全部路由的 http.Handler（NewHandler，基于 Go 1.22 http.ServeMux）
+// - Gin 路由注册方法（与 NewHandler 共用同一张路由表）
 //
 // 鉴权信息仅通过回调注入（AuthProvider），该包不会读取本地 auth.json。
 //
 // 使用示例：
 //
-//	// net/http
+//	// net/http / chi：一次挂载全部路由
+//	h, _ := openaihttp.NewHandler(openaihttp.Config{
+//		BasePath:     "/v1",
+//		AuthProvider: func(ctx context.Context) (string, string, error) { return accessToken, accountID, nil },
+//	})
+//	mux.Handle("/v1/", h)
+//
+//	// net/http：单独使用各 handler
 //	modelsH, chatH, responsesH, _ := openaihttp.Handlers(openaihttp.Config{
 //		AuthProvider: func(ctx context.Context) (string, string, error) {
 //			return accessToken, accountID, nil
@@ -9,7 +9,10 @@ import (
 
 	"github.com/LubyRuffy/gptb2o"
 	"github.com/LubyRuffy/gptb2o/backend"
+	"github.com/LubyRuffy/gptb2o/batch"
+	"github.com/LubyRuffy/gptb2o/metrics"
 	"github.com/LubyRuffy/gptb2o/openaiapi"
+	"github.com/LubyRuffy/gptb2o/telemetry"
 	"github.com/LubyRuffy/gptb2o/trace"
 )
 
@@ -29,6 +32,7 @@ func Handlers(cfg Config) (modelsHandler http.HandlerFunc, chatHandler http.Hand
 		WriteOpenAIError:  writeOpenAIError,
 		SystemFingerprint: resolved.SystemFingerprint,
 		NewChatModel:      chatModelFactory,
+		Models:            resolved.Settings.models,
 	})
 	if err != nil {
 		return nil, nil, nil, err
@@ -42,6 +46,8 @@ func Handlers(cfg Config) (modelsHandler http.HandlerFunc, chatHandler http.Hand
 		chatHandler = wrapWithTracer(resolved.Tracer, chatHandler)
 		responsesHandler = wrapWithTracer(resolved.Tracer, responsesHandler)
 	}
+	chatHandler = instrumentHandler(resolved, metrics.RouteChatCompletions, chatHandler)
+	responsesHandler = instrumentHandler(resolved, metrics.RouteResponses, responsesHandler)
 	return modelsHandler, chatHandler, responsesHandler, nil
 }
 
@@ -53,16 +59,18 @@ func ClaudeMessagesHandler(cfg Config) (http.HandlerFunc, error) {
 	h, err := newClaudeCompatHandler(claudeCompatConfig{
 		Now:          time.Now,
 		NewChatModel: newChatModelFactory(resolved),
+		Models:       resolved.Settings.models,
 		WriteJSON:    writeJSON,
 		WriteError:   writeClaudeError,
 	})
 	if err != nil {
 		return nil, err
 	}
+	handler := h.handleMessages
 	if resolved.Tracer != nil {
-		return wrapWithTracer(resolved.Tracer, h.handleMessages), nil
+		handler = wrapWithTracer(resolved.Tracer, handler)
 	}
-	return h.handleMessages, nil
+	return instrumentHandler(resolved, metrics.RouteMessages, handler), nil
 }
 
 func ClaudeCountTokensHandler(cfg Config) (http.HandlerFunc, error) {
@@ -73,16 +81,18 @@ func ClaudeCountTokensHandler(cfg Config) (http.HandlerFunc, error) {
 	h, err := newClaudeCompatHandler(claudeCompatConfig{
 		Now:          time.Now,
 		NewChatModel: newChatModelFactory(resolved),
+		Models:       resolved.Settings.models,
 		WriteJSON:    writeJSON,
 		WriteError:   writeClaudeError,
 	})
 	if err != nil {
 		return nil, err
 	}
+	handler := h.handleCountTokens
 	if resolved.Tracer != nil {
-		return wrapWithTracer(resolved.Tracer, h.handleCountTokens), nil
+		handler = wrapWithTracer(resolved.Tracer, handler)
 	}
-	return h.handleCountTokens, nil
+	return instrumentHandler(resolved, metrics.RouteCountTokens, handler), nil
 }
 
 func newChatModelFactory(resolved resolvedConfig) func(ctx context.Context, modelID string, tools []openaiapi.OpenAITool, toolCallHandler func(*backend.ToolCall)) (chatModel, error) {
@@ -103,7 +113,10 @@ func newChatModelFactory(resolved resolvedConfig) func(ctx context.Context, mode
 			AccountID:       accountID,
 			HTTPClient:      resolved.HTTPClient,
 			Originator:      resolved.Originator,
-			ReasoningEffort: resolved.ReasoningEffort,
+			ReasoningEffort: resolved.Settings.defaultReasoningEffort(modelID, resolved.ReasoningEffort),
+			OnRetry:         metricsRetryHook(resolved.Metrics),
+			Telemetry:       resolved.Telemetry,
+			Timeouts:        resolved.Timeouts,
 		})
 		if err != nil {
 			return nil, &httpError{
@@ -129,14 +142,28 @@ func newChatModelFactory(resolved resolvedConfig) func(ctx context.Context, mode
 }
 
 type resolvedConfig struct {
-	BasePath          string
-	BackendURL        string
-	HTTPClient        *http.Client
-	AuthProvider      AuthProvider
-	Originator        string
-	ReasoningEffort   string
-	SystemFingerprint string
-	Tracer            *trace.Tracer
+	BasePath                string
+	BackendURL              string
+	HTTPClient              *http.Client
+	AuthProvider            AuthProvider
+	Originator              string
+	ReasoningEffort         string
+	SystemFingerprint       string
+	Tracer                  *trace.Tracer
+	Metrics                 *metrics.Metrics
+	Telemetry               *telemetry.Tracer
+	Batches                 *batch.Store
+	BatchConcurrency        int
+	Version                 string
+	AuthSource              string
+	BackendProbeTTL         time.Duration
+	Settings                *SettingsStore
+	ModelsURL               string
+	ModelsTTL               time.Duration
+	Timeouts                backend.StreamTimeouts
+	WebSocketAllowedOrigins []string
+	modelDiscovery          *modelDiscovery
+	admission               *admissionController
 }
 
 func resolveConfig(cfg Config) (resolvedConfig, error) {
@@ -158,6 +185,14 @@ func resolveConfig(cfg Config) (resolvedConfig, error) {
 		cloned.Transport = cfg.Tracer.WrapTransport(client.Transport)
 		client = &cloned
 	}
+	if cfg.Metrics != nil {
+		cloned := *client
+		cloned.Transport = wrapTransportWithMetrics(cfg.Metrics, client.Transport)
+		client = &cloned
+		if sink, ok := cfg.Tracer.Sink().(interface{ DroppedWrites() uint64 }); ok {
+			cfg.Metrics.TrackTraceDroppedWrites(sink.DroppedWrites)
+		}
+	}
 
 	originator := strings.TrimSpace(cfg.Originator)
 	if originator == "" {
@@ -170,16 +205,64 @@ func resolveConfig(cfg Config) (resolvedConfig, error) {
 		fp = defaultSystemFingerprint
 	}
 
-	return resolvedConfig{
-		BasePath:          normalizeBasePath(cfg.BasePath),
-		BackendURL:        backendURL,
-		HTTPClient:        client,
-		AuthProvider:      cfg.AuthProvider,
-		Originator:        originator,
-		ReasoningEffort:   reasoningEffort,
-		SystemFingerprint: fp,
-		Tracer:            cfg.Tracer,
-	}, nil
+	resolved := resolvedConfig{
+		BasePath:                normalizeBasePath(cfg.BasePath),
+		BackendURL:              backendURL,
+		HTTPClient:              client,
+		AuthProvider:            cfg.AuthProvider,
+		Originator:              originator,
+		ReasoningEffort:         reasoningEffort,
+		SystemFingerprint:       fp,
+		Tracer:                  cfg.Tracer,
+		Metrics:                 cfg.Metrics,
+		Telemetry:               cfg.Telemetry,
+		Batches:                 cfg.Batches,
+		BatchConcurrency:        cfg.BatchConcurrency,
+		Version:                 strings.TrimSpace(cfg.Version),
+		AuthSource:              strings.TrimSpace(cfg.AuthSource),
+		BackendProbeTTL:         cfg.BackendProbeTTL,
+		Settings:                cfg.Settings,
+		ModelsURL:               strings.TrimSpace(cfg.ModelsURL),
+		ModelsTTL:               cfg.ModelsTTL,
+		WebSocketAllowedOrigins: cfg.WebSocketAllowedOrigins,
+		Timeouts: backend.StreamTimeouts{
+			Connect:    cfg.ConnectTimeout,
+			FirstEvent: cfg.FirstEventTimeout,
+			Idle:       cfg.IdleTimeout,
+			Total:      cfg.RequestTimeout,
+		},
+	}
+	resolved.admission = cfg.admission
+	if resolved.admission == nil {
+		resolved.admission = newAdmissionController(cfg.MaxConcurrentRequests, cfg.MaxQueuedRequests, cfg.MaxQueueWait)
+	}
+	switch {
+	case cfg.Settings != nil && cfg.Settings.discovery != nil:
+		resolved.modelDiscovery = cfg.Settings.discovery
+	case resolved.ModelsURL != "":
+		resolved.modelDiscovery = newModelDiscovery(resolved)
+		resolved.Settings = cfg.Settings.withDiscovery(resolved.modelDiscovery)
+	}
+	return resolved, nil
+}
+
+// shareRouteState 让同一张路由表中的各个 handler 共用一份 backend 模型列表缓存与并发限制。
+func shareRouteState(cfg Config) (Config, error) {
+	resolved, err := resolveConfig(cfg)
+	if err != nil {
+		return Config{}, err
+	}
+	cfg.Settings = resolved.Settings
+	cfg.admission = resolved.admission
+	return cfg, nil
+}
+
+// instrumentHandler 在已包装 trace 的 handler 外依次套上并发限制、metrics 与 telemetry；telemetry 在最外层，
+// 以便在内层 trace 写入 interaction_id 响应头后读取；排队被拒的请求同样计入 metrics。
+func instrumentHandler(resolved resolvedConfig, route string, handler http.HandlerFunc) http.HandlerFunc {
+	handler = wrapWithAdmission(resolved.admission, route, handler)
+	handler = wrapWithMetrics(resolved.Metrics, resolved.Settings, route, handler)
+	return wrapWithTelemetry(resolved.Telemetry, route, handler)
 }
 
 func wrapWithTracer(tracer *trace.Tracer, handler http.HandlerFunc) http.HandlerFunc {
@@ -819,3 +819,100 @@ func TestResponses_ReasoningEffort_XHighUnsupported_RetryToHigh(t *testing.T) {
 	require.Equal(t, http.StatusOK, w.Code)
 	require.Equal(t, int32(2), atomic.LoadInt32(&callCount))
 }
+
+func TestChatCompletions_NonStream_StopSequenceTruncatesContent(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: {\"type\":\"response.output_text.delta\",\"delta\":\"first line\\nsecond line\"}\n\n")
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	t.Cleanup(backend.Close)
+
+	_, chatHandler, _, err := openaihttp.Handlers(openaihttp.Config{
+		BackendURL:   backend.URL,
+		HTTPClient:   backend.Client(),
+		AuthProvider: func(ctx context.Context) (string, string, error) { return "token", "acc", nil },
+	})
+	require.NoError(t, err)
+
+	reqBody := []byte(fmt.Sprintf(`{"model":%q,"messages":[{"role":"user","content":"hi"}],"stream":false,"stop":"\n"}`, gptb2o.ModelNamespace+"gpt-5.4"))
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", bytes.NewReader(reqBody))
+	w := httptest.NewRecorder()
+	chatHandler(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	var resp openaiapi.OpenAIChatCompletion
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.Len(t, resp.Choices, 1)
+	require.Equal(t, "first line", resp.Choices[0].Message.Content)
+	require.NotNil(t, resp.Choices[0].FinishReason)
+	require.Equal(t, "stop", *resp.Choices[0].FinishReason)
+}
+
+func TestChatCompletions_Stream_StopSequenceCancelsBackend(t *testing.T) {
+	backendCanceled := make(chan struct{})
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		flusher := w.(http.Flusher)
+		for _, delta := range []string{"hello EN", "D and more"} {
+			fmt.Fprintf(w, "data: {\"type\":\"response.output_text.delta\",\"delta\":%q}\n\n", delta)
+			flusher.Flush()
+		}
+		// 不主动结束流：只有代理侧取消请求，handler 才能返回。
+		<-r.Context().Done()
+		close(backendCanceled)
+	}))
+	t.Cleanup(backend.Close)
+
+	_, chatHandler, _, err := openaihttp.Handlers(openaihttp.Config{
+		BackendURL:   backend.URL,
+		HTTPClient:   backend.Client(),
+		AuthProvider: func(ctx context.Context) (string, string, error) { return "token", "acc", nil },
+	})
+	require.NoError(t, err)
+
+	reqBody := []byte(fmt.Sprintf(`{"model":%q,"messages":[{"role":"user","content":"hi"}],"stream":true,"stop":["END","###"]}`, gptb2o.ModelNamespace+"gpt-5.4"))
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", bytes.NewReader(reqBody))
+	w := httptest.NewRecorder()
+	chatHandler(w, req)
+	<-backendCanceled
+
+	require.Equal(t, http.StatusOK, w.Code)
+	var (
+		content      strings.Builder
+		finishReason string
+	)
+	for _, line := range strings.Split(w.Body.String(), "\n") {
+		data, ok := strings.CutPrefix(line, "data: ")
+		if !ok || data == "[DONE]" {
+			continue
+		}
+		var chunk openaiapi.OpenAIChatChunk
+		require.NoError(t, json.Unmarshal([]byte(data), &chunk))
+		for _, choice := range chunk.Choices {
+			if choice.Delta.Content != nil {
+				content.WriteString(*choice.Delta.Content)
+			}
+			if choice.FinishReason != nil {
+				finishReason = *choice.FinishReason
+			}
+		}
+	}
+	require.Equal(t, "hello ", content.String())
+	require.Equal(t, "stop", finishReason)
+	require.Contains(t, w.Body.String(), "data: [DONE]\n")
+}
+
+func TestChatCompletions_InvalidStopRejected(t *testing.T) {
+	_, chatHandler, _, err := openaihttp.Handlers(openaihttp.Config{
+		AuthProvider: func(ctx context.Context) (string, string, error) { return "token", "acc", nil },
+	})
+	require.NoError(t, err)
+
+	reqBody := []byte(fmt.Sprintf(`{"model":%q,"messages":[{"role":"user","content":"hi"}],"stop":[1]}`, gptb2o.ModelNamespace+"gpt-5.4"))
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", bytes.NewReader(reqBody))
+	w := httptest.NewRecorder()
+	chatHandler(w, req)
+
+	require.Equal(t, http.StatusBadRequest, w.Code)
+}
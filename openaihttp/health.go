@@ -0,0 +1,353 @@
+package openaihttp
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/LubyRuffy/gptb2o/trace"
+)
+
+// 诊断端点挂在根路径上，不受 BasePath 影响，便于 supervisor / k8s 探针使用固定路径。
+const (
+	HealthzPath   = "/healthz"
+	ReadyzPath    = "/readyz"
+	DebugInfoPath = "/debug/info"
+)
+
+const (
+	checkStatusOK          = "ok"
+	checkStatusUnavailable = "unavailable"
+	checkStatusSkipped     = "skipped"
+
+	readinessCheckTimeout = 5 * time.Second
+	redactedValue         = "REDACTED"
+)
+
+type readinessCheck struct {
+	Status    string     `json:"status"`
+	Error     string     `json:"error,omitempty"`
+	CheckedAt *time.Time `json:"checked_at,omitempty"`
+}
+
+type readinessResponse struct {
+	Status string                    `json:"status"`
+	Checks map[string]readinessCheck `json:"checks"`
+}
+
+type debugInfoResponse struct {
+	Version       string           `json:"version"`
+	GoVersion     string           `json:"go_version"`
+	StartedAt     time.Time        `json:"started_at"`
+	UptimeSeconds int64            `json:"uptime_seconds"`
+	Auth          debugInfoAuth    `json:"auth"`
+	Config        debugInfoConfig  `json:"config"`
+	Models        []debugInfoModel `json:"models"`
+	ModelAliases  []debugInfoAlias `json:"model_aliases"`
+	// ModelDiscovery 仅在配置了 ModelsURL 时输出。
+	ModelDiscovery *debugInfoModelDiscovery `json:"model_discovery,omitempty"`
+	// Admission 仅在启用 MaxConcurrentRequests 时输出。
+	Admission *admissionStatus `json:"admission,omitempty"`
+	Trace     *debugInfoTrace  `json:"trace"`
+}
+
+type debugInfoAuth struct {
+	Source          string `json:"source"`
+	AccountIDSuffix string `json:"account_id_suffix,omitempty"`
+	Error           string `json:"error,omitempty"`
+}
+
+type debugInfoConfig struct {
+	BasePath          string `json:"base_path"`
+	BackendURL        string `json:"backend_url"`
+	Originator        string `json:"originator"`
+	ReasoningEffort   string `json:"reasoning_effort"`
+	SystemFingerprint string `json:"system_fingerprint"`
+	Trace             bool   `json:"trace"`
+	Metrics           bool   `json:"metrics"`
+	OTLPEndpoint      string `json:"otlp_endpoint,omitempty"`
+	Batches           bool   `json:"batches"`
+	BatchConcurrency  int    `json:"batch_concurrency,omitempty"`
+	BackendProbeTTL   string `json:"backend_probe_ttl,omitempty"`
+	// 以下为 backend 超时，未设置时省略。
+	ConnectTimeout    string `json:"connect_timeout,omitempty"`
+	FirstEventTimeout string `json:"first_event_timeout,omitempty"`
+	IdleTimeout       string `json:"idle_timeout,omitempty"`
+	RequestTimeout    string `json:"request_timeout,omitempty"`
+}
+
+type debugInfoModel struct {
+	ID              string `json:"id"`
+	Name            string `json:"name"`
+	ReasoningEffort string `json:"reasoning_effort,omitempty"`
+	ContextWindow   int    `json:"context_window,omitempty"`
+	Tools           bool   `json:"tools"`
+	Vision          bool   `json:"vision"`
+	XHigh           bool   `json:"xhigh"`
+}
+
+type debugInfoAlias struct {
+	Pattern string `json:"pattern"`
+	Target  string `json:"target"`
+}
+
+type debugInfoModelDiscovery struct {
+	URL       string     `json:"url"`
+	TTL       string     `json:"ttl"`
+	Models    int        `json:"models"`
+	FetchedAt *time.Time `json:"fetched_at,omitempty"`
+	Error     string     `json:"error,omitempty"`
+}
+
+type debugInfoTrace struct {
+	trace.SinkStats
+	Error string `json:"error,omitempty"`
+}
+
+// diagnostics 实现 /healthz、/readyz 与 /debug/info。backend 探测结果按 BackendProbeTTL 缓存，
+// 避免探针频繁访问 ChatGPT backend。
+type diagnostics struct {
+	cfg       resolvedConfig
+	startedAt time.Time
+	now       func() time.Time
+
+	probeMu   sync.Mutex
+	probeAt   time.Time
+	probeErr  error
+	probeDone bool
+}
+
+func newDiagnostics(cfg resolvedConfig) *diagnostics {
+	return &diagnostics{cfg: cfg, startedAt: time.Now(), now: time.Now}
+}
+
+func buildDiagnosticsRoutes(cfg Config) ([]route, error) {
+	resolved, err := resolveConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	d := newDiagnostics(resolved)
+	return []route{
+		{http.MethodGet, HealthzPath, d.handleHealthz},
+		{http.MethodGet, ReadyzPath, d.handleReadyz},
+		{http.MethodGet, DebugInfoPath, requireAPIKey(resolved.Settings, d.handleDebugInfo)},
+	}, nil
+}
+
+// handleHealthz 只表示进程存活，不做任何依赖检查。
+func (d *diagnostics) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, map[string]string{"status": checkStatusOK})
+}
+
+func (d *diagnostics) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	ready := d.readiness(r.Context())
+	w.Header().Set("Content-Type", "application/json")
+	if ready.Status != checkStatusOK {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	writeJSON(w, ready)
+}
+
+func (d *diagnostics) readiness(ctx context.Context) readinessResponse {
+	ctx, cancel := context.WithTimeout(ctx, readinessCheckTimeout)
+	defer cancel()
+
+	checks := map[string]readinessCheck{
+		"auth":    toReadinessCheck(d.checkAuth(ctx)),
+		"trace":   toReadinessCheck(d.checkTrace(ctx)),
+		"backend": d.checkBackend(ctx),
+	}
+	status := checkStatusOK
+	for _, check := range checks {
+		if check.Status == checkStatusUnavailable {
+			status = checkStatusUnavailable
+		}
+	}
+	return readinessResponse{Status: status, Checks: checks}
+}
+
+func toReadinessCheck(err error) readinessCheck {
+	if err != nil {
+		return readinessCheck{Status: checkStatusUnavailable, Error: err.Error()}
+	}
+	return readinessCheck{Status: checkStatusOK}
+}
+
+func (d *diagnostics) checkAuth(ctx context.Context) error {
+	accessToken, _, err := d.cfg.AuthProvider(ctx)
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(accessToken) == "" {
+		return fmt.Errorf("auth provider returned an empty access token")
+	}
+	return nil
+}
+
+// checkTrace 在未启用 trace 或 Sink 未实现 trace.HealthChecker 时视为就绪。
+func (d *diagnostics) checkTrace(ctx context.Context) error {
+	checker, ok := d.cfg.Tracer.Sink().(trace.HealthChecker)
+	if !ok {
+		return nil
+	}
+	return checker.CheckWritable(ctx)
+}
+
+// checkBackend 探测 BackendURL 是否可达：只要拿到非 5xx 响应即可（未带认证时 backend 返回 4xx 属正常）。
+// BackendProbeTTL <= 0 时跳过；结果在 TTL 内复用。
+func (d *diagnostics) checkBackend(ctx context.Context) readinessCheck {
+	if d.cfg.BackendProbeTTL <= 0 {
+		return readinessCheck{Status: checkStatusSkipped}
+	}
+
+	d.probeMu.Lock()
+	defer d.probeMu.Unlock()
+	if !d.probeDone || d.now().Sub(d.probeAt) >= d.cfg.BackendProbeTTL {
+		d.probeErr = d.probeBackend(ctx)
+		d.probeAt = d.now()
+		d.probeDone = true
+	}
+	checkedAt := d.probeAt
+	check := toReadinessCheck(d.probeErr)
+	check.CheckedAt = &checkedAt
+	return check
+}
+
+func (d *diagnostics) probeBackend(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, d.cfg.BackendURL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", d.cfg.Originator)
+	resp, err := d.cfg.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("backend unreachable: %w", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return fmt.Errorf("backend probe returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func (d *diagnostics) handleDebugInfo(w http.ResponseWriter, r *http.Request) {
+	now := d.now()
+	info := debugInfoResponse{
+		Version:       d.cfg.Version,
+		GoVersion:     runtime.Version(),
+		StartedAt:     d.startedAt,
+		UptimeSeconds: int64(now.Sub(d.startedAt).Seconds()),
+		Auth:          debugInfoAuth{Source: d.cfg.AuthSource},
+		Config: debugInfoConfig{
+			BasePath:          d.cfg.BasePath,
+			BackendURL:        redactURL(d.cfg.BackendURL),
+			Originator:        d.cfg.Originator,
+			ReasoningEffort:   d.cfg.ReasoningEffort,
+			SystemFingerprint: d.cfg.SystemFingerprint,
+			Trace:             d.cfg.Tracer.Sink() != nil,
+			Metrics:           d.cfg.Metrics != nil,
+			OTLPEndpoint:      redactURL(d.cfg.Telemetry.Endpoint()),
+			Batches:           d.cfg.Batches != nil,
+		},
+	}
+	if info.Config.Batches {
+		info.Config.BatchConcurrency = d.cfg.BatchConcurrency
+	}
+	if d.cfg.BackendProbeTTL > 0 {
+		info.Config.BackendProbeTTL = d.cfg.BackendProbeTTL.String()
+	}
+	info.Config.ConnectTimeout = durationOrEmpty(d.cfg.Timeouts.Connect)
+	info.Config.FirstEventTimeout = durationOrEmpty(d.cfg.Timeouts.FirstEvent)
+	info.Config.IdleTimeout = durationOrEmpty(d.cfg.Timeouts.Idle)
+	info.Config.RequestTimeout = durationOrEmpty(d.cfg.Timeouts.Total)
+
+	ctx, cancel := context.WithTimeout(r.Context(), readinessCheckTimeout)
+	defer cancel()
+	if _, accountID, err := d.cfg.AuthProvider(ctx); err != nil {
+		info.Auth.Error = err.Error()
+	} else {
+		info.Auth.AccountIDSuffix = accountIDSuffix(accountID)
+	}
+
+	models := d.cfg.Settings.models()
+	for _, m := range models.Models() {
+		info.Models = append(info.Models, debugInfoModel{
+			ID:              m.FullID(),
+			Name:            m.Name,
+			ReasoningEffort: m.ReasoningEffort,
+			ContextWindow:   m.ContextWindow,
+			Tools:           m.Capabilities.Tools,
+			Vision:          m.Capabilities.Vision,
+			XHigh:           m.Capabilities.XHigh,
+		})
+	}
+	for _, a := range models.Aliases() {
+		info.ModelAliases = append(info.ModelAliases, debugInfoAlias{Pattern: a.Pattern, Target: a.Target})
+	}
+	if d.cfg.modelDiscovery != nil {
+		status := d.cfg.modelDiscovery.status()
+		info.ModelDiscovery = &status
+	}
+	if d.cfg.admission != nil {
+		status := d.cfg.admission.status()
+		info.Admission = &status
+	}
+	if checker, ok := d.cfg.Tracer.Sink().(trace.HealthChecker); ok {
+		stats, err := checker.Stats()
+		info.Trace = &debugInfoTrace{SinkStats: stats}
+		if err != nil {
+			info.Trace.Error = err.Error()
+		}
+	}
+	writeJSON(w, info)
+}
+
+// accountIDSuffix 只保留 account id 的末 4 位，足以区分账号又不泄露完整值。
+func accountIDSuffix(accountID string) string {
+	accountID = strings.TrimSpace(accountID)
+	if accountID == "" {
+		return ""
+	}
+	const keep = 4
+	if len(accountID) <= keep {
+		return "..." + accountID
+	}
+	return "..." + accountID[len(accountID)-keep:]
+}
+
+// redactURL 隐去 URL 中的密码与查询参数值，这两处常被用来携带 token。
+func redactURL(raw string) string {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return ""
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return redactedValue
+	}
+	if u.User != nil {
+		if _, ok := u.User.Password(); ok {
+			u.User = url.UserPassword(u.User.Username(), redactedValue)
+		}
+	}
+	if u.RawQuery != "" {
+		query := u.Query()
+		for key := range query {
+			query.Set(key, redactedValue)
+		}
+		u.RawQuery = query.Encode()
+	}
+	return u.String()
+}
+
+func durationOrEmpty(d time.Duration) string {
+	if d <= 0 {
+		return ""
+	}
+	return d.String()
+}
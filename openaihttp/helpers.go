@@ -18,22 +18,25 @@ func writeOpenAIError(w http.ResponseWriter, statusCode int, message string) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(statusCode)
 
-	var errType string
+	errResp := openaiapi.OpenAIError{}
+	errResp.Error.Message = message
+	errResp.Error.Type = openAIErrorTypeForStatus(statusCode)
+	_ = json.NewEncoder(w).Encode(errResp)
+}
+
+func openAIErrorTypeForStatus(statusCode int) string {
 	switch statusCode {
 	case http.StatusBadRequest:
-		errType = "invalid_request_error"
+		return "invalid_request_error"
 	case http.StatusNotFound:
-		errType = "not_found_error"
+		return "not_found_error"
 	case http.StatusServiceUnavailable:
-		errType = "service_unavailable_error"
+		return "service_unavailable_error"
+	case http.StatusGatewayTimeout:
+		return "timeout_error"
 	default:
-		errType = "api_error"
+		return "api_error"
 	}
-
-	errResp := openaiapi.OpenAIError{}
-	errResp.Error.Message = message
-	errResp.Error.Type = errType
-	_ = json.NewEncoder(w).Encode(errResp)
 }
 
 func claudeErrorTypeForStatus(statusCode int) string {
@@ -50,8 +53,10 @@ func claudeErrorTypeForStatus(statusCode int) string {
 		return "request_too_large"
 	case http.StatusTooManyRequests:
 		return "rate_limit_error"
-	case http.StatusServiceUnavailable:
+	case http.StatusServiceUnavailable, StatusClaudeOverloaded:
 		return "overloaded_error"
+	case http.StatusGatewayTimeout:
+		return "timeout_error"
 	default:
 		return "api_error"
 	}
@@ -0,0 +1,217 @@
+package openaihttp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/LubyRuffy/gptb2o"
+	"github.com/LubyRuffy/gptb2o/backend"
+	"github.com/LubyRuffy/gptb2o/metrics"
+	"github.com/LubyRuffy/gptb2o/trace"
+)
+
+// 模型标签的兜底取值：未填写 model 记为 unknown，不受支持的 model 统一记为 other，避免标签基数失控。
+const (
+	metricsModelUnknown = "unknown"
+	metricsModelOther   = "other"
+)
+
+// wrapWithMetrics 统计请求量、时延、首 token 时间、活跃流与流中途错误，并把标签放入 context
+// 供 backend transport 与重试回调使用，model 标签按 settings 中的别名解析。m 为 nil 时原样返回 handler。
+func wrapWithMetrics(m *metrics.Metrics, settings *SettingsStore, route string, handler http.HandlerFunc) http.HandlerFunc {
+	if m == nil || handler == nil {
+		return handler
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		startedAt := time.Now()
+		bodyBytes, err := io.ReadAll(r.Body)
+		_ = r.Body.Close()
+		if err != nil {
+			bodyBytes = nil
+		}
+		r.Body = io.NopCloser(bytes.NewReader(bodyBytes))
+
+		var payload struct {
+			Model  string `json:"model"`
+			Stream bool   `json:"stream"`
+		}
+		_ = json.Unmarshal(bodyBytes, &payload)
+
+		clientAPI := clientAPIForRoute(route, r)
+		labels := metrics.Labels{
+			Route:     route,
+			Model:     metricsModelLabel(settings.models(), payload.Model),
+			ClientAPI: clientAPI,
+		}
+
+		if payload.Stream {
+			m.StreamStarted(labels)
+			defer m.StreamFinished(labels)
+		}
+
+		capture := &observedResponseWriter{ResponseWriter: w, statusCode: http.StatusOK, startedAt: startedAt}
+		handler(capture, r.WithContext(metrics.ContextWithLabels(r.Context(), labels)))
+
+		firstToken := time.Duration(-1)
+		streamErrors := 0
+		if capture.timer != nil {
+			if ms := capture.timer.Timing().FirstTokenMs; ms != nil {
+				firstToken = time.Duration(*ms) * time.Millisecond
+			}
+			streamErrors = capture.timer.ErrorEvents()
+		}
+		m.RequestFinished(labels, capture.statusCode, time.Since(startedAt), firstToken, streamErrors)
+	}
+}
+
+// clientAPIForRoute 返回 openai 或 claude；Claude 入口之外也按请求头识别 Claude 客户端。
+func clientAPIForRoute(route string, r *http.Request) string {
+	if route == metrics.RouteMessages || route == metrics.RouteCountTokens || isClaudeAPIRequest(r) {
+		return "claude"
+	}
+	return "openai"
+}
+
+// metricsModelLabel 按模型目录把请求中的 model（含别名）归一化为后端模型 ID。
+func metricsModelLabel(models *gptb2o.ModelRegistry, model string) string {
+	if strings.TrimSpace(model) == "" {
+		return metricsModelUnknown
+	}
+	if info, ok := models.Resolve(model); ok {
+		return info.ID
+	}
+	return metricsModelOther
+}
+
+// observedResponseWriter 记录状态码，并用 trace.StreamTimer 识别写给客户端的首个文本增量与 error 事件；
+// metrics 与 telemetry 共用。
+type observedResponseWriter struct {
+	http.ResponseWriter
+	statusCode  int
+	wroteHeader bool
+	startedAt   time.Time
+	timer       *trace.StreamTimer
+}
+
+func (w *observedResponseWriter) WriteHeader(statusCode int) {
+	if w.wroteHeader {
+		return
+	}
+	w.statusCode = statusCode
+	w.wroteHeader = true
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *observedResponseWriter) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.timer == nil {
+		w.timer = trace.NewStreamTimer(w.startedAt, w.Header().Get("Content-Type"))
+	}
+	w.timer.Observe(p, time.Now())
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *observedResponseWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (w *observedResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, http.ErrNotSupported
+	}
+	return hijacker.Hijack()
+}
+
+// metricsRetryHook 返回 backend.ChatModelConfig.OnRetry 回调；m 为 nil 时返回 nil。
+func metricsRetryHook(m *metrics.Metrics) func(ctx context.Context, reason backend.RetryReason) {
+	if m == nil {
+		return nil
+	}
+	return func(ctx context.Context, reason backend.RetryReason) {
+		recordBackendRetry(ctx, m, reason)
+	}
+}
+
+func recordBackendRetry(ctx context.Context, m *metrics.Metrics, reason backend.RetryReason) {
+	if labels, ok := metrics.LabelsFromContext(ctx); ok {
+		m.BackendRetry(labels, string(reason))
+	}
+}
+
+// wrapTransportWithMetrics 从 backend SSE 中解析 response.usage，按请求标签累加 token 数。
+// 没有标签的请求（如 batch worker、WebSocket）不计入。
+func wrapTransportWithMetrics(m *metrics.Metrics, base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if m == nil {
+		return base
+	}
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		resp, err := base.RoundTrip(req)
+		if err != nil || resp.Body == nil {
+			return resp, err
+		}
+		labels, ok := metrics.LabelsFromContext(req.Context())
+		if !ok || resp.StatusCode != http.StatusOK {
+			return resp, nil
+		}
+		resp.Body = &usageRecordingBody{ReadCloser: resp.Body, metrics: m, labels: labels}
+		return resp, nil
+	})
+}
+
+type roundTripperFunc func(req *http.Request) (*http.Response, error)
+
+func (fn roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return fn(req)
+}
+
+// usageRecordingBody 扫描 backend SSE，在读完或关闭时按最后一次出现的 usage 记录一次 token 数。
+type usageRecordingBody struct {
+	io.ReadCloser
+	metrics *metrics.Metrics
+	labels  metrics.Labels
+	scanner backendUsageScanner
+	once    sync.Once
+}
+
+func (b *usageRecordingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 {
+		b.scanner.Write(p[:n])
+	}
+	if err != nil {
+		b.record()
+	}
+	return n, err
+}
+
+func (b *usageRecordingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.record()
+	return err
+}
+
+func (b *usageRecordingBody) record() {
+	b.once.Do(func() {
+		usage := b.scanner.usage
+		if usage == nil {
+			return
+		}
+		b.metrics.Tokens(b.labels, usage.InputTokens, usage.OutputTokens, usage.OutputTokensDetails.ReasoningTokens)
+	})
+}
@@ -0,0 +1,111 @@
+package openaihttp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/LubyRuffy/gptb2o"
+	"github.com/LubyRuffy/gptb2o/backend"
+	"github.com/LubyRuffy/gptb2o/metrics"
+	"github.com/LubyRuffy/gptb2o/openaiapi"
+	"github.com/cloudwego/eino/schema"
+	"github.com/stretchr/testify/require"
+)
+
+func scrapeMetrics(t *testing.T, m *metrics.Metrics) string {
+	t.Helper()
+	w := httptest.NewRecorder()
+	m.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, metrics.ContentType, w.Header().Get("Content-Type"))
+	return w.Body.String()
+}
+
+func TestMetrics_ResponsesRetryUsageAndFirstToken(t *testing.T) {
+	backendSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload struct {
+			Reasoning struct {
+				Effort string `json:"effort"`
+			} `json:"reasoning"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&payload))
+		if payload.Reasoning.Effort == "xhigh" {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = fmt.Fprint(w, `{"error":{"message":"Unsupported value: 'xhigh' is not supported","param":"reasoning.effort","code":"unsupported_value"}}`)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = fmt.Fprint(w, "event: response.output_text.delta\ndata: {\"type\":\"response.output_text.delta\",\"delta\":\"hi\"}\n\n")
+		// usage 位于很长的 output 之后，验证超长行只保留行尾也能解析。
+		_, _ = fmt.Fprintf(w, "event: response.completed\ndata: {\"type\":\"response.completed\",\"response\":{\"output\":%q,\"usage\":{\"input_tokens\":11,\"output_tokens\":7,\"output_tokens_details\":{\"reasoning_tokens\":3},\"total_tokens\":18}}}\n\n", strings.Repeat("x", 3*maxUsageLineTailBytes))
+	}))
+	t.Cleanup(backendSrv.Close)
+
+	m := metrics.New()
+	handler, err := NewHandler(Config{
+		BackendURL: backendSrv.URL,
+		HTTPClient: backendSrv.Client(),
+		AuthProvider: func(ctx context.Context) (string, string, error) {
+			return "token", "acc", nil
+		},
+		Metrics: m,
+	})
+	require.NoError(t, err)
+
+	body := `{"model":"chatgpt/codex/gpt-5.4","input":"hi","stream":true,"reasoning":{"effort":"xhigh"}}`
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/responses", strings.NewReader(body)))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	out := scrapeMetrics(t, m)
+	require.Contains(t, out, "# TYPE gptb2o_requests_total counter\n")
+	require.Contains(t, out, `gptb2o_requests_total{route="responses",model="gpt-5.4",client_api="openai",status="200"} 1`)
+	require.Contains(t, out, `gptb2o_request_duration_seconds_count{route="responses",model="gpt-5.4",client_api="openai"} 1`)
+	require.Contains(t, out, `gptb2o_time_to_first_token_seconds_count{route="responses",model="gpt-5.4",client_api="openai"} 1`)
+	require.Contains(t, out, `gptb2o_backend_retries_total{route="responses",model="gpt-5.4",reason="reasoning_effort"} 1`)
+	require.Contains(t, out, `gptb2o_tokens_total{route="responses",model="gpt-5.4",client_api="openai",type="input"} 11`)
+	require.Contains(t, out, `gptb2o_tokens_total{route="responses",model="gpt-5.4",client_api="openai",type="output"} 7`)
+	require.Contains(t, out, `gptb2o_tokens_total{route="responses",model="gpt-5.4",client_api="openai",type="reasoning"} 3`)
+	require.Contains(t, out, `gptb2o_active_streams{route="responses",model="gpt-5.4",client_api="openai"} 0`)
+}
+
+func TestMetrics_ClaudeMidStreamErrorAndModelLabels(t *testing.T) {
+	h, err := newClaudeCompatHandler(claudeCompatConfig{
+		Now: time.Now,
+		NewChatModel: func(ctx context.Context, modelID string, tools []openaiapi.OpenAITool, toolCallHandler func(*backend.ToolCall)) (chatModel, error) {
+			return &stubChatModel{
+				streamMsgs:         []*schema.Message{{Content: "hello"}},
+				streamRecvErr:      &httpError{Status: http.StatusBadGateway, Message: "backend recv down"},
+				streamRecvErrAfter: 1,
+			}, nil
+		},
+		WriteJSON:  writeJSON,
+		WriteError: writeClaudeError,
+	})
+	require.NoError(t, err)
+
+	m := metrics.New()
+	handler := wrapWithMetrics(m, nil, metrics.RouteMessages, h.handleMessages)
+
+	body := []byte(`{"model":"claude-sonnet-4-5","messages":[{"role":"user","content":"hello"}],"stream":true,"max_tokens":16}`)
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodPost, "/v1/messages", bytes.NewReader(body)))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Contains(t, w.Body.String(), "event: error\n")
+
+	out := scrapeMetrics(t, m)
+	require.Contains(t, out, `gptb2o_stream_errors_total{route="messages",model="gpt-5.5",client_api="claude"} 1`)
+	require.Contains(t, out, `gptb2o_requests_total{route="messages",model="gpt-5.5",client_api="claude",status="200"} 1`)
+
+	require.Equal(t, "gpt-5.4", metricsModelLabel(gptb2o.DefaultModelRegistry(), "chatgpt/codex/gpt-5.4"))
+	require.Equal(t, "other", metricsModelLabel(gptb2o.DefaultModelRegistry(), "my-own-model"))
+	require.Equal(t, "unknown", metricsModelLabel(gptb2o.DefaultModelRegistry(), " "))
+}
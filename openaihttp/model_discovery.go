@@ -0,0 +1,294 @@
+package openaihttp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/LubyRuffy/gptb2o"
+)
+
+const (
+	// DefaultModelsTTL 是 backend 模型列表的默认缓存时长。
+	DefaultModelsTTL = 10 * time.Minute
+
+	modelsFetchTimeout = 10 * time.Second
+	// modelsRetryInterval 是拉取失败后的重试间隔（不超过 TTL），避免 backend 故障时每个请求都去拉取。
+	modelsRetryInterval = 30 * time.Second
+	modelsMaxBodyBytes  = 4 << 20
+)
+
+// backendModelsResponse 是 Codex CLI 使用的 backend 模型列表格式，只解析 gptb2o 用到的字段。
+type backendModelsResponse struct {
+	Models []backendModel `json:"models"`
+}
+
+type backendModel struct {
+	Slug                     string `json:"slug"`
+	ID                       string `json:"id"`
+	DisplayName              string `json:"display_name"`
+	Visibility               string `json:"visibility"`
+	ContextWindow            int    `json:"context_window"`
+	DefaultReasoningLevel    string `json:"default_reasoning_level"`
+	SupportedReasoningLevels []struct {
+		Effort string `json:"effort"`
+	} `json:"supported_reasoning_levels"`
+	InputModalities []string `json:"input_modalities"`
+}
+
+// modelInfo 把 backend 模型转换为 registry 条目；backend 未返回的能力按支持处理。
+func (m backendModel) modelInfo() gptb2o.ModelInfo {
+	id := strings.TrimSpace(m.Slug)
+	if id == "" {
+		id = strings.TrimSpace(m.ID)
+	}
+	info := gptb2o.ModelInfo{
+		ID:              gptb2o.NormalizeModelID(id),
+		Name:            strings.TrimSpace(m.DisplayName),
+		ReasoningEffort: normalizeReasoningEffort(m.DefaultReasoningLevel),
+		ContextWindow:   m.ContextWindow,
+		Capabilities:    gptb2o.ModelCapabilities{Tools: true, Vision: true, XHigh: true},
+	}
+	if m.InputModalities != nil {
+		info.Capabilities.Vision = containsFold(m.InputModalities, "image")
+	}
+	if len(m.SupportedReasoningLevels) > 0 {
+		levels := make([]string, 0, len(m.SupportedReasoningLevels))
+		for _, level := range m.SupportedReasoningLevels {
+			levels = append(levels, level.Effort)
+		}
+		info.Capabilities.XHigh = containsFold(levels, "xhigh")
+	}
+	return info
+}
+
+func containsFold(values []string, target string) bool {
+	for _, v := range values {
+		if strings.EqualFold(strings.TrimSpace(v), target) {
+			return true
+		}
+	}
+	return false
+}
+
+// modelDiscovery 定期从 backend 拉取账号可用的模型，并与静态 registry 合并：
+// 静态目录中的模型保持原定义与顺序，backend 新增的模型追加在后，别名沿用静态目录。
+// 拉取都在后台进行：首次拉取完成前只使用静态目录，之后过期的列表继续使用直到刷新完成。拉取失败时沿用上一次成功的结果。
+type modelDiscovery struct {
+	url          string
+	ttl          time.Duration
+	client       *http.Client
+	authProvider AuthProvider
+	originator   string
+	now          func() time.Time
+
+	mu sync.Mutex
+	// models 保留 backend 返回的默认 effort；合并进 registry 时去掉，见 defaultEffort。
+	models     []gptb2o.ModelInfo
+	fetched    bool
+	fetchedAt  time.Time
+	attemptAt  time.Time
+	lastErr    error
+	refreshing bool
+	generation int
+
+	mergedBase       *gptb2o.ModelRegistry
+	mergedGeneration int
+	merged           *gptb2o.ModelRegistry
+}
+
+func newModelDiscovery(cfg resolvedConfig) *modelDiscovery {
+	ttl := cfg.ModelsTTL
+	if ttl <= 0 {
+		ttl = DefaultModelsTTL
+	}
+	return &modelDiscovery{
+		url:          cfg.ModelsURL,
+		ttl:          ttl,
+		client:       cfg.HTTPClient,
+		authProvider: cfg.AuthProvider,
+		originator:   cfg.Originator,
+		now:          time.Now,
+	}
+}
+
+// registry 返回 base 与 backend 模型列表合并后的 registry。
+func (d *modelDiscovery) registry(base *gptb2o.ModelRegistry) *gptb2o.ModelRegistry {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.staleLocked() && !d.refreshing {
+		d.refreshing = true
+		go d.refresh()
+	}
+
+	if len(d.models) == 0 {
+		return base
+	}
+	if d.merged != nil && d.mergedBase == base && d.mergedGeneration == d.generation {
+		return d.merged
+	}
+	merged, err := mergeModelRegistry(base, d.models)
+	if err != nil {
+		log.Printf("[gptb2o][models] merge backend models: %v", err)
+		return base
+	}
+	if missing := unlistedStaticModels(base, d.models); len(missing) > 0 {
+		log.Printf("[gptb2o][models] backend does not list %s for this account; they stay in /v1/models and requests for them go to the backend as-is", strings.Join(missing, ", "))
+	}
+	d.mergedBase, d.mergedGeneration, d.merged = base, d.generation, merged
+	return merged
+}
+
+// defaultEffort 返回 backend 为 modelID 声明的 default_reasoning_level。它只作为最后的回退：
+// 运营方通过 --reasoning-effort、defaults.reasoning_effort 或模型目录配置的默认值优先。
+func (d *modelDiscovery) defaultEffort(modelID string) string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, m := range d.models {
+		if m.ID == modelID {
+			return m.ReasoningEffort
+		}
+	}
+	return ""
+}
+
+// staleLocked 报告是否需要重新拉取；从未拉取过时 fetchedAt 为零值，同样视为过期。
+func (d *modelDiscovery) staleLocked() bool {
+	now := d.now()
+	if d.lastErr != nil {
+		retry := modelsRetryInterval
+		if retry > d.ttl {
+			retry = d.ttl
+		}
+		return now.Sub(d.attemptAt) >= retry
+	}
+	return now.Sub(d.fetchedAt) >= d.ttl
+}
+
+func (d *modelDiscovery) refresh() {
+	ctx, cancel := context.WithTimeout(context.Background(), modelsFetchTimeout)
+	defer cancel()
+	models, err := d.fetch(ctx)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.refreshing = false
+	d.attemptAt = d.now()
+	d.lastErr = err
+	if err != nil {
+		log.Printf("[gptb2o][models] %v", err)
+		return
+	}
+	d.models = models
+	d.fetched = true
+	d.fetchedAt = d.attemptAt
+	d.generation++
+}
+
+func (d *modelDiscovery) fetch(ctx context.Context) ([]gptb2o.ModelInfo, error) {
+	accessToken, accountID, err := d.authProvider(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("fetch %s: auth: %w", redactURL(d.url), err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, d.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	if accountID != "" {
+		req.Header.Set("ChatGPT-Account-Id", accountID)
+	}
+	req.Header.Set("Originator", d.originator)
+	req.Header.Set("User-Agent", d.originator)
+	req.Header.Set("Accept", "application/json")
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetch %s: %w", redactURL(d.url), err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, modelsMaxBodyBytes))
+	if err != nil {
+		return nil, fmt.Errorf("fetch %s: %w", redactURL(d.url), err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetch %s: status %d", redactURL(d.url), resp.StatusCode)
+	}
+	var payload backendModelsResponse
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, fmt.Errorf("fetch %s: decode: %w", redactURL(d.url), err)
+	}
+	models := make([]gptb2o.ModelInfo, 0, len(payload.Models))
+	seen := make(map[string]bool, len(payload.Models))
+	for _, m := range payload.Models {
+		// visibility 为 hide / none 的模型是 backend 内部型号，不对外列出。
+		if v := strings.ToLower(strings.TrimSpace(m.Visibility)); v == "hide" || v == "none" {
+			continue
+		}
+		info := m.modelInfo()
+		if info.ID == "" || seen[info.ID] {
+			continue
+		}
+		seen[info.ID] = true
+		models = append(models, info)
+	}
+	if len(models) == 0 {
+		return nil, fmt.Errorf("fetch %s: no models in response", redactURL(d.url))
+	}
+	return models, nil
+}
+
+// status 返回最近一次拉取的结果，用于 /debug/info。
+func (d *modelDiscovery) status() debugInfoModelDiscovery {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	status := debugInfoModelDiscovery{URL: redactURL(d.url), TTL: d.ttl.String(), Models: len(d.models)}
+	if d.fetched {
+		fetchedAt := d.fetchedAt
+		status.FetchedAt = &fetchedAt
+	}
+	if d.lastErr != nil {
+		status.Error = d.lastErr.Error()
+	}
+	return status
+}
+
+// mergeModelRegistry 把 discovered 中 base 没有的模型追加到 base 之后。
+func mergeModelRegistry(base *gptb2o.ModelRegistry, discovered []gptb2o.ModelInfo) (*gptb2o.ModelRegistry, error) {
+	models := base.Models()
+	added := false
+	for _, m := range discovered {
+		if _, ok := base.Lookup(m.ID); ok {
+			continue
+		}
+		// backend 的默认 effort 不写入目录，避免覆盖运营方配置的默认值。
+		m.ReasoningEffort = ""
+		models = append(models, m)
+		added = true
+	}
+	if !added {
+		return base, nil
+	}
+	return gptb2o.NewModelRegistry(models, base.Aliases())
+}
+
+// unlistedStaticModels 返回静态目录中 backend 未列出的模型。静态目录总是完整保留（它也包含运营方配置的模型），
+// 这里只用于提示：这些模型在当前账号下可能不可用。
+func unlistedStaticModels(base *gptb2o.ModelRegistry, discovered []gptb2o.ModelInfo) []string {
+	listed := make(map[string]bool, len(discovered))
+	for _, m := range discovered {
+		listed[m.ID] = true
+	}
+	var missing []string
+	for _, m := range base.Models() {
+		if !listed[m.ID] {
+			missing = append(missing, m.ID)
+		}
+	}
+	return missing
+}
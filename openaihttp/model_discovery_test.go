@@ -0,0 +1,256 @@
+package openaihttp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/LubyRuffy/gptb2o"
+	"github.com/stretchr/testify/require"
+)
+
+func TestModelDiscovery_MergesBackendModels(t *testing.T) {
+	var (
+		mu          sync.Mutex
+		modelCalls  int
+		backendCall []string
+	)
+	backendSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/models" {
+			require.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+			require.Equal(t, "acct", r.Header.Get("ChatGPT-Account-Id"))
+			mu.Lock()
+			modelCalls++
+			mu.Unlock()
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, `{"models":[
+				{"slug":"gpt-5.5","display_name":"ignored"},
+				{"slug":"gpt-6","display_name":"GPT-6","context_window":400000,"default_reasoning_level":"high",
+				 "supported_reasoning_levels":[{"effort":"low"},{"effort":"high"}],"input_modalities":["text"]},
+				{"slug":"gpt-internal","visibility":"hide"}
+			]}`)
+			return
+		}
+		var payload struct {
+			Model     string `json:"model"`
+			Reasoning struct {
+				Effort string `json:"effort"`
+			} `json:"reasoning"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&payload))
+		mu.Lock()
+		backendCall = append(backendCall, payload.Model+"/"+payload.Reasoning.Effort)
+		mu.Unlock()
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: {\"type\":\"response.output_text.delta\",\"delta\":\"ok\"}\n\n")
+		fmt.Fprint(w, "data: {\"type\":\"response.completed\",\"response\":{\"id\":\"resp_1\",\"object\":\"response\"}}\n\n")
+	}))
+	t.Cleanup(backendSrv.Close)
+
+	h, err := NewHandler(Config{
+		BackendURL:   backendSrv.URL + "/responses",
+		ModelsURL:    backendSrv.URL + "/models",
+		AuthProvider: func(ctx context.Context) (string, string, error) { return "token", "acct", nil },
+	})
+	require.NoError(t, err)
+
+	serve := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return w
+	}
+
+	// 首次拉取在后台进行，不阻塞请求；拉取完成前只返回静态目录。
+	var w *httptest.ResponseRecorder
+	require.Eventually(t, func() bool {
+		w = serve(http.MethodGet, "/v1/models", "")
+		return w.Code == http.StatusOK && strings.Contains(w.Body.String(), `"GPT-6"`)
+	}, time.Second, 5*time.Millisecond)
+	var list struct {
+		Data []struct {
+			ID            string `json:"id"`
+			DisplayName   string `json:"display_name"`
+			ContextWindow int    `json:"context_window"`
+		} `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	ids := make([]string, 0, len(list.Data))
+	for _, m := range list.Data {
+		ids = append(ids, m.ID)
+	}
+	// 内置模型保持原顺序与定义，backend 新增模型追加在后，hide 模型不列出。
+	require.Equal(t, gptb2o.DefaultModelFullID, ids[0])
+	require.Equal(t, "GPT-5.5", list.Data[0].DisplayName)
+	last := list.Data[len(list.Data)-1]
+	require.Equal(t, gptb2o.ModelNamespace+"gpt-6", last.ID)
+	require.Equal(t, "GPT-6", last.DisplayName)
+	require.Equal(t, 400000, last.ContextWindow)
+	require.NotContains(t, ids, gptb2o.ModelNamespace+"gpt-internal")
+
+	w = serve(http.MethodPost, "/v1/chat/completions", `{"model":"gpt-6","messages":[{"role":"user","content":"hi"}],"reasoning_effort":"xhigh"}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	w = serve(http.MethodPost, "/v1/responses", `{"model":"gpt-6","input":"hi"}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	// 既不在静态目录也不在 backend 列表中的模型在请求 backend 前即返回 400。
+	w = serve(http.MethodPost, "/v1/responses", `{"model":"gpt-internal","input":"hi"}`)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	require.Contains(t, w.Body.String(), "unsupported model")
+
+	w = serve(http.MethodGet, DebugInfoPath, "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var info debugInfoResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &info))
+	require.NotNil(t, info.ModelDiscovery)
+	require.Equal(t, 2, info.ModelDiscovery.Models)
+	require.NotNil(t, info.ModelDiscovery.FetchedAt)
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Equal(t, 1, modelCalls, "model list should be cached within the TTL")
+	require.Equal(t, []string{"gpt-6/high", "gpt-6/high"}, backendCall)
+}
+
+func TestModelDiscovery_RefreshAfterTTLAndKeepLastOnError(t *testing.T) {
+	var (
+		status atomic.Int32
+		slug   atomic.Value
+		calls  atomic.Int32
+	)
+	status.Store(http.StatusOK)
+	slug.Store("gpt-6")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if code := int(status.Load()); code != http.StatusOK {
+			w.WriteHeader(code)
+			return
+		}
+		fmt.Fprintf(w, `{"models":[{"slug":%q}]}`, slug.Load())
+	}))
+	t.Cleanup(srv.Close)
+
+	now := time.Unix(1_700_000_000, 0)
+	var nowMu sync.Mutex
+	d := newModelDiscovery(resolvedConfig{
+		ModelsURL:    srv.URL,
+		ModelsTTL:    time.Minute,
+		HTTPClient:   srv.Client(),
+		AuthProvider: func(ctx context.Context) (string, string, error) { return "token", "", nil },
+		Originator:   gptb2o.DefaultOriginator,
+	})
+	d.now = func() time.Time {
+		nowMu.Lock()
+		defer nowMu.Unlock()
+		return now
+	}
+	advance := func(delta time.Duration) {
+		nowMu.Lock()
+		now = now.Add(delta)
+		nowMu.Unlock()
+	}
+	base := gptb2o.DefaultModelRegistry()
+	supports := func(id string) bool {
+		_, ok := d.registry(base).Lookup(id)
+		return ok
+	}
+	waitCalls := func(n int32) {
+		t.Helper()
+		require.Eventually(t, func() bool {
+			d.mu.Lock()
+			defer d.mu.Unlock()
+			return calls.Load() >= n && !d.refreshing
+		}, time.Second, 5*time.Millisecond)
+	}
+
+	// 首次使用只触发后台拉取，拉取完成前只有静态目录。
+	supports(gptb2o.DefaultModelID)
+	waitCalls(1)
+	require.True(t, supports("gpt-6"))
+	require.True(t, supports(gptb2o.DefaultModelID))
+	require.EqualValues(t, 1, calls.Load())
+
+	// TTL 过期后先返回旧列表，同时在后台刷新。
+	slug.Store("gpt-7")
+	advance(time.Minute)
+	require.True(t, supports("gpt-6"))
+	waitCalls(2)
+	require.True(t, supports("gpt-7"))
+	require.False(t, supports("gpt-6"))
+
+	// 拉取失败时保留上一次成功的列表，并按重试间隔再次尝试。
+	status.Store(http.StatusBadGateway)
+	advance(time.Minute)
+	supports("gpt-7")
+	waitCalls(3)
+	require.True(t, supports("gpt-7"))
+	require.Contains(t, d.status().Error, "status 502")
+	require.EqualValues(t, 3, calls.Load())
+	advance(modelsRetryInterval)
+	supports("gpt-7")
+	waitCalls(4)
+}
+
+func TestModelDiscovery_FirstFetchDoesNotBlockAndKeepsOperatorEffort(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		fmt.Fprint(w, `{"models":[{"slug":"gpt-6","default_reasoning_level":"high"}]}`)
+	}))
+	t.Cleanup(srv.Close)
+	t.Cleanup(func() {
+		select {
+		case <-release:
+		default:
+			close(release)
+		}
+	})
+
+	d := newModelDiscovery(resolvedConfig{
+		ModelsURL:    srv.URL,
+		HTTPClient:   srv.Client(),
+		AuthProvider: func(ctx context.Context) (string, string, error) { return "token", "", nil },
+		Originator:   gptb2o.DefaultOriginator,
+	})
+	settings := NewSettingsStore(Settings{}).withDiscovery(d)
+
+	// backend 尚未响应时直接使用静态目录。
+	done := make(chan bool, 1)
+	go func() {
+		_, ok := settings.models().Lookup("gpt-6")
+		done <- ok
+	}()
+	select {
+	case ok := <-done:
+		require.False(t, ok)
+	case <-time.After(time.Second):
+		t.Fatal("first model lookup blocked on backend model discovery")
+	}
+
+	close(release)
+	require.Eventually(t, func() bool {
+		_, ok := settings.models().Lookup("gpt-6")
+		return ok
+	}, time.Second, 5*time.Millisecond)
+
+	// backend 的 default_reasoning_level 只在没有运营方默认值时使用。
+	require.Equal(t, "low", settings.defaultReasoningEffort(gptb2o.ModelNamespace+"gpt-6", "low"))
+	require.Equal(t, "high", settings.defaultReasoningEffort(gptb2o.ModelNamespace+"gpt-6", ""))
+	settings.Store(Settings{ReasoningEffort: "medium"})
+	require.Equal(t, "medium", settings.defaultReasoningEffort(gptb2o.ModelNamespace+"gpt-6", ""))
+}
+
+func TestUnlistedStaticModels(t *testing.T) {
+	base, err := gptb2o.NewModelRegistry([]gptb2o.ModelInfo{{ID: "gpt-5.5"}, {ID: "gpt-5.4-mini"}}, nil)
+	require.NoError(t, err)
+	// 静态目录保持完整，只报告 backend 没有列出的模型。
+	missing := unlistedStaticModels(base, []gptb2o.ModelInfo{{ID: "gpt-5.5"}, {ID: "gpt-6"}})
+	require.Equal(t, []string{"gpt-5.4-mini"}, missing)
+	require.Empty(t, unlistedStaticModels(base, []gptb2o.ModelInfo{{ID: "gpt-5.5"}, {ID: "gpt-5.4-mini"}}))
+}
@@ -0,0 +1,787 @@
+package openaihttp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/LubyRuffy/gptb2o/batch"
+	"github.com/LubyRuffy/gptb2o/openaiapi"
+	"github.com/google/uuid"
+)
+
+const (
+	openAIBatchMaxRequests     = 50000
+	openAIBatchMaxListLimit    = 100
+	openAIBatchCompletionLimit = 24 * time.Hour
+	// openAIMaxUploadBytes 限制单个上传文件的大小：文件整体读入内存并作为一个 SQLite blob 保存，
+	// 因此远低于 OpenAI 的 200 MB 上限。
+	openAIMaxUploadBytes = 32 << 20
+)
+
+// OpenAIBatchHandlers 对应 OpenAI Files API（purpose=batch）与 Batch API 的各个端点。
+// 带 id 的端点通过 r.PathValue("file_id") / r.PathValue("batch_id") 读取参数。
+type OpenAIBatchHandlers struct {
+	UploadFile  http.HandlerFunc
+	ListFiles   http.HandlerFunc
+	GetFile     http.HandlerFunc
+	FileContent http.HandlerFunc
+	DeleteFile  http.HandlerFunc
+	CreateBatch http.HandlerFunc
+	ListBatches http.HandlerFunc
+	GetBatch    http.HandlerFunc
+	CancelBatch http.HandlerFunc
+}
+
+type openAIFileObject struct {
+	ID        string `json:"id"`
+	Object    string `json:"object"`
+	Bytes     int64  `json:"bytes"`
+	CreatedAt int64  `json:"created_at"`
+	Filename  string `json:"filename"`
+	Purpose   string `json:"purpose"`
+}
+
+type openAIListResponse[T any] struct {
+	Object  string  `json:"object"`
+	Data    []T     `json:"data"`
+	FirstID *string `json:"first_id"`
+	LastID  *string `json:"last_id"`
+	HasMore bool    `json:"has_more"`
+}
+
+type openAIDeletedObject struct {
+	ID      string `json:"id"`
+	Object  string `json:"object"`
+	Deleted bool   `json:"deleted"`
+}
+
+type openAIBatchCreateRequest struct {
+	InputFileID      string            `json:"input_file_id"`
+	Endpoint         string            `json:"endpoint"`
+	CompletionWindow string            `json:"completion_window"`
+	Metadata         map[string]string `json:"metadata,omitempty"`
+}
+
+type openAIBatchObject struct {
+	ID               string                    `json:"id"`
+	Object           string                    `json:"object"`
+	Endpoint         string                    `json:"endpoint"`
+	Errors           *openAIBatchErrors        `json:"errors"`
+	InputFileID      string                    `json:"input_file_id"`
+	CompletionWindow string                    `json:"completion_window"`
+	Status           string                    `json:"status"`
+	OutputFileID     *string                   `json:"output_file_id"`
+	ErrorFileID      *string                   `json:"error_file_id"`
+	CreatedAt        int64                     `json:"created_at"`
+	InProgressAt     *int64                    `json:"in_progress_at"`
+	ExpiresAt        *int64                    `json:"expires_at"`
+	FinalizingAt     *int64                    `json:"finalizing_at"`
+	CompletedAt      *int64                    `json:"completed_at"`
+	FailedAt         *int64                    `json:"failed_at"`
+	ExpiredAt        *int64                    `json:"expired_at"`
+	CancellingAt     *int64                    `json:"cancelling_at"`
+	CancelledAt      *int64                    `json:"cancelled_at"`
+	RequestCounts    batch.OpenAIRequestCounts `json:"request_counts"`
+	Metadata         map[string]string         `json:"metadata"`
+}
+
+type openAIBatchErrors struct {
+	Object string             `json:"object"`
+	Data   []openAIBatchError `json:"data"`
+}
+
+type openAIBatchError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Line    *int   `json:"line,omitempty"`
+}
+
+type openAIBatchInputLine struct {
+	CustomID string          `json:"custom_id"`
+	Method   string          `json:"method"`
+	URL      string          `json:"url"`
+	Body     json.RawMessage `json:"body"`
+}
+
+type openAIBatchOutputLine struct {
+	ID       string                     `json:"id"`
+	CustomID string                     `json:"custom_id"`
+	Response *openAIBatchOutputResponse `json:"response"`
+	Error    *openAIBatchOutputError    `json:"error"`
+}
+
+type openAIBatchOutputResponse struct {
+	StatusCode int             `json:"status_code"`
+	RequestID  string          `json:"request_id"`
+	Body       json.RawMessage `json:"body"`
+}
+
+type openAIBatchOutputError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// openAIBatchRunner 持有 Files/Batch 端点与后台 worker。
+// 每行请求交给对应的在线接口 handler 执行（强制 stream=false），输出按 OpenAI 格式写成 output/error 文件。
+type openAIBatchRunner struct {
+	store     *batch.Store
+	endpoints map[string]openAIBatchEndpoint
+	now       func() time.Time
+	queue     *batchQueue
+}
+
+type openAIBatchEndpoint struct {
+	path    string
+	handler http.HandlerFunc
+}
+
+// OpenAIBatchesHandlers 返回 Files / Batch API 的各个 handler，并在 Batches store 上恢复遗留请求、启动 worker。
+// 每个 store 只能构造一次：worker 使用本次的模型、鉴权与 trace 配置，再次构造返回 batch.ErrWorkersAttached。
+func OpenAIBatchesHandlers(cfg Config) (OpenAIBatchHandlers, error) {
+	resolved, err := resolveConfig(cfg)
+	if err != nil {
+		return OpenAIBatchHandlers{}, err
+	}
+	if resolved.Batches == nil {
+		return OpenAIBatchHandlers{}, fmt.Errorf("Batches store is required")
+	}
+	compat, err := newCompatHandler(compatConfig{
+		Now:               time.Now,
+		NewChatCompletion: openaiapi.NewChatCompletionID,
+		WriteJSON:         writeJSON,
+		WriteOpenAIError:  writeOpenAIError,
+		SystemFingerprint: resolved.SystemFingerprint,
+		NewChatModel:      newChatModelFactory(resolved),
+		Models:            resolved.Settings.models,
+	})
+	if err != nil {
+		return OpenAIBatchHandlers{}, err
+	}
+
+	runner := newOpenAIBatchRunner(resolved.Batches, map[string]openAIBatchEndpoint{
+		"/v1/chat/completions": {
+			path:    joinPath(resolved.BasePath, "/chat/completions"),
+			handler: wrapWithTracer(resolved.Tracer, compat.handleChatCompletions),
+		},
+		"/v1/responses": {
+			path:    joinPath(resolved.BasePath, "/responses"),
+			handler: wrapWithTracer(resolved.Tracer, newResponsesHandler(resolved)),
+		},
+	}, resolved.BatchConcurrency)
+	if err := runner.start(); err != nil {
+		return OpenAIBatchHandlers{}, err
+	}
+	return OpenAIBatchHandlers{
+		UploadFile:  wrapWithTracer(resolved.Tracer, runner.handleUploadFile),
+		ListFiles:   wrapWithTracer(resolved.Tracer, runner.handleListFiles),
+		GetFile:     wrapWithTracer(resolved.Tracer, runner.handleGetFile),
+		FileContent: wrapWithTracer(resolved.Tracer, runner.handleFileContent),
+		DeleteFile:  wrapWithTracer(resolved.Tracer, runner.handleDeleteFile),
+		CreateBatch: wrapWithTracer(resolved.Tracer, runner.handleCreateBatch),
+		ListBatches: wrapWithTracer(resolved.Tracer, runner.handleListBatches),
+		GetBatch:    wrapWithTracer(resolved.Tracer, runner.handleGetBatch),
+		CancelBatch: wrapWithTracer(resolved.Tracer, runner.handleCancelBatch),
+	}, nil
+}
+
+func newOpenAIBatchRunner(store *batch.Store, endpoints map[string]openAIBatchEndpoint, concurrency int) *openAIBatchRunner {
+	return &openAIBatchRunner{
+		store:     store,
+		endpoints: endpoints,
+		now:       time.Now,
+		queue:     newBatchQueue(concurrency),
+	}
+}
+
+// start 恢复上次进程遗留的 batch，并启动 worker；store 关闭后 worker 退出。
+func (b *openAIBatchRunner) start() error {
+	if err := b.store.AttachWorkers("openai batches"); err != nil {
+		return err
+	}
+	batchIDs, err := b.store.RecoverOpenAIBatches(b.now())
+	if err != nil {
+		return fmt.Errorf("recover openai batches: %w", err)
+	}
+	for _, batchID := range batchIDs {
+		b.finalizeIfDone(batchID)
+	}
+	b.queue.start(b.store.Done(), b.next)
+	return nil
+}
+
+func (b *openAIBatchRunner) next(ctx context.Context) bool {
+	b.expireDueBatches()
+	var inflight *batchInflight
+	req, ok, err := b.store.ClaimOpenAIBatchRequest(b.now(), func(req batch.OpenAIBatchRequest) {
+		inflight = b.queue.track(req.BatchID, req.ID)
+	})
+	if err != nil && ctx.Err() == nil {
+		log.Printf("[gptb2o][batches] claim openai request failed: %v", err)
+	}
+	if !ok {
+		return false
+	}
+	b.queue.notify()
+	b.run(ctx, req, inflight)
+	return true
+}
+
+func (b *openAIBatchRunner) expireDueBatches() {
+	batchIDs, err := b.store.ExpireOpenAIBatches(b.now())
+	if err != nil {
+		return
+	}
+	for _, batchID := range batchIDs {
+		b.finalizeIfDone(batchID)
+	}
+}
+
+func (b *openAIBatchRunner) run(ctx context.Context, req batch.OpenAIBatchRequest, inflight *batchInflight) {
+	defer b.queue.untrack(req.BatchID, req.ID)
+	record, err := b.store.GetOpenAIBatch(req.BatchID)
+	if err != nil {
+		log.Printf("[gptb2o][batches] load openai batch failed: batch=%s err=%v", req.BatchID, err)
+		return
+	}
+
+	reqCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	inflight.bind(cancel)
+
+	status, line := b.execute(reqCtx, record.Endpoint, req)
+	if ctx.Err() != nil {
+		// 进程退出导致的中断不落结果，重启后重新排队。
+		return
+	}
+	if inflight.wasCanceled() {
+		status, line = batch.RequestCanceled, nil
+	}
+	output := ""
+	if line != nil {
+		data, _ := json.Marshal(line)
+		output = string(data)
+	}
+	if err := b.store.FinishOpenAIBatchRequest(req.ID, status, output, b.now()); err != nil {
+		log.Printf("[gptb2o][batches] save openai result failed: batch=%s custom_id=%s err=%v", req.BatchID, req.CustomID, err)
+		return
+	}
+	b.finalizeIfDone(req.BatchID)
+}
+
+func (b *openAIBatchRunner) execute(ctx context.Context, endpoint string, req batch.OpenAIBatchRequest) (string, *openAIBatchOutputLine) {
+	line := &openAIBatchOutputLine{
+		ID:       "batch_req_" + strings.ReplaceAll(uuid.NewString(), "-", ""),
+		CustomID: req.CustomID,
+	}
+	target, ok := b.endpoints[endpoint]
+	if !ok {
+		line.Error = &openAIBatchOutputError{Code: "invalid_url", Message: "unsupported endpoint " + endpoint}
+		return batch.RequestErrored, line
+	}
+	body, err := forceNonStreamBody([]byte(req.Body))
+	if err != nil {
+		line.Error = &openAIBatchOutputError{Code: "invalid_request", Message: "body must be a JSON object"}
+		return batch.RequestErrored, line
+	}
+	code, respBody, err := serveBatchRequest(ctx, target.handler, target.path, body)
+	if err != nil {
+		line.Error = &openAIBatchOutputError{Code: "internal_error", Message: err.Error()}
+		return batch.RequestErrored, line
+	}
+	if !json.Valid(respBody) {
+		respBody, _ = json.Marshal(string(respBody))
+	}
+	line.Response = &openAIBatchOutputResponse{
+		StatusCode: code,
+		RequestID:  "req_" + strings.ReplaceAll(uuid.NewString(), "-", ""),
+		Body:       respBody,
+	}
+	if code < 200 || code >= 300 {
+		return batch.RequestErrored, line
+	}
+	return batch.RequestSucceeded, line
+}
+
+// finalizeIfDone 在所有请求结束后生成 output/error 文件并把 batch 置为终态。
+func (b *openAIBatchRunner) finalizeIfDone(batchID string) {
+	now := b.now()
+	record, ok, err := b.store.BeginFinalizeOpenAIBatch(batchID, now)
+	if err != nil {
+		log.Printf("[gptb2o][batches] finalize openai batch failed: batch=%s err=%v", batchID, err)
+		return
+	}
+	if !ok {
+		return
+	}
+	requests, err := b.store.ListOpenAIBatchRequests(batchID)
+	if err != nil {
+		log.Printf("[gptb2o][batches] finalize openai batch failed: batch=%s err=%v", batchID, err)
+		return
+	}
+
+	var output, errorsOut bytes.Buffer
+	for _, req := range requests {
+		switch req.Status {
+		case batch.RequestSucceeded:
+			output.WriteString(req.Output + "\n")
+		case batch.RequestErrored:
+			errorsOut.WriteString(req.Output + "\n")
+		case batch.RequestCanceled, batch.RequestExpired:
+			code, message := "batch_cancelled", "This request was cancelled before it completed."
+			if req.Status == batch.RequestExpired {
+				code, message = "batch_expired", "This request could not be executed before the completion window expired."
+			}
+			data, _ := json.Marshal(openAIBatchOutputLine{
+				ID:       "batch_req_" + strings.ReplaceAll(uuid.NewString(), "-", ""),
+				CustomID: req.CustomID,
+				Error:    &openAIBatchOutputError{Code: code, Message: message},
+			})
+			errorsOut.Write(data)
+			errorsOut.WriteByte('\n')
+		}
+	}
+
+	finalStatus := batch.OpenAIBatchCompleted
+	switch {
+	case record.CancellingAt != nil:
+		finalStatus = batch.OpenAIBatchCancelled
+	case record.ExpiredAt != nil:
+		finalStatus = batch.OpenAIBatchExpired
+	}
+	var outputFile, errorFile *batch.File
+	if output.Len() > 0 {
+		outputFile = &batch.File{
+			FileID:    newOpenAIFileID(),
+			Purpose:   batch.FilePurposeBatchOutput,
+			Filename:  batchID + "_output.jsonl",
+			Content:   output.Bytes(),
+			CreatedAt: now,
+		}
+	}
+	if errorsOut.Len() > 0 {
+		errorFile = &batch.File{
+			FileID:    newOpenAIFileID(),
+			Purpose:   batch.FilePurposeBatchOutput,
+			Filename:  batchID + "_error.jsonl",
+			Content:   errorsOut.Bytes(),
+			CreatedAt: now,
+		}
+	}
+	if err := b.store.CompleteOpenAIBatch(batchID, finalStatus, outputFile, errorFile, now); err != nil {
+		log.Printf("[gptb2o][batches] complete openai batch failed: batch=%s err=%v", batchID, err)
+	}
+}
+
+func newOpenAIFileID() string {
+	return "file-" + strings.ReplaceAll(uuid.NewString(), "-", "")
+}
+
+func (b *openAIBatchRunner) handleUploadFile(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeOpenAIError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, openAIMaxUploadBytes)
+	if err := r.ParseMultipartForm(openAIMaxUploadBytes); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeOpenAIError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("file exceeds the %d MiB upload limit", openAIMaxUploadBytes>>20))
+			return
+		}
+		writeOpenAIError(w, http.StatusBadRequest, "invalid multipart form")
+		return
+	}
+	purpose := strings.TrimSpace(r.FormValue("purpose"))
+	if purpose != batch.FilePurposeBatch {
+		writeOpenAIError(w, http.StatusBadRequest, "only purpose=batch is supported")
+		return
+	}
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		writeOpenAIError(w, http.StatusBadRequest, "file is required")
+		return
+	}
+	defer file.Close()
+	content, err := io.ReadAll(file)
+	if err != nil {
+		writeOpenAIError(w, http.StatusBadRequest, "failed to read file")
+		return
+	}
+
+	record := batch.File{
+		FileID:    newOpenAIFileID(),
+		Purpose:   purpose,
+		Filename:  header.Filename,
+		Content:   content,
+		CreatedAt: b.now(),
+	}
+	if err := b.store.CreateFile(record); err != nil {
+		writeOpenAIError(w, http.StatusInternalServerError, "failed to save file")
+		return
+	}
+	record.Bytes = int64(len(content))
+	writeJSON(w, openAIFileResponse(record))
+}
+
+func (b *openAIBatchRunner) handleListFiles(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeOpenAIError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	limit, after, ok := parseOpenAIListParams(w, r, 10000)
+	if !ok {
+		return
+	}
+	files, hasMore, err := b.store.ListFiles(strings.TrimSpace(r.URL.Query().Get("purpose")), limit, after)
+	if errors.Is(err, batch.ErrNotFound) {
+		writeOpenAIError(w, http.StatusBadRequest, "pagination cursor not found")
+		return
+	}
+	if err != nil {
+		writeOpenAIError(w, http.StatusInternalServerError, "failed to list files")
+		return
+	}
+	resp := openAIListResponse[openAIFileObject]{Object: "list", Data: make([]openAIFileObject, 0, len(files)), HasMore: hasMore}
+	for _, f := range files {
+		resp.Data = append(resp.Data, openAIFileResponse(f))
+	}
+	if len(resp.Data) > 0 {
+		resp.FirstID = &resp.Data[0].ID
+		resp.LastID = &resp.Data[len(resp.Data)-1].ID
+	}
+	writeJSON(w, resp)
+}
+
+func (b *openAIBatchRunner) handleGetFile(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeOpenAIError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	f, err := b.store.GetFile(strings.TrimSpace(r.PathValue("file_id")))
+	if err != nil {
+		writeOpenAILookupError(w, err, "file")
+		return
+	}
+	writeJSON(w, openAIFileResponse(f))
+}
+
+func (b *openAIBatchRunner) handleFileContent(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeOpenAIError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	f, err := b.store.GetFileContent(strings.TrimSpace(r.PathValue("file_id")))
+	if err != nil {
+		writeOpenAILookupError(w, err, "file")
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.Itoa(len(f.Content)))
+	_, _ = w.Write(f.Content)
+}
+
+func (b *openAIBatchRunner) handleDeleteFile(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		writeOpenAIError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	fileID := strings.TrimSpace(r.PathValue("file_id"))
+	if err := b.store.DeleteFile(fileID); err != nil {
+		writeOpenAILookupError(w, err, "file")
+		return
+	}
+	writeJSON(w, openAIDeletedObject{ID: fileID, Object: "file", Deleted: true})
+}
+
+func (b *openAIBatchRunner) handleCreateBatch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeOpenAIError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	var req openAIBatchCreateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeOpenAIError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if _, ok := b.endpoints[req.Endpoint]; !ok {
+		writeOpenAIError(w, http.StatusBadRequest, "endpoint must be /v1/chat/completions or /v1/responses")
+		return
+	}
+	if req.CompletionWindow != "24h" {
+		writeOpenAIError(w, http.StatusBadRequest, "completion_window must be 24h")
+		return
+	}
+	input, err := b.store.GetFileContent(strings.TrimSpace(req.InputFileID))
+	if err != nil {
+		if errors.Is(err, batch.ErrNotFound) {
+			writeOpenAIError(w, http.StatusBadRequest, "input_file_id not found")
+			return
+		}
+		writeOpenAIError(w, http.StatusInternalServerError, "failed to load input file")
+		return
+	}
+	if input.Purpose != batch.FilePurposeBatch {
+		writeOpenAIError(w, http.StatusBadRequest, "input file must have purpose=batch")
+		return
+	}
+
+	now := b.now()
+	record := batch.OpenAIBatch{
+		BatchID:          "batch_" + strings.ReplaceAll(uuid.NewString(), "-", ""),
+		Endpoint:         req.Endpoint,
+		InputFileID:      input.FileID,
+		CompletionWindow: req.CompletionWindow,
+		Status:           batch.OpenAIBatchInProgress,
+		CreatedAt:        now,
+		ExpiresAt:        now.Add(openAIBatchCompletionLimit),
+		InProgressAt:     &now,
+	}
+	if len(req.Metadata) > 0 {
+		data, _ := json.Marshal(req.Metadata)
+		record.MetadataJSON = string(data)
+	}
+
+	requests, lineErrors := parseOpenAIBatchInput(input.Content, req.Endpoint)
+	if len(lineErrors) > 0 {
+		// 与 OpenAI 一致：输入文件校验失败时 batch 直接进入 failed，错误明细放在 errors 中。
+		data, _ := json.Marshal(openAIBatchErrors{Object: "list", Data: lineErrors})
+		record.Status = batch.OpenAIBatchFailed
+		record.ErrorsJSON = string(data)
+		record.InProgressAt = nil
+		record.FailedAt = &now
+		requests = nil
+	}
+	if err := b.store.CreateOpenAIBatch(record, requests); err != nil {
+		writeOpenAIError(w, http.StatusInternalServerError, "failed to create batch")
+		return
+	}
+	b.queue.notify()
+	b.writeBatch(w, record.BatchID)
+}
+
+// parseOpenAIBatchInput 解析 batch 输入 JSONL，逐行校验 custom_id/method/url/body。
+func parseOpenAIBatchInput(content []byte, endpoint string) ([]batch.OpenAIBatchRequest, []openAIBatchError) {
+	var (
+		requests []batch.OpenAIBatchRequest
+		errs     []openAIBatchError
+		seen     = make(map[string]struct{})
+	)
+	addErr := func(line int, code, message string) {
+		lineNo := line
+		errs = append(errs, openAIBatchError{Code: code, Message: message, Line: &lineNo})
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	scanner.Buffer(make([]byte, 0, 64<<10), openAIMaxUploadBytes)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		raw := bytes.TrimSpace(scanner.Bytes())
+		if len(raw) == 0 {
+			continue
+		}
+		var line openAIBatchInputLine
+		if err := json.Unmarshal(raw, &line); err != nil {
+			addErr(lineNo, "invalid_json_line", "line is not valid JSON")
+			continue
+		}
+		customID := strings.TrimSpace(line.CustomID)
+		switch {
+		case customID == "":
+			addErr(lineNo, "missing_required_parameter", "custom_id is required")
+			continue
+		case !strings.EqualFold(strings.TrimSpace(line.Method), http.MethodPost):
+			addErr(lineNo, "invalid_method", "method must be POST")
+			continue
+		case strings.TrimSpace(line.URL) != endpoint:
+			addErr(lineNo, "mismatched_endpoint", fmt.Sprintf("url must match batch endpoint %s", endpoint))
+			continue
+		}
+		body := bytes.TrimSpace(line.Body)
+		if len(body) == 0 || body[0] != '{' {
+			addErr(lineNo, "invalid_request", "body must be a JSON object")
+			continue
+		}
+		if _, ok := seen[customID]; ok {
+			addErr(lineNo, "duplicate_custom_id", fmt.Sprintf("duplicate custom_id %q", customID))
+			continue
+		}
+		seen[customID] = struct{}{}
+		requests = append(requests, batch.OpenAIBatchRequest{CustomID: customID, Body: string(body)})
+	}
+	if err := scanner.Err(); err != nil {
+		addErr(lineNo+1, "invalid_json_line", err.Error())
+	}
+	if len(errs) == 0 {
+		switch {
+		case len(requests) == 0:
+			errs = append(errs, openAIBatchError{Code: "empty_file", Message: "input file contains no requests"})
+		case len(requests) > openAIBatchMaxRequests:
+			errs = append(errs, openAIBatchError{Code: "too_many_requests", Message: fmt.Sprintf("batch supports at most %d requests", openAIBatchMaxRequests)})
+		}
+	}
+	return requests, errs
+}
+
+func (b *openAIBatchRunner) handleListBatches(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeOpenAIError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	limit, after, ok := parseOpenAIListParams(w, r, openAIBatchMaxListLimit)
+	if !ok {
+		return
+	}
+	records, hasMore, err := b.store.ListOpenAIBatches(limit, after)
+	if errors.Is(err, batch.ErrNotFound) {
+		writeOpenAIError(w, http.StatusBadRequest, "pagination cursor not found")
+		return
+	}
+	if err != nil {
+		writeOpenAIError(w, http.StatusInternalServerError, "failed to list batches")
+		return
+	}
+	resp := openAIListResponse[openAIBatchObject]{Object: "list", Data: make([]openAIBatchObject, 0, len(records)), HasMore: hasMore}
+	for _, record := range records {
+		item, err := b.batchResponse(record)
+		if err != nil {
+			writeOpenAIError(w, http.StatusInternalServerError, "failed to list batches")
+			return
+		}
+		resp.Data = append(resp.Data, item)
+	}
+	if len(resp.Data) > 0 {
+		resp.FirstID = &resp.Data[0].ID
+		resp.LastID = &resp.Data[len(resp.Data)-1].ID
+	}
+	writeJSON(w, resp)
+}
+
+func (b *openAIBatchRunner) handleGetBatch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeOpenAIError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	b.writeBatch(w, strings.TrimSpace(r.PathValue("batch_id")))
+}
+
+func (b *openAIBatchRunner) handleCancelBatch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeOpenAIError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	batchID := strings.TrimSpace(r.PathValue("batch_id"))
+	if _, err := b.store.CancelOpenAIBatch(batchID, b.now()); err != nil {
+		writeOpenAILookupError(w, err, "batch")
+		return
+	}
+	b.queue.cancelInflight(batchID)
+	b.finalizeIfDone(batchID)
+	b.writeBatch(w, batchID)
+}
+
+func (b *openAIBatchRunner) writeBatch(w http.ResponseWriter, batchID string) {
+	record, err := b.store.GetOpenAIBatch(batchID)
+	if err != nil {
+		writeOpenAILookupError(w, err, "batch")
+		return
+	}
+	resp, err := b.batchResponse(record)
+	if err != nil {
+		writeOpenAIError(w, http.StatusInternalServerError, "failed to load batch")
+		return
+	}
+	writeJSON(w, resp)
+}
+
+func (b *openAIBatchRunner) batchResponse(record batch.OpenAIBatch) (openAIBatchObject, error) {
+	counts, err := b.store.CountOpenAIBatchRequests(record.BatchID)
+	if err != nil {
+		return openAIBatchObject{}, err
+	}
+	resp := openAIBatchObject{
+		ID:               record.BatchID,
+		Object:           "batch",
+		Endpoint:         record.Endpoint,
+		InputFileID:      record.InputFileID,
+		CompletionWindow: record.CompletionWindow,
+		Status:           record.Status,
+		CreatedAt:        record.CreatedAt.Unix(),
+		InProgressAt:     unixOrNil(record.InProgressAt),
+		ExpiresAt:        unixOrNil(&record.ExpiresAt),
+		FinalizingAt:     unixOrNil(record.FinalizingAt),
+		CompletedAt:      unixOrNil(record.CompletedAt),
+		FailedAt:         unixOrNil(record.FailedAt),
+		ExpiredAt:        unixOrNil(record.ExpiredAt),
+		CancellingAt:     unixOrNil(record.CancellingAt),
+		CancelledAt:      unixOrNil(record.CancelledAt),
+		RequestCounts:    counts,
+	}
+	if record.OutputFileID != "" {
+		resp.OutputFileID = &record.OutputFileID
+	}
+	if record.ErrorFileID != "" {
+		resp.ErrorFileID = &record.ErrorFileID
+	}
+	if record.ErrorsJSON != "" {
+		var errs openAIBatchErrors
+		if json.Unmarshal([]byte(record.ErrorsJSON), &errs) == nil {
+			resp.Errors = &errs
+		}
+	}
+	if record.MetadataJSON != "" {
+		_ = json.Unmarshal([]byte(record.MetadataJSON), &resp.Metadata)
+	}
+	return resp, nil
+}
+
+func openAIFileResponse(f batch.File) openAIFileObject {
+	return openAIFileObject{
+		ID:        f.FileID,
+		Object:    "file",
+		Bytes:     f.Bytes,
+		CreatedAt: f.CreatedAt.Unix(),
+		Filename:  f.Filename,
+		Purpose:   f.Purpose,
+	}
+}
+
+func parseOpenAIListParams(w http.ResponseWriter, r *http.Request, maxLimit int) (int, string, bool) {
+	query := r.URL.Query()
+	limit := 20
+	if raw := strings.TrimSpace(query.Get("limit")); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > maxLimit {
+			writeOpenAIError(w, http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", maxLimit))
+			return 0, "", false
+		}
+		limit = n
+	}
+	return limit, strings.TrimSpace(query.Get("after")), true
+}
+
+func writeOpenAILookupError(w http.ResponseWriter, err error, kind string) {
+	if errors.Is(err, batch.ErrNotFound) {
+		writeOpenAIError(w, http.StatusNotFound, kind+" not found")
+		return
+	}
+	writeOpenAIError(w, http.StatusInternalServerError, "failed to load "+kind)
+}
+
+func unixOrNil(t *time.Time) *int64 {
+	if t == nil || t.IsZero() {
+		return nil
+	}
+	v := t.Unix()
+	return &v
+}
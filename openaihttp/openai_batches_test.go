@@ -0,0 +1,267 @@
+package openaihttp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/LubyRuffy/gptb2o/batch"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestOpenAIBatchRunner(t *testing.T, chat http.HandlerFunc) *openAIBatchRunner {
+	t.Helper()
+	store, err := batch.OpenStore(filepath.Join(t.TempDir(), "batch.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = store.Close() })
+	runner := newOpenAIBatchRunner(store, map[string]openAIBatchEndpoint{
+		"/v1/chat/completions": {path: "/v1/chat/completions", handler: chat},
+	}, 2)
+	require.NoError(t, runner.start())
+	return runner
+}
+
+func uploadOpenAIBatchFile(t *testing.T, runner *openAIBatchRunner, content string) openAIFileObject {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	require.NoError(t, mw.WriteField("purpose", "batch"))
+	part, err := mw.CreateFormFile("file", "input.jsonl")
+	require.NoError(t, err)
+	_, err = io.WriteString(part, content)
+	require.NoError(t, err)
+	require.NoError(t, mw.Close())
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/files", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	w := httptest.NewRecorder()
+	runner.handleUploadFile(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var file openAIFileObject
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &file))
+	return file
+}
+
+func createOpenAIBatch(t *testing.T, runner *openAIBatchRunner, fileID string) openAIBatchObject {
+	t.Helper()
+	body := `{"input_file_id":"` + fileID + `","endpoint":"/v1/chat/completions","completion_window":"24h","metadata":{"job":"eval"}}`
+	req := httptest.NewRequest(http.MethodPost, "/v1/batches", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	runner.handleCreateBatch(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var created openAIBatchObject
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	return created
+}
+
+func getOpenAIBatch(t *testing.T, runner *openAIBatchRunner, batchID string) openAIBatchObject {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/v1/batches/"+batchID, nil)
+	req.SetPathValue("batch_id", batchID)
+	w := httptest.NewRecorder()
+	runner.handleGetBatch(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var got openAIBatchObject
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &got))
+	return got
+}
+
+func waitOpenAIBatchStatus(t *testing.T, runner *openAIBatchRunner, batchID string, status string) openAIBatchObject {
+	t.Helper()
+	var got openAIBatchObject
+	require.Eventually(t, func() bool {
+		got = getOpenAIBatch(t, runner, batchID)
+		return got.Status == status
+	}, 5*time.Second, 10*time.Millisecond)
+	return got
+}
+
+func readOpenAIFileLines(t *testing.T, runner *openAIBatchRunner, fileID string) map[string]openAIBatchOutputLine {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/v1/files/"+fileID+"/content", nil)
+	req.SetPathValue("file_id", fileID)
+	w := httptest.NewRecorder()
+	runner.handleFileContent(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	lines := make(map[string]openAIBatchOutputLine)
+	for _, raw := range strings.Split(strings.TrimSpace(w.Body.String()), "\n") {
+		var line openAIBatchOutputLine
+		require.NoError(t, json.Unmarshal([]byte(raw), &line))
+		lines[line.CustomID] = line
+	}
+	return lines
+}
+
+func TestOpenAIBatches_RunProducesOutputAndErrorFiles(t *testing.T) {
+	var sawStream atomic.Bool
+	runner := newTestOpenAIBatchRunner(t, func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Model  string `json:"model"`
+			Stream bool   `json:"stream"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		if req.Stream {
+			sawStream.Store(true)
+		}
+		if req.Model == "bad" {
+			writeOpenAIError(w, http.StatusBadRequest, "unsupported model")
+			return
+		}
+		writeJSON(w, map[string]any{"object": "chat.completion", "model": req.Model})
+	})
+
+	input := uploadOpenAIBatchFile(t, runner, strings.Join([]string{
+		`{"custom_id":"ok","method":"POST","url":"/v1/chat/completions","body":{"model":"gpt-5.4","stream":true,"messages":[]}}`,
+		`{"custom_id":"bad","method":"POST","url":"/v1/chat/completions","body":{"model":"bad","messages":[]}}`,
+	}, "\n"))
+	require.Equal(t, "batch", input.Purpose)
+	require.True(t, strings.HasPrefix(input.ID, "file-"))
+
+	created := createOpenAIBatch(t, runner, input.ID)
+	require.Equal(t, "batch", created.Object)
+	require.Equal(t, map[string]string{"job": "eval"}, created.Metadata)
+
+	done := waitOpenAIBatchStatus(t, runner, created.ID, batch.OpenAIBatchCompleted)
+	require.Equal(t, batch.OpenAIRequestCounts{Total: 2, Completed: 1, Failed: 1}, done.RequestCounts)
+	require.NotNil(t, done.CompletedAt)
+	require.NotNil(t, done.OutputFileID)
+	require.NotNil(t, done.ErrorFileID)
+
+	output := readOpenAIFileLines(t, runner, *done.OutputFileID)
+	require.Len(t, output, 1)
+	require.Equal(t, http.StatusOK, output["ok"].Response.StatusCode)
+	require.JSONEq(t, `{"object":"chat.completion","model":"gpt-5.4"}`, string(output["ok"].Response.Body))
+
+	errorsOut := readOpenAIFileLines(t, runner, *done.ErrorFileID)
+	require.Len(t, errorsOut, 1)
+	require.Equal(t, http.StatusBadRequest, errorsOut["bad"].Response.StatusCode)
+	require.False(t, sawStream.Load())
+}
+
+func TestOpenAIBatches_InvalidInputFailsBatch(t *testing.T) {
+	runner := newTestOpenAIBatchRunner(t, func(w http.ResponseWriter, r *http.Request) {
+		t.Error("handler should not run for a failed batch")
+	})
+
+	input := uploadOpenAIBatchFile(t, runner, strings.Join([]string{
+		`{"custom_id":"a","method":"POST","url":"/v1/responses","body":{}}`,
+		`not json`,
+	}, "\n"))
+	created := createOpenAIBatch(t, runner, input.ID)
+	require.Equal(t, batch.OpenAIBatchFailed, created.Status)
+	require.NotNil(t, created.FailedAt)
+	require.NotNil(t, created.Errors)
+	require.Len(t, created.Errors.Data, 2)
+	require.Equal(t, "mismatched_endpoint", created.Errors.Data[0].Code)
+	require.Equal(t, 2, *created.Errors.Data[1].Line)
+}
+
+func TestOpenAIBatches_CancelWritesCancelledErrors(t *testing.T) {
+	started := make(chan struct{}, 4)
+	runner := newTestOpenAIBatchRunner(t, func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-r.Context().Done()
+		writeOpenAIError(w, http.StatusInternalServerError, "canceled")
+	})
+
+	input := uploadOpenAIBatchFile(t, runner, strings.Join([]string{
+		`{"custom_id":"a","method":"POST","url":"/v1/chat/completions","body":{}}`,
+		`{"custom_id":"b","method":"POST","url":"/v1/chat/completions","body":{}}`,
+		`{"custom_id":"c","method":"POST","url":"/v1/chat/completions","body":{}}`,
+	}, "\n"))
+	created := createOpenAIBatch(t, runner, input.ID)
+	<-started
+	<-started
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/batches/"+created.ID+"/cancel", nil)
+	req.SetPathValue("batch_id", created.ID)
+	w := httptest.NewRecorder()
+	runner.handleCancelBatch(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	done := waitOpenAIBatchStatus(t, runner, created.ID, batch.OpenAIBatchCancelled)
+	require.NotNil(t, done.CancellingAt)
+	require.NotNil(t, done.CancelledAt)
+	require.Nil(t, done.OutputFileID)
+	require.NotNil(t, done.ErrorFileID)
+	errorsOut := readOpenAIFileLines(t, runner, *done.ErrorFileID)
+	require.Len(t, errorsOut, 3)
+	for _, line := range errorsOut {
+		require.Equal(t, "batch_cancelled", line.Error.Code)
+	}
+}
+
+func TestOpenAIBatches_FileLifecycle(t *testing.T) {
+	runner := newTestOpenAIBatchRunner(t, func(w http.ResponseWriter, r *http.Request) {})
+	input := uploadOpenAIBatchFile(t, runner, "{}\n")
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/files?purpose=batch", nil)
+	w := httptest.NewRecorder()
+	runner.handleListFiles(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	var list openAIListResponse[openAIFileObject]
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	require.Len(t, list.Data, 1)
+	require.Equal(t, input.ID, list.Data[0].ID)
+	require.EqualValues(t, 3, list.Data[0].Bytes)
+
+	req = httptest.NewRequest(http.MethodDelete, "/v1/files/"+input.ID, nil)
+	req.SetPathValue("file_id", input.ID)
+	w = httptest.NewRecorder()
+	runner.handleDeleteFile(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	req = httptest.NewRequest(http.MethodGet, "/v1/files/"+input.ID, nil)
+	req.SetPathValue("file_id", input.ID)
+	w = httptest.NewRecorder()
+	runner.handleGetFile(w, req)
+	require.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestOpenAIBatchesHandlers_RejectsSecondConstructionOnSameStore(t *testing.T) {
+	store, err := batch.OpenStore(filepath.Join(t.TempDir(), "batch.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = store.Close() })
+	cfg := Config{
+		Batches:      store,
+		AuthProvider: func(ctx context.Context) (string, string, error) { return "token", "", nil },
+	}
+
+	_, err = OpenAIBatchesHandlers(cfg)
+	require.NoError(t, err)
+	_, err = OpenAIBatchesHandlers(cfg)
+	require.ErrorIs(t, err, batch.ErrWorkersAttached)
+	// Message Batches 的 worker 与 Files/Batch 的 worker 互不冲突。
+	_, err = ClaudeMessageBatchesHandlers(cfg)
+	require.NoError(t, err)
+}
+
+func TestOpenAIBatches_UploadRejectsOversizedFile(t *testing.T) {
+	runner := newTestOpenAIBatchRunner(t, nil)
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	require.NoError(t, mw.WriteField("purpose", "batch"))
+	part, err := mw.CreateFormFile("file", "input.jsonl")
+	require.NoError(t, err)
+	_, err = part.Write(bytes.Repeat([]byte("x"), openAIMaxUploadBytes+1))
+	require.NoError(t, err)
+	require.NoError(t, mw.Close())
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/files", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	w := httptest.NewRecorder()
+	runner.handleUploadFile(w, req)
+	require.Equal(t, http.StatusRequestEntityTooLarge, w.Code, w.Body.String())
+	require.Contains(t, w.Body.String(), "32 MiB")
+}
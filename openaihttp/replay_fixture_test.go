@@ -0,0 +1,123 @@
+package openaihttp_test
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/LubyRuffy/gptb2o/openaihttp"
+	"github.com/LubyRuffy/gptb2o/trace"
+	"github.com/stretchr/testify/require"
+)
+
+// updateRecordings 为 true 时先重新录制 fixture：go test ./openaihttp -run ReplaysRecorded -update-recordings
+var updateRecordings = flag.Bool("update-recordings", false, "re-record testdata/recordings fixtures through the trace exporter")
+
+const (
+	claudeReadFixture = "testdata/recordings/claude_read_tool_use.jsonl"
+	claudeReadRequest = `{
+  "model":"gpt-5.4",
+  "max_tokens":1024,
+  "messages":[{"role":"user","content":"show me /tmp/a.txt"}],
+  "tools":[{"name":"Read","description":"read a file","input_schema":{"type":"object","properties":{"file_path":{"type":"string"}},"required":["file_path"]}}]
+}`
+	// claudeReadBackendSSE 是录制时 stub backend 返回的响应。
+	claudeReadBackendSSE = "event: response.created\n" +
+		`data: {"type":"response.created","response":{"id":"resp_fixture_1","status":"in_progress"}}` + "\n\n" +
+		"event: response.completed\n" +
+		`data: {"type":"response.completed","response":{"id":"resp_fixture_1","status":"completed","output":[{"id":"fc_fixture_1","type":"function_call","call_id":"call_fixture_1","name":"Read","arguments":"{\"file_path\":\"/tmp/a.txt\"}","status":"completed"}],"usage":{"input_tokens":42,"output_tokens":9}}}` + "\n\n" +
+		"data: [DONE]\n\n"
+)
+
+func serveClaudeRead(t *testing.T, cfg openaihttp.Config) *httptest.ResponseRecorder {
+	t.Helper()
+	cfg.AuthProvider = func(ctx context.Context) (string, string, error) { return "token", "acc", nil }
+	handler, err := openaihttp.ClaudeMessagesHandler(cfg)
+	require.NoError(t, err)
+	req := httptest.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(claudeReadRequest))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	handler(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	return w
+}
+
+type stubSSETransport string
+
+func (body stubSSETransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		_, _ = io.Copy(io.Discard, req.Body)
+		_ = req.Body.Close()
+	}
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     http.Header{"Content-Type": []string{"text/event-stream"}},
+		Body:       io.NopCloser(strings.NewReader(string(body))),
+		Request:    req,
+	}, nil
+}
+
+// recordClaudeReadFixture 让真实的 handler 经 trace 记录一次 backend 会话，再用
+// trace export --format recordings 同一套导出逻辑写出 fixture，保证请求体与当前实现一致。
+func recordClaudeReadFixture(t *testing.T) {
+	t.Helper()
+	store, err := trace.OpenStore(filepath.Join(t.TempDir(), "trace.db"))
+	require.NoError(t, err)
+	defer func() { require.NoError(t, store.Close()) }()
+
+	// 不改 BackendURL，录制中的 URL 与线上默认地址一致；stub transport 代替真实 backend。
+	w := serveClaudeRead(t, openaihttp.Config{
+		HTTPClient: &http.Client{Transport: stubSSETransport(claudeReadBackendSSE)},
+		Tracer:     trace.NewTracer(store, trace.TracerOptions{}),
+	})
+	interactionID := w.Header().Get(trace.InteractionIDHeader)
+	require.NotEmpty(t, interactionID)
+
+	file, err := os.Create(claudeReadFixture)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, file.Close()) }()
+	require.NoError(t, store.Export(file, []string{interactionID}, trace.ExportOptions{Format: trace.ExportRecordings}))
+}
+
+// 用 trace export --format recordings 导出的 backend 会话作为离线 fixture，无需 GPTB2O_ACCESS_TOKEN。
+// 严格匹配：handler 发往 backend 的请求体一旦变化，测试就会失败，需要用 -update-recordings 重新录制。
+func TestClaudeMessages_ReplaysRecordedBackendFixture(t *testing.T) {
+	if *updateRecordings {
+		recordClaudeReadFixture(t)
+	}
+
+	file, err := os.Open(claudeReadFixture)
+	require.NoError(t, err)
+	defer file.Close()
+	recordings, err := trace.ReadRecordings(file)
+	require.NoError(t, err)
+	require.Len(t, recordings, 1)
+	transport, err := trace.NewReplayTransport(recordings, trace.ReplayTransportOptions{Match: trace.ReplayStrict})
+	require.NoError(t, err)
+
+	w := serveClaudeRead(t, openaihttp.Config{HTTPClient: &http.Client{Transport: transport}})
+	var resp struct {
+		StopReason string `json:"stop_reason"`
+		Content    []struct {
+			Type  string         `json:"type"`
+			Name  string         `json:"name"`
+			Input map[string]any `json:"input"`
+		} `json:"content"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.Equal(t, "tool_use", resp.StopReason)
+	require.Len(t, resp.Content, 1)
+	require.Equal(t, "Read", resp.Content[0].Name)
+	require.Equal(t, "/tmp/a.txt", resp.Content[0].Input["file_path"])
+	require.Empty(t, transport.Unused())
+}
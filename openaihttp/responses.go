@@ -12,9 +12,9 @@ import (
 	"net/http"
 	"strings"
 
-	"github.com/LubyRuffy/gptb2o"
 	"github.com/LubyRuffy/gptb2o/backend"
 	"github.com/LubyRuffy/gptb2o/openaiapi"
+	"github.com/LubyRuffy/gptb2o/telemetry"
 )
 
 const (
@@ -76,74 +76,55 @@ func newResponsesHandler(cfg resolvedConfig) http.HandlerFunc {
 			return
 		}
 
-		req.Model = strings.TrimSpace(req.Model)
-		if req.Model == "" {
-			writeOpenAIError(w, http.StatusBadRequest, "model is required")
-			return
-		}
-		if !gptb2o.IsSupportedModelID(req.Model) {
-			writeOpenAIError(w, http.StatusBadRequest, "unsupported model")
-			return
-		}
-
-		inputItems, systemInstructions, err := parseResponsesInput(req.Input)
-		if err != nil {
-			writeOpenAIError(w, http.StatusBadRequest, err.Error())
-			return
-		}
-
-		normalizedModel := gptb2o.NormalizeModelID(req.Model)
-		instructions := mergeInstructions(normalizeUndefinedString(req.Instructions), normalizeUndefinedString(systemInstructions))
-		if instructions == "" {
-			// ChatGPT backend `/backend-api/codex/responses` 在某些情况下会要求 instructions 字段存在且为有效值，
-			// 即使调用方没有显式提供（例如 CLI curl 直接请求）。
-			// 同时部分客户端会把未定义字段序列化为 "[undefined]"，这里统一清洗并补默认值。
-			instructions = defaultCodexInstructions
-		}
-		effort := normalizeReasoningEffort(req.Reasoning.Effort)
-		if effort == "" {
-			effort = cfg.ReasoningEffort
-		}
-		tools := backend.EnsureWebSearchToolDefinition(backend.ToolsFromOpenAITools(req.Tools))
-		tools, _ = backend.RemoveToolTypeDefinitions(tools, backend.ToolTypeCodeInterpreter)
-
-		accessToken, accountID, err := cfg.AuthProvider(r.Context())
-		if err != nil {
-			writeOpenAIError(w, http.StatusServiceUnavailable, "auth not available")
-			return
-		}
-
-		payload := backendResponsesPayload{
-			Model:        normalizedModel,
-			Input:        inputItems,
-			Instructions: instructions,
-			Reasoning:    reasoningOrNil(effort),
-			Tools:        tools,
-			Store:        false,
-			Stream:       true,
-		}
-
-		resp, err := doBackendResponsesRequest(r.Context(), cfg, accessToken, accountID, payload)
+		// RequestTimeout 覆盖整个 handler，包括读完 backend 流。
+		ctx, cancel := backend.WithRequestTimeout(r.Context(), cfg.Timeouts.Total)
+		defer cancel()
+		resp, err := startResponsesRequest(ctx, cfg, req)
 		if err != nil {
+			if isServerShuttingDown(r.Context()) {
+				writeOpenAIError(w, http.StatusServiceUnavailable, ErrServerShuttingDown.Error())
+				return
+			}
 			var httpErr *httpErrorWithStatus
 			if errors.As(err, &httpErr) && httpErr != nil {
-				log.Printf("[gptb2o][responses] backend request failed: status=%d model=%s stream=%t message=%q", httpErr.status, normalizedModel, req.Stream, compactLogMessage(httpErr.message))
 				writeOpenAIError(w, httpErr.status, httpErr.Error())
 				return
 			}
-			log.Printf("[gptb2o][responses] backend request error: model=%s stream=%t err=%v", normalizedModel, req.Stream, err)
+			if timeoutErr, ok := backend.AsStreamTimeout(ctx, err); ok {
+				writeOpenAIError(w, http.StatusGatewayTimeout, timeoutErr.Error())
+				return
+			}
 			writeOpenAIError(w, http.StatusBadGateway, err.Error())
 			return
 		}
 		defer resp.Body.Close()
 
 		if req.Stream {
-			_ = writeResponsesStream(w, r.Context(), resp.Body)
+			err := writeResponsesStream(w, ctx, resp.Body)
+			if err == nil {
+				return
+			}
+			if isServerShuttingDown(r.Context()) {
+				writeResponsesShutdownEvent(w)
+				return
+			}
+			if timeoutErr, ok := backend.AsStreamTimeout(ctx, err); ok {
+				log.Printf("[gptb2o][responses] %v", timeoutErr)
+				writeResponsesErrorEvent(w, timeoutErr.Code(), timeoutErr.Error())
+			}
 			return
 		}
 
-		completedResp, err := readCompletedResponse(r.Context(), resp.Body)
+		completedResp, err := readCompletedResponse(ctx, resp.Body)
 		if err != nil {
+			if isServerShuttingDown(r.Context()) {
+				writeOpenAIError(w, http.StatusServiceUnavailable, ErrServerShuttingDown.Error())
+				return
+			}
+			if timeoutErr, ok := backend.AsStreamTimeout(ctx, err); ok {
+				writeOpenAIError(w, http.StatusGatewayTimeout, timeoutErr.Error())
+				return
+			}
 			writeOpenAIError(w, http.StatusBadGateway, err.Error())
 			return
 		}
@@ -153,6 +134,69 @@ func newResponsesHandler(cfg resolvedConfig) http.HandlerFunc {
 	}
 }
 
+// startResponsesRequest 校验请求并发起上游流式调用，HTTP 与 WebSocket 两种传输共用。
+// 校验/鉴权失败返回 *httpErrorWithStatus，调用方负责关闭返回的 resp.Body。
+func startResponsesRequest(ctx context.Context, cfg resolvedConfig, req responsesRequest) (*http.Response, error) {
+	req.Model = strings.TrimSpace(req.Model)
+	if req.Model == "" {
+		return nil, &httpErrorWithStatus{status: http.StatusBadRequest, message: "model is required"}
+	}
+	modelInfo, ok := cfg.Settings.models().Resolve(req.Model)
+	if !ok {
+		return nil, &httpErrorWithStatus{status: http.StatusBadRequest, message: "unsupported model"}
+	}
+	if err := toolsUnsupportedError(modelInfo, len(req.Tools)); err != nil {
+		return nil, &httpErrorWithStatus{status: http.StatusBadRequest, message: httpMessageFromError(err)}
+	}
+
+	inputItems, systemInstructions, err := parseResponsesInput(req.Input)
+	if err != nil {
+		return nil, &httpErrorWithStatus{status: http.StatusBadRequest, message: err.Error()}
+	}
+
+	normalizedModel := modelInfo.ID
+	instructions := mergeInstructions(normalizeUndefinedString(req.Instructions), normalizeUndefinedString(systemInstructions))
+	if instructions == "" {
+		// ChatGPT backend `/backend-api/codex/responses` 在某些情况下会要求 instructions 字段存在且为有效值，
+		// 即使调用方没有显式提供（例如 CLI curl 直接请求）。
+		// 同时部分客户端会把未定义字段序列化为 "[undefined]"，这里统一清洗并补默认值。
+		instructions = defaultCodexInstructions
+	}
+	effort := effortForModel(modelInfo, normalizeReasoningEffort(req.Reasoning.Effort))
+	if effort == "" {
+		effort = cfg.Settings.defaultReasoningEffort(normalizedModel, cfg.ReasoningEffort)
+	}
+	tools := backend.EnsureWebSearchToolDefinition(backend.ToolsFromOpenAITools(req.Tools))
+	tools, _ = backend.RemoveToolTypeDefinitions(tools, backend.ToolTypeCodeInterpreter)
+
+	accessToken, accountID, err := cfg.AuthProvider(ctx)
+	if err != nil {
+		return nil, &httpErrorWithStatus{status: http.StatusServiceUnavailable, message: "auth not available"}
+	}
+
+	payload := backendResponsesPayload{
+		Model:        normalizedModel,
+		Input:        inputItems,
+		Instructions: instructions,
+		Reasoning:    reasoningOrNil(effort),
+		Tools:        tools,
+		Store:        false,
+		Stream:       true,
+	}
+
+	resp, err := doBackendResponsesRequest(ctx, cfg, accessToken, accountID, payload)
+	if err != nil {
+		var httpErr *httpErrorWithStatus
+		if errors.As(err, &httpErr) && httpErr != nil {
+			log.Printf("[gptb2o][responses] backend request failed: status=%d model=%s stream=%t message=%q", httpErr.status, normalizedModel, req.Stream, compactLogMessage(httpErr.message))
+			return nil, err
+		}
+		log.Printf("[gptb2o][responses] backend request error: model=%s stream=%t err=%v", normalizedModel, req.Stream, err)
+		return nil, err
+	}
+	return resp, nil
+}
+
 func doBackendResponsesRequest(
 	ctx context.Context,
 	cfg resolvedConfig,
@@ -162,15 +206,21 @@ func doBackendResponsesRequest(
 ) (*http.Response, error) {
 	currentPayload := payload
 	retriedReasoningEffort := false
+	requestSpan := telemetry.SpanFromContext(ctx)
 
-	for {
+	for attempt := 1; ; attempt++ {
 		bodyBytes, err := json.Marshal(currentPayload)
 		if err != nil {
 			return nil, fmt.Errorf("failed to encode backend request: %w", err)
 		}
 
-		req, err := http.NewRequestWithContext(ctx, http.MethodPost, cfg.BackendURL, bytes.NewReader(bodyBytes))
+		attemptCtx, attemptSpan := startBackendAttemptSpan(ctx, cfg, attempt, currentPayload)
+		// watchdog 在 resp.Body 关闭时停止，透传流的读取同样受 idle 超时约束。
+		reqCtx, watchdog := backend.NewStreamWatchdog(attemptCtx, cfg.Timeouts)
+		req, err := http.NewRequestWithContext(reqCtx, http.MethodPost, cfg.BackendURL, bytes.NewReader(bodyBytes))
 		if err != nil {
+			watchdog.Stop()
+			attemptSpan.End()
 			return nil, fmt.Errorf("failed to build backend request: %w", err)
 		}
 
@@ -185,15 +235,26 @@ func doBackendResponsesRequest(
 
 		resp, err := cfg.HTTPClient.Do(req)
 		if err != nil {
+			err = watchdog.Err(err)
+			watchdog.Stop()
+			attemptSpan.RecordError(err)
+			attemptSpan.End()
 			return nil, fmt.Errorf("backend request failed: %w", err)
 		}
+		resp.Body = watchdog.WatchBody(resp.Body)
+		attemptSpan.SetAttributes(telemetry.Int(telemetry.AttrHTTPStatusCode, resp.StatusCode))
 		if resp.StatusCode >= http.StatusOK && resp.StatusCode < http.StatusBadRequest {
+			if cfg.Telemetry != nil {
+				resp.Body = newTracedResponseBody(attemptCtx, cfg, requestSpan, attemptSpan, resp.Body)
+			}
 			return resp, nil
 		}
 
 		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxBackendErrBytes))
 		_ = resp.Body.Close()
 		message := strings.TrimSpace(string(body))
+		attemptSpan.SetError(message)
+		attemptSpan.End()
 
 		if !retriedReasoningEffort && resp.StatusCode == http.StatusBadRequest && currentPayload.Reasoning != nil {
 			currentEffort := strings.TrimSpace(currentPayload.Reasoning.Effort)
@@ -205,6 +266,8 @@ func doBackendResponsesRequest(
 				)
 				currentPayload.Reasoning = &responsesReasoning{Effort: fallbackEffort}
 				retriedReasoningEffort = true
+				recordBackendRetry(ctx, cfg.Metrics, backend.RetryReasonReasoningEffort)
+				requestSpan.AddEvent("retry", telemetry.String(telemetry.AttrRetryReason, string(backend.RetryReasonReasoningEffort)))
 				continue
 			}
 		}
@@ -464,6 +527,19 @@ func writeResponsesStream(w http.ResponseWriter, ctx context.Context, body io.Re
 		return fmt.Errorf("streaming not supported")
 	}
 
+	return forEachOfficialEvent(ctx, body, func(eventType string, dataLines []string) error {
+		_, _ = fmt.Fprintf(w, "event: %s\n", eventType)
+		for _, line := range dataLines {
+			_, _ = fmt.Fprintf(w, "data: %s\n", line)
+		}
+		_, _ = fmt.Fprint(w, "\n")
+		flusher.Flush()
+		return nil
+	})
+}
+
+// forEachOfficialEvent 逐个解析上游 SSE 事件并回调；无法识别 type 的事件会被跳过，遇到 [DONE] 结束。
+func forEachOfficialEvent(ctx context.Context, body io.Reader, fn func(eventType string, dataLines []string) error) error {
 	reader := bufio.NewReader(body)
 	var dataLines []string
 
@@ -475,12 +551,7 @@ func writeResponsesStream(w http.ResponseWriter, ctx context.Context, body io.Re
 		line, err := reader.ReadString('\n')
 		if err != nil {
 			if errors.Is(err, io.EOF) {
-				if len(dataLines) > 0 {
-					if err := flushOfficialEvent(w, flusher, dataLines); err != nil {
-						return err
-					}
-				}
-				return nil
+				return emitOfficialEvent(dataLines, fn)
 			}
 			return err
 		}
@@ -490,7 +561,7 @@ func writeResponsesStream(w http.ResponseWriter, ctx context.Context, body io.Re
 			if len(dataLines) == 0 {
 				continue
 			}
-			if err := flushOfficialEvent(w, flusher, dataLines); err != nil {
+			if err := emitOfficialEvent(dataLines, fn); err != nil {
 				return err
 			}
 			dataLines = dataLines[:0]
@@ -509,7 +580,7 @@ func writeResponsesStream(w http.ResponseWriter, ctx context.Context, body io.Re
 	}
 }
 
-func flushOfficialEvent(w http.ResponseWriter, flusher http.Flusher, dataLines []string) error {
+func emitOfficialEvent(dataLines []string, fn func(eventType string, dataLines []string) error) error {
 	if len(dataLines) == 0 {
 		return nil
 	}
@@ -525,14 +596,7 @@ func flushOfficialEvent(w http.ResponseWriter, flusher http.Flusher, dataLines [
 	if eventType == "" {
 		return nil
 	}
-
-	_, _ = fmt.Fprintf(w, "event: %s\n", eventType)
-	for _, line := range dataLines {
-		_, _ = fmt.Fprintf(w, "data: %s\n", line)
-	}
-	_, _ = fmt.Fprint(w, "\n")
-	flusher.Flush()
-	return nil
+	return fn(eventType, dataLines)
 }
 
 func readCompletedResponse(ctx context.Context, body io.Reader) ([]byte, error) {
@@ -0,0 +1,489 @@
+package openaihttp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/LubyRuffy/gptb2o/backend"
+	"github.com/LubyRuffy/gptb2o/metrics"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// 单帧上限与 HTTP 请求体保持同一量级，允许携带图片等较大的 input。
+	maxResponsesWSMessageBytes = 32 << 20
+
+	responsesWSCreate    = "response.create"
+	responsesWSCancel    = "response.cancel"
+	responsesWSCancelled = "response.cancelled"
+
+	responsesWSCloseTimeout = time.Second
+)
+
+// newResponsesWSUpgrader 返回校验 Origin 的 Upgrader。浏览器发起 WebSocket 不经过 CORS 预检，
+// 若不校验，任意网页都能借本机代理保存的 ChatGPT 凭据发起请求；因此默认只接受与请求 Host 相同的 Origin
+// 以及不带 Origin 的非浏览器客户端，其他来源需加入 allowedOrigins（"*" 表示不限制）。
+func newResponsesWSUpgrader(allowedOrigins []string) websocket.Upgrader {
+	allowed := make(map[string]bool, len(allowedOrigins))
+	for _, origin := range allowedOrigins {
+		if origin = strings.TrimRight(strings.TrimSpace(origin), "/"); origin != "" {
+			allowed[strings.ToLower(origin)] = true
+		}
+	}
+	return websocket.Upgrader{
+		CheckOrigin: func(r *http.Request) bool {
+			origin := strings.TrimSpace(r.Header.Get("Origin"))
+			if origin == "" || allowed["*"] || allowed[strings.ToLower(origin)] {
+				return true
+			}
+			u, err := url.Parse(origin)
+			return err == nil && strings.EqualFold(u.Host, r.Host)
+		},
+	}
+}
+
+// ResponsesWebSocketHandler 返回 GET /v1/responses 的 WebSocket 处理器。
+// 客户端在同一连接上发送 response.create / response.cancel 帧，
+// 服务端以文本帧逐个推送与 SSE 接口相同的 Responses 事件。
+// 每个 response.create 按一次 POST /v1/responses 流式请求参与并发限制，并记录 metrics、telemetry 与 trace。
+func ResponsesWebSocketHandler(cfg Config) (http.HandlerFunc, error) {
+	resolved, err := resolveConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return newResponsesWebSocketHandler(resolved), nil
+}
+
+func newResponsesWebSocketHandler(cfg resolvedConfig) http.HandlerFunc {
+	upgrader := newResponsesWSUpgrader(cfg.WebSocketAllowedOrigins)
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !websocket.IsWebSocketUpgrade(r) {
+			writeOpenAIError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			// Upgrade 失败时已写回 HTTP 错误。
+			return
+		}
+		session := newResponsesWSSession(cfg, conn, r)
+		session.serve(r.Context())
+	}
+}
+
+// responsesWSSession 表示一条 WebSocket 连接；同一时刻最多一个进行中的 response。
+type responsesWSSession struct {
+	cfg  resolvedConfig
+	conn *websocket.Conn
+	// upgrade 是升级请求，每个 response.create 沿用它的路径与请求头。
+	upgrade *http.Request
+
+	writeMu sync.Mutex
+
+	mu         sync.Mutex
+	cancel     context.CancelFunc
+	responseID string
+	done       chan struct{}
+	// closing 表示服务正在停机，连接即将关闭，不再接受新的 response.create。
+	closing bool
+}
+
+type responsesWSClientEvent struct {
+	Type       string          `json:"type"`
+	Response   json.RawMessage `json:"response,omitempty"`
+	ResponseID string          `json:"response_id,omitempty"`
+}
+
+type responsesWSErrorEvent struct {
+	Type  string                 `json:"type"`
+	Error responsesWSErrorDetail `json:"error"`
+}
+
+type responsesWSErrorDetail struct {
+	Type    string `json:"type"`
+	Code    string `json:"code,omitempty"`
+	Message string `json:"message"`
+	Status  int    `json:"status,omitempty"`
+}
+
+func newResponsesWSSession(cfg resolvedConfig, conn *websocket.Conn, upgrade *http.Request) *responsesWSSession {
+	conn.SetReadLimit(maxResponsesWSMessageBytes)
+	return &responsesWSSession{cfg: cfg, conn: conn, upgrade: upgrade}
+}
+
+func (s *responsesWSSession) serve(parent context.Context) {
+	ctx, cancel := context.WithCancel(parent)
+	defer func() {
+		cancel()
+		s.wait()
+		_ = s.conn.Close()
+	}()
+	go s.closeOnShutdown(ctx, drainFromContext(parent))
+
+	for {
+		messageType, data, err := s.conn.ReadMessage()
+		if err != nil {
+			if !s.isClosing() && !websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway, websocket.CloseNoStatusReceived) {
+				log.Printf("[gptb2o][responses][ws] read failed: %v", err)
+			}
+			return
+		}
+		if messageType != websocket.TextMessage {
+			s.writeError(http.StatusBadRequest, "invalid_message", "only text frames are supported")
+			continue
+		}
+
+		var event responsesWSClientEvent
+		if err := json.Unmarshal(data, &event); err != nil {
+			s.writeError(http.StatusBadRequest, "invalid_json", "invalid event payload")
+			continue
+		}
+		switch strings.TrimSpace(event.Type) {
+		case responsesWSCreate:
+			s.handleCreate(ctx, event, data)
+		case responsesWSCancel:
+			s.handleCancel(event.ResponseID)
+		default:
+			s.writeError(http.StatusBadRequest, "unknown_event", "unsupported event type: "+event.Type)
+		}
+	}
+}
+
+// closeOnShutdown 在停机开始（drain 关闭）或请求 context 被取消时关闭连接：先等进行中的 response 结束
+// （排空超时后它会随 ctx 收到 server shutting down 错误），再发送 going away 关闭帧并断开，
+// 使阻塞在 ReadMessage 的 serve 退出。serve 正常返回时 ctx 同样结束，此时关闭是幂等的。
+func (s *responsesWSSession) closeOnShutdown(ctx context.Context, drain <-chan struct{}) {
+	select {
+	case <-ctx.Done():
+	case <-drain:
+	}
+	s.mu.Lock()
+	s.closing = true
+	done := s.done
+	s.mu.Unlock()
+	if done != nil {
+		<-done
+	}
+
+	s.writeMu.Lock()
+	_ = s.conn.WriteControl(websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseGoingAway, ErrServerShuttingDown.Error()),
+		time.Now().Add(responsesWSCloseTimeout))
+	s.writeMu.Unlock()
+	_ = s.conn.Close()
+}
+
+func (s *responsesWSSession) isClosing() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closing
+}
+
+func (s *responsesWSSession) handleCreate(ctx context.Context, event responsesWSClientEvent, raw []byte) {
+	// 请求参数既可以放在 response 字段中，也可以与 type 平铺在同一层。
+	body := raw
+	if len(event.Response) > 0 && string(event.Response) != "null" {
+		body = event.Response
+	}
+	var req responsesRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		s.writeError(http.StatusBadRequest, "invalid_json", "invalid response.create payload")
+		return
+	}
+
+	s.mu.Lock()
+	if s.closing {
+		s.mu.Unlock()
+		s.writeError(http.StatusServiceUnavailable, responsesShutdownErrorCode, ErrServerShuttingDown.Error())
+		return
+	}
+	if s.done != nil {
+		s.mu.Unlock()
+		s.writeError(http.StatusBadRequest, "response_in_progress", "a response is already in progress on this connection")
+		return
+	}
+	respCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	s.cancel = cancel
+	s.responseID = ""
+	s.done = done
+	s.mu.Unlock()
+
+	go func() {
+		defer func() {
+			cancel()
+			s.release(done)
+			close(done)
+		}()
+		s.dispatch(respCtx, body, req, func() { s.release(done) })
+	}()
+}
+
+// dispatch 把一轮 response 交给与 POST /v1/responses 相同的包装链（并发限制、metrics、telemetry、trace）。
+// 包装层写入的是 responsesWSRecorder：推送给客户端的帧在其中以 SSE 形式镜像，便于按流式请求统计与记录。
+func (s *responsesWSSession) dispatch(ctx context.Context, body []byte, req responsesRequest, release func()) {
+	r, err := s.newCreateRequest(ctx, body)
+	if err != nil {
+		s.writeError(http.StatusBadRequest, "invalid_json", "invalid response.create payload")
+		return
+	}
+	rec := &responsesWSRecorder{header: make(http.Header)}
+	handled := false
+	var handler http.HandlerFunc = func(w http.ResponseWriter, r *http.Request) {
+		handled = true
+		s.runResponse(r.Context(), req, release, w)
+	}
+	handler = wrapWithTracer(s.cfg.Tracer, handler)
+	instrumentHandler(s.cfg, metrics.RouteResponses, handler)(rec, r)
+	if handled {
+		return
+	}
+	// handler 未执行说明请求在排队阶段被拒绝，或排队期间被取消。
+	switch {
+	case rec.status >= http.StatusBadRequest:
+		s.writeError(rec.status, "", rec.errorMessage())
+	case isServerShuttingDown(ctx):
+		s.writeError(http.StatusServiceUnavailable, responsesShutdownErrorCode, ErrServerShuttingDown.Error())
+	default:
+		s.writeCancelled()
+	}
+}
+
+// newCreateRequest 把 response.create 的参数转换为等价的 POST /v1/responses 流式请求。
+func (s *responsesWSSession) newCreateRequest(ctx context.Context, body []byte) (*http.Request, error) {
+	var payload map[string]json.RawMessage
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, err
+	}
+	delete(payload, "type")
+	payload["stream"] = json.RawMessage("true")
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	r, err := http.NewRequestWithContext(ctx, http.MethodPost, s.upgrade.URL.String(), bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	r.Header = s.upgrade.Header.Clone()
+	for _, name := range []string{"Upgrade", "Connection", "Sec-Websocket-Key", "Sec-Websocket-Version", "Sec-Websocket-Extensions", "Sec-Websocket-Protocol"} {
+		r.Header.Del(name)
+	}
+	r.Header.Set("Content-Type", "application/json")
+	r.Host = s.upgrade.Host
+	r.RemoteAddr = s.upgrade.RemoteAddr
+	return r, nil
+}
+
+// responsesWSRecorder 只在内存中记录状态码；错误响应体保留下来，供排队被拒时转成 error 帧。
+type responsesWSRecorder struct {
+	header    http.Header
+	status    int
+	errorBody bytes.Buffer
+}
+
+func (w *responsesWSRecorder) Header() http.Header { return w.header }
+
+func (w *responsesWSRecorder) WriteHeader(statusCode int) {
+	if w.status == 0 {
+		w.status = statusCode
+	}
+}
+
+func (w *responsesWSRecorder) Write(p []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	if w.status >= http.StatusBadRequest {
+		w.errorBody.Write(p)
+	}
+	return len(p), nil
+}
+
+func (w *responsesWSRecorder) Flush() {}
+
+func (w *responsesWSRecorder) errorMessage() string {
+	var errResp struct {
+		Error struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(w.errorBody.Bytes(), &errResp); err == nil && errResp.Error.Message != "" {
+		return errResp.Error.Message
+	}
+	return http.StatusText(w.status)
+}
+
+// release 释放连接上的 response 槽位；只处理自己那一轮，避免覆盖后续 response 的状态。
+func (s *responsesWSSession) release(done chan struct{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.done != done {
+		return
+	}
+	s.cancel = nil
+	s.responseID = ""
+	s.done = nil
+}
+
+func (s *responsesWSSession) handleCancel(responseID string) {
+	responseID = strings.TrimSpace(responseID)
+	s.mu.Lock()
+	cancel := s.cancel
+	current := s.responseID
+	s.mu.Unlock()
+
+	if cancel == nil {
+		s.writeError(http.StatusBadRequest, "no_active_response", "no response in progress")
+		return
+	}
+	if responseID != "" && current != "" && responseID != current {
+		s.writeError(http.StatusNotFound, "response_not_found", "response not found: "+responseID)
+		return
+	}
+	cancel()
+}
+
+// runResponse 把一次上游流转发到连接上，并把推送的事件以 SSE 形式镜像到 w。收到终止事件时先调用 release，
+// 使客户端收到 response.completed 后即可发起下一轮，而不必等上游连接关闭。
+func (s *responsesWSSession) runResponse(ctx context.Context, req responsesRequest, release func(), w http.ResponseWriter) {
+	reqCtx, cancel := backend.WithRequestTimeout(ctx, s.cfg.Timeouts.Total)
+	defer cancel()
+	resp, err := startResponsesRequest(reqCtx, s.cfg, req)
+	if err != nil {
+		if isServerShuttingDown(ctx) {
+			s.fail(w, false, http.StatusServiceUnavailable, responsesShutdownErrorCode, ErrServerShuttingDown.Error())
+			return
+		}
+		if ctx.Err() != nil {
+			s.writeCancelled()
+			return
+		}
+		var httpErr *httpErrorWithStatus
+		if errors.As(err, &httpErr) && httpErr != nil {
+			s.fail(w, false, httpErr.status, "", httpErr.Error())
+			return
+		}
+		if timeoutErr, ok := backend.AsStreamTimeout(reqCtx, err); ok {
+			s.fail(w, false, http.StatusGatewayTimeout, timeoutErr.Code(), timeoutErr.Error())
+			return
+		}
+		s.fail(w, false, http.StatusBadGateway, "", err.Error())
+		return
+	}
+	defer resp.Body.Close()
+
+	w.Header().Set("Content-Type", sseContentTypeValue)
+	finished := false
+	err = forEachOfficialEvent(reqCtx, resp.Body, func(eventType string, dataLines []string) error {
+		payload := strings.Join(dataLines, "\n")
+		switch eventType {
+		case "response.created":
+			s.rememberResponseID(payload)
+		case "response.completed", "response.failed", "response.incomplete":
+			finished = true
+			release()
+		}
+		_, _ = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", eventType, payload)
+		return s.writeMessage([]byte(payload))
+	})
+	if finished {
+		return
+	}
+	if isServerShuttingDown(ctx) {
+		s.fail(w, true, http.StatusServiceUnavailable, responsesShutdownErrorCode, ErrServerShuttingDown.Error())
+		return
+	}
+	if ctx.Err() != nil {
+		s.writeCancelled()
+		return
+	}
+	if timeoutErr, ok := backend.AsStreamTimeout(reqCtx, err); ok {
+		log.Printf("[gptb2o][responses][ws] %v", timeoutErr)
+		s.fail(w, true, http.StatusGatewayTimeout, timeoutErr.Code(), timeoutErr.Error())
+		return
+	}
+	if err != nil {
+		log.Printf("[gptb2o][responses][ws] stream failed: %v", err)
+		s.fail(w, true, http.StatusBadGateway, "", err.Error())
+	}
+}
+
+// fail 推送 error 帧，并按 HTTP 接口的形式镜像到 w：流开始前是 JSON 错误响应，之后是 SSE error 事件。
+func (s *responsesWSSession) fail(w http.ResponseWriter, streaming bool, status int, code string, message string) {
+	if streaming {
+		writeResponsesErrorEvent(w, code, message)
+	} else {
+		writeOpenAIError(w, status, message)
+	}
+	s.writeError(status, code, message)
+}
+
+func (s *responsesWSSession) rememberResponseID(payload string) {
+	var created struct {
+		Response struct {
+			ID string `json:"id"`
+		} `json:"response"`
+	}
+	if err := json.Unmarshal([]byte(payload), &created); err != nil {
+		return
+	}
+	s.mu.Lock()
+	s.responseID = strings.TrimSpace(created.Response.ID)
+	s.mu.Unlock()
+}
+
+func (s *responsesWSSession) wait() {
+	s.mu.Lock()
+	done := s.done
+	s.mu.Unlock()
+	if done != nil {
+		<-done
+	}
+}
+
+func (s *responsesWSSession) writeCancelled() {
+	s.mu.Lock()
+	responseID := s.responseID
+	s.mu.Unlock()
+
+	event := map[string]any{"type": responsesWSCancelled}
+	if responseID != "" {
+		event["response"] = map[string]any{"id": responseID, "status": "cancelled"}
+	}
+	s.writeJSON(event)
+}
+
+func (s *responsesWSSession) writeError(status int, code string, message string) {
+	s.writeJSON(responsesWSErrorEvent{
+		Type: "error",
+		Error: responsesWSErrorDetail{
+			Type:    openAIErrorTypeForStatus(status),
+			Code:    code,
+			Message: message,
+			Status:  status,
+		},
+	})
+}
+
+func (s *responsesWSSession) writeJSON(v any) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	_ = s.writeMessage(data)
+}
+
+// writeMessage 串行化写入：读循环与 response goroutine 都会发送帧。
+func (s *responsesWSSession) writeMessage(data []byte) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	return s.conn.WriteMessage(websocket.TextMessage, data)
+}
@@ -0,0 +1,240 @@
+package openaihttp_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/LubyRuffy/gptb2o"
+	"github.com/LubyRuffy/gptb2o/metrics"
+	"github.com/LubyRuffy/gptb2o/openaihttp"
+	"github.com/LubyRuffy/gptb2o/trace"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+)
+
+func dialResponsesWebSocket(t *testing.T, backendHandler http.HandlerFunc) *websocket.Conn {
+	t.Helper()
+	return dialWS(t, newResponsesWSServer(t, openaihttp.Config{}, backendHandler))
+}
+
+// newResponsesWSServer 启动 WebSocket 服务并返回 ws:// 地址；同一服务上的连接共用并发限制等状态。
+func newResponsesWSServer(t *testing.T, cfg openaihttp.Config, backendHandler http.HandlerFunc) string {
+	t.Helper()
+	backend := httptest.NewServer(backendHandler)
+	t.Cleanup(backend.Close)
+
+	cfg.BackendURL = backend.URL
+	cfg.HTTPClient = backend.Client()
+	cfg.AuthProvider = func(ctx context.Context) (string, string, error) { return "token", "acc", nil }
+	handler, err := openaihttp.ResponsesWebSocketHandler(cfg)
+	require.NoError(t, err)
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	return "ws" + strings.TrimPrefix(server.URL, "http") + "/v1/responses"
+}
+
+func dialWS(t *testing.T, wsURL string) *websocket.Conn {
+	t.Helper()
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+	return conn
+}
+
+func readWSEvent(t *testing.T, conn *websocket.Conn) map[string]any {
+	t.Helper()
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	var event map[string]any
+	require.NoError(t, conn.ReadJSON(&event))
+	return event
+}
+
+func TestResponsesWebSocket_StreamsEventsOnOneConnection(t *testing.T) {
+	conn := dialResponsesWebSocket(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: {\"type\":\"response.created\",\"response\":{\"id\":\"resp_1\"}}\n\n")
+		fmt.Fprint(w, "data: {\"type\":\"response.output_text.delta\",\"delta\":\"hello\"}\n\n")
+		fmt.Fprint(w, "data: {\"type\":\"response.completed\",\"response\":{\"id\":\"resp_1\",\"object\":\"response\"}}\n\n")
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	})
+
+	model := gptb2o.ModelNamespace + "gpt-5.4"
+	for i := 0; i < 2; i++ {
+		if i == 0 {
+			require.NoError(t, conn.WriteJSON(map[string]any{"type": "response.create", "model": model, "input": "hi"}))
+		} else {
+			require.NoError(t, conn.WriteJSON(map[string]any{"type": "response.create", "response": map[string]any{"model": model, "input": "again"}}))
+		}
+		require.Equal(t, "response.created", readWSEvent(t, conn)["type"])
+		delta := readWSEvent(t, conn)
+		require.Equal(t, "response.output_text.delta", delta["type"])
+		require.Equal(t, "hello", delta["delta"])
+		require.Equal(t, "response.completed", readWSEvent(t, conn)["type"])
+	}
+}
+
+func TestResponsesWebSocket_CancelInFlightResponse(t *testing.T) {
+	conn := dialResponsesWebSocket(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: {\"type\":\"response.created\",\"response\":{\"id\":\"resp_slow\"}}\n\n")
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	})
+
+	require.NoError(t, conn.WriteJSON(map[string]any{"type": "response.create", "model": gptb2o.ModelNamespace + "gpt-5.4", "input": "hi"}))
+	require.Equal(t, "response.created", readWSEvent(t, conn)["type"])
+
+	require.NoError(t, conn.WriteJSON(map[string]any{"type": "response.cancel", "response_id": "resp_other"}))
+	mismatch := readWSEvent(t, conn)
+	require.Equal(t, "error", mismatch["type"])
+	require.Equal(t, "response_not_found", mismatch["error"].(map[string]any)["code"])
+
+	require.NoError(t, conn.WriteJSON(map[string]any{"type": "response.cancel", "response_id": "resp_slow"}))
+	cancelled := readWSEvent(t, conn)
+	require.Equal(t, "response.cancelled", cancelled["type"])
+	require.Equal(t, "resp_slow", cancelled["response"].(map[string]any)["id"])
+
+	// 取消后连接仍可继续使用。
+	require.NoError(t, conn.WriteJSON(map[string]any{"type": "response.cancel"}))
+	require.Equal(t, "no_active_response", readWSEvent(t, conn)["error"].(map[string]any)["code"])
+}
+
+func TestResponsesWebSocket_InvalidRequestReturnsErrorEvent(t *testing.T) {
+	conn := dialResponsesWebSocket(t, func(w http.ResponseWriter, r *http.Request) {
+		t.Error("backend should not be called")
+	})
+
+	require.NoError(t, conn.WriteJSON(map[string]any{"type": "response.create", "model": "unknown-model", "input": "hi"}))
+	event := readWSEvent(t, conn)
+	require.Equal(t, "error", event["type"])
+	detail := event["error"].(map[string]any)
+	require.Equal(t, "invalid_request_error", detail["type"])
+	require.Equal(t, "unsupported model", detail["message"])
+
+	require.NoError(t, conn.WriteJSON(map[string]any{"type": "session.update"}))
+	require.Equal(t, "unknown_event", readWSEvent(t, conn)["error"].(map[string]any)["code"])
+}
+
+func TestResponsesWebSocket_RejectsCrossSiteOrigin(t *testing.T) {
+	newServer := func(allowed ...string) string {
+		handler, err := openaihttp.ResponsesWebSocketHandler(openaihttp.Config{
+			AuthProvider:            func(ctx context.Context) (string, string, error) { return "token", "acc", nil },
+			WebSocketAllowedOrigins: allowed,
+		})
+		require.NoError(t, err)
+		server := httptest.NewServer(handler)
+		t.Cleanup(server.Close)
+		return server.URL
+	}
+	dial := func(serverURL, origin string) (int, error) {
+		header := http.Header{}
+		if origin != "" {
+			header.Set("Origin", origin)
+		}
+		conn, resp, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(serverURL, "http")+"/v1/responses", header)
+		if conn != nil {
+			_ = conn.Close()
+		}
+		if resp == nil {
+			return 0, err
+		}
+		return resp.StatusCode, err
+	}
+
+	serverURL := newServer()
+	// 浏览器中的第三方网页不能借用代理的 ChatGPT 凭据。
+	status, err := dial(serverURL, "https://evil.example")
+	require.Error(t, err)
+	require.Equal(t, http.StatusForbidden, status)
+	// 同源页面与不带 Origin 的 SDK / CLI 不受影响。
+	_, err = dial(serverURL, serverURL)
+	require.NoError(t, err)
+	_, err = dial(serverURL, "")
+	require.NoError(t, err)
+
+	serverURL = newServer("https://app.example/")
+	_, err = dial(serverURL, "https://app.example")
+	require.NoError(t, err)
+	_, err = dial(serverURL, "https://other.example")
+	require.Error(t, err)
+}
+
+func TestResponsesWebSocket_AdmissionLimitsEachResponse(t *testing.T) {
+	wsURL := newResponsesWSServer(t, openaihttp.Config{MaxConcurrentRequests: 1}, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: {\"type\":\"response.created\",\"response\":{\"id\":\"resp_busy\"}}\n\n")
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	})
+	model := gptb2o.ModelNamespace + "gpt-5.4"
+
+	busy := dialWS(t, wsURL)
+	require.NoError(t, busy.WriteJSON(map[string]any{"type": "response.create", "model": model, "input": "hi"}))
+	require.Equal(t, "response.created", readWSEvent(t, busy)["type"])
+
+	// 名额被另一条连接上的 response 占用，且不允许排队。
+	other := dialWS(t, wsURL)
+	require.NoError(t, other.WriteJSON(map[string]any{"type": "response.create", "model": model, "input": "hi"}))
+	event := readWSEvent(t, other)
+	require.Equal(t, "error", event["type"])
+	detail := event["error"].(map[string]any)
+	require.Equal(t, "service_unavailable_error", detail["type"])
+	require.EqualValues(t, http.StatusServiceUnavailable, detail["status"])
+	require.Contains(t, detail["message"], "admission queue is full")
+}
+
+func TestResponsesWebSocket_RecordsMetricsAndTracePerResponse(t *testing.T) {
+	sink := trace.NewMemorySink(10)
+	m := metrics.New()
+	wsURL := newResponsesWSServer(t, openaihttp.Config{
+		Tracer:  trace.NewTracer(sink, trace.TracerOptions{}),
+		Metrics: m,
+	}, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: {\"type\":\"response.created\",\"response\":{\"id\":\"resp_1\"}}\n\n")
+		fmt.Fprint(w, "data: {\"type\":\"response.output_text.delta\",\"delta\":\"hello\"}\n\n")
+		fmt.Fprint(w, "data: {\"type\":\"response.completed\",\"response\":{\"id\":\"resp_1\",\"object\":\"response\"}}\n\n")
+	})
+
+	conn := dialWS(t, wsURL)
+	require.NoError(t, conn.WriteJSON(map[string]any{"type": "response.create", "model": gptb2o.ModelNamespace + "gpt-5.4", "input": "hi"}))
+	require.Equal(t, "response.created", readWSEvent(t, conn)["type"])
+	require.Equal(t, "response.output_text.delta", readWSEvent(t, conn)["type"])
+	require.Equal(t, "response.completed", readWSEvent(t, conn)["type"])
+
+	var items []trace.Interaction
+	require.Eventually(t, func() bool {
+		var err error
+		items, err = sink.ListInteractions(trace.InteractionFilter{})
+		return err == nil && len(items) == 1 && items[0].StatusCode != 0
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, http.MethodPost, items[0].Method)
+	require.Equal(t, "/v1/responses", items[0].Path)
+	require.Equal(t, http.StatusOK, items[0].StatusCode)
+
+	_, events, err := sink.GetInteraction(items[0].InteractionID)
+	require.NoError(t, err)
+	var kinds []trace.EventKind
+	for _, event := range events {
+		kinds = append(kinds, event.Kind)
+	}
+	require.Contains(t, kinds, trace.EventBackendRequest)
+	require.Contains(t, kinds, trace.EventClientResponse)
+
+	scrape := func() string {
+		w := httptest.NewRecorder()
+		m.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		return w.Body.String()
+	}
+	require.Eventually(t, func() bool {
+		return strings.Contains(scrape(), `gptb2o_requests_total{route="responses",model="gpt-5.4",client_api="openai",status="200"} 1`)
+	}, 5*time.Second, 10*time.Millisecond)
+	out := scrape()
+	require.Contains(t, out, `gptb2o_time_to_first_token_seconds_count{route="responses",model="gpt-5.4",client_api="openai"} 1`)
+	require.Contains(t, out, `gptb2o_active_streams{route="responses",model="gpt-5.4",client_api="openai"} 0`)
+}
@@ -0,0 +1,146 @@
+package openaihttp
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/LubyRuffy/gptb2o"
+)
+
+// route 描述一条 HTTP 路由。pattern 相对于 BasePath，路径参数写作 {name}，
+// handler 通过 r.PathValue(name) 读取，net/http 与 gin 共用同一张路由表。
+type route struct {
+	method  string
+	pattern string
+	handler http.HandlerFunc
+}
+
+var routePathParamPattern = regexp.MustCompile(`\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// NewHandler 返回注册了全部 OpenAI/Claude 兼容路由以及 /healthz、/readyz、/debug/info 的 http.Handler，
+// 基于 Go 1.22 http.ServeMux（方法 + 路径参数匹配），可直接挂到 net/http、chi 等路由上。
+func NewHandler(cfg Config) (http.Handler, error) {
+	cfg, err := shareRouteState(cfg)
+	if err != nil {
+		return nil, err
+	}
+	routes, err := buildRoutes(cfg)
+	if err != nil {
+		return nil, err
+	}
+	diagnosticsRoutes, err := buildDiagnosticsRoutes(cfg)
+	if err != nil {
+		return nil, err
+	}
+	basePath := normalizeBasePath(cfg.BasePath)
+	mux := http.NewServeMux()
+	for _, rt := range routes {
+		mux.HandleFunc(rt.method+" "+joinPath(basePath, rt.pattern), rt.handler)
+	}
+	for _, rt := range diagnosticsRoutes {
+		mux.HandleFunc(rt.method+" "+rt.pattern, rt.handler)
+	}
+	return mux, nil
+}
+
+func buildRoutes(cfg Config) ([]route, error) {
+	modelsHandler, chatHandler, responsesHandler, err := Handlers(cfg)
+	if err != nil {
+		return nil, err
+	}
+	responsesWSHandler, err := ResponsesWebSocketHandler(cfg)
+	if err != nil {
+		return nil, err
+	}
+	claudeHandler, err := ClaudeMessagesHandler(cfg)
+	if err != nil {
+		return nil, err
+	}
+	claudeCountTokensHandler, err := ClaudeCountTokensHandler(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	claudeModelsHandler := claudeModelsListHandler(cfg.Settings.models)
+	routes := []route{
+		{http.MethodGet, "/models", func(w http.ResponseWriter, r *http.Request) {
+			if isClaudeAPIRequest(r) {
+				claudeModelsHandler(w, r)
+				return
+			}
+			modelsHandler(w, r)
+		}},
+		{http.MethodGet, "/models/{model_id}", claudeModelDetailHandler(cfg.Settings.models)},
+		{http.MethodPost, "/chat/completions", chatHandler},
+		{http.MethodPost, "/responses", responsesHandler},
+		{http.MethodGet, "/responses", responsesWSHandler},
+		{http.MethodPost, "/messages", claudeHandler},
+		{http.MethodPost, "/messages/count_tokens", claudeCountTokensHandler},
+	}
+
+	if cfg.Batches != nil {
+		batches, err := ClaudeMessageBatchesHandlers(cfg)
+		if err != nil {
+			return nil, err
+		}
+		openaiBatches, err := OpenAIBatchesHandlers(cfg)
+		if err != nil {
+			return nil, err
+		}
+		routes = append(routes,
+			route{http.MethodPost, "/messages/batches", batches.Create},
+			route{http.MethodGet, "/messages/batches", batches.List},
+			route{http.MethodGet, "/messages/batches/{batch_id}", batches.Get},
+			route{http.MethodGet, "/messages/batches/{batch_id}/results", batches.Results},
+			route{http.MethodPost, "/messages/batches/{batch_id}/cancel", batches.Cancel},
+			route{http.MethodPost, "/files", openaiBatches.UploadFile},
+			route{http.MethodGet, "/files", openaiBatches.ListFiles},
+			route{http.MethodGet, "/files/{file_id}", openaiBatches.GetFile},
+			route{http.MethodGet, "/files/{file_id}/content", openaiBatches.FileContent},
+			route{http.MethodDelete, "/files/{file_id}", openaiBatches.DeleteFile},
+			route{http.MethodPost, "/batches", openaiBatches.CreateBatch},
+			route{http.MethodGet, "/batches", openaiBatches.ListBatches},
+			route{http.MethodGet, "/batches/{batch_id}", openaiBatches.GetBatch},
+			route{http.MethodPost, "/batches/{batch_id}/cancel", openaiBatches.CancelBatch},
+		)
+	}
+	for i := range routes {
+		routes[i].handler = requireAPIKey(cfg.Settings, routes[i].handler)
+	}
+	return routes, nil
+}
+
+// claudeModelDetailHandler 只服务 Claude 客户端；OpenAI 没有该端点，
+// 非 Claude 请求保持与未注册路由一致的 404 文本，避免影响 OpenAI 客户端。
+func claudeModelDetailHandler(models func() *gptb2o.ModelRegistry) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !isClaudeAPIRequest(r) {
+			http.NotFound(w, r)
+			return
+		}
+
+		modelID := strings.TrimSpace(r.PathValue("model_id"))
+		if modelID == "" {
+			writeClaudeError(w, http.StatusBadRequest, "model_id is required")
+			return
+		}
+		// 复用与 /v1/messages 同一套模型目录解析，避免 models 与 messages 不一致。
+		registry := models()
+		if _, ok := registry.Resolve(modelID); !ok {
+			writeClaudeError(w, http.StatusNotFound, "model not found")
+			return
+		}
+		writeJSON(w, claudeModelInfoForID(registry, modelID))
+	}
+}
+
+// routePathParams 返回 pattern 中的路径参数名，按出现顺序排列。
+func routePathParams(pattern string) []string {
+	matches := routePathParamPattern.FindAllStringSubmatch(pattern, -1)
+	names := make([]string, 0, len(matches))
+	for _, m := range matches {
+		names = append(names, m[1])
+	}
+	return names
+}
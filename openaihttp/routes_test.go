@@ -0,0 +1,89 @@
+package openaihttp_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/LubyRuffy/gptb2o/batch"
+	"github.com/LubyRuffy/gptb2o/openaihttp"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewHandler_ServeMuxRoutes(t *testing.T) {
+	store, err := batch.OpenStore(filepath.Join(t.TempDir(), "batch.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = store.Close() })
+
+	h, err := openaihttp.NewHandler(openaihttp.Config{
+		BasePath:     "/api/v1",
+		Batches:      store,
+		AuthProvider: func(ctx context.Context) (string, string, error) { return "token", "", nil },
+	})
+	require.NoError(t, err)
+
+	// OpenAI 与 Claude 客户端共用 /models，按请求头区分返回格式。
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/models", nil)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	var openaiList struct {
+		Object string `json:"object"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &openaiList))
+	require.Equal(t, "list", openaiList.Object)
+
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/models/sonnet", nil)
+	req.Header.Set("anthropic-version", "2023-06-01")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	var model struct {
+		Type string `json:"type"`
+		ID   string `json:"id"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &model))
+	require.Equal(t, "model", model.Type)
+	require.Equal(t, "sonnet", model.ID)
+
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/models/sonnet", nil)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	require.Equal(t, http.StatusNotFound, w.Code)
+	require.Contains(t, w.Body.String(), "404 page not found")
+
+	// 路径参数经由 r.PathValue 传给 batch handler。
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	require.NoError(t, mw.WriteField("purpose", "batch"))
+	part, err := mw.CreateFormFile("file", "input.jsonl")
+	require.NoError(t, err)
+	_, err = part.Write([]byte("{}\n"))
+	require.NoError(t, err)
+	require.NoError(t, mw.Close())
+	req = httptest.NewRequest(http.MethodPost, "/api/v1/files", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var uploaded struct {
+		ID string `json:"id"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &uploaded))
+
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/files/"+uploaded.ID+"/content", nil)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "{}\n", w.Body.String())
+
+	req = httptest.NewRequest(http.MethodGet, "/v1/models", nil)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	require.Equal(t, http.StatusNotFound, w.Code)
+}
@@ -0,0 +1,206 @@
+package openaihttp
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+
+	"github.com/LubyRuffy/gptb2o"
+)
+
+// APIKey 是允许访问 gptb2o 的客户端密钥。Name 用于日志与公平调度，不会回显 Key。
+type APIKey struct {
+	Name string
+	Key  string
+}
+
+// Settings 是可在运行中热更新的配置子集：入站 API key、模型目录与默认 reasoning effort。
+// 变更通过 SettingsStore.Store 整体替换，进行中的请求继续使用开始时读到的值。
+type Settings struct {
+	// APIKeys 非空时，API 路由、/debug/info 以及经 SettingsStore.RequireAPIKey 包装的端点要求客户端通过 Authorization: Bearer 或 x-api-key 提供其中之一。
+	APIKeys []APIKey
+	// Models 可选，替换 gptb2o.DefaultModelRegistry() 作为 /v1/models 输出、模型校验、别名解析与按模型默认 effort 的来源。
+	Models *gptb2o.ModelRegistry
+	// ReasoningEffort 非空时覆盖 Config.ReasoningEffort，作为请求未指定 effort 时的默认值；模型自身的默认 effort 优先。
+	ReasoningEffort string
+}
+
+// SettingsStore 保存当前生效的 Settings，读写均为原子操作，可在请求处理中并发读取。
+type SettingsStore struct {
+	current atomic.Pointer[Settings]
+	// parent 非 nil 时本 store 是 handler 内部视图：读写委托给 parent，只额外叠加 backend 模型发现。
+	parent    *SettingsStore
+	discovery *modelDiscovery
+}
+
+// NewSettingsStore 创建以 s 为初始值的 SettingsStore。
+func NewSettingsStore(s Settings) *SettingsStore {
+	store := &SettingsStore{}
+	store.Store(s)
+	return store
+}
+
+// Load 返回当前 Settings；store 为 nil 时返回零值。
+func (s *SettingsStore) Load() Settings {
+	if s == nil {
+		return Settings{}
+	}
+	if s.parent != nil {
+		return s.parent.Load()
+	}
+	if current := s.current.Load(); current != nil {
+		return *current
+	}
+	return Settings{}
+}
+
+// Store 替换当前 Settings。
+func (s *SettingsStore) Store(settings Settings) {
+	if s == nil {
+		return
+	}
+	if s.parent != nil {
+		s.parent.Store(settings)
+		return
+	}
+	normalized := Settings{
+		APIKeys:         append([]APIKey(nil), settings.APIKeys...),
+		Models:          settings.Models,
+		ReasoningEffort: normalizeReasoningEffort(settings.ReasoningEffort),
+	}
+	s.current.Store(&normalized)
+}
+
+// withDiscovery 返回共享 s 的视图，其模型目录叠加 backend 发现的模型；s 可以为 nil。
+func (s *SettingsStore) withDiscovery(d *modelDiscovery) *SettingsStore {
+	if s == nil {
+		s = NewSettingsStore(Settings{})
+	}
+	return &SettingsStore{parent: s, discovery: d}
+}
+
+// models 返回当前生效的模型目录；未配置时使用内置 registry，启用模型发现时合并 backend 模型列表。
+func (s *SettingsStore) models() *gptb2o.ModelRegistry {
+	models := s.Load().Models
+	if models == nil {
+		models = gptb2o.DefaultModelRegistry()
+	}
+	if s != nil && s.discovery != nil {
+		return s.discovery.registry(models)
+	}
+	return models
+}
+
+// resolveModel 按当前模型目录解析别名与模型 ID，不支持的模型返回 400。
+func (s *SettingsStore) resolveModel(model string) (gptb2o.ModelInfo, error) {
+	info, ok := s.models().Resolve(model)
+	if !ok {
+		return gptb2o.ModelInfo{}, &httpError{Status: http.StatusBadRequest, Message: "unsupported model"}
+	}
+	return info, nil
+}
+
+// defaultReasoningEffort 按 模型默认值 -> Settings 默认值 -> fallback -> backend 发现的模型默认值
+// 的顺序返回默认 effort，并按模型能力降级 xhigh。
+func (s *SettingsStore) defaultReasoningEffort(modelID string, fallback string) string {
+	info, _ := s.models().Lookup(modelID)
+	effort := info.ReasoningEffort
+	if effort == "" {
+		effort = s.Load().ReasoningEffort
+	}
+	if effort == "" {
+		effort = fallback
+	}
+	if effort == "" && info.ID != "" && s != nil && s.discovery != nil {
+		effort = s.discovery.defaultEffort(info.ID)
+	}
+	return effortForModel(info, effort)
+}
+
+// effortForModel 在模型声明不支持 xhigh 时把 xhigh 降为 high；未知模型原样返回。
+func effortForModel(info gptb2o.ModelInfo, effort string) string {
+	if info.ID != "" && !info.Capabilities.XHigh && strings.EqualFold(strings.TrimSpace(effort), "xhigh") {
+		return "high"
+	}
+	return effort
+}
+
+// toolsUnsupportedError 在模型声明不支持工具而请求携带 tools 时返回 400。
+func toolsUnsupportedError(info gptb2o.ModelInfo, toolCount int) error {
+	if toolCount == 0 || info.Capabilities.Tools {
+		return nil
+	}
+	return &httpError{Status: http.StatusBadRequest, Message: fmt.Sprintf("model %s does not support tools", info.ID)}
+}
+
+type apiKeyNameContextKey struct{}
+
+// apiKeyNameFromContext 返回通过校验的 API key 名称；未启用 API key 时为空。
+func apiKeyNameFromContext(ctx context.Context) string {
+	name, _ := ctx.Value(apiKeyNameContextKey{}).(string)
+	return name
+}
+
+// RequireAPIKey 用与 API 路由相同的 API key 校验包装 h，供调用方自行挂载的
+// /metrics、/debug/traces 等调试端点使用；未配置 API key（或 s 为 nil）时不做校验。
+func (s *SettingsStore) RequireAPIKey(h http.Handler) http.Handler {
+	if s == nil || h == nil {
+		return h
+	}
+	return requireAPIKey(s, h.ServeHTTP)
+}
+
+// requireAPIKey 在 Settings.APIKeys 非空时校验请求携带的密钥，失败按 Claude / OpenAI 各自的错误格式返回 401。
+// 每次请求读取最新 Settings，热更新后立即生效。
+func requireAPIKey(settings *SettingsStore, handler http.HandlerFunc) http.HandlerFunc {
+	if settings == nil || handler == nil {
+		return handler
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		keys := settings.Load().APIKeys
+		if len(keys) == 0 {
+			handler(w, r)
+			return
+		}
+		name, ok := matchAPIKey(keys, requestAPIKey(r))
+		if !ok {
+			if isClaudeAPIRequest(r) {
+				writeClaudeTypedError(w, http.StatusUnauthorized, "invalid x-api-key")
+			} else {
+				writeOpenAIError(w, http.StatusUnauthorized, "invalid api key")
+			}
+			return
+		}
+		handler(w, r.WithContext(context.WithValue(r.Context(), apiKeyNameContextKey{}, name)))
+	}
+}
+
+func requestAPIKey(r *http.Request) string {
+	if key := strings.TrimSpace(r.Header.Get("x-api-key")); key != "" {
+		return key
+	}
+	auth := strings.TrimSpace(r.Header.Get("Authorization"))
+	if len(auth) > len("bearer ") && strings.EqualFold(auth[:len("bearer ")], "bearer ") {
+		return strings.TrimSpace(auth[len("bearer "):])
+	}
+	return ""
+}
+
+// matchAPIKey 用常量时间比较遍历全部密钥，避免按匹配位置泄露耗时差异。
+func matchAPIKey(keys []APIKey, presented string) (string, bool) {
+	if presented == "" {
+		return "", false
+	}
+	matched := ""
+	found := false
+	for _, key := range keys {
+		if key.Key != "" && subtle.ConstantTimeCompare([]byte(key.Key), []byte(presented)) == 1 && !found {
+			matched = key.Name
+			found = true
+		}
+	}
+	return matched, found
+}
@@ -0,0 +1,199 @@
+package openaihttp_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/LubyRuffy/gptb2o"
+	"github.com/LubyRuffy/gptb2o/openaihttp"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSettings_APIKeysAndHotSwap(t *testing.T) {
+	settings := openaihttp.NewSettingsStore(openaihttp.Settings{
+		APIKeys: []openaihttp.APIKey{{Name: "alice", Key: "sk-alice"}},
+	})
+	h, err := openaihttp.NewHandler(openaihttp.Config{
+		Settings:     settings,
+		AuthProvider: func(ctx context.Context) (string, string, error) { return "token", "", nil },
+	})
+	require.NoError(t, err)
+
+	get := func(path string, header map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w
+	}
+
+	w := get("/v1/models", nil)
+	require.Equal(t, http.StatusUnauthorized, w.Code)
+	require.Contains(t, w.Body.String(), `"error"`)
+
+	// Claude 客户端使用 x-api-key，错误体为 Claude 格式。
+	w = get("/v1/models", map[string]string{"x-api-key": "wrong", "anthropic-version": "2023-06-01"})
+	require.Equal(t, http.StatusUnauthorized, w.Code)
+	require.Contains(t, w.Body.String(), `"type":"authentication_error"`)
+
+	require.Equal(t, http.StatusOK, get("/v1/models", map[string]string{"Authorization": "Bearer sk-alice"}).Code)
+	require.Equal(t, http.StatusOK, get(openaihttp.HealthzPath, nil).Code)
+	require.Equal(t, http.StatusUnauthorized, get(openaihttp.DebugInfoPath, nil).Code)
+
+	// 热更新后旧 key 立即失效，新 key 生效；清空 key 列表则关闭校验。
+	settings.Store(openaihttp.Settings{APIKeys: []openaihttp.APIKey{{Name: "bob", Key: "sk-bob"}}})
+	require.Equal(t, http.StatusUnauthorized, get("/v1/models", map[string]string{"Authorization": "Bearer sk-alice"}).Code)
+	require.Equal(t, http.StatusOK, get("/v1/models", map[string]string{"Authorization": "bearer sk-bob"}).Code)
+	settings.Store(openaihttp.Settings{})
+	require.Equal(t, http.StatusOK, get("/v1/models", nil).Code)
+}
+
+func TestSettingsStore_RequireAPIKey(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { _, _ = w.Write([]byte("ok")) })
+	serve := func(h http.Handler, header string) int {
+		req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		if header != "" {
+			req.Header.Set("Authorization", header)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// 未使用 Settings 时不做校验。
+	var nilStore *openaihttp.SettingsStore
+	require.Equal(t, http.StatusOK, serve(nilStore.RequireAPIKey(ok), ""))
+
+	settings := openaihttp.NewSettingsStore(openaihttp.Settings{})
+	h := settings.RequireAPIKey(ok)
+	require.Equal(t, http.StatusOK, serve(h, ""))
+
+	settings.Store(openaihttp.Settings{APIKeys: []openaihttp.APIKey{{Name: "ops", Key: "sk-ops"}}})
+	require.Equal(t, http.StatusUnauthorized, serve(h, ""))
+	require.Equal(t, http.StatusOK, serve(h, "Bearer sk-ops"))
+}
+
+func TestSettings_ModelRegistry(t *testing.T) {
+	type backendCall struct {
+		Model  string
+		Effort string
+	}
+	var (
+		mu    sync.Mutex
+		calls []backendCall
+	)
+	backendSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload struct {
+			Model     string `json:"model"`
+			Reasoning struct {
+				Effort string `json:"effort"`
+			} `json:"reasoning"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&payload))
+		mu.Lock()
+		calls = append(calls, backendCall{Model: payload.Model, Effort: payload.Reasoning.Effort})
+		mu.Unlock()
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: {\"type\":\"response.output_text.delta\",\"delta\":\"ok\"}\n\n")
+		fmt.Fprint(w, "data: {\"type\":\"response.completed\",\"response\":{\"id\":\"resp_1\",\"object\":\"response\"}}\n\n")
+	}))
+	t.Cleanup(backendSrv.Close)
+
+	builtin := gptb2o.BuiltinModels()
+	builtin[1].ReasoningEffort = "high" // gpt-5.4
+	models := append([]gptb2o.ModelInfo{{
+		ID:            "gpt-6-preview",
+		Name:          "GPT-6 Preview",
+		ContextWindow: 1000000,
+		Capabilities:  gptb2o.ModelCapabilities{Vision: true},
+	}}, builtin...)
+	registry, err := gptb2o.NewModelRegistry(models, append([]gptb2o.ModelAlias{
+		{Pattern: "Fast", Target: "gpt-5.4-mini"},
+		{Pattern: "claude-sonnet-*", Target: "gpt-5.4"},
+	}, gptb2o.BuiltinModelAliases()...))
+	require.NoError(t, err)
+
+	settings := openaihttp.NewSettingsStore(openaihttp.Settings{Models: registry, ReasoningEffort: "low"})
+	h, err := openaihttp.NewHandler(openaihttp.Config{
+		BackendURL:      backendSrv.URL,
+		ReasoningEffort: "medium",
+		Settings:        settings,
+		AuthProvider:    func(ctx context.Context) (string, string, error) { return "token", "", nil },
+	})
+	require.NoError(t, err)
+
+	serve := func(method, path, body string, header map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w
+	}
+	post := func(path, body string) {
+		t.Helper()
+		w := serve(http.MethodPost, path, body, nil)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	}
+
+	// /v1/models 与 Claude 模型列表都来自 registry，第一项为默认模型。
+	w := serve(http.MethodGet, "/v1/models", "", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var list struct {
+		Data []struct {
+			ID            string `json:"id"`
+			DisplayName   string `json:"display_name"`
+			ContextWindow int    `json:"context_window"`
+			Capabilities  struct {
+				Tools bool `json:"tools"`
+				XHigh bool `json:"xhigh"`
+			} `json:"capabilities"`
+		} `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	require.Equal(t, gptb2o.ModelNamespace+"gpt-6-preview", list.Data[0].ID)
+	require.Equal(t, "GPT-6 Preview", list.Data[0].DisplayName)
+	require.Equal(t, 1000000, list.Data[0].ContextWindow)
+	require.False(t, list.Data[0].Capabilities.Tools)
+	require.True(t, list.Data[1].Capabilities.XHigh)
+	w = serve(http.MethodGet, "/v1/models", "", map[string]string{"anthropic-version": "2023-06-01"})
+	require.Contains(t, w.Body.String(), `{"type":"model","id":"fast","display_name":"Fast"`)
+	require.Contains(t, w.Body.String(), `"id":"chatgpt/codex/gpt-6-preview","display_name":"GPT-6 Preview"`)
+
+	post("/v1/chat/completions", `{"model":"fast","messages":[{"role":"user","content":"hi"}]}`)
+	post("/v1/responses", `{"model":"chatgpt/codex/gpt-5.4","input":"hi"}`)
+	post("/v1/messages", `{"model":"claude-sonnet-4-5","max_tokens":16,"messages":[{"role":"user","content":"hi"}]}`)
+	post("/v1/messages", `{"model":"gpt-6-preview","max_tokens":16,"output_config":{"effort":"xhigh"},"messages":[{"role":"user","content":"hi"}]}`)
+
+	// 模型声明不支持 tools 时直接拒绝，不请求 backend。
+	w = serve(http.MethodPost, "/v1/chat/completions", `{"model":"gpt-6-preview","messages":[{"role":"user","content":"hi"}],"tools":[{"type":"function","function":{"name":"f","parameters":{"type":"object"}}}]}`, nil)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	require.Contains(t, w.Body.String(), "model gpt-6-preview does not support tools")
+	w = serve(http.MethodPost, "/v1/chat/completions", `{"model":"gpt-9","messages":[{"role":"user","content":"hi"}]}`, nil)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+
+	// 热更新 registry 后立即生效；未配置 Models 时回退到内置目录。
+	settings.Store(openaihttp.Settings{})
+	post("/v1/chat/completions", `{"model":"claude-sonnet-4-5","messages":[{"role":"user","content":"hi"}]}`)
+	w = serve(http.MethodPost, "/v1/chat/completions", `{"model":"fast","messages":[{"role":"user","content":"hi"}]}`, nil)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Equal(t, []backendCall{
+		{Model: "gpt-5.4-mini", Effort: "low"},
+		{Model: "gpt-5.4", Effort: "high"},
+		{Model: "gpt-5.4", Effort: "high"},
+		{Model: "gpt-6-preview", Effort: "high"},
+		{Model: "gpt-5.5", Effort: "medium"},
+	}, calls)
+}
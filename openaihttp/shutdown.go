@@ -0,0 +1,74 @@
+package openaihttp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/LubyRuffy/gptb2o/openaiapi"
+)
+
+// ErrServerShuttingDown 是服务停机时取消请求 context 使用的 cause。宿主在排空期限到达后调用
+// context.WithCancelCause 返回的 cancel(ErrServerShuttingDown)（通常经 http.Server.BaseContext 传给所有请求），
+// 进行中的请求会收到 503 / overloaded_error，流式请求会收到 error 事件，而不是被直接断开。
+var ErrServerShuttingDown = errors.New("server is shutting down")
+
+// responsesShutdownErrorCode 是 /v1/responses 流中 error 事件的 code。
+const responsesShutdownErrorCode = "server_shutting_down"
+
+type drainContextKey struct{}
+
+// ContextWithDrain 返回携带 drain 的 context，通常在 http.Server.BaseContext 中使用。宿主开始优雅停机时关闭 drain：
+// 普通请求不受影响，Responses WebSocket 这类长连接在没有进行中的 response 时立即以 going away 关闭，
+// 有进行中的 response 时等它结束后关闭，避免空闲连接拖住整个排空期。
+func ContextWithDrain(ctx context.Context, drain <-chan struct{}) context.Context {
+	return context.WithValue(ctx, drainContextKey{}, drain)
+}
+
+// drainFromContext 返回 ContextWithDrain 设置的 channel；未设置时返回 nil（永不就绪）。
+func drainFromContext(ctx context.Context) <-chan struct{} {
+	drain, _ := ctx.Value(drainContextKey{}).(<-chan struct{})
+	return drain
+}
+
+func isServerShuttingDown(ctx context.Context) bool {
+	return errors.Is(context.Cause(ctx), ErrServerShuttingDown)
+}
+
+// shutdownAwareError 在请求因服务停机被取消时把 err 换成 503，其余情况原样返回。
+func shutdownAwareError(ctx context.Context, err error) error {
+	if err == nil || !isServerShuttingDown(ctx) {
+		return err
+	}
+	return &httpError{Status: http.StatusServiceUnavailable, Message: ErrServerShuttingDown.Error(), Err: err}
+}
+
+// writeOpenAIStreamError 在已开始的 chat.completions 流中写出 OpenAI 风格的 error chunk。
+func writeOpenAIStreamError(w http.ResponseWriter, flusher http.Flusher, statusCode int, message string) {
+	errResp := openaiapi.OpenAIError{}
+	errResp.Error.Message = message
+	errResp.Error.Type = openAIErrorTypeForStatus(statusCode)
+	data, _ := json.Marshal(errResp)
+	fmt.Fprintf(w, "data: %s\n\n", data)
+	flusher.Flush()
+}
+
+// writeResponsesShutdownEvent 在 /v1/responses 透传流中写出 Responses API 的 error 事件。
+func writeResponsesShutdownEvent(w http.ResponseWriter) {
+	writeResponsesErrorEvent(w, responsesShutdownErrorCode, ErrServerShuttingDown.Error())
+}
+
+// writeResponsesErrorEvent 在 /v1/responses 透传流中写出带 code 的 error 事件。
+func writeResponsesErrorEvent(w http.ResponseWriter, code, message string) {
+	data, _ := json.Marshal(map[string]any{
+		"type":    "error",
+		"code":    code,
+		"message": message,
+	})
+	fmt.Fprintf(w, "event: error\ndata: %s\n\n", data)
+	if flusher, ok := w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,198 @@
+package openaihttp
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxOpenAIStopSequences 与 OpenAI chat.completions 的上限保持一致。
+const maxOpenAIStopSequences = 4
+
+// normalizeStopSequences 去掉空串并去重，保持原有顺序。
+// 注意这里不做 TrimSpace：OpenAI 客户端常用 "\n" 之类的纯空白 stop sequence。
+func normalizeStopSequences(raw []string) []string {
+	if len(raw) == 0 {
+		return nil
+	}
+	out := make([]string, 0, len(raw))
+	seen := make(map[string]struct{}, len(raw))
+	for _, s := range raw {
+		if s == "" {
+			continue
+		}
+		if _, ok := seen[s]; ok {
+			continue
+		}
+		seen[s] = struct{}{}
+		out = append(out, s)
+	}
+	if len(out) == 0 {
+		return nil
+	}
+	return out
+}
+
+// parseOpenAIStopSequences 解析 chat.completions 的 `stop` 字段（string 或 string 数组）。
+func parseOpenAIStopSequences(raw any) ([]string, error) {
+	switch v := raw.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return normalizeStopSequences([]string{v}), nil
+	case []string:
+		if len(v) > maxOpenAIStopSequences {
+			return nil, fmt.Errorf("stop supports at most %d sequences", maxOpenAIStopSequences)
+		}
+		return normalizeStopSequences(v), nil
+	case []any:
+		if len(v) > maxOpenAIStopSequences {
+			return nil, fmt.Errorf("stop supports at most %d sequences", maxOpenAIStopSequences)
+		}
+		out := make([]string, 0, len(v))
+		for _, item := range v {
+			s, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("stop must be a string or an array of strings")
+			}
+			out = append(out, s)
+		}
+		return normalizeStopSequences(out), nil
+	default:
+		return nil, fmt.Errorf("stop must be a string or an array of strings")
+	}
+}
+
+func maxStopSequenceLen(stopSequences []string) int {
+	maxLen := 0
+	for _, s := range stopSequences {
+		if len(s) > maxLen {
+			maxLen = len(s)
+		}
+	}
+	return maxLen
+}
+
+// findFirstStopSequence 返回 s 中最早出现的 stop sequence；同一位置命中多个时取最长的。
+func findFirstStopSequence(s string, stopSequences []string) (int, string, bool) {
+	if s == "" || len(stopSequences) == 0 {
+		return 0, "", false
+	}
+	bestIdx := -1
+	bestSeq := ""
+	for _, seq := range stopSequences {
+		if seq == "" {
+			continue
+		}
+		idx := strings.Index(s, seq)
+		if idx < 0 {
+			continue
+		}
+		if bestIdx < 0 || idx < bestIdx || (idx == bestIdx && len(seq) > len(bestSeq)) {
+			bestIdx = idx
+			bestSeq = seq
+		}
+	}
+	if bestIdx < 0 {
+		return 0, "", false
+	}
+	return bestIdx, bestSeq, true
+}
+
+// truncateAtStopSequence 用于非流式输出：截断到第一个 stop sequence 之前。
+func truncateAtStopSequence(text string, stopSequences []string) (string, string, bool) {
+	idx, seq, ok := findFirstStopSequence(text, stopSequences)
+	if !ok {
+		return text, "", false
+	}
+	return text[:idx], seq, true
+}
+
+// stopSequenceMatcher 在流式输出中检测 stop sequence。
+//
+// 为了不把跨 chunk 的 stop sequence 前缀提前发给客户端，matcher 会一直保留
+// 长度为 (最长 stop sequence - 1) 的尾部缓冲；只有确定不可能构成 stop sequence 的部分才会放行。
+type stopSequenceMatcher struct {
+	sequences []string
+	holdLen   int
+	buf       string
+	matched   string
+	stopped   bool
+}
+
+func newStopSequenceMatcher(stopSequences []string) *stopSequenceMatcher {
+	holdLen := maxStopSequenceLen(stopSequences) - 1
+	if holdLen < 0 {
+		holdLen = 0
+	}
+	return &stopSequenceMatcher{
+		sequences: stopSequences,
+		holdLen:   holdLen,
+	}
+}
+
+// push 追加一段 delta，返回可安全输出的文本。
+// 第二个返回值为 true 表示已命中 stop sequence：返回的文本是命中位置之前的剩余部分，之后的输入都会被丢弃。
+func (m *stopSequenceMatcher) push(delta string) (string, bool) {
+	if m == nil {
+		return delta, false
+	}
+	if m.stopped {
+		return "", true
+	}
+	if delta == "" {
+		return "", false
+	}
+	m.buf += delta
+	if idx, seq, ok := findFirstStopSequence(m.buf, m.sequences); ok {
+		out := m.buf[:idx]
+		m.buf = ""
+		m.matched = seq
+		m.stopped = true
+		return out, true
+	}
+	// 扣留长度按字节计算，放行前回退到 rune 起点，避免把多字节字符拆到两个 delta 中。
+	safeLen := runeStartBefore(m.buf, len(m.buf)-m.holdLen)
+	if safeLen <= 0 {
+		return "", false
+	}
+	out := m.buf[:safeLen]
+	m.buf = m.buf[safeLen:]
+	return out, false
+}
+
+// runeStartBefore 返回不超过 n 的最大 rune 起始字节偏移，n 越界时按 [0, len(s)] 截取。
+func runeStartBefore(s string, n int) int {
+	if n >= len(s) {
+		return len(s)
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return max(n, 0)
+}
+
+// pending 返回当前被扣留、尚未输出的字节数。
+func (m *stopSequenceMatcher) pending() int {
+	if m == nil {
+		return 0
+	}
+	return len(m.buf)
+}
+
+// flush 在流结束时取出被扣留的尾部；已命中 stop sequence 时返回空串。
+func (m *stopSequenceMatcher) flush() string {
+	if m == nil || m.stopped {
+		return ""
+	}
+	out := m.buf
+	m.buf = ""
+	return out
+}
+
+func (m *stopSequenceMatcher) stopSequence() (string, bool) {
+	if m == nil || !m.stopped {
+		return "", false
+	}
+	return m.matched, true
+}
@@ -0,0 +1,124 @@
+package openaihttp
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseOpenAIStopSequences(t *testing.T) {
+	got, err := parseOpenAIStopSequences(nil)
+	require.NoError(t, err)
+	require.Nil(t, got)
+
+	got, err = parseOpenAIStopSequences("\n")
+	require.NoError(t, err)
+	require.Equal(t, []string{"\n"}, got)
+
+	got, err = parseOpenAIStopSequences([]any{"END", "", "END", "###"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"END", "###"}, got)
+
+	_, err = parseOpenAIStopSequences([]any{"a", 1})
+	require.Error(t, err)
+
+	_, err = parseOpenAIStopSequences([]any{"a", "b", "c", "d", "e"})
+	require.Error(t, err)
+
+	_, err = parseOpenAIStopSequences(42.0)
+	require.Error(t, err)
+}
+
+func TestStopSequenceMatcher_HoldsBackPossiblePrefix(t *testing.T) {
+	m := newStopSequenceMatcher([]string{"STOP", "ST"})
+
+	out, stopped := m.push("helloS")
+	require.False(t, stopped)
+	require.Equal(t, "hel", out)
+	require.Equal(t, 3, m.pending())
+
+	out, stopped = m.push("Tuff")
+	require.True(t, stopped)
+	require.Equal(t, "lo", out)
+	seq, ok := m.stopSequence()
+	require.True(t, ok)
+	require.Equal(t, "ST", seq)
+
+	out, stopped = m.push("more")
+	require.True(t, stopped)
+	require.Empty(t, out)
+	require.Empty(t, m.flush())
+}
+
+func TestStopSequenceMatcher_SplitAcrossManyChunks(t *testing.T) {
+	m := newStopSequenceMatcher([]string{"<|end|>"})
+
+	var got strings.Builder
+	stopped := false
+	for _, chunk := range []string{"ans", "wer <", "|e", "nd", "|> trailing"} {
+		out, hit := m.push(chunk)
+		got.WriteString(out)
+		if hit {
+			stopped = true
+			break
+		}
+	}
+	require.True(t, stopped)
+	require.Equal(t, "answer ", got.String())
+}
+
+func TestStopSequenceMatcher_KeepsMultiByteRunesWhole(t *testing.T) {
+	m := newStopSequenceMatcher([]string{"。END"})
+
+	var got strings.Builder
+	stopped := false
+	for _, chunk := range []string{"你好世界", "。EN", "D后续"} {
+		out, hit := m.push(chunk)
+		require.True(t, utf8.ValidString(out), "chunk %q released invalid UTF-8 %q", chunk, out)
+		got.WriteString(out)
+		if hit {
+			stopped = true
+			break
+		}
+	}
+	require.True(t, stopped)
+	require.Equal(t, "你好世界", got.String())
+
+	m = newStopSequenceMatcher([]string{"。END"})
+	out, _ := m.push("你好世界")
+	require.Equal(t, "你好", out)
+	require.Equal(t, "世界", m.flush())
+}
+
+func TestStopSequenceMatcher_FlushReleasesTailWithoutMatch(t *testing.T) {
+	m := newStopSequenceMatcher([]string{"STOP"})
+
+	out, stopped := m.push("abcST")
+	require.False(t, stopped)
+	require.Equal(t, "ab", out)
+	require.Equal(t, "cST", m.flush())
+	_, ok := m.stopSequence()
+	require.False(t, ok)
+}
+
+func TestStopSequenceMatcher_NoSequencesPassesThrough(t *testing.T) {
+	m := newStopSequenceMatcher(nil)
+
+	out, stopped := m.push("abc")
+	require.False(t, stopped)
+	require.Equal(t, "abc", out)
+	require.Zero(t, m.pending())
+}
+
+func TestTruncateAtStopSequence(t *testing.T) {
+	text, seq, ok := truncateAtStopSequence("one\ntwo", []string{"\n"})
+	require.True(t, ok)
+	require.Equal(t, "one", text)
+	require.Equal(t, "\n", seq)
+
+	text, _, ok = truncateAtStopSequence("one two", []string{"\n"})
+	require.False(t, ok)
+	require.Equal(t, "one two", text)
+}
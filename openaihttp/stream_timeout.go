@@ -0,0 +1,18 @@
+package openaihttp
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/LubyRuffy/gptb2o/backend"
+)
+
+// timeoutAwareError 在 err 由 backend 超时（backend.StreamTimeoutError）引起时换成 504，其余情况原样返回。
+// 504 在 Claude 入口映射为 timeout_error，在 OpenAI 入口映射为 timeout_error 类型的 error。
+func timeoutAwareError(ctx context.Context, err error) error {
+	timeoutErr, ok := backend.AsStreamTimeout(ctx, err)
+	if !ok {
+		return err
+	}
+	return &httpError{Status: http.StatusGatewayTimeout, Message: timeoutErr.Error(), Err: timeoutErr}
+}
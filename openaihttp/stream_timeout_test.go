@@ -0,0 +1,84 @@
+package openaihttp
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStreamTimeouts_WriteTimeoutErrors(t *testing.T) {
+	release := make(chan struct{})
+	backendSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/stalled-headers" {
+			<-release
+			return
+		}
+		// 发出一个事件后停止发送，模拟 backend 中途卡住。
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: {\"type\":\"response.created\",\"response\":{\"id\":\"resp_1\"}}\n\n")
+		fmt.Fprint(w, "data: {\"type\":\"response.output_text.delta\",\"delta\":\"partial\"}\n\n")
+		w.(http.Flusher).Flush()
+		<-release
+	}))
+	t.Cleanup(backendSrv.Close)
+	t.Cleanup(func() { close(release) })
+
+	newHandler := func(path string) http.Handler {
+		h, err := NewHandler(Config{
+			BackendURL:     backendSrv.URL + path,
+			ConnectTimeout: 50 * time.Millisecond,
+			IdleTimeout:    50 * time.Millisecond,
+			AuthProvider:   func(ctx context.Context) (string, string, error) { return "token", "", nil },
+		})
+		require.NoError(t, err)
+		return h
+	}
+	serve := func(h http.Handler, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, path, strings.NewReader(body)))
+		return w
+	}
+	stalled := newHandler("/stalled-stream")
+
+	info := httptest.NewRecorder()
+	stalled.ServeHTTP(info, httptest.NewRequest(http.MethodGet, DebugInfoPath, nil))
+	require.Contains(t, info.Body.String(), `"connect_timeout":"50ms"`)
+	require.Contains(t, info.Body.String(), `"idle_timeout":"50ms"`)
+	require.NotContains(t, info.Body.String(), "request_timeout")
+
+	w := serve(stalled, "/v1/messages", `{"model":"sonnet","max_tokens":16,"stream":true,"messages":[{"role":"user","content":"hi"}]}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Contains(t, w.Body.String(), "partial")
+	require.Contains(t, w.Body.String(), "event: error\ndata: {\"error\":{\"message\":\"backend stream idle timeout: no stream data for 50ms\",\"type\":\"timeout_error\"}")
+	require.NotContains(t, w.Body.String(), "message_stop")
+
+	w = serve(stalled, "/v1/chat/completions", `{"model":"gpt-5.5","stream":true,"messages":[{"role":"user","content":"hi"}]}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Contains(t, w.Body.String(), `"type":"timeout_error"`)
+	require.NotContains(t, w.Body.String(), "[DONE]")
+
+	w = serve(stalled, "/v1/responses", `{"model":"gpt-5.5","stream":true,"input":"hi"}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Contains(t, w.Body.String(), "event: response.output_text.delta")
+	require.Contains(t, w.Body.String(), `event: error`+"\n"+`data: {"code":"backend_idle_timeout"`)
+
+	w = serve(stalled, "/v1/responses", `{"model":"gpt-5.5","input":"hi"}`)
+	require.Equal(t, http.StatusGatewayTimeout, w.Code)
+	require.Contains(t, w.Body.String(), "backend stream idle timeout")
+
+	stalledHeaders := newHandler("/stalled-headers")
+	w = serve(stalledHeaders, "/v1/messages", `{"model":"sonnet","max_tokens":16,"messages":[{"role":"user","content":"hi"}]}`)
+	require.Equal(t, http.StatusGatewayTimeout, w.Code)
+	require.Contains(t, w.Body.String(), `"type":"timeout_error"`)
+	require.Contains(t, w.Body.String(), "backend connect timeout")
+
+	w = serve(stalledHeaders, "/v1/responses", `{"model":"gpt-5.5","stream":true,"input":"hi"}`)
+	require.Equal(t, http.StatusGatewayTimeout, w.Code)
+	require.Contains(t, w.Body.String(), "backend connect timeout")
+}
@@ -0,0 +1,141 @@
+package openaihttp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/LubyRuffy/gptb2o/telemetry"
+	"github.com/LubyRuffy/gptb2o/trace"
+)
+
+// wrapWithTelemetry 为入站请求创建 server span：沿用客户端 traceparent 作为父 span，
+// 并记录 model、effort、状态码与 trace 分配的 interaction_id。tracer 为 nil 时原样返回 handler。
+func wrapWithTelemetry(tracer *telemetry.Tracer, route string, handler http.HandlerFunc) http.HandlerFunc {
+	if tracer == nil || handler == nil {
+		return handler
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		startedAt := time.Now()
+		bodyBytes, err := io.ReadAll(r.Body)
+		_ = r.Body.Close()
+		if err != nil {
+			bodyBytes = nil
+		}
+		r.Body = io.NopCloser(bytes.NewReader(bodyBytes))
+
+		var payload struct {
+			Model     string `json:"model"`
+			Stream    bool   `json:"stream"`
+			Reasoning struct {
+				Effort string `json:"effort"`
+			} `json:"reasoning"`
+			OutputConfig struct {
+				Effort string `json:"effort"`
+			} `json:"output_config"`
+		}
+		_ = json.Unmarshal(bodyBytes, &payload)
+		effort := strings.TrimSpace(payload.Reasoning.Effort)
+		if effort == "" {
+			effort = strings.TrimSpace(payload.OutputConfig.Effort)
+		}
+
+		ctx := telemetry.Extract(r.Context(), r.Header)
+		ctx, span := tracer.Start(ctx, r.Method+" "+r.URL.Path, telemetry.SpanKindServer,
+			telemetry.String(telemetry.AttrHTTPMethod, r.Method),
+			telemetry.String(telemetry.AttrHTTPRoute, r.URL.Path),
+			telemetry.String(telemetry.AttrClientAPI, clientAPIForRoute(route, r)),
+			telemetry.String(telemetry.AttrModel, strings.TrimSpace(payload.Model)),
+			telemetry.Bool(telemetry.AttrStream, payload.Stream),
+		)
+		defer span.End()
+		if effort != "" {
+			span.SetAttributes(telemetry.String(telemetry.AttrReasoningEffort, effort))
+		}
+
+		capture := &observedResponseWriter{ResponseWriter: w, statusCode: http.StatusOK, startedAt: startedAt}
+		handler(capture, r.WithContext(ctx))
+
+		span.SetAttributes(telemetry.Int(telemetry.AttrHTTPStatusCode, capture.statusCode))
+		// interaction_id 由内层 trace.Tracer 写入响应头，据此可从 span 跳到 --show-interaction。
+		if interactionID := capture.Header().Get(trace.InteractionIDHeader); interactionID != "" {
+			span.SetAttributes(telemetry.String(telemetry.AttrInteractionID, interactionID))
+		}
+		switch {
+		case capture.statusCode >= http.StatusInternalServerError:
+			span.SetError(http.StatusText(capture.statusCode))
+		case capture.timer != nil && capture.timer.ErrorEvents() > 0:
+			span.SetError("stream error event sent to client")
+		}
+	}
+}
+
+// startBackendAttemptSpan 为 /v1/responses 的一次 backend 请求创建 client span。
+func startBackendAttemptSpan(ctx context.Context, cfg resolvedConfig, attempt int, payload backendResponsesPayload) (context.Context, *telemetry.Span) {
+	effort := ""
+	if payload.Reasoning != nil {
+		effort = payload.Reasoning.Effort
+	}
+	return cfg.Telemetry.Start(ctx, telemetry.SpanBackendAttempt, telemetry.SpanKindClient,
+		telemetry.String(telemetry.AttrHTTPMethod, http.MethodPost),
+		telemetry.String(telemetry.AttrURLFull, cfg.BackendURL),
+		telemetry.String(telemetry.AttrModel, payload.Model),
+		telemetry.String(telemetry.AttrReasoningEffort, effort),
+		telemetry.Int(telemetry.AttrAttempt, attempt),
+	)
+}
+
+// tracedResponseBody 在 /v1/responses 透传 backend SSE 时记录 SSE stream span，读完或关闭时
+// 结束 stream 与 attempt span，并把 usage 写到 stream span 与入站请求 span 上。
+type tracedResponseBody struct {
+	io.ReadCloser
+	request *telemetry.Span
+	attempt *telemetry.Span
+	stream  *telemetry.Span
+	scanner backendUsageScanner
+	once    sync.Once
+}
+
+func newTracedResponseBody(ctx context.Context, cfg resolvedConfig, request, attempt *telemetry.Span, body io.ReadCloser) io.ReadCloser {
+	_, stream := cfg.Telemetry.Start(ctx, telemetry.SpanSSEStream, telemetry.SpanKindInternal)
+	return &tracedResponseBody{ReadCloser: body, request: request, attempt: attempt, stream: stream}
+}
+
+func (b *tracedResponseBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 {
+		b.scanner.Write(p[:n])
+	}
+	if err != nil {
+		if !errors.Is(err, io.EOF) {
+			b.stream.RecordError(err)
+			b.attempt.RecordError(err)
+		}
+		b.finish()
+	}
+	return n, err
+}
+
+func (b *tracedResponseBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.finish()
+	return err
+}
+
+func (b *tracedResponseBody) finish() {
+	b.once.Do(func() {
+		if usage := b.scanner.usage; usage != nil {
+			attrs := telemetry.UsageAttributes(usage.InputTokens, usage.OutputTokens, usage.OutputTokensDetails.ReasoningTokens)
+			b.stream.SetAttributes(attrs...)
+			b.request.SetAttributes(attrs...)
+		}
+		b.stream.End()
+		b.attempt.End()
+	})
+}
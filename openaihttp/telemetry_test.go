@@ -0,0 +1,207 @@
+package openaihttp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/LubyRuffy/gptb2o/telemetry"
+	"github.com/LubyRuffy/gptb2o/trace"
+	"github.com/stretchr/testify/require"
+)
+
+type stubSpan struct {
+	TraceID      string `json:"traceId"`
+	SpanID       string `json:"spanId"`
+	ParentSpanID string `json:"parentSpanId"`
+	Name         string `json:"name"`
+	Attributes   []struct {
+		Key   string `json:"key"`
+		Value struct {
+			StringValue *string `json:"stringValue"`
+			IntValue    *string `json:"intValue"`
+		} `json:"value"`
+	} `json:"attributes"`
+	Status struct {
+		Code int `json:"code"`
+	} `json:"status"`
+}
+
+func (s stubSpan) attr(key string) string {
+	for _, kv := range s.Attributes {
+		if kv.Key != key {
+			continue
+		}
+		if kv.Value.StringValue != nil {
+			return *kv.Value.StringValue
+		}
+		if kv.Value.IntValue != nil {
+			return *kv.Value.IntValue
+		}
+	}
+	return ""
+}
+
+// otlpCollectorStub 是进程内的 OTLP/HTTP collector，按到达顺序保存 span。
+type otlpCollectorStub struct {
+	mu    sync.Mutex
+	spans []stubSpan
+}
+
+func (c *otlpCollectorStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ResourceSpans []struct {
+			ScopeSpans []struct {
+				Spans []stubSpan `json:"spans"`
+			} `json:"scopeSpans"`
+		} `json:"resourceSpans"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, rs := range req.ResourceSpans {
+		for _, ss := range rs.ScopeSpans {
+			c.spans = append(c.spans, ss.Spans...)
+		}
+	}
+}
+
+func (c *otlpCollectorStub) byName(name string) []stubSpan {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var out []stubSpan
+	for _, span := range c.spans {
+		if span.Name == name {
+			out = append(out, span)
+		}
+	}
+	return out
+}
+
+func newTelemetryTestHandler(t *testing.T, backendURL string, reasoningEffort string) (http.Handler, *telemetry.Tracer, *otlpCollectorStub) {
+	t.Helper()
+	collector := &otlpCollectorStub{}
+	collectorSrv := httptest.NewServer(collector)
+	t.Cleanup(collectorSrv.Close)
+
+	tracer, err := telemetry.NewTracer(telemetry.TracerOptions{Endpoint: collectorSrv.URL})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = tracer.Shutdown(context.Background()) })
+
+	handler, err := NewHandler(Config{
+		BackendURL:      backendURL,
+		ReasoningEffort: reasoningEffort,
+		AuthProvider: func(ctx context.Context) (string, string, error) {
+			return "token", "acc", nil
+		},
+		Tracer:    trace.NewTracer(trace.NewMemorySink(10), trace.TracerOptions{}),
+		Telemetry: tracer,
+	})
+	require.NoError(t, err)
+	return handler, tracer, collector
+}
+
+const telemetryTestUsageSSE = "event: response.output_text.delta\ndata: {\"type\":\"response.output_text.delta\",\"delta\":\"hi\"}\n\n" +
+	"event: response.completed\ndata: {\"type\":\"response.completed\",\"response\":{\"usage\":{\"input_tokens\":11,\"output_tokens\":7,\"output_tokens_details\":{\"reasoning_tokens\":3}}}}\n\n"
+
+func TestTelemetry_ClaudeMessagesSpanTree(t *testing.T) {
+	backendSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload struct {
+			Reasoning struct {
+				Effort string `json:"effort"`
+			} `json:"reasoning"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&payload))
+		// backend 只应看到 gptb2o 自己的请求，不透传客户端 traceparent。
+		require.Empty(t, r.Header.Get(telemetry.TraceparentHeader))
+		if payload.Reasoning.Effort == "xhigh" {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = fmt.Fprint(w, `{"error":{"message":"Unsupported value: 'xhigh' is not supported","param":"reasoning.effort"}}`)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = fmt.Fprint(w, telemetryTestUsageSSE)
+	}))
+	t.Cleanup(backendSrv.Close)
+
+	handler, tracer, collector := newTelemetryTestHandler(t, backendSrv.URL, "xhigh")
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(`{"model":"gpt-5.5","max_tokens":16,"messages":[{"role":"user","content":"hi"}]}`))
+	req.Header.Set(telemetry.TraceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, tracer.ForceFlush(context.Background()))
+
+	inbound := collector.byName("POST /v1/messages")
+	require.Len(t, inbound, 1)
+	require.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", inbound[0].TraceID)
+	require.Equal(t, "00f067aa0ba902b7", inbound[0].ParentSpanID)
+	require.Equal(t, w.Header().Get(trace.InteractionIDHeader), inbound[0].attr(telemetry.AttrInteractionID))
+	require.Equal(t, "claude", inbound[0].attr(telemetry.AttrClientAPI))
+	require.Equal(t, "200", inbound[0].attr(telemetry.AttrHTTPStatusCode))
+
+	chatModel := collector.byName(telemetry.SpanChatModel)
+	require.Len(t, chatModel, 1)
+	require.Equal(t, inbound[0].SpanID, chatModel[0].ParentSpanID)
+	require.Equal(t, "gpt-5.5", chatModel[0].attr(telemetry.AttrModel))
+	require.Equal(t, "xhigh", chatModel[0].attr(telemetry.AttrReasoningEffort))
+	require.Equal(t, "11", chatModel[0].attr(telemetry.AttrInputTokens))
+	require.Equal(t, "7", chatModel[0].attr(telemetry.AttrOutputTokens))
+	require.Equal(t, "3", chatModel[0].attr(telemetry.AttrReasoningTokens))
+
+	attempts := collector.byName(telemetry.SpanBackendAttempt)
+	require.Len(t, attempts, 2)
+	require.Equal(t, "1", attempts[0].attr(telemetry.AttrAttempt))
+	require.Equal(t, "400", attempts[0].attr(telemetry.AttrHTTPStatusCode))
+	require.Equal(t, 2, attempts[0].Status.Code)
+	require.Equal(t, "2", attempts[1].attr(telemetry.AttrAttempt))
+	require.Equal(t, "high", attempts[1].attr(telemetry.AttrReasoningEffort))
+	for _, attempt := range attempts {
+		require.Equal(t, chatModel[0].SpanID, attempt.ParentSpanID)
+	}
+
+	streams := collector.byName(telemetry.SpanSSEStream)
+	require.Len(t, streams, 1)
+	require.Equal(t, attempts[1].SpanID, streams[0].ParentSpanID)
+	require.Equal(t, "11", streams[0].attr(telemetry.AttrInputTokens))
+}
+
+func TestTelemetry_ResponsesStreamSpans(t *testing.T) {
+	backendSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = fmt.Fprint(w, telemetryTestUsageSSE)
+	}))
+	t.Cleanup(backendSrv.Close)
+
+	handler, tracer, collector := newTelemetryTestHandler(t, backendSrv.URL, "")
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/responses", strings.NewReader(`{"model":"gpt-5.4","input":"hi","stream":true,"reasoning":{"effort":"low"}}`))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, tracer.ForceFlush(context.Background()))
+
+	inbound := collector.byName("POST /v1/responses")
+	require.Len(t, inbound, 1)
+	require.Empty(t, inbound[0].ParentSpanID)
+	require.Equal(t, "low", inbound[0].attr(telemetry.AttrReasoningEffort))
+	require.Equal(t, "11", inbound[0].attr(telemetry.AttrInputTokens))
+	require.NotEmpty(t, inbound[0].attr(telemetry.AttrInteractionID))
+
+	attempts := collector.byName(telemetry.SpanBackendAttempt)
+	require.Len(t, attempts, 1)
+	require.Equal(t, inbound[0].SpanID, attempts[0].ParentSpanID)
+	streams := collector.byName(telemetry.SpanSSEStream)
+	require.Len(t, streams, 1)
+	require.Equal(t, attempts[0].SpanID, streams[0].ParentSpanID)
+	require.Equal(t, "3", streams[0].attr(telemetry.AttrReasoningTokens))
+}
@@ -3,7 +3,11 @@ package openaihttp
 import (
 	"context"
 	"net/http"
+	"time"
 
+	"github.com/LubyRuffy/gptb2o/batch"
+	"github.com/LubyRuffy/gptb2o/metrics"
+	"github.com/LubyRuffy/gptb2o/telemetry"
 	"github.com/LubyRuffy/gptb2o/trace"
 )
 
@@ -29,4 +33,47 @@ type Config struct {
 	SystemFingerprint string
 	// Tracer 可选，启用后会记录客户端与 backend 的全链路请求/响应。
 	Tracer *trace.Tracer
+	// Metrics 可选，启用后统计 chat_completions / responses / messages / count_tokens 的 Prometheus 指标。
+	Metrics *metrics.Metrics
+	// Telemetry 可选，启用后为上述四个入口、chat model 调用、每次 backend 尝试与 SSE 读取创建 OpenTelemetry span。
+	Telemetry *telemetry.Tracer
+	// Batches 可选，启用 /v1/messages/batches；batch 与请求结果持久化在该 store 中，重启后继续执行。
+	Batches *batch.Store
+	// BatchConcurrency batch worker 并发数，默认 4。
+	BatchConcurrency int
+	// Version 在 /debug/info 中展示的版本号。
+	Version string
+	// AuthSource 在 /debug/info 中展示的认证来源（如 codex / env），仅用于展示。
+	AuthSource string
+	// BackendProbeTTL 大于 0 时 /readyz 会探测 BackendURL 是否可达，结果缓存该时长；默认不探测。
+	BackendProbeTTL time.Duration
+	// Settings 可选，提供可热更新的入站 API key、模型目录与默认 effort；为 nil 时不校验 API key。
+	Settings *SettingsStore
+	// ModelsURL 可选，设置后从该 backend 端点（Codex CLI 使用的模型列表，默认地址见 gptb2o.DefaultModelsURL）
+	// 拉取账号可用的模型，与模型目录合并；为空时只使用静态目录。
+	ModelsURL string
+	// ModelsTTL 是 backend 模型列表的缓存时长，默认 DefaultModelsTTL。
+	ModelsTTL time.Duration
+	// MaxConcurrentRequests 大于 0 时限制同时处理的 chat.completions / responses / messages 请求数（流式请求直到流结束），
+	// 超出的请求按入站 API key 或 metadata.user_id 公平排队。
+	MaxConcurrentRequests int
+	// MaxQueuedRequests 是排队请求数上限，队列满时立即返回 503 / 529；0 表示不排队。
+	MaxQueuedRequests int
+	// MaxQueueWait 是请求排队的最长时间，默认 DefaultMaxQueueWait；超时返回 503 / 529。
+	MaxQueueWait time.Duration
+	// WebSocketAllowedOrigins 是允许连接 GET /v1/responses WebSocket 的额外浏览器来源（如 https://app.example），
+	// "*" 表示不限制；默认只接受与请求 Host 相同的 Origin 以及不带 Origin 的非浏览器客户端。
+	WebSocketAllowedOrigins []string
+	// ConnectTimeout 大于 0 时限制发出 backend 请求到收到响应头的时间。
+	ConnectTimeout time.Duration
+	// FirstEventTimeout 大于 0 时限制收到响应头后等待首个 SSE 数据的时间；为 0 时沿用 IdleTimeout。
+	FirstEventTimeout time.Duration
+	// IdleTimeout 大于 0 时限制 backend 流中相邻两次收到数据的间隔，避免 backend 中途停止发送时客户端一直挂起。
+	IdleTimeout time.Duration
+	// RequestTimeout 大于 0 时限制整个 backend 请求（含读完整个流）的时间。
+	// 以上超时触发时，已开始的流以 error 事件结束，尚未开始时返回 504。
+	RequestTimeout time.Duration
+
+	// admission 由 NewHandler / RegisterGinRoutes 创建，使同一张路由表共用一个并发限制。
+	admission *admissionController
 }
@@ -0,0 +1,206 @@
+package gptb2o
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ModelCapabilities 描述模型支持的能力，用于请求前校验与 /v1/models 展示。
+type ModelCapabilities struct {
+	// Tools 为 false 时拒绝携带 tools 的请求。
+	Tools bool
+	// Vision 表示模型接受图片输入，仅用于展示。
+	Vision bool
+	// XHigh 为 false 时 reasoning effort xhigh 会在发送前降为 high，避免一次 backend 400 重试。
+	XHigh bool
+}
+
+// ModelInfo 描述 registry 中的一个 backend 模型。
+type ModelInfo struct {
+	// ID 是 backend 模型 ID，不带 namespace。
+	ID string
+	// Name 是展示名，为空时使用 ID。
+	Name string
+	// ReasoningEffort 是请求未指定 effort 时的默认值，为空时沿用服务默认值。
+	ReasoningEffort string
+	// ContextWindow 是上下文窗口 token 数，0 表示未知。
+	ContextWindow int
+	Capabilities  ModelCapabilities
+}
+
+// FullID 返回带 ModelNamespace 的模型 ID。
+func (m ModelInfo) FullID() string {
+	return ModelNamespace + m.ID
+}
+
+// ModelAlias 把客户端模型名映射到 registry 中的模型。Pattern 不区分大小写，支持 * 通配，
+// 例如 "claude-sonnet-*" -> "gpt-5.5"。
+type ModelAlias struct {
+	Pattern string
+	Target  string
+}
+
+// IsPattern 报告别名是否包含通配符。
+func (a ModelAlias) IsPattern() bool {
+	return strings.Contains(a.Pattern, "*")
+}
+
+// ModelRegistry 是可配置的模型目录：模型列表、别名与每个模型的默认值。创建后只读，可并发使用。
+type ModelRegistry struct {
+	models  []ModelInfo
+	index   map[string]int
+	aliases []ModelAlias
+}
+
+// NewModelRegistry 校验并创建 registry。models 的顺序即 /v1/models 的输出顺序，第一项为默认模型；
+// aliases 按顺序匹配，先匹配者生效。
+func NewModelRegistry(models []ModelInfo, aliases []ModelAlias) (*ModelRegistry, error) {
+	if len(models) == 0 {
+		return nil, fmt.Errorf("model registry needs at least one model")
+	}
+	r := &ModelRegistry{
+		models:  make([]ModelInfo, 0, len(models)),
+		index:   make(map[string]int, len(models)),
+		aliases: make([]ModelAlias, 0, len(aliases)),
+	}
+	for i, m := range models {
+		m.ID = NormalizeModelID(m.ID)
+		if m.ID == "" {
+			return nil, fmt.Errorf("models[%d]: id is required", i)
+		}
+		if _, ok := r.index[m.ID]; ok {
+			return nil, fmt.Errorf("models[%d]: duplicate model %q", i, m.ID)
+		}
+		m.Name = strings.TrimSpace(m.Name)
+		if m.Name == "" {
+			m.Name = m.ID
+		}
+		m.ReasoningEffort = strings.TrimSpace(m.ReasoningEffort)
+		r.index[m.ID] = len(r.models)
+		r.models = append(r.models, m)
+	}
+	for i, a := range aliases {
+		a.Pattern = strings.ToLower(strings.TrimSpace(a.Pattern))
+		a.Target = NormalizeModelID(a.Target)
+		if a.Pattern == "" {
+			return nil, fmt.Errorf("aliases[%d]: pattern is required", i)
+		}
+		if _, ok := r.index[a.Target]; !ok {
+			return nil, fmt.Errorf("aliases[%d]: %q targets unknown model %q", i, a.Pattern, a.Target)
+		}
+		r.aliases = append(r.aliases, a)
+	}
+	return r, nil
+}
+
+// Models 返回全部模型，第一项为默认模型。
+func (r *ModelRegistry) Models() []ModelInfo {
+	return append([]ModelInfo(nil), r.models...)
+}
+
+// Aliases 返回全部别名，按匹配顺序排列。
+func (r *ModelRegistry) Aliases() []ModelAlias {
+	return append([]ModelAlias(nil), r.aliases...)
+}
+
+// Default 返回默认模型（列表第一项）。
+func (r *ModelRegistry) Default() ModelInfo {
+	return r.models[0]
+}
+
+// Lookup 按模型 ID 查找（支持带 namespace/prefix 的写法），不解析别名。
+func (r *ModelRegistry) Lookup(modelID string) (ModelInfo, bool) {
+	i, ok := r.index[NormalizeModelID(modelID)]
+	if !ok {
+		return ModelInfo{}, false
+	}
+	return r.models[i], true
+}
+
+// Resolve 先按模型 ID、再按别名解析客户端传入的模型名；已声明的模型不会被通配别名改写。
+func (r *ModelRegistry) Resolve(model string) (ModelInfo, bool) {
+	trimmed := strings.TrimSpace(model)
+	if trimmed == "" {
+		return ModelInfo{}, false
+	}
+	if info, ok := r.Lookup(trimmed); ok {
+		return info, true
+	}
+	lower := strings.ToLower(trimmed)
+	for _, a := range r.aliases {
+		if matchModelPattern(a.Pattern, lower) {
+			return r.Lookup(a.Target)
+		}
+	}
+	return ModelInfo{}, false
+}
+
+// matchModelPattern 做不区分大小写的 * 通配匹配，pattern 与 s 均已转为小写。
+func matchModelPattern(pattern, s string) bool {
+	parts := strings.Split(pattern, "*")
+	if len(parts) == 1 {
+		return pattern == s
+	}
+	if !strings.HasPrefix(s, parts[0]) {
+		return false
+	}
+	s = s[len(parts[0]):]
+	last := parts[len(parts)-1]
+	for _, part := range parts[1 : len(parts)-1] {
+		i := strings.Index(s, part)
+		if i < 0 {
+			return false
+		}
+		s = s[i+len(part):]
+	}
+	return strings.HasSuffix(s, last)
+}
+
+// 使用固定顺序，确保客户端“默认选中第一项”时稳定得到 DefaultModelID。
+var builtinModels = []ModelInfo{
+	{ID: "gpt-5.5", Name: "GPT-5.5"},
+	{ID: "gpt-5.4", Name: "GPT-5.4"},
+	{ID: "gpt-5.4-mini", Name: "GPT-5.4 Mini"},
+	{ID: "gpt-5.3-codex-spark", Name: "GPT-5.3 Codex Spark"},
+	{ID: "gpt-5.3-codex", Name: "GPT-5.3 Codex"},
+	{ID: "gpt-5.2-codex", Name: "GPT-5.2 Codex"},
+	{ID: "gpt-5.2", Name: "GPT-5.2"},
+}
+
+// Claude Code CLI 支持简写别名（例如 --model sonnet/opus/haiku）以及完整的 claude-* 模型名，
+// 映射到内部可用的模型，确保 CLI 直接使用别名也能跑通。
+var builtinModelAliases = []ModelAlias{
+	{Pattern: "sonnet", Target: DefaultModelID},
+	{Pattern: "opus", Target: DefaultModelID},
+	{Pattern: "haiku", Target: "gpt-5.4-mini"},
+	{Pattern: "claude-haiku*", Target: "gpt-5.4-mini"},
+	{Pattern: "claude-*", Target: DefaultModelID},
+}
+
+// BuiltinModels 返回内置模型列表；内置模型支持 tools、vision 与 xhigh（不支持时由 backend 降级重试兜底）。
+func BuiltinModels() []ModelInfo {
+	out := make([]ModelInfo, 0, len(builtinModels))
+	for _, m := range builtinModels {
+		m.Capabilities = ModelCapabilities{Tools: true, Vision: true, XHigh: true}
+		out = append(out, m)
+	}
+	return out
+}
+
+// BuiltinModelAliases 返回内置的 Claude 模型名别名。
+func BuiltinModelAliases() []ModelAlias {
+	return append([]ModelAlias(nil), builtinModelAliases...)
+}
+
+var defaultModelRegistry = func() *ModelRegistry {
+	r, err := NewModelRegistry(BuiltinModels(), BuiltinModelAliases())
+	if err != nil {
+		panic(err)
+	}
+	return r
+}()
+
+// DefaultModelRegistry 返回只包含内置模型与别名的 registry。
+func DefaultModelRegistry() *ModelRegistry {
+	return defaultModelRegistry
+}
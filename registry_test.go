@@ -0,0 +1,112 @@
+package gptb2o_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/LubyRuffy/gptb2o"
+)
+
+func TestModelRegistry_ResolveAliasesAndPatterns(t *testing.T) {
+	r, err := gptb2o.NewModelRegistry([]gptb2o.ModelInfo{
+		{ID: "gpt-5.5"},
+		{ID: "chatgpt/codex/gpt-5.4-mini", Name: "Mini"},
+	}, []gptb2o.ModelAlias{
+		{Pattern: "Fast", Target: "gpt-5.4-mini"},
+		{Pattern: "claude-*-haiku-*", Target: "gpt-5.4-mini"},
+		{Pattern: "claude-*", Target: "gpt-5.5"},
+	})
+	if err != nil {
+		t.Fatalf("NewModelRegistry() error = %v", err)
+	}
+
+	cases := map[string]string{
+		"fast":                       "gpt-5.4-mini",
+		"FAST":                       "gpt-5.4-mini",
+		"claude-3-5-haiku-20241022":  "gpt-5.4-mini",
+		"claude-sonnet-4-5":          "gpt-5.5",
+		"chatgpt/codex/gpt-5.4-mini": "gpt-5.4-mini",
+		"opencode/codex/gpt-5.5":     "gpt-5.5",
+		" gpt-5.5 ":                  "gpt-5.5",
+	}
+	for in, want := range cases {
+		m, ok := r.Resolve(in)
+		if !ok || m.ID != want {
+			t.Fatalf("Resolve(%q) = %q, %v; want %q", in, m.ID, ok, want)
+		}
+	}
+	for _, in := range []string{"", "gpt-9", "fast-ish", "sonnet"} {
+		if m, ok := r.Resolve(in); ok {
+			t.Fatalf("Resolve(%q) = %q, want unsupported", in, m.ID)
+		}
+	}
+	if _, ok := r.Lookup("fast"); ok {
+		t.Fatalf("Lookup should not resolve aliases")
+	}
+	if m, _ := r.Lookup("gpt-5.5"); m.Name != "gpt-5.5" {
+		t.Fatalf("empty name should fall back to id, got %q", m.Name)
+	}
+	if r.Default().ID != "gpt-5.5" {
+		t.Fatalf("Default() = %q, want gpt-5.5", r.Default().ID)
+	}
+}
+
+func TestModelRegistry_ResolvePrefersExactModelID(t *testing.T) {
+	r, err := gptb2o.NewModelRegistry([]gptb2o.ModelInfo{
+		{ID: "gpt-5.5"},
+		{ID: "gpt-5.4-mini"},
+	}, []gptb2o.ModelAlias{
+		{Pattern: "gpt-*", Target: "gpt-5.5"},
+	})
+	if err != nil {
+		t.Fatalf("NewModelRegistry() error = %v", err)
+	}
+
+	cases := map[string]string{
+		"gpt-5.4-mini":               "gpt-5.4-mini",
+		"chatgpt/codex/gpt-5.4-mini": "gpt-5.4-mini",
+		"gpt-4o":                     "gpt-5.5",
+	}
+	for in, want := range cases {
+		m, ok := r.Resolve(in)
+		if !ok || m.ID != want {
+			t.Fatalf("Resolve(%q) = %q, %v; want %q", in, m.ID, ok, want)
+		}
+	}
+}
+
+func TestNewModelRegistry_Errors(t *testing.T) {
+	cases := []struct {
+		name    string
+		models  []gptb2o.ModelInfo
+		aliases []gptb2o.ModelAlias
+		want    string
+	}{
+		{name: "empty", want: "at least one model"},
+		{name: "missing id", models: []gptb2o.ModelInfo{{Name: "x"}}, want: "models[0]: id is required"},
+		{name: "duplicate", models: []gptb2o.ModelInfo{{ID: "a"}, {ID: "chatgpt/codex/a"}}, want: `models[1]: duplicate model "a"`},
+		{name: "unknown target", models: []gptb2o.ModelInfo{{ID: "a"}}, aliases: []gptb2o.ModelAlias{{Pattern: "x", Target: "b"}}, want: `aliases[0]: "x" targets unknown model "b"`},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := gptb2o.NewModelRegistry(tc.models, tc.aliases)
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Fatalf("NewModelRegistry() error = %v, want %q", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestPresetModels_UseBuiltinRegistry(t *testing.T) {
+	builtin := gptb2o.DefaultModelRegistry()
+	models := gptb2o.PresetModels()
+	if len(models) != len(builtin.Models()) || models[0].ID != gptb2o.DefaultModelFullID {
+		t.Fatalf("PresetModels() = %+v", models)
+	}
+	if !gptb2o.IsSupportedModelID(gptb2o.DefaultModelFullID) || gptb2o.IsSupportedModelID("gpt-6-preview") {
+		t.Fatalf("IsSupportedModelID should follow the builtin registry")
+	}
+	if id, ok := gptb2o.ResolveModelID("claude-sonnet-4-5"); !ok || id != gptb2o.DefaultModelID {
+		t.Fatalf("ResolveModelID(claude-sonnet-4-5) = %q, %v", id, ok)
+	}
+}
@@ -0,0 +1,36 @@
+package telemetry
+
+// gptb2o 创建的 span 名称。入站请求 span 按 HTTP 语义约定命名为 "POST /v1/messages" 等。
+const (
+	SpanChatModel      = "gptb2o.chat_model"
+	SpanBackendAttempt = "gptb2o.backend_attempt"
+	SpanSSEStream      = "gptb2o.sse_stream"
+)
+
+// 属性键。通用字段沿用 OpenTelemetry 语义约定（http.* / gen_ai.*），gptb2o 特有字段使用 gptb2o. 前缀。
+const (
+	AttrHTTPMethod      = "http.request.method"
+	AttrHTTPRoute       = "http.route"
+	AttrHTTPStatusCode  = "http.response.status_code"
+	AttrURLFull         = "url.full"
+	AttrModel           = "gen_ai.request.model"
+	AttrInputTokens     = "gen_ai.usage.input_tokens"
+	AttrOutputTokens    = "gen_ai.usage.output_tokens"
+	AttrReasoningTokens = "gptb2o.usage.reasoning_tokens"
+	AttrInteractionID   = "gptb2o.interaction_id"
+	AttrClientAPI       = "gptb2o.client_api"
+	AttrStream          = "gptb2o.stream"
+	AttrReasoningEffort = "gptb2o.reasoning_effort"
+	AttrAttempt         = "gptb2o.attempt"
+	AttrRetryReason     = "gptb2o.retry_reason"
+	AttrSSEEvents       = "gptb2o.sse_events"
+)
+
+// UsageAttributes 返回 token 用量属性，供 chat model 与 SSE stream span 共用。
+func UsageAttributes(input, output, reasoning int64) []Attribute {
+	return []Attribute{
+		Int64(AttrInputTokens, input),
+		Int64(AttrOutputTokens, output),
+		Int64(AttrReasoningTokens, reasoning),
+	}
+}
@@ -0,0 +1,415 @@
+package telemetry
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultServiceName   = "gptb2o"
+	defaultQueueSize     = 2048
+	defaultBatchSize     = 256
+	defaultFlushInterval = 5 * time.Second
+	exportTimeout        = 10 * time.Second
+	instrumentationScope = "github.com/LubyRuffy/gptb2o"
+)
+
+type TracerOptions struct {
+	// Endpoint 为 OTLP/HTTP collector 地址。只有 host:port 或根路径时自动补 /v1/traces，
+	// 与 OTEL_EXPORTER_OTLP_ENDPOINT 的语义一致；缺省 scheme 时使用 http。
+	Endpoint string
+	// ServiceName 写入 resource 的 service.name，默认 "gptb2o"。
+	ServiceName string
+	// Headers 随每次导出发送，例如 collector 的鉴权头。
+	Headers map[string]string
+	// HTTPClient 可选，nil 时使用带 10s 超时的 http.Client。
+	HTTPClient *http.Client
+	// FlushInterval 为批量导出间隔，默认 5s；积满 256 个 span 时会提前导出。
+	FlushInterval time.Duration
+}
+
+// Tracer 创建 span 并由后台 goroutine 批量导出到 OTLP/HTTP collector。
+// 导出不在请求路径上进行：队列满时丢弃并计数。nil *Tracer 表示关闭 tracing。
+type Tracer struct {
+	endpoint    string
+	serviceName string
+	headers     map[string]string
+	client      *http.Client
+	interval    time.Duration
+
+	queue     chan exportOp
+	dropped   atomic.Uint64
+	closed    atomic.Bool
+	done      chan struct{}
+	closeOnce sync.Once
+	worker    sync.WaitGroup
+}
+
+type exportOp struct {
+	span    *Span
+	flushed chan struct{}
+}
+
+func NewTracer(opts TracerOptions) (*Tracer, error) {
+	endpoint, err := otlpTracesURL(opts.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+	serviceName := strings.TrimSpace(opts.ServiceName)
+	if serviceName == "" {
+		serviceName = defaultServiceName
+	}
+	client := opts.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: exportTimeout}
+	}
+	interval := opts.FlushInterval
+	if interval <= 0 {
+		interval = defaultFlushInterval
+	}
+	t := &Tracer{
+		endpoint:    endpoint,
+		serviceName: serviceName,
+		headers:     opts.Headers,
+		client:      client,
+		interval:    interval,
+		queue:       make(chan exportOp, defaultQueueSize),
+		done:        make(chan struct{}),
+	}
+	t.worker.Add(1)
+	go t.exportLoop()
+	return t, nil
+}
+
+// otlpTracesURL 规范化 collector 地址。
+func otlpTracesURL(endpoint string) (string, error) {
+	endpoint = strings.TrimSpace(endpoint)
+	if endpoint == "" {
+		return "", fmt.Errorf("otlp endpoint is required")
+	}
+	if !strings.Contains(endpoint, "://") {
+		endpoint = "http://" + endpoint
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", fmt.Errorf("invalid otlp endpoint: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", fmt.Errorf("invalid otlp endpoint scheme: %q", u.Scheme)
+	}
+	if u.Host == "" {
+		return "", fmt.Errorf("invalid otlp endpoint: missing host")
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = "/v1/traces"
+	}
+	return u.String(), nil
+}
+
+// Endpoint 返回实际导出的 URL，用于启动日志。
+func (t *Tracer) Endpoint() string {
+	if t == nil {
+		return ""
+	}
+	return t.endpoint
+}
+
+func (t *Tracer) enqueue(span *Span) {
+	if t.closed.Load() {
+		t.dropped.Add(1)
+		return
+	}
+	select {
+	case t.queue <- exportOp{span: span}:
+	default:
+		if n := t.dropped.Add(1); n&(n-1) == 0 {
+			log.Printf("[gptb2o][telemetry] export queue full, dropped=%d", n)
+		}
+	}
+}
+
+func (t *Tracer) exportLoop() {
+	defer t.worker.Done()
+	ticker := time.NewTicker(t.interval)
+	defer ticker.Stop()
+
+	var batch []*Span
+	var flushes []chan struct{}
+	export := func() {
+		if len(batch) > 0 {
+			if err := t.export(batch); err != nil {
+				t.dropped.Add(uint64(len(batch)))
+				log.Printf("[gptb2o][telemetry] export failed: spans=%d err=%v", len(batch), err)
+			}
+			batch = batch[:0]
+		}
+		for _, ch := range flushes {
+			close(ch)
+		}
+		flushes = flushes[:0]
+	}
+	for {
+		select {
+		case op := <-t.queue:
+			if op.flushed != nil {
+				flushes = append(flushes, op.flushed)
+				export()
+				continue
+			}
+			batch = append(batch, op.span)
+			if len(batch) >= defaultBatchSize {
+				export()
+			}
+		case <-ticker.C:
+			export()
+		case <-t.done:
+			// 关闭时导出队列中剩余的 span 再退出。
+		drain:
+			for {
+				select {
+				case op := <-t.queue:
+					if op.flushed != nil {
+						flushes = append(flushes, op.flushed)
+					} else {
+						batch = append(batch, op.span)
+					}
+				default:
+					break drain
+				}
+			}
+			export()
+			return
+		}
+	}
+}
+
+// ForceFlush 阻塞到此前结束的 span 全部导出（或 ctx 到期）。
+func (t *Tracer) ForceFlush(ctx context.Context) error {
+	if t == nil || t.closed.Load() {
+		return nil
+	}
+	flushed := make(chan struct{})
+	select {
+	case t.queue <- exportOp{flushed: flushed}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case <-flushed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Shutdown 停止接收新 span，导出剩余 span 后返回；之后结束的 span 会被丢弃。
+func (t *Tracer) Shutdown(ctx context.Context) error {
+	if t == nil {
+		return nil
+	}
+	t.closeOnce.Do(func() {
+		t.closed.Store(true)
+		close(t.done)
+	})
+	finished := make(chan struct{})
+	go func() {
+		t.worker.Wait()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// DroppedSpans 返回因队列满、导出失败或已关闭而丢弃的 span 数。
+func (t *Tracer) DroppedSpans() uint64 {
+	if t == nil {
+		return 0
+	}
+	return t.dropped.Load()
+}
+
+func (t *Tracer) export(spans []*Span) error {
+	body, err := json.Marshal(t.encode(spans))
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), exportTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range t.headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<10))
+		return fmt.Errorf("collector returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(message)))
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return nil
+}
+
+// 以下类型对应 OTLP/HTTP 的 JSON 编码（ExportTraceServiceRequest）：
+// trace/span id 使用 hex，64 位整数使用十进制字符串。
+
+type otlpExportRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              SpanKind       `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Events            []otlpEvent    `json:"events,omitempty"`
+	Status            otlpStatus     `json:"status"`
+}
+
+type otlpEvent struct {
+	TimeUnixNano string         `json:"timeUnixNano"`
+	Name         string         `json:"name"`
+	Attributes   []otlpKeyValue `json:"attributes,omitempty"`
+}
+
+// otlpStatus.Code：0 unset、1 ok、2 error。
+type otlpStatus struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
+
+func (t *Tracer) encode(spans []*Span) otlpExportRequest {
+	out := make([]otlpSpan, 0, len(spans))
+	for _, span := range spans {
+		out = append(out, span.encode())
+	}
+	return otlpExportRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource:   otlpResource{Attributes: encodeAttributes([]Attribute{String("service.name", t.serviceName)})},
+		ScopeSpans: []otlpScopeSpans{{Scope: otlpScope{Name: instrumentationScope}, Spans: out}},
+	}}}
+}
+
+func (s *Span) encode() otlpSpan {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := otlpSpan{
+		TraceID:           s.sc.TraceID.String(),
+		SpanID:            s.sc.SpanID.String(),
+		Name:              s.name,
+		Kind:              s.kind,
+		StartTimeUnixNano: strconv.FormatInt(s.startAt.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(s.endAt.UnixNano(), 10),
+		Attributes:        encodeAttributes(s.attrs),
+	}
+	if s.parent.IsValid() {
+		out.ParentSpanID = hex.EncodeToString(s.parent[:])
+	}
+	for _, event := range s.events {
+		out.Events = append(out.Events, otlpEvent{
+			TimeUnixNano: strconv.FormatInt(event.at.UnixNano(), 10),
+			Name:         event.name,
+			Attributes:   encodeAttributes(event.attrs),
+		})
+	}
+	if s.statusError {
+		out.Status = otlpStatus{Code: 2, Message: s.statusMessage}
+	}
+	return out
+}
+
+// encodeAttributes 按首次出现的顺序输出，同名属性取最后一次设置的值。
+func encodeAttributes(attrs []Attribute) []otlpKeyValue {
+	if len(attrs) == 0 {
+		return nil
+	}
+	index := make(map[string]int, len(attrs))
+	out := make([]otlpKeyValue, 0, len(attrs))
+	for _, attr := range attrs {
+		value, ok := encodeValue(attr.Value)
+		if !ok {
+			continue
+		}
+		if i, seen := index[attr.Key]; seen {
+			out[i].Value = value
+			continue
+		}
+		index[attr.Key] = len(out)
+		out = append(out, otlpKeyValue{Key: attr.Key, Value: value})
+	}
+	return out
+}
+
+func encodeValue(v any) (otlpValue, bool) {
+	switch value := v.(type) {
+	case string:
+		return otlpValue{StringValue: &value}, true
+	case bool:
+		return otlpValue{BoolValue: &value}, true
+	case int:
+		s := strconv.Itoa(value)
+		return otlpValue{IntValue: &s}, true
+	case int64:
+		s := strconv.FormatInt(value, 10)
+		return otlpValue{IntValue: &s}, true
+	case float64:
+		return otlpValue{DoubleValue: &value}, true
+	default:
+		return otlpValue{}, false
+	}
+}
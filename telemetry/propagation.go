@@ -0,0 +1,73 @@
+package telemetry
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// TraceparentHeader 是 W3C Trace Context 的传播头。
+const TraceparentHeader = "traceparent"
+
+const traceFlagSampled = 0x01
+
+// ParseTraceparent 解析 W3C traceparent（version-traceid-parentid-flags）。
+// 未知的高版本按规范只取前四段；全零 id 与 ff 版本视为无效。
+func ParseTraceparent(value string) (SpanContext, error) {
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 {
+		return SpanContext{}, fmt.Errorf("invalid traceparent: %q", value)
+	}
+	version, traceID, spanID, flags := parts[0], parts[1], parts[2], parts[3]
+	if len(version) != 2 || version == "ff" || (version == "00" && len(parts) != 4) {
+		return SpanContext{}, fmt.Errorf("invalid traceparent version: %q", value)
+	}
+	var sc SpanContext
+	if err := decodeLowerHex(sc.TraceID[:], traceID); err != nil {
+		return SpanContext{}, fmt.Errorf("invalid traceparent trace-id: %w", err)
+	}
+	if err := decodeLowerHex(sc.SpanID[:], spanID); err != nil {
+		return SpanContext{}, fmt.Errorf("invalid traceparent parent-id: %w", err)
+	}
+	var flagBytes [1]byte
+	if err := decodeLowerHex(flagBytes[:], flags); err != nil {
+		return SpanContext{}, fmt.Errorf("invalid traceparent flags: %w", err)
+	}
+	if !sc.IsValid() {
+		return SpanContext{}, fmt.Errorf("invalid traceparent: all-zero id")
+	}
+	sc.Sampled = flagBytes[0]&traceFlagSampled != 0
+	return sc, nil
+}
+
+func decodeLowerHex(dst []byte, s string) error {
+	if len(s) != 2*len(dst) || strings.ToLower(s) != s {
+		return fmt.Errorf("want %d lowercase hex chars, got %q", 2*len(dst), s)
+	}
+	_, err := hex.Decode(dst, []byte(s))
+	return err
+}
+
+// FormatTraceparent 以 version 00 编码 SpanContext。
+func FormatTraceparent(sc SpanContext) string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return "00-" + sc.TraceID.String() + "-" + sc.SpanID.String() + "-" + flags
+}
+
+// Extract 从请求头读取 traceparent 作为远端父 span；缺失或格式错误时原样返回 ctx，由 Start 开启新 trace。
+func Extract(ctx context.Context, header http.Header) context.Context {
+	value := header.Get(TraceparentHeader)
+	if value == "" {
+		return ctx
+	}
+	sc, err := ParseTraceparent(value)
+	if err != nil {
+		return ctx
+	}
+	return ContextWithRemoteSpanContext(ctx, sc)
+}
@@ -0,0 +1,214 @@
+// Package telemetry 提供最小化的 OpenTelemetry 兼容 tracing：W3C traceparent 传播、
+// span 记录与 OTLP/HTTP（JSON 编码）批量导出。只覆盖 gptb2o 需要的部分，不依赖 otel SDK。
+package telemetry
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// SpanKind 与 OTLP 的 Span.SpanKind 取值一致。
+type SpanKind int
+
+const (
+	SpanKindInternal SpanKind = 1
+	SpanKindServer   SpanKind = 2
+	SpanKindClient   SpanKind = 3
+)
+
+type TraceID [16]byte
+
+func (id TraceID) String() string { return hex.EncodeToString(id[:]) }
+
+func (id TraceID) IsValid() bool { return id != TraceID{} }
+
+type SpanID [8]byte
+
+func (id SpanID) String() string { return hex.EncodeToString(id[:]) }
+
+func (id SpanID) IsValid() bool { return id != SpanID{} }
+
+// SpanContext 是跨进程传播的 span 标识。
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Sampled bool
+}
+
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID.IsValid() && sc.SpanID.IsValid()
+}
+
+// Attribute 是 span 属性；Value 支持 string、bool、int、int64 与 float64。
+type Attribute struct {
+	Key   string
+	Value any
+}
+
+func String(key, value string) Attribute { return Attribute{Key: key, Value: value} }
+
+func Bool(key string, value bool) Attribute { return Attribute{Key: key, Value: value} }
+
+func Int(key string, value int) Attribute { return Attribute{Key: key, Value: int64(value)} }
+
+func Int64(key string, value int64) Attribute { return Attribute{Key: key, Value: value} }
+
+func Float64(key string, value float64) Attribute { return Attribute{Key: key, Value: value} }
+
+type spanEvent struct {
+	name  string
+	at    time.Time
+	attrs []Attribute
+}
+
+// Span 记录一段操作。nil *Span 的方法均为空操作，未启用 tracing 时调用方无需判空。
+type Span struct {
+	tracer  *Tracer
+	name    string
+	kind    SpanKind
+	sc      SpanContext
+	parent  SpanID
+	startAt time.Time
+
+	mu            sync.Mutex
+	endAt         time.Time
+	attrs         []Attribute
+	events        []spanEvent
+	statusError   bool
+	statusMessage string
+	ended         bool
+}
+
+func (s *Span) SpanContext() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.sc
+}
+
+// SetAttributes 追加属性；同名属性以最后一次为准。
+func (s *Span) SetAttributes(attrs ...Attribute) {
+	if s == nil || !s.sc.Sampled {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attrs = append(s.attrs, attrs...)
+}
+
+func (s *Span) AddEvent(name string, attrs ...Attribute) {
+	if s == nil || !s.sc.Sampled {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, spanEvent{name: name, at: time.Now(), attrs: attrs})
+}
+
+// RecordError 把 span 状态置为 error 并记录错误信息；err 为 nil 时不做处理。
+func (s *Span) RecordError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.SetError(err.Error())
+}
+
+func (s *Span) SetError(message string) {
+	if s == nil || !s.sc.Sampled {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.statusError = true
+	s.statusMessage = message
+}
+
+// End 结束 span 并交给导出队列；重复调用只生效一次。
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.endAt = time.Now()
+	s.mu.Unlock()
+	if s.sc.Sampled {
+		s.tracer.enqueue(s)
+	}
+}
+
+type spanContextKey struct{}
+
+type remoteSpanContextKey struct{}
+
+// ContextWithSpan 把 span 设为 ctx 中的当前 span，后续 Start 以它为父 span。
+func ContextWithSpan(ctx context.Context, span *Span) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return context.WithValue(ctx, spanContextKey{}, span)
+}
+
+func SpanFromContext(ctx context.Context) *Span {
+	if ctx == nil {
+		return nil
+	}
+	span, _ := ctx.Value(spanContextKey{}).(*Span)
+	return span
+}
+
+// ContextWithRemoteSpanContext 记录从上游传入的父 span，通常由 Extract 调用。
+func ContextWithRemoteSpanContext(ctx context.Context, sc SpanContext) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return context.WithValue(ctx, remoteSpanContextKey{}, sc)
+}
+
+// parentFromContext 优先返回本进程内的当前 span，其次是上游传入的 span。
+func parentFromContext(ctx context.Context) (SpanContext, bool) {
+	if ctx == nil {
+		return SpanContext{}, false
+	}
+	if span := SpanFromContext(ctx); span != nil {
+		return span.sc, true
+	}
+	if sc, ok := ctx.Value(remoteSpanContextKey{}).(SpanContext); ok && sc.IsValid() {
+		return sc, true
+	}
+	return SpanContext{}, false
+}
+
+// Start 创建子 span 并返回携带它的 ctx。t 为 nil 时返回原 ctx 与 nil span。
+// 父 span 未采样时新 span 同样不采样，只用于继续传播 trace id。
+func (t *Tracer) Start(ctx context.Context, name string, kind SpanKind, attrs ...Attribute) (context.Context, *Span) {
+	if t == nil {
+		return ctx, nil
+	}
+	span := &Span{
+		tracer:  t,
+		name:    name,
+		kind:    kind,
+		startAt: time.Now(),
+	}
+	if parent, ok := parentFromContext(ctx); ok {
+		span.sc.TraceID = parent.TraceID
+		span.sc.Sampled = parent.Sampled
+		span.parent = parent.SpanID
+	} else {
+		_, _ = rand.Read(span.sc.TraceID[:])
+		span.sc.Sampled = true
+	}
+	_, _ = rand.Read(span.sc.SpanID[:])
+	if span.sc.Sampled {
+		span.attrs = append(span.attrs, attrs...)
+	}
+	return ContextWithSpan(ctx, span), span
+}
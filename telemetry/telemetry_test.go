@@ -0,0 +1,190 @@
+package telemetry
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// collectorStub 是进程内的 OTLP/HTTP collector，记录收到的请求体。
+type collectorStub struct {
+	mu       sync.Mutex
+	requests []otlpExportRequest
+	headers  []http.Header
+}
+
+func (c *collectorStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req otlpExportRequest
+	if r.URL.Path != "/v1/traces" || json.NewDecoder(r.Body).Decode(&req) != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	c.mu.Lock()
+	c.requests = append(c.requests, req)
+	c.headers = append(c.headers, r.Header.Clone())
+	c.mu.Unlock()
+	w.WriteHeader(http.StatusOK)
+}
+
+func (c *collectorStub) spans() map[string]otlpSpan {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	out := make(map[string]otlpSpan)
+	for _, req := range c.requests {
+		for _, rs := range req.ResourceSpans {
+			for _, ss := range rs.ScopeSpans {
+				for _, span := range ss.Spans {
+					out[span.Name] = span
+				}
+			}
+		}
+	}
+	return out
+}
+
+func attrValue(span otlpSpan, key string) any {
+	for _, kv := range span.Attributes {
+		if kv.Key != key {
+			continue
+		}
+		switch {
+		case kv.Value.StringValue != nil:
+			return *kv.Value.StringValue
+		case kv.Value.IntValue != nil:
+			return *kv.Value.IntValue
+		case kv.Value.BoolValue != nil:
+			return *kv.Value.BoolValue
+		case kv.Value.DoubleValue != nil:
+			return *kv.Value.DoubleValue
+		}
+	}
+	return nil
+}
+
+func TestTraceparent_RoundTrip(t *testing.T) {
+	t.Parallel()
+
+	sc, err := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	require.NoError(t, err)
+	require.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", sc.TraceID.String())
+	require.Equal(t, "00f067aa0ba902b7", sc.SpanID.String())
+	require.True(t, sc.Sampled)
+	require.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", FormatTraceparent(sc))
+
+	// 未来版本允许附加字段。
+	sc, err = ParseTraceparent("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00-extra")
+	require.NoError(t, err)
+	require.False(t, sc.Sampled)
+
+	for _, bad := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+	} {
+		_, err := ParseTraceparent(bad)
+		require.Error(t, err, bad)
+	}
+}
+
+func TestTracer_ExportsSpanTreeOverOTLPHTTP(t *testing.T) {
+	t.Parallel()
+
+	collector := &collectorStub{}
+	srv := httptest.NewServer(collector)
+	t.Cleanup(srv.Close)
+
+	tracer, err := NewTracer(TracerOptions{
+		Endpoint:    srv.URL,
+		ServiceName: "gptb2o-test",
+		Headers:     map[string]string{"X-Collector-Token": "secret"},
+	})
+	require.NoError(t, err)
+	require.Equal(t, srv.URL+"/v1/traces", tracer.Endpoint())
+
+	header := http.Header{}
+	header.Set(TraceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	ctx := Extract(context.Background(), header)
+
+	ctx, root := tracer.Start(ctx, "POST /v1/messages", SpanKindServer, String(AttrModel, "gpt-5.5"))
+	_, child := tracer.Start(ctx, SpanBackendAttempt, SpanKindClient, Int(AttrAttempt, 1))
+	child.RecordError(errors.New("backend 400"))
+	child.End()
+	root.AddEvent("retry", String(AttrRetryReason, "reasoning_effort"))
+	root.SetAttributes(UsageAttributes(11, 7, 3)...)
+	root.SetAttributes(String(AttrModel, "gpt-5.4"))
+	root.End()
+	root.End()
+
+	require.NoError(t, tracer.Shutdown(context.Background()))
+
+	spans := collector.spans()
+	require.Len(t, spans, 2)
+	rootSpan := spans["POST /v1/messages"]
+	childSpan := spans[SpanBackendAttempt]
+	require.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", rootSpan.TraceID)
+	require.Equal(t, "00f067aa0ba902b7", rootSpan.ParentSpanID)
+	require.Equal(t, SpanKindServer, rootSpan.Kind)
+	require.Equal(t, rootSpan.TraceID, childSpan.TraceID)
+	require.Equal(t, rootSpan.SpanID, childSpan.ParentSpanID)
+	require.Equal(t, "gpt-5.4", attrValue(rootSpan, AttrModel))
+	require.Equal(t, "11", attrValue(rootSpan, AttrInputTokens))
+	require.Equal(t, "3", attrValue(rootSpan, AttrReasoningTokens))
+	require.Len(t, rootSpan.Events, 1)
+	require.Equal(t, 2, childSpan.Status.Code)
+	require.Equal(t, "backend 400", childSpan.Status.Message)
+
+	collector.mu.Lock()
+	require.Equal(t, "secret", collector.headers[0].Get("X-Collector-Token"))
+	require.Equal(t, "application/json", collector.headers[0].Get("Content-Type"))
+	resource := collector.requests[0].ResourceSpans[0].Resource.Attributes
+	collector.mu.Unlock()
+	require.Equal(t, "service.name", resource[0].Key)
+	require.Equal(t, "gptb2o-test", *resource[0].Value.StringValue)
+}
+
+func TestTracer_UnsampledParentAndNilTracer(t *testing.T) {
+	t.Parallel()
+
+	collector := &collectorStub{}
+	srv := httptest.NewServer(collector)
+	t.Cleanup(srv.Close)
+
+	tracer, err := NewTracer(TracerOptions{Endpoint: srv.Listener.Addr().String()})
+	require.NoError(t, err)
+
+	header := http.Header{}
+	header.Set(TraceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	ctx, span := tracer.Start(Extract(context.Background(), header), "unsampled", SpanKindServer)
+	require.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", span.SpanContext().TraceID.String())
+	_, child := tracer.Start(ctx, "child", SpanKindInternal)
+	require.False(t, child.SpanContext().Sampled)
+	child.End()
+	span.End()
+	require.NoError(t, tracer.ForceFlush(context.Background()))
+	require.Empty(t, collector.spans())
+	require.NoError(t, tracer.Shutdown(context.Background()))
+
+	var nilTracer *Tracer
+	ctx, nilSpan := nilTracer.Start(context.Background(), "noop", SpanKindInternal)
+	require.Nil(t, nilSpan)
+	require.Nil(t, SpanFromContext(ctx))
+	nilSpan.SetAttributes(String("k", "v"))
+	nilSpan.RecordError(errors.New("ignored"))
+	nilSpan.End()
+	require.NoError(t, nilTracer.Shutdown(context.Background()))
+
+	_, err = NewTracer(TracerOptions{Endpoint: "ftp://collector"})
+	require.Error(t, err)
+	_, err = NewTracer(TracerOptions{})
+	require.Error(t, err)
+}
@@ -18,3 +18,21 @@ func InteractionIDFromContext(ctx context.Context) string {
 	value, _ := ctx.Value(interactionIDContextKey{}).(string)
 	return value
 }
+
+type replayOfContextKey struct{}
+
+// ContextWithReplayOf 标记请求是对某个已记录 interaction 的重放，WrapHTTP 会把它写入 interactions.replay_of。
+func ContextWithReplayOf(ctx context.Context, interactionID string) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return context.WithValue(ctx, replayOfContextKey{}, interactionID)
+}
+
+func ReplayOfFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	value, _ := ctx.Value(replayOfContextKey{}).(string)
+	return value
+}
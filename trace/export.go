@@ -0,0 +1,387 @@
+package trace
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// ExportFormat 为 Export 支持的输出格式。
+type ExportFormat string
+
+const (
+	// ExportHAR 输出 HAR 1.2：client 请求/响应与每次 backend 请求/响应各为一个 entry。
+	ExportHAR ExportFormat = "har"
+	// ExportJSONL 每行一个 interaction（结构同 NewInteractionJSON）。
+	ExportJSONL ExportFormat = "jsonl"
+	// ExportRecordings 每行一个 backend 请求/响应对（Recording），作为 ReplayTransport 的离线 fixture。
+	ExportRecordings ExportFormat = "recordings"
+)
+
+const (
+	scrubbedPlaceholder = "[SCRUBBED]"
+	// harPlaceholderOrigin 用于补全 client 侧只记录了 path 的 URL，HAR 要求绝对地址。
+	harPlaceholderOrigin = "http://gptb2o.local"
+	// harTimeLayout 固定毫秒位数，保证 startedDateTime 可按字符串排序。
+	harTimeLayout = "2006-01-02T15:04:05.000Z07:00"
+)
+
+// ExportOptions 控制导出时的脱敏方式。敏感头始终按 SanitizeHeaders 规则处理。
+type ExportOptions struct {
+	Format ExportFormat
+	// RedactHeaders 额外需要替换为 [REDACTED] 的头名，大小写不敏感。
+	RedactHeaders []string
+	// Scrub 中的正则在 body、URL、summary 与 error_summary 中匹配到的内容替换为 [SCRUBBED]。
+	Scrub []*regexp.Regexp
+	// OmitBodies 为 true 时丢弃全部 body，只保留元数据与 summary。
+	OmitBodies bool
+}
+
+// Export 将指定 interaction 按 opts.Format 写入 w；ids 中不存在的 interaction 返回错误。
+func (s *Store) Export(w io.Writer, ids []string, opts ExportOptions) error {
+	if s == nil || s.db == nil {
+		return fmt.Errorf("trace store is nil")
+	}
+	format := opts.Format
+	if format == "" {
+		format = ExportJSONL
+	}
+	if format != ExportHAR && format != ExportJSONL && format != ExportRecordings {
+		return fmt.Errorf("unsupported export format %q", format)
+	}
+
+	redactor := newExportRedactor(opts)
+	bw := bufio.NewWriter(w)
+	var entries []harEntry
+	for _, id := range ids {
+		interaction, events, err := s.GetInteraction(id)
+		if err != nil {
+			return fmt.Errorf("load interaction %s: %w", id, err)
+		}
+		interaction, events = redactor.apply(interaction, events)
+		if format == ExportHAR {
+			entries = append(entries, buildHAREntries(interaction, events)...)
+			continue
+		}
+		if format == ExportRecordings {
+			if err := WriteRecordings(bw, recordingsFromEvents(interaction.InteractionID, events)); err != nil {
+				return err
+			}
+			continue
+		}
+		line, err := json.Marshal(NewInteractionJSON(interaction, events))
+		if err != nil {
+			return err
+		}
+		if _, err := bw.Write(append(line, '\n')); err != nil {
+			return err
+		}
+	}
+	if format == ExportHAR {
+		if entries == nil {
+			entries = []harEntry{}
+		}
+		enc := json.NewEncoder(bw)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(harDocument{Log: harLog{
+			Version: "1.2",
+			Creator: harCreator{Name: "gptb2o", Version: "1"},
+			Entries: entries,
+		}}); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+type exportRedactor struct {
+	headers map[string]struct{}
+	scrub   []*regexp.Regexp
+	omit    bool
+}
+
+func newExportRedactor(opts ExportOptions) exportRedactor {
+	headers := make(map[string]struct{}, len(opts.RedactHeaders))
+	for _, name := range opts.RedactHeaders {
+		if name = strings.ToLower(strings.TrimSpace(name)); name != "" {
+			headers[name] = struct{}{}
+		}
+	}
+	return exportRedactor{headers: headers, scrub: opts.Scrub, omit: opts.OmitBodies}
+}
+
+func (r exportRedactor) text(s string) string {
+	for _, re := range r.scrub {
+		s = re.ReplaceAllString(s, scrubbedPlaceholder)
+	}
+	return s
+}
+
+func (r exportRedactor) apply(interaction Interaction, events []InteractionEvent) (Interaction, []InteractionEvent) {
+	interaction.Query = r.text(interaction.Query)
+	interaction.ErrorSummary = r.text(interaction.ErrorSummary)
+	out := make([]InteractionEvent, len(events))
+	for i, event := range events {
+		event.URL = r.text(event.URL)
+		event.Summary = r.text(event.Summary)
+		event.HeadersJSON = r.headersJSON(event.HeadersJSON)
+		if r.omit {
+			event.Body = ""
+		} else {
+			event.Body = r.text(event.Body)
+		}
+		out[i] = event
+	}
+	return interaction, out
+}
+
+// headersJSON 重新套用 SanitizeHeaders，覆盖旧版本写入或新增敏感头名之前的记录。
+func (r exportRedactor) headersJSON(raw string) string {
+	headers := parseHeadersJSON(raw)
+	if headers == nil {
+		return raw
+	}
+	sanitized := SanitizeHeaders(headers)
+	for key := range sanitized {
+		if _, ok := r.headers[strings.ToLower(key)]; ok {
+			sanitized.Set(key, "[REDACTED]")
+		}
+	}
+	data, err := json.Marshal(sanitized)
+	if err != nil {
+		return "{}"
+	}
+	return string(data)
+}
+
+func parseHeadersJSON(raw string) http.Header {
+	if strings.TrimSpace(raw) == "" {
+		return nil
+	}
+	var headers http.Header
+	if err := json.Unmarshal([]byte(raw), &headers); err != nil {
+		return nil
+	}
+	return headers
+}
+
+type harDocument struct {
+	Log harLog `json:"log"`
+}
+
+type harLog struct {
+	Version string     `json:"version"`
+	Creator harCreator `json:"creator"`
+	Entries []harEntry `json:"entries"`
+}
+
+type harCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type harEntry struct {
+	StartedDateTime string      `json:"startedDateTime"`
+	Time            int64       `json:"time"`
+	Request         harRequest  `json:"request"`
+	Response        harResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         harTimings  `json:"timings"`
+	InteractionID   string      `json:"_interactionId"`
+	Stage           string      `json:"_stage"`
+	Summary         string      `json:"_summary,omitempty"`
+}
+
+type harRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	QueryString []harNameValue `json:"queryString"`
+	PostData    *harPostData   `json:"postData,omitempty"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+	Truncated   bool           `json:"_bodyTruncated,omitempty"`
+}
+
+type harResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	Content     harContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+	Truncated   bool           `json:"_bodyTruncated,omitempty"`
+}
+
+type harNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type harPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+type harContent struct {
+	Size     int    `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+}
+
+type harTimings struct {
+	Send    int64 `json:"send"`
+	Wait    int64 `json:"wait"`
+	Receive int64 `json:"receive"`
+}
+
+// buildHAREntries 按 seq 配对请求与响应：client_request/client_response 一对，
+// backend_request 与随后最早未配对的 backend_response 一对；没有响应的请求以 status=0 输出。
+func buildHAREntries(interaction Interaction, events []InteractionEvent) []harEntry {
+	var entries []harEntry
+	var client *InteractionEvent
+	var backend []InteractionEvent
+	emit := func(req InteractionEvent, resp *InteractionEvent, stage string) {
+		entries = append(entries, newHAREntry(interaction, req, resp, stage))
+	}
+	for i := range events {
+		event := events[i]
+		switch event.Kind {
+		case EventClientRequest:
+			client = &event
+		case EventClientResponse:
+			if client != nil {
+				emit(*client, &event, "client")
+				client = nil
+			}
+		case EventBackendRequest:
+			backend = append(backend, event)
+		case EventBackendResponse:
+			if len(backend) > 0 {
+				emit(backend[0], &event, "backend")
+				backend = backend[1:]
+			}
+		}
+	}
+	for _, req := range backend {
+		emit(req, nil, "backend")
+	}
+	if client != nil {
+		emit(*client, nil, "client")
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].StartedDateTime < entries[j].StartedDateTime })
+	return entries
+}
+
+func newHAREntry(interaction Interaction, req InteractionEvent, resp *InteractionEvent, stage string) harEntry {
+	reqURL := req.URL
+	if reqURL == "" {
+		reqURL = req.Path
+	}
+	if !strings.Contains(reqURL, "://") {
+		reqURL = harPlaceholderOrigin + reqURL
+	}
+	entry := harEntry{
+		StartedDateTime: req.CreatedAt.UTC().Format(harTimeLayout),
+		InteractionID:   interaction.InteractionID,
+		Stage:           stage,
+		Request: harRequest{
+			Method:      req.Method,
+			URL:         reqURL,
+			HTTPVersion: "HTTP/1.1",
+			Cookies:     []harNameValue{},
+			Headers:     harHeaders(req.HeadersJSON),
+			QueryString: harQueryString(reqURL),
+			HeadersSize: -1,
+			BodySize:    len(req.Body),
+			Truncated:   req.BodyTruncated,
+		},
+		Response: harResponse{
+			HTTPVersion: "HTTP/1.1",
+			Cookies:     []harNameValue{},
+			Headers:     []harNameValue{},
+			HeadersSize: -1,
+			BodySize:    -1,
+		},
+		Timings: harTimings{Wait: -1},
+	}
+	if req.Body != "" {
+		entry.Request.PostData = &harPostData{MimeType: req.ContentType, Text: req.Body}
+	}
+	if resp == nil {
+		entry.Response.Content = harContent{MimeType: "x-unknown"}
+		return entry
+	}
+
+	entry.Summary = resp.Summary
+	entry.Time = resp.DurationMs
+	if stage == "client" && interaction.ClientTiming.FirstByteMs != nil {
+		entry.Timings.Wait = *interaction.ClientTiming.FirstByteMs
+	}
+	if stage == "backend" && interaction.BackendTiming.FirstByteMs != nil {
+		entry.Timings.Wait = *interaction.BackendTiming.FirstByteMs
+	}
+	if entry.Timings.Wait < 0 {
+		entry.Timings.Wait = resp.DurationMs
+	} else {
+		entry.Timings.Receive = max(resp.DurationMs-entry.Timings.Wait, 0)
+	}
+	mimeType := resp.ContentType
+	if mimeType == "" {
+		mimeType = "x-unknown"
+	}
+	entry.Response.Status = resp.StatusCode
+	entry.Response.StatusText = http.StatusText(resp.StatusCode)
+	entry.Response.Headers = harHeaders(resp.HeadersJSON)
+	entry.Response.Content = harContent{Size: len(resp.Body), MimeType: mimeType, Text: resp.Body}
+	entry.Response.BodySize = len(resp.Body)
+	entry.Response.Truncated = resp.BodyTruncated
+	return entry
+}
+
+func harHeaders(raw string) []harNameValue {
+	headers := parseHeadersJSON(raw)
+	out := make([]harNameValue, 0, len(headers))
+	keys := make([]string, 0, len(headers))
+	for key := range headers {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		for _, value := range headers[key] {
+			out = append(out, harNameValue{Name: key, Value: value})
+		}
+	}
+	return out
+}
+
+func harQueryString(rawURL string) []harNameValue {
+	out := []harNameValue{}
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return out
+	}
+	query := parsed.Query()
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		for _, value := range query[key] {
+			out = append(out, harNameValue{Name: key, Value: value})
+		}
+	}
+	return out
+}
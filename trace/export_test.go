@@ -0,0 +1,105 @@
+package trace
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func seedExportInteraction(t *testing.T, store *Store) {
+	t.Helper()
+	require.NoError(t, store.StartInteraction(Interaction{InteractionID: "ia_export", Method: http.MethodPost, Path: "/v1/messages", ClientAPI: "claude"}))
+	events := []InteractionEvent{
+		{Kind: EventClientRequest, Method: http.MethodPost, Path: "/v1/messages", URL: "/v1/messages?beta=true", ContentType: "application/json",
+			HeadersJSON: `{"Authorization":["Bearer sk-live"],"X-Team":["secret-team"]}`, Body: `{"messages":[{"role":"user","content":"my email is bob@example.com"}]}`},
+		{Kind: EventBackendRequest, Method: http.MethodPost, URL: "https://chatgpt.com/backend-api/codex/responses", ContentType: "application/json", Body: `{"input":"bob@example.com"}`},
+		{Kind: EventBackendResponse, StatusCode: http.StatusOK, ContentType: "text/event-stream", DurationMs: 40, Body: "event: response.completed\ndata: {\"type\":\"response.completed\",\"response\":{\"status\":\"completed\"}}\n\n"},
+		{Kind: EventClientResponse, StatusCode: http.StatusOK, ContentType: "text/event-stream", DurationMs: 50, Body: "event: message_stop\ndata: {\"type\":\"message_stop\"}\n\n"},
+	}
+	for _, event := range events {
+		event.InteractionID = "ia_export"
+		require.NoError(t, store.AppendEvent(event))
+	}
+	require.NoError(t, store.FinishInteraction("ia_export", http.StatusOK, ""))
+}
+
+func TestStore_Export_HARRedactsAndPairsEntries(t *testing.T) {
+	t.Parallel()
+
+	store, err := OpenStore(filepath.Join(t.TempDir(), "trace.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { require.NoError(t, store.Close()) })
+	seedExportInteraction(t, store)
+
+	var buf bytes.Buffer
+	require.NoError(t, store.Export(&buf, []string{"ia_export"}, ExportOptions{
+		Format:        ExportHAR,
+		RedactHeaders: []string{"x-team"},
+		Scrub:         []*regexp.Regexp{regexp.MustCompile(`[\w.]+@[\w.]+`)},
+	}))
+	out := buf.String()
+	require.NotContains(t, out, "sk-live")
+	require.NotContains(t, out, "secret-team")
+	require.NotContains(t, out, "bob@example.com")
+	require.Contains(t, out, scrubbedPlaceholder)
+
+	var har struct {
+		Log struct {
+			Version string `json:"version"`
+			Entries []struct {
+				Stage   string `json:"_stage"`
+				Request struct {
+					URL         string `json:"url"`
+					QueryString []struct {
+						Name string `json:"name"`
+					} `json:"queryString"`
+				} `json:"request"`
+				Response struct {
+					Status  int `json:"status"`
+					Content struct {
+						MimeType string `json:"mimeType"`
+					} `json:"content"`
+				} `json:"response"`
+			} `json:"entries"`
+		} `json:"log"`
+	}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &har))
+	require.Equal(t, "1.2", har.Log.Version)
+	require.Len(t, har.Log.Entries, 2)
+	require.Equal(t, "client", har.Log.Entries[0].Stage)
+	require.Equal(t, harPlaceholderOrigin+"/v1/messages?beta=true", har.Log.Entries[0].Request.URL)
+	require.Equal(t, "beta", har.Log.Entries[0].Request.QueryString[0].Name)
+	require.Equal(t, "backend", har.Log.Entries[1].Stage)
+	require.Equal(t, http.StatusOK, har.Log.Entries[1].Response.Status)
+	require.Equal(t, "text/event-stream", har.Log.Entries[1].Response.Content.MimeType)
+}
+
+func TestStore_Export_JSONLOmitBodies(t *testing.T) {
+	t.Parallel()
+
+	store, err := OpenStore(filepath.Join(t.TempDir(), "trace.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { require.NoError(t, store.Close()) })
+	seedExportInteraction(t, store)
+
+	var buf bytes.Buffer
+	require.NoError(t, store.Export(&buf, []string{"ia_export"}, ExportOptions{Format: ExportJSONL, OmitBodies: true}))
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 1)
+	var got InteractionJSON
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &got))
+	require.Equal(t, "ia_export", got.Interaction.InteractionID)
+	require.Len(t, got.Events, 4)
+	for _, event := range got.Events {
+		require.Empty(t, event.Body)
+	}
+	require.NotContains(t, buf.String(), "sk-live")
+
+	require.Error(t, store.Export(&buf, []string{"ia_missing"}, ExportOptions{}))
+}
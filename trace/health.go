@@ -0,0 +1,152 @@
+package trace
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"gorm.io/gorm"
+)
+
+// SinkStats 是 trace 存储的概况，供 /debug/info 展示。不适用的字段为 0。
+type SinkStats struct {
+	Kind          string `json:"kind"`
+	Interactions  int64  `json:"interactions"`
+	Events        int64  `json:"events"`
+	Bytes         int64  `json:"bytes"`
+	DroppedWrites uint64 `json:"dropped_writes"`
+}
+
+// HealthChecker 是 Sink 的可选扩展，内置 Sink 均已实现，供 /readyz 与 /debug/info 使用。
+type HealthChecker interface {
+	// CheckWritable 在存储已关闭或无法写入时返回错误。
+	CheckWritable(ctx context.Context) error
+	Stats() (SinkStats, error)
+}
+
+var (
+	_ HealthChecker = (*Store)(nil)
+	_ HealthChecker = (*JSONLSink)(nil)
+	_ HealthChecker = (*MemorySink)(nil)
+)
+
+var errSinkClosed = errors.New("trace sink is closed")
+
+// Sink 返回 Tracer 使用的存储；未配置时为 nil。
+func (t *Tracer) Sink() Sink {
+	if t == nil {
+		return nil
+	}
+	return t.sink
+}
+
+var errRollbackProbe = errors.New("rollback write probe")
+
+// CheckWritable 在事务内原样写回 user_version 再回滚，确认库文件可获得写锁且未被只读挂载。
+func (s *Store) CheckWritable(ctx context.Context) error {
+	if s == nil || s.db == nil || s.closed.Load() {
+		return errSinkClosed
+	}
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var version int64
+		if err := tx.Raw("PRAGMA user_version").Scan(&version).Error; err != nil {
+			return err
+		}
+		if err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", version)).Error; err != nil {
+			return err
+		}
+		return errRollbackProbe
+	})
+	if errors.Is(err, errRollbackProbe) {
+		return nil
+	}
+	return err
+}
+
+func (s *Store) Stats() (SinkStats, error) {
+	stats := SinkStats{Kind: "sqlite", DroppedWrites: s.DroppedWrites()}
+	if s == nil || s.db == nil {
+		return stats, errSinkClosed
+	}
+	if err := s.db.Model(&Interaction{}).Count(&stats.Interactions).Error; err != nil {
+		return stats, err
+	}
+	if err := s.db.Model(&InteractionEvent{}).Count(&stats.Events).Error; err != nil {
+		return stats, err
+	}
+	bytes, err := s.FileBytes()
+	if err != nil {
+		return stats, err
+	}
+	stats.Bytes = bytes
+	return stats, nil
+}
+
+// CheckWritable 确认 sink 未关闭，且当前文件仍在原路径上（没有被外部删除或移走）。
+func (s *JSONLSink) CheckWritable(ctx context.Context) error {
+	if s == nil {
+		return errSinkClosed
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		return errSinkClosed
+	}
+	opened, err := s.file.Stat()
+	if err != nil {
+		return fmt.Errorf("stat trace jsonl: %w", err)
+	}
+	current, err := os.Stat(s.opts.Path)
+	if err != nil {
+		return fmt.Errorf("stat trace jsonl: %w", err)
+	}
+	if !os.SameFile(opened, current) {
+		return fmt.Errorf("trace jsonl %s was replaced on disk", s.opts.Path)
+	}
+	return nil
+}
+
+// Stats 只统计文件大小；interaction 与事件数需要扫描文件，这里不计算。
+func (s *JSONLSink) Stats() (SinkStats, error) {
+	stats := SinkStats{Kind: "jsonl", DroppedWrites: s.DroppedWrites()}
+	if s == nil {
+		return stats, errSinkClosed
+	}
+	for n := 0; n <= s.opts.MaxFiles; n++ {
+		path := s.opts.Path
+		if n > 0 {
+			path = s.rotatedPath(n)
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return stats, err
+		}
+		stats.Bytes += info.Size()
+	}
+	return stats, nil
+}
+
+func (s *MemorySink) CheckWritable(ctx context.Context) error {
+	if s == nil {
+		return errSinkClosed
+	}
+	return nil
+}
+
+func (s *MemorySink) Stats() (SinkStats, error) {
+	stats := SinkStats{Kind: "memory", DroppedWrites: s.DroppedWrites()}
+	if s == nil {
+		return stats, errSinkClosed
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stats.Interactions = int64(len(s.order))
+	for _, item := range s.byID {
+		stats.Events += int64(len(item.events))
+	}
+	return stats, nil
+}
@@ -0,0 +1,54 @@
+package trace
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHealthChecker_BuiltinSinks(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	store, err := OpenStore(filepath.Join(dir, "trace.db"))
+	require.NoError(t, err)
+	jsonl, err := OpenJSONLSink(JSONLSinkOptions{Path: filepath.Join(dir, "trace.jsonl")})
+	require.NoError(t, err)
+	memory := NewMemorySink(10)
+
+	for _, sink := range []Sink{store, jsonl, memory} {
+		exerciseSink(t, sink)
+		checker, ok := sink.(HealthChecker)
+		require.True(t, ok)
+		require.NoError(t, checker.CheckWritable(context.Background()))
+
+		stats, err := checker.Stats()
+		require.NoError(t, err)
+		require.Positive(t, stats.Interactions+stats.Bytes, stats.Kind)
+	}
+
+	stats, err := store.Stats()
+	require.NoError(t, err)
+	require.Equal(t, SinkStats{Kind: "sqlite", Interactions: 1, Events: 2, Bytes: stats.Bytes}, stats)
+	// CheckWritable 的写入探测必须回滚，不能留下数据。
+	interactions, err := store.ListInteractions(InteractionFilter{})
+	require.NoError(t, err)
+	require.Len(t, interactions, 1)
+
+	stats, err = memory.Stats()
+	require.NoError(t, err)
+	require.Equal(t, SinkStats{Kind: "memory", Interactions: 1, Events: 2}, stats)
+
+	// 文件被外部移走后 jsonl sink 不再可写。
+	require.NoError(t, os.Rename(filepath.Join(dir, "trace.jsonl"), filepath.Join(dir, "moved.jsonl")))
+	require.Error(t, jsonl.CheckWritable(context.Background()))
+
+	require.NoError(t, store.Close())
+	require.NoError(t, jsonl.Close())
+	require.ErrorIs(t, store.CheckWritable(context.Background()), errSinkClosed)
+	require.ErrorIs(t, jsonl.CheckWritable(context.Background()), errSinkClosed)
+	require.Nil(t, (*Tracer)(nil).Sink())
+}
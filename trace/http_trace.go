@@ -9,6 +9,7 @@ import (
 	"log"
 	"net"
 	"net/http"
+	"reflect"
 	"strconv"
 	"strings"
 	"time"
@@ -24,12 +25,16 @@ type TracerOptions struct {
 }
 
 type Tracer struct {
-	store        *Store
+	sink         Sink
 	maxBodyBytes int
 	logger       *log.Logger
 }
 
-func NewTracer(store *Store, opts TracerOptions) *Tracer {
+// NewTracer 创建写入 sink 的 Tracer；sink 为 nil 时 WrapHTTP / WrapTransport 直接透传。
+func NewTracer(sink Sink, opts TracerOptions) *Tracer {
+	if isNilSink(sink) {
+		sink = nil
+	}
 	maxBodyBytes := opts.MaxBodyBytes
 	if maxBodyBytes <= 0 {
 		maxBodyBytes = defaultMaxBodyBytes
@@ -39,19 +44,32 @@ func NewTracer(store *Store, opts TracerOptions) *Tracer {
 		logger = log.Default()
 	}
 	return &Tracer{
-		store:        store,
+		sink:         sink,
 		maxBodyBytes: maxBodyBytes,
 		logger:       logger,
 	}
 }
 
+// isNilSink 识别 (*Store)(nil) 之类的 typed nil，避免它们被当作可用的 Sink。
+func isNilSink(sink Sink) bool {
+	if sink == nil {
+		return true
+	}
+	v := reflect.ValueOf(sink)
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Map, reflect.Slice, reflect.Func, reflect.Chan, reflect.Interface:
+		return v.IsNil()
+	}
+	return false
+}
+
 func (t *Tracer) WrapHTTP(next http.Handler) http.Handler {
 	if next == nil {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, "handler is nil", http.StatusInternalServerError)
 		})
 	}
-	if t == nil || t.store == nil {
+	if t == nil || t.sink == nil {
 		return next
 	}
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -60,7 +78,7 @@ func (t *Tracer) WrapHTTP(next http.Handler) http.Handler {
 		bodyBytes := readAndReplaceRequestBody(r)
 		model, stream := extractModelAndStream(bodyBytes)
 
-		_ = t.store.StartInteraction(Interaction{
+		t.sink.StartInteractionAsync(Interaction{
 			InteractionID: interactionID,
 			Method:        r.Method,
 			Path:          r.URL.Path,
@@ -69,10 +87,11 @@ func (t *Tracer) WrapHTTP(next http.Handler) http.Handler {
 			Model:         model,
 			Stream:        stream,
 			StartedAt:     startedAt,
+			ReplayOf:      ReplayOfFromContext(r.Context()),
 		})
 
 		requestBody, requestTruncated := TruncateBody(bodyBytes, t.maxBodyBytes)
-		_ = t.store.AppendEvent(InteractionEvent{
+		t.sink.AppendEventAsync(InteractionEvent{
 			InteractionID: interactionID,
 			Kind:          EventClientRequest,
 			Method:        r.Method,
@@ -90,13 +109,13 @@ func (t *Tracer) WrapHTTP(next http.Handler) http.Handler {
 		ctx := ContextWithInteractionID(r.Context(), interactionID)
 		r = r.WithContext(ctx)
 
-		capture := newResponseCaptureWriter(w, t.maxBodyBytes)
+		capture := newResponseCaptureWriter(w, t.maxBodyBytes, startedAt)
 		capture.Header().Set(InteractionIDHeader, interactionID)
 		next.ServeHTTP(capture, r)
 
 		responseHeaders := capture.Header().Clone()
 		responseBody, responseTruncated := capture.body()
-		_ = t.store.AppendEvent(InteractionEvent{
+		t.sink.AppendEventAsync(InteractionEvent{
 			InteractionID: interactionID,
 			Kind:          EventClientResponse,
 			Method:        r.Method,
@@ -110,7 +129,8 @@ func (t *Tracer) WrapHTTP(next http.Handler) http.Handler {
 			Summary:       summarizeResponse("client response", capture.StatusCode(), len(responseBody), responseTruncated),
 			DurationMs:    time.Since(startedAt).Milliseconds(),
 		})
-		_ = t.store.FinishInteraction(interactionID, capture.StatusCode(), summarizeResponseError(responseHeaders.Get("Content-Type"), capture.StatusCode(), responseBody))
+		t.sink.SetClientTimingAsync(interactionID, capture.timing())
+		t.sink.FinishInteractionAsync(interactionID, capture.StatusCode(), summarizeResponseError(responseHeaders.Get("Content-Type"), capture.StatusCode(), responseBody))
 		t.logf("interaction_id=%s stage=%s status=%d duration_ms=%d", interactionID, EventClientResponse, capture.StatusCode(), time.Since(startedAt).Milliseconds())
 	})
 }
@@ -199,16 +219,22 @@ func summarizeResponseError(contentType string, statusCode int, body string) str
 	return fmt.Sprintf("http %d: %s", statusCode, firstLine)
 }
 
+// extractSSEErrorSummary 从流式响应中提取第一个错误：Claude / Responses 的 `event: error`
+// （error 对象或顶层 code/message），以及 chat.completions 流中不带 event 行的 error chunk。
 func extractSSEErrorSummary(body string) string {
 	lines := strings.Split(body, "\n")
 	var currentEvent string
 	for _, line := range lines {
 		line = strings.TrimRight(line, "\r")
+		if line == "" {
+			currentEvent = ""
+			continue
+		}
 		if strings.HasPrefix(line, "event: ") {
 			currentEvent = strings.TrimSpace(strings.TrimPrefix(line, "event: "))
 			continue
 		}
-		if currentEvent != "error" || !strings.HasPrefix(line, "data: ") {
+		if (currentEvent != "error" && currentEvent != "") || !strings.HasPrefix(line, "data: ") {
 			continue
 		}
 		payload := strings.TrimSpace(strings.TrimPrefix(line, "data: "))
@@ -216,8 +242,10 @@ func extractSSEErrorSummary(body string) string {
 			continue
 		}
 		var envelope struct {
-			Type  string `json:"type"`
-			Error struct {
+			Type    string `json:"type"`
+			Code    string `json:"code"`
+			Message string `json:"message"`
+			Error   *struct {
 				Type    string `json:"type"`
 				Message string `json:"message"`
 			} `json:"error"`
@@ -225,8 +253,15 @@ func extractSSEErrorSummary(body string) string {
 		if err := json.Unmarshal([]byte(payload), &envelope); err != nil {
 			continue
 		}
-		msg := strings.TrimSpace(envelope.Error.Message)
-		errType := strings.TrimSpace(envelope.Error.Type)
+		var errType, msg string
+		switch {
+		case envelope.Error != nil:
+			errType, msg = strings.TrimSpace(envelope.Error.Type), strings.TrimSpace(envelope.Error.Message)
+		case currentEvent == "error":
+			errType, msg = strings.TrimSpace(envelope.Code), strings.TrimSpace(envelope.Message)
+		default:
+			continue
+		}
 		switch {
 		case errType != "" && msg != "":
 			return errType + ": " + msg
@@ -303,15 +338,18 @@ type responseCaptureWriter struct {
 	statusCode  int
 	wroteHeader bool
 	bodyBuffer  limitedBuffer
+	startedAt   time.Time
+	timer       *StreamTimer
 }
 
-func newResponseCaptureWriter(w http.ResponseWriter, maxBodyBytes int) *responseCaptureWriter {
+func newResponseCaptureWriter(w http.ResponseWriter, maxBodyBytes int, startedAt time.Time) *responseCaptureWriter {
 	return &responseCaptureWriter{
 		ResponseWriter: w,
 		statusCode:     http.StatusOK,
 		bodyBuffer: limitedBuffer{
 			maxBytes: maxBodyBytes,
 		},
+		startedAt: startedAt,
 	}
 }
 
@@ -333,6 +371,11 @@ func (w *responseCaptureWriter) Write(p []byte) (int, error) {
 		w.WriteHeader(http.StatusOK)
 	}
 	w.bodyBuffer.Write(p)
+	if w.timer == nil {
+		// Content-Type 在首次 Write 时才确定是否为 SSE。
+		w.timer = NewStreamTimer(w.startedAt, w.Header().Get("Content-Type"))
+	}
+	w.timer.Observe(p, time.Now())
 	return w.ResponseWriter.Write(p)
 }
 
@@ -358,3 +401,10 @@ func (w *responseCaptureWriter) StatusCode() int {
 func (w *responseCaptureWriter) body() (string, bool) {
 	return w.bodyBuffer.String()
 }
+
+func (w *responseCaptureWriter) timing() StreamTiming {
+	if w.timer == nil {
+		return StreamTiming{}
+	}
+	return w.timer.Timing()
+}
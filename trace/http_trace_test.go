@@ -35,6 +35,7 @@ func TestTracer_WrapHTTP_RecordsClientRequestAndResponse(t *testing.T) {
 	interactionID := w.Header().Get("X-GPTB2O-Interaction-ID")
 	require.NotEmpty(t, interactionID)
 
+	store.Flush()
 	got, events, err := store.GetInteraction(interactionID)
 	require.NoError(t, err)
 	require.Equal(t, http.StatusOK, got.StatusCode)
@@ -72,12 +73,19 @@ func TestTracer_WrapHTTP_CapturesStreamBody(t *testing.T) {
 	interactionID := w.Header().Get("X-GPTB2O-Interaction-ID")
 	require.NotEmpty(t, interactionID)
 
+	store.Flush()
 	_, events, err := store.GetInteraction(interactionID)
 	require.NoError(t, err)
 	require.Len(t, events, 2)
 	require.Equal(t, EventClientResponse, events[1].Kind)
 	require.Equal(t, "text/event-stream", events[1].ContentType)
 	require.Contains(t, events[1].Body, "event: message_start")
+
+	got, _, err := store.GetInteraction(interactionID)
+	require.NoError(t, err)
+	require.NotNil(t, got.ClientTiming.FirstByteMs)
+	require.Nil(t, got.ClientTiming.FirstTokenMs)
+	require.Equal(t, 1, got.ClientTiming.SSEEvents)
 }
 
 func TestTracer_WrapHTTP_SSEErrorSetsInteractionErrorSummary(t *testing.T) {
@@ -104,6 +112,7 @@ func TestTracer_WrapHTTP_SSEErrorSetsInteractionErrorSummary(t *testing.T) {
 	interactionID := w.Header().Get("X-GPTB2O-Interaction-ID")
 	require.NotEmpty(t, interactionID)
 
+	store.Flush()
 	got, events, err := store.GetInteraction(interactionID)
 	require.NoError(t, err)
 	require.Equal(t, "api_error: backend recv down", got.ErrorSummary)
@@ -111,3 +120,17 @@ func TestTracer_WrapHTTP_SSEErrorSetsInteractionErrorSummary(t *testing.T) {
 	require.Equal(t, EventClientResponse, events[1].Kind)
 	require.Contains(t, events[1].Body, "event: error")
 }
+
+func TestExtractSSEErrorSummary_ResponsesAndChatErrors(t *testing.T) {
+	t.Parallel()
+
+	responses := "event: response.created\ndata: {\"type\":\"response.created\"}\n\n" +
+		"event: error\ndata: {\"type\":\"error\",\"code\":\"backend_idle_timeout\",\"message\":\"backend stream idle timeout: no stream data for 1s\"}\n\n"
+	require.Equal(t, "backend_idle_timeout: backend stream idle timeout: no stream data for 1s", extractSSEErrorSummary(responses))
+
+	chat := "data: {\"id\":\"chatcmpl-1\",\"choices\":[]}\n\n" +
+		"data: {\"error\":{\"message\":\"backend first event timeout: no stream data within 1s\",\"type\":\"timeout_error\"}}\n\n"
+	require.Equal(t, "timeout_error: backend first event timeout: no stream data within 1s", extractSSEErrorSummary(chat))
+
+	require.Empty(t, extractSSEErrorSummary("event: message_start\ndata: {\"type\":\"message_start\",\"message\":\"x\"}\n\n"))
+}
@@ -0,0 +1,382 @@
+package trace
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultJSONLMaxBytes = 100 << 20
+	defaultJSONLMaxFiles = 5
+	jsonlFlushInterval   = time.Second
+)
+
+// JSONL 记录类型，每行一个 jsonlRecord，供 Filebeat / Vector 等日志采集器直接读取。
+const (
+	jsonlRecordStart  = "interaction_started"
+	jsonlRecordEvent  = "event"
+	jsonlRecordFinish = "interaction_finished"
+	jsonlRecordTiming = "timing"
+)
+
+type jsonlRecord struct {
+	Type        string            `json:"type"`
+	Time        time.Time         `json:"time"`
+	Interaction *Interaction      `json:"interaction,omitempty"`
+	Event       *InteractionEvent `json:"event,omitempty"`
+
+	// 以下字段用于 interaction_finished / timing 记录。
+	InteractionID string        `json:"interaction_id,omitempty"`
+	StatusCode    int           `json:"status_code,omitempty"`
+	ErrorSummary  string        `json:"error_summary,omitempty"`
+	Side          string        `json:"side,omitempty"`
+	Timing        *StreamTiming `json:"timing,omitempty"`
+}
+
+type JSONLSinkOptions struct {
+	// Path 为当前写入的文件；滚动后的历史文件依次为 Path.1（最新）… Path.N。
+	Path string
+	// MaxBytes 为单个文件的大小上限，默认 100 MiB。
+	MaxBytes int64
+	// MaxFiles 为保留的历史文件数，默认 5；超出的最旧文件会被删除。
+	MaxFiles int
+}
+
+// JSONLSink 把 trace 以追加方式写入按大小滚动的 JSONL 文件。写入经缓冲后每秒落盘一次；
+// GetInteraction / ListInteractions 通过扫描当前与历史文件重建，只适合排障时偶尔调用。
+type JSONLSink struct {
+	opts JSONLSinkOptions
+	seqs *seqAllocator
+
+	mu   sync.Mutex
+	file *os.File
+	buf  *bufio.Writer
+	size int64
+
+	dropped   atomic.Uint64
+	closeOnce sync.Once
+	done      chan struct{}
+	flusher   sync.WaitGroup
+}
+
+func OpenJSONLSink(opts JSONLSinkOptions) (*JSONLSink, error) {
+	opts.Path = strings.TrimSpace(opts.Path)
+	if opts.Path == "" {
+		return nil, fmt.Errorf("trace jsonl path is required")
+	}
+	if opts.MaxBytes <= 0 {
+		opts.MaxBytes = defaultJSONLMaxBytes
+	}
+	if opts.MaxFiles <= 0 {
+		opts.MaxFiles = defaultJSONLMaxFiles
+	}
+	if err := os.MkdirAll(filepath.Dir(opts.Path), 0o755); err != nil {
+		return nil, fmt.Errorf("create trace jsonl dir: %w", err)
+	}
+	s := &JSONLSink{opts: opts, seqs: newSeqAllocator(nil), done: make(chan struct{})}
+	if err := s.openFile(); err != nil {
+		return nil, err
+	}
+	s.flusher.Add(1)
+	go s.flushLoop()
+	return s, nil
+}
+
+func (s *JSONLSink) openFile() error {
+	file, err := os.OpenFile(s.opts.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("open trace jsonl: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return fmt.Errorf("stat trace jsonl: %w", err)
+	}
+	s.file = file
+	s.buf = bufio.NewWriterSize(file, 64<<10)
+	s.size = info.Size()
+	return nil
+}
+
+func (s *JSONLSink) flushLoop() {
+	defer s.flusher.Done()
+	ticker := time.NewTicker(jsonlFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.Flush()
+		case <-s.done:
+			return
+		}
+	}
+}
+
+func (s *JSONLSink) write(record jsonlRecord) {
+	if s == nil {
+		return
+	}
+	record.Time = time.Now()
+	line, err := json.Marshal(record)
+	if err != nil {
+		s.dropped.Add(1)
+		return
+	}
+	line = append(line, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		s.dropped.Add(1)
+		return
+	}
+	if s.size > 0 && s.size+int64(len(line)) > s.opts.MaxBytes {
+		if err := s.rotate(); err != nil {
+			s.dropped.Add(1)
+			log.Printf("[gptb2o][trace] rotate jsonl failed: %v", err)
+			return
+		}
+	}
+	n, err := s.buf.Write(line)
+	s.size += int64(n)
+	if err != nil {
+		s.dropped.Add(1)
+	}
+}
+
+// rotate 把当前文件改名为 Path.1，已有的历史文件依次后移，超过 MaxFiles 的删除。调用方持有 mu。
+func (s *JSONLSink) rotate() error {
+	if err := s.buf.Flush(); err != nil {
+		return err
+	}
+	if err := s.file.Close(); err != nil {
+		return err
+	}
+	s.file = nil
+	_ = os.Remove(s.rotatedPath(s.opts.MaxFiles))
+	for i := s.opts.MaxFiles - 1; i >= 1; i-- {
+		if err := os.Rename(s.rotatedPath(i), s.rotatedPath(i+1)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	if err := os.Rename(s.opts.Path, s.rotatedPath(1)); err != nil {
+		return err
+	}
+	return s.openFile()
+}
+
+func (s *JSONLSink) rotatedPath(n int) string {
+	return fmt.Sprintf("%s.%d", s.opts.Path, n)
+}
+
+func (s *JSONLSink) StartInteractionAsync(interaction Interaction) {
+	if s == nil || strings.TrimSpace(interaction.InteractionID) == "" {
+		return
+	}
+	if interaction.StartedAt.IsZero() {
+		interaction.StartedAt = time.Now()
+	}
+	s.seqs.start(interaction.InteractionID)
+	s.write(jsonlRecord{Type: jsonlRecordStart, Interaction: &interaction})
+}
+
+func (s *JSONLSink) AppendEventAsync(event InteractionEvent) {
+	if s == nil || strings.TrimSpace(event.InteractionID) == "" || event.Kind == "" {
+		return
+	}
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now()
+	}
+	if event.Seq <= 0 {
+		event.Seq, _ = s.seqs.next(event.InteractionID)
+	}
+	s.write(jsonlRecord{Type: jsonlRecordEvent, Event: &event})
+}
+
+func (s *JSONLSink) FinishInteractionAsync(interactionID string, statusCode int, errorSummary string) {
+	interactionID = strings.TrimSpace(interactionID)
+	if s == nil || interactionID == "" {
+		return
+	}
+	s.seqs.retire(interactionID)
+	s.write(jsonlRecord{Type: jsonlRecordFinish, InteractionID: interactionID, StatusCode: statusCode, ErrorSummary: errorSummary})
+}
+
+func (s *JSONLSink) SetClientTimingAsync(interactionID string, timing StreamTiming) {
+	s.writeTiming(interactionID, "client", timing)
+}
+
+func (s *JSONLSink) SetBackendTimingAsync(interactionID string, timing StreamTiming) {
+	s.writeTiming(interactionID, "backend", timing)
+}
+
+func (s *JSONLSink) writeTiming(interactionID string, side string, timing StreamTiming) {
+	interactionID = strings.TrimSpace(interactionID)
+	if s == nil || interactionID == "" {
+		return
+	}
+	s.write(jsonlRecord{Type: jsonlRecordTiming, InteractionID: interactionID, Side: side, Timing: &timing})
+}
+
+func (s *JSONLSink) GetInteraction(interactionID string) (Interaction, []InteractionEvent, error) {
+	interactionID = strings.TrimSpace(interactionID)
+	if s == nil || interactionID == "" {
+		return Interaction{}, nil, ErrInteractionNotFound
+	}
+	all, err := s.load(interactionID)
+	if err != nil {
+		return Interaction{}, nil, err
+	}
+	// 预筛选只按子串匹配，replay_of 等字段引用该 id 的其他 interaction 也可能被读入。
+	for _, item := range all {
+		if item.interaction.InteractionID == interactionID {
+			return item.interaction, sortedEvents(item.events), nil
+		}
+	}
+	return Interaction{}, nil, ErrInteractionNotFound
+}
+
+func (s *JSONLSink) ListInteractions(filter InteractionFilter) ([]Interaction, error) {
+	if s == nil {
+		return nil, fmt.Errorf("trace sink is nil")
+	}
+	all, err := s.load("")
+	if err != nil {
+		return nil, err
+	}
+	return listTraced(all, filter), nil
+}
+
+// load 从最旧的历史文件读到当前文件，重建 interaction；onlyID 非空时跳过不含该 id 的行。
+// 开始记录已被滚动删除的 interaction 会被忽略。
+func (s *JSONLSink) load(onlyID string) ([]*tracedInteraction, error) {
+	s.Flush()
+	byID := make(map[string]*tracedInteraction)
+	var order []string
+	apply := func(record jsonlRecord) {
+		switch record.Type {
+		case jsonlRecordStart:
+			if record.Interaction == nil {
+				return
+			}
+			id := record.Interaction.InteractionID
+			if _, ok := byID[id]; !ok {
+				byID[id] = &tracedInteraction{interaction: *record.Interaction}
+				order = append(order, id)
+			}
+		case jsonlRecordEvent:
+			if record.Event == nil {
+				return
+			}
+			if item, ok := byID[record.Event.InteractionID]; ok {
+				item.events = append(item.events, *record.Event)
+			}
+		case jsonlRecordFinish:
+			if item, ok := byID[record.InteractionID]; ok {
+				finishedAt := record.Time
+				item.interaction.StatusCode = record.StatusCode
+				item.interaction.ErrorSummary = record.ErrorSummary
+				item.interaction.FinishedAt = &finishedAt
+			}
+		case jsonlRecordTiming:
+			if item, ok := byID[record.InteractionID]; ok && record.Timing != nil {
+				applyTiming(&item.interaction, record.Side+"_", *record.Timing)
+			}
+		}
+	}
+
+	for i := s.opts.MaxFiles; i >= 0; i-- {
+		path := s.opts.Path
+		if i > 0 {
+			path = s.rotatedPath(i)
+		}
+		if err := scanJSONLFile(path, onlyID, apply); err != nil {
+			return nil, err
+		}
+	}
+	out := make([]*tracedInteraction, 0, len(order))
+	for _, id := range order {
+		out = append(out, byID[id])
+	}
+	return out, nil
+}
+
+func scanJSONLFile(path string, onlyID string, apply func(jsonlRecord)) error {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer func() { _ = file.Close() }()
+
+	reader := bufio.NewReaderSize(file, 64<<10)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 && (onlyID == "" || strings.Contains(string(line), onlyID)) {
+			var record jsonlRecord
+			// 进程被杀时最后一行可能不完整，跳过无法解析的行。
+			if json.Unmarshal(line, &record) == nil {
+				apply(record)
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Flush 把缓冲区写入文件，使此前的写入对读取与外部采集器可见。
+func (s *JSONLSink) Flush() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.buf != nil {
+		if err := s.buf.Flush(); err != nil {
+			log.Printf("[gptb2o][trace] flush jsonl failed: %v", err)
+		}
+	}
+}
+
+func (s *JSONLSink) Close() error {
+	if s == nil {
+		return nil
+	}
+	var err error
+	s.closeOnce.Do(func() {
+		close(s.done)
+		s.flusher.Wait()
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.file == nil {
+			return
+		}
+		err = errors.Join(s.buf.Flush(), s.file.Close())
+		s.file, s.buf = nil, nil
+	})
+	return err
+}
+
+// DroppedWrites 返回编码、滚动或写文件失败而丢弃的记录数。
+func (s *JSONLSink) DroppedWrites() uint64 {
+	if s == nil {
+		return 0
+	}
+	return s.dropped.Load()
+}
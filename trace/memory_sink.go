@@ -0,0 +1,153 @@
+package trace
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const defaultMemorySinkInteractions = 1000
+
+// MemorySink 是只保存在内存中的环形缓冲 Sink，超出容量时淘汰最早开始的 interaction。
+// 适合测试以及不希望写盘的部署；进程退出后数据即丢失。
+type MemorySink struct {
+	capacity int
+	seqs     *seqAllocator
+
+	mu    sync.Mutex
+	byID  map[string]*tracedInteraction
+	order []string
+	// dropped 统计因 interaction 已被淘汰或从未开始而丢弃的写入。
+	dropped atomic.Uint64
+}
+
+// NewMemorySink 创建最多保留 capacity 条 interaction 的 MemorySink；capacity <= 0 时使用 1000。
+func NewMemorySink(capacity int) *MemorySink {
+	if capacity <= 0 {
+		capacity = defaultMemorySinkInteractions
+	}
+	return &MemorySink{
+		capacity: capacity,
+		seqs:     newSeqAllocator(nil),
+		byID:     make(map[string]*tracedInteraction),
+	}
+}
+
+func (s *MemorySink) StartInteractionAsync(interaction Interaction) {
+	if s == nil || strings.TrimSpace(interaction.InteractionID) == "" {
+		return
+	}
+	if interaction.StartedAt.IsZero() {
+		interaction.StartedAt = time.Now()
+	}
+	s.seqs.start(interaction.InteractionID)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.byID[interaction.InteractionID]; ok {
+		return
+	}
+	if len(s.order) >= s.capacity {
+		evicted := s.order[0]
+		s.order = s.order[1:]
+		delete(s.byID, evicted)
+	}
+	s.byID[interaction.InteractionID] = &tracedInteraction{interaction: interaction}
+	s.order = append(s.order, interaction.InteractionID)
+}
+
+func (s *MemorySink) AppendEventAsync(event InteractionEvent) {
+	if s == nil || strings.TrimSpace(event.InteractionID) == "" || event.Kind == "" {
+		return
+	}
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now()
+	}
+	if event.Seq <= 0 {
+		// lookup 为 nil，next 不会失败。
+		event.Seq, _ = s.seqs.next(event.InteractionID)
+	}
+	s.update(event.InteractionID, func(item *tracedInteraction) {
+		item.events = append(item.events, event)
+	})
+}
+
+func (s *MemorySink) FinishInteractionAsync(interactionID string, statusCode int, errorSummary string) {
+	if s == nil {
+		return
+	}
+	s.seqs.retire(interactionID)
+	finishedAt := time.Now()
+	s.update(interactionID, func(item *tracedInteraction) {
+		item.interaction.StatusCode = statusCode
+		item.interaction.ErrorSummary = errorSummary
+		item.interaction.FinishedAt = &finishedAt
+		item.interaction.UpdatedAt = finishedAt
+	})
+}
+
+func (s *MemorySink) SetClientTimingAsync(interactionID string, timing StreamTiming) {
+	s.update(interactionID, func(item *tracedInteraction) {
+		applyTiming(&item.interaction, "client_", timing)
+	})
+}
+
+func (s *MemorySink) SetBackendTimingAsync(interactionID string, timing StreamTiming) {
+	s.update(interactionID, func(item *tracedInteraction) {
+		applyTiming(&item.interaction, "backend_", timing)
+	})
+}
+
+func (s *MemorySink) update(interactionID string, fn func(item *tracedInteraction)) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	item, ok := s.byID[strings.TrimSpace(interactionID)]
+	if !ok {
+		s.dropped.Add(1)
+		return
+	}
+	fn(item)
+}
+
+func (s *MemorySink) GetInteraction(interactionID string) (Interaction, []InteractionEvent, error) {
+	if s == nil {
+		return Interaction{}, nil, ErrInteractionNotFound
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	item, ok := s.byID[interactionID]
+	if !ok {
+		return Interaction{}, nil, ErrInteractionNotFound
+	}
+	return item.interaction, sortedEvents(item.events), nil
+}
+
+func (s *MemorySink) ListInteractions(filter InteractionFilter) ([]Interaction, error) {
+	if s == nil {
+		return nil, nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	all := make([]*tracedInteraction, 0, len(s.order))
+	for _, id := range s.order {
+		all = append(all, s.byID[id])
+	}
+	return listTraced(all, filter), nil
+}
+
+// Flush 为空操作：MemorySink 的写入是同步的。
+func (s *MemorySink) Flush() {}
+
+func (s *MemorySink) Close() error { return nil }
+
+// DroppedWrites 返回写到已淘汰或未开始的 interaction 上而被丢弃的写入数。
+func (s *MemorySink) DroppedWrites() uint64 {
+	if s == nil {
+		return 0
+	}
+	return s.dropped.Load()
+}
@@ -14,36 +14,43 @@ const (
 )
 
 type Interaction struct {
-	ID            uint   `gorm:"primaryKey"`
-	InteractionID string `gorm:"uniqueIndex;size:128;not null"`
-	Method        string `gorm:"size:16"`
-	Path          string `gorm:"size:512"`
-	Query         string `gorm:"size:1024"`
-	ClientAPI     string `gorm:"size:32"`
-	Model         string `gorm:"size:128"`
-	Stream        bool
-	StatusCode    int
-	ErrorSummary  string    `gorm:"type:text"`
-	StartedAt     time.Time `gorm:"not null"`
-	FinishedAt    *time.Time
-	CreatedAt     time.Time
-	UpdatedAt     time.Time
+	ID            uint       `gorm:"primaryKey" json:"id"`
+	InteractionID string     `gorm:"uniqueIndex;size:128;not null" json:"interaction_id"`
+	Method        string     `gorm:"size:16" json:"method"`
+	Path          string     `gorm:"size:512" json:"path"`
+	Query         string     `gorm:"size:1024" json:"query"`
+	ClientAPI     string     `gorm:"size:32" json:"client_api"`
+	Model         string     `gorm:"size:128" json:"model"`
+	Stream        bool       `json:"stream"`
+	StatusCode    int        `json:"status_code"`
+	ErrorSummary  string     `gorm:"type:text" json:"error_summary"`
+	StartedAt     time.Time  `gorm:"not null" json:"started_at"`
+	FinishedAt    *time.Time `json:"finished_at,omitempty"`
+	// ReplayOf 为 trace replay 产生的 interaction 指向被重放的原始 interaction_id。
+	ReplayOf string `gorm:"index;size:128" json:"replay_of,omitempty"`
+	// RecoverySummary 在 interaction 结束时由事件计算并落库，供 ListInteractions 直接过滤；进行中的 interaction 为空。
+	RecoverySummary string `gorm:"type:text" json:"recovery_summary,omitempty"`
+	// ClientTiming 为写回客户端的响应时延，BackendTiming 为最后一次 backend 响应的时延。
+	ClientTiming  StreamTiming `gorm:"embedded;embeddedPrefix:client_" json:"client_timing"`
+	BackendTiming StreamTiming `gorm:"embedded;embeddedPrefix:backend_" json:"backend_timing"`
+	CreatedAt     time.Time    `json:"created_at"`
+	UpdatedAt     time.Time    `json:"updated_at"`
 }
 
 type InteractionEvent struct {
-	ID            uint      `gorm:"primaryKey"`
-	InteractionID string    `gorm:"index;size:128;not null"`
-	Seq           int       `gorm:"index;not null"`
-	Kind          EventKind `gorm:"size:32;not null"`
-	Method        string    `gorm:"size:16"`
-	Path          string    `gorm:"size:512"`
-	URL           string    `gorm:"type:text"`
-	StatusCode    int
-	ContentType   string `gorm:"size:256"`
-	HeadersJSON   string `gorm:"type:text"`
-	Body          string `gorm:"type:text"`
-	BodyTruncated bool
-	Summary       string `gorm:"type:text"`
-	DurationMs    int64
-	CreatedAt     time.Time
+	ID            uint      `gorm:"primaryKey" json:"id"`
+	InteractionID string    `gorm:"index;size:128;not null" json:"interaction_id"`
+	Seq           int       `gorm:"index;not null" json:"seq"`
+	Kind          EventKind `gorm:"size:32;not null" json:"kind"`
+	Method        string    `gorm:"size:16" json:"method"`
+	Path          string    `gorm:"size:512" json:"path"`
+	URL           string    `gorm:"type:text" json:"url"`
+	StatusCode    int       `json:"status_code"`
+	ContentType   string    `gorm:"size:256" json:"content_type"`
+	HeadersJSON   string    `gorm:"type:text" json:"headers_json"`
+	Body          string    `gorm:"type:text" json:"body"`
+	BodyTruncated bool      `json:"body_truncated"`
+	Summary       string    `gorm:"type:text" json:"summary"`
+	DurationMs    int64     `json:"duration_ms"`
+	CreatedAt     time.Time `json:"created_at"`
 }
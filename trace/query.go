@@ -0,0 +1,141 @@
+package trace
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	defaultListLimit = 50
+	// backfillBatchSize 是补算 recovery_summary 时每批读取的 interaction 数。
+	backfillBatchSize = 200
+)
+
+// InteractionFilter 描述 ListInteractions 的过滤条件，零值字段表示不过滤。
+type InteractionFilter struct {
+	// Since/Until 按 started_at 过滤，Since 含边界，Until 不含。
+	Since time.Time
+	Until time.Time
+	// ClientAPI 精确匹配，例如 openai / claude。
+	ClientAPI string
+	// Model 按子串匹配，兼容带 chatgpt/codex/ 前缀与不带前缀两种写法。
+	Model      string
+	StatusCode int
+	// HasError 只保留 error_summary 非空的 interaction。
+	HasError bool
+	// HasRecovery 只保留 recovery_summary 非空的 interaction（仅 Claude /v1/messages 会产生）。
+	HasRecovery bool
+	// Text 在事件 body 与 summary 中做子串搜索。
+	Text string
+	// Limit 默认 50。
+	Limit int
+	// Offset 跳过前 N 条满足条件的结果，用于分页。
+	Offset int
+}
+
+// ListInteractions 按 started_at 倒序返回满足条件的 interaction；与 GetInteraction 一样先等待异步写入落库。
+// recovery_summary 在 interaction 结束时落库，尚未结束的 interaction 为空。
+func (s *Store) ListInteractions(filter InteractionFilter) ([]Interaction, error) {
+	if s == nil || s.db == nil {
+		return nil, fmt.Errorf("trace store is nil")
+	}
+	s.Flush()
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = defaultListLimit
+	}
+
+	var page []Interaction
+	if err := s.interactionQuery(filter).
+		Order("julianday(started_at) DESC, id DESC").
+		Offset(max(filter.Offset, 0)).
+		Limit(limit).
+		Find(&page).Error; err != nil {
+		return nil, err
+	}
+	return page, nil
+}
+
+// backfillRecoverySummaries 为升级前已结束的 Claude /v1/messages interaction 补算 recovery_summary。
+func backfillRecoverySummaries(db *gorm.DB) error {
+	var batch []Interaction
+	return db.Select("id", "interaction_id", "client_api", "path").
+		Where("client_api = ? AND path = ? AND finished_at IS NOT NULL", "claude", "/v1/messages").
+		FindInBatches(&batch, backfillBatchSize, func(tx *gorm.DB, _ int) error {
+			for _, interaction := range batch {
+				recovery, err := loadRecoverySummary(db, interaction)
+				if err != nil {
+					return err
+				}
+				if recovery == "" {
+					continue
+				}
+				if err := db.Model(&Interaction{}).Where("id = ?", interaction.ID).
+					Update("recovery_summary", recovery).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		}).Error
+}
+
+// ParseFilterTime 解析 Since/Until：支持 RFC3339、本地日期 2006-01-02，
+// 以及相对 now 的 duration（如 30m、2h）；空字符串返回零值。
+func ParseFilterTime(raw string, now time.Time) (time.Time, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(raw); err == nil {
+		return now.Add(-d), nil
+	}
+	if t, err := time.Parse(time.RFC3339, raw); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", raw, time.Local); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("unrecognized time %q", raw)
+}
+
+func (s *Store) interactionQuery(filter InteractionFilter) *gorm.DB {
+	query := s.db.Model(&Interaction{})
+	// SQLite 以带时区偏移的文本保存时间，直接按字符串比较会受写入时的时区影响；
+	// julianday 先把两侧换算为 UTC 再比较。
+	if !filter.Since.IsZero() {
+		query = query.Where("julianday(started_at) >= julianday(?)", filter.Since.UTC())
+	}
+	if !filter.Until.IsZero() {
+		query = query.Where("julianday(started_at) < julianday(?)", filter.Until.UTC())
+	}
+	if clientAPI := strings.TrimSpace(filter.ClientAPI); clientAPI != "" {
+		query = query.Where("client_api = ?", clientAPI)
+	}
+	if model := strings.TrimSpace(filter.Model); model != "" {
+		query = query.Where("model LIKE ? ESCAPE '\\'", "%"+escapeLike(model)+"%")
+	}
+	if filter.StatusCode != 0 {
+		query = query.Where("status_code = ?", filter.StatusCode)
+	}
+	if filter.HasError {
+		query = query.Where("error_summary IS NOT NULL AND error_summary <> ''")
+	}
+	if filter.HasRecovery {
+		query = query.Where("recovery_summary IS NOT NULL AND recovery_summary <> ''")
+	}
+	if text := strings.TrimSpace(filter.Text); text != "" {
+		pattern := "%" + escapeLike(text) + "%"
+		query = query.Where(
+			"EXISTS (SELECT 1 FROM interaction_events e WHERE e.interaction_id = interactions.interaction_id AND (e.body LIKE ? ESCAPE '\\' OR e.summary LIKE ? ESCAPE '\\'))",
+			pattern, pattern,
+		)
+	}
+	return query
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
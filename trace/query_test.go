@@ -0,0 +1,147 @@
+package trace
+
+import (
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func seedListInteraction(t *testing.T, store *Store, interaction Interaction, status int, errorSummary string, body string) {
+	t.Helper()
+	require.NoError(t, store.StartInteraction(interaction))
+	require.NoError(t, store.AppendEvent(InteractionEvent{
+		InteractionID: interaction.InteractionID,
+		Seq:           1,
+		Kind:          EventClientRequest,
+		Body:          body,
+		Summary:       "client request",
+	}))
+	require.NoError(t, store.FinishInteraction(interaction.InteractionID, status, errorSummary))
+}
+
+func TestStore_ListInteractions_Filters(t *testing.T) {
+	t.Parallel()
+
+	store, err := OpenStore(filepath.Join(t.TempDir(), "trace.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { require.NoError(t, store.Close()) })
+
+	base := time.Date(2026, 10, 1, 12, 0, 0, 0, time.Local)
+	seedListInteraction(t, store, Interaction{
+		InteractionID: "ia_old", Method: http.MethodPost, Path: "/v1/responses",
+		ClientAPI: "openai", Model: "chatgpt/codex/gpt-5.4", StartedAt: base,
+	}, http.StatusOK, "", `{"input":"hello world"}`)
+	seedListInteraction(t, store, Interaction{
+		InteractionID: "ia_failed", Method: http.MethodPost, Path: "/v1/chat/completions",
+		ClientAPI: "openai", Model: "gpt-5.5", StartedAt: base.Add(time.Hour),
+	}, http.StatusBadGateway, "api_error: upstream", `{"messages":[]}`)
+	seedListInteraction(t, store, Interaction{
+		InteractionID: "ia_recovery", Method: http.MethodPost, Path: "/v1/messages",
+		ClientAPI: "claude", Model: "gpt-5.4", StartedAt: base.Add(2 * time.Hour),
+	}, http.StatusOK, "", `{"messages":[{"role":"user","content":[{"type":"tool_result","tool_use_id":"a","content":"Team \"t1\" does not exist. Call spawnTeam first to create the team."}]}]}`)
+
+	ids := func(items []Interaction) []string {
+		out := make([]string, 0, len(items))
+		for _, item := range items {
+			out = append(out, item.InteractionID)
+		}
+		return out
+	}
+
+	all, err := store.ListInteractions(InteractionFilter{})
+	require.NoError(t, err)
+	require.Equal(t, []string{"ia_recovery", "ia_failed", "ia_old"}, ids(all))
+	require.Equal(t, "missing-team:t1", all[0].RecoverySummary)
+
+	got, err := store.ListInteractions(InteractionFilter{Limit: 1})
+	require.NoError(t, err)
+	require.Equal(t, []string{"ia_recovery"}, ids(got))
+
+	got, err = store.ListInteractions(InteractionFilter{Limit: 1, Offset: 1})
+	require.NoError(t, err)
+	require.Equal(t, []string{"ia_failed"}, ids(got))
+
+	got, err = store.ListInteractions(InteractionFilter{Since: base.Add(30 * time.Minute), Until: base.Add(2 * time.Hour)})
+	require.NoError(t, err)
+	require.Equal(t, []string{"ia_failed"}, ids(got))
+
+	got, err = store.ListInteractions(InteractionFilter{ClientAPI: "openai", Model: "gpt-5.4"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"ia_old"}, ids(got))
+
+	got, err = store.ListInteractions(InteractionFilter{HasError: true})
+	require.NoError(t, err)
+	require.Equal(t, []string{"ia_failed"}, ids(got))
+
+	got, err = store.ListInteractions(InteractionFilter{StatusCode: http.StatusBadGateway})
+	require.NoError(t, err)
+	require.Equal(t, []string{"ia_failed"}, ids(got))
+
+	got, err = store.ListInteractions(InteractionFilter{HasRecovery: true})
+	require.NoError(t, err)
+	require.Equal(t, []string{"ia_recovery"}, ids(got))
+
+	got, err = store.ListInteractions(InteractionFilter{Text: "hello world"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"ia_old"}, ids(got))
+
+	got, err = store.ListInteractions(InteractionFilter{Text: "100%"})
+	require.NoError(t, err)
+	require.Empty(t, got)
+}
+
+func TestStore_ListInteractions_ComparesTimesInUTC(t *testing.T) {
+	t.Parallel()
+
+	store, err := OpenStore(filepath.Join(t.TempDir(), "trace.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { require.NoError(t, store.Close()) })
+
+	// 两条记录以不同时区写入：按文本比较时 +08:00 的记录会排在后面并错误地命中 Since。
+	east := time.FixedZone("UTC+8", 8*3600)
+	west := time.FixedZone("UTC-5", -5*3600)
+	seedListInteraction(t, store, Interaction{
+		InteractionID: "ia_east", Path: "/v1/responses", ClientAPI: "openai",
+		StartedAt: time.Date(2026, 1, 1, 1, 0, 0, 0, east), // 2025-12-31T17:00Z
+	}, http.StatusOK, "", `{}`)
+	seedListInteraction(t, store, Interaction{
+		InteractionID: "ia_west", Path: "/v1/responses", ClientAPI: "openai",
+		StartedAt: time.Date(2025, 12, 31, 16, 0, 0, 0, west), // 2025-12-31T21:00Z
+	}, http.StatusOK, "", `{}`)
+
+	got, err := store.ListInteractions(InteractionFilter{Since: time.Date(2025, 12, 31, 20, 0, 0, 0, time.UTC)})
+	require.NoError(t, err)
+	require.Len(t, got, 1)
+	require.Equal(t, "ia_west", got[0].InteractionID)
+
+	got, err = store.ListInteractions(InteractionFilter{})
+	require.NoError(t, err)
+	require.Equal(t, "ia_west", got[0].InteractionID)
+	require.Equal(t, "ia_east", got[1].InteractionID)
+}
+
+func TestOpenStore_BackfillsRecoverySummary(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "trace.db")
+	store, err := OpenStore(path)
+	require.NoError(t, err)
+	seedListInteraction(t, store, Interaction{
+		InteractionID: "ia_legacy", Method: http.MethodPost, Path: "/v1/messages", ClientAPI: "claude",
+		StartedAt: time.Now(),
+	}, http.StatusOK, "", `Already leading team "t2".`)
+	// 模拟升级前的库：去掉 recovery_summary 列。
+	require.NoError(t, store.db.Migrator().DropColumn(&Interaction{}, "RecoverySummary"))
+	require.NoError(t, store.Close())
+
+	store, err = OpenStore(path)
+	require.NoError(t, err)
+	t.Cleanup(func() { require.NoError(t, store.Close()) })
+	got, err := store.ListInteractions(InteractionFilter{HasRecovery: true})
+	require.NoError(t, err)
+	require.Len(t, got, 1)
+	require.Equal(t, "stale-team:t2", got[0].RecoverySummary)
+}
@@ -0,0 +1,171 @@
+package trace
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// replayTextSnippet 为文本差异两侧各展示的字符数。
+const replayTextSnippet = 120
+
+// ReplayableRequest 返回 interaction 中可用于重放的 client_request 事件；
+// 没有请求事件或 body 在入库时被截断时返回错误。
+func ReplayableRequest(events []InteractionEvent) (InteractionEvent, error) {
+	for _, event := range events {
+		if event.Kind != EventClientRequest {
+			continue
+		}
+		if event.BodyTruncated {
+			return InteractionEvent{}, fmt.Errorf("client_request body was truncated at %d bytes; raise --trace-max-body-bytes and capture the request again", len(event.Body))
+		}
+		return event, nil
+	}
+	return InteractionEvent{}, fmt.Errorf("interaction has no client_request event")
+}
+
+// InteractionOutcome 是用于比较的最终结果，取自最后一个 client_response 的 transcript。
+type InteractionOutcome struct {
+	InteractionID string               `json:"interaction_id"`
+	StatusCode    int                  `json:"status_code"`
+	ErrorSummary  string               `json:"error_summary,omitempty"`
+	StopReason    string               `json:"stop_reason,omitempty"`
+	ToolCalls     []TranscriptToolCall `json:"tool_calls,omitempty"`
+	Text          string               `json:"text"`
+}
+
+func OutcomeOf(interaction Interaction, events []InteractionEvent) InteractionOutcome {
+	out := InteractionOutcome{
+		InteractionID: interaction.InteractionID,
+		StatusCode:    interaction.StatusCode,
+		ErrorSummary:  interaction.ErrorSummary,
+	}
+	for i := len(events) - 1; i >= 0; i-- {
+		if events[i].Kind != EventClientResponse {
+			continue
+		}
+		if transcript, ok := BuildTranscript(events[i]); ok {
+			out.StopReason = transcript.StopReason
+			out.ToolCalls = transcript.ToolCalls
+			out.Text = transcript.Text
+		}
+		break
+	}
+	return out
+}
+
+// InteractionDiff 比较原始请求与重放结果。工具调用按 name + 归一化后的 arguments 比较，忽略每次都会变化的 call id。
+type InteractionDiff struct {
+	Original          InteractionOutcome `json:"original"`
+	Replay            InteractionOutcome `json:"replay"`
+	StatusChanged     bool               `json:"status_changed"`
+	ErrorChanged      bool               `json:"error_changed"`
+	StopReasonChanged bool               `json:"stop_reason_changed"`
+	ToolCallsChanged  bool               `json:"tool_calls_changed"`
+	TextChanged       bool               `json:"text_changed"`
+	// TextDivergeAt 为两段文本第一个不同字符（rune）的位置，相同时为 -1。
+	TextDivergeAt int `json:"text_diverge_at"`
+}
+
+func (d InteractionDiff) Changed() bool {
+	return d.StatusChanged || d.ErrorChanged || d.StopReasonChanged || d.ToolCallsChanged || d.TextChanged
+}
+
+func DiffInteractions(original, replay InteractionOutcome) InteractionDiff {
+	diff := InteractionDiff{
+		Original:          original,
+		Replay:            replay,
+		StatusChanged:     original.StatusCode != replay.StatusCode,
+		ErrorChanged:      original.ErrorSummary != replay.ErrorSummary,
+		StopReasonChanged: original.StopReason != replay.StopReason,
+		ToolCallsChanged:  !sameToolCalls(original.ToolCalls, replay.ToolCalls),
+		TextDivergeAt:     -1,
+	}
+	if original.Text != replay.Text {
+		diff.TextChanged = true
+		a, b := []rune(original.Text), []rune(replay.Text)
+		i := 0
+		for i < len(a) && i < len(b) && a[i] == b[i] {
+			i++
+		}
+		diff.TextDivergeAt = i
+	}
+	return diff
+}
+
+func sameToolCalls(a, b []TranscriptToolCall) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Name != b[i].Name || normalizeJSONText(a[i].Arguments) != normalizeJSONText(b[i].Arguments) {
+			return false
+		}
+	}
+	return true
+}
+
+// normalizeJSONText 去掉空白与 key 顺序差异；非 JSON 原样返回。
+func normalizeJSONText(raw string) string {
+	var value any
+	if err := json.Unmarshal([]byte(raw), &value); err != nil {
+		return raw
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return raw
+	}
+	return string(data)
+}
+
+// FormatInteractionDiff 输出逐字段对比，未变化的字段标记 (same)。
+func FormatInteractionDiff(d InteractionDiff) string {
+	var builder strings.Builder
+	builder.WriteString("original: " + d.Original.InteractionID + "\n")
+	builder.WriteString("replay:   " + d.Replay.InteractionID + "\n")
+	builder.WriteString(fmt.Sprintf("status_code: %d -> %d%s\n", d.Original.StatusCode, d.Replay.StatusCode, diffMark(d.StatusChanged)))
+	if d.Original.ErrorSummary != "" || d.Replay.ErrorSummary != "" {
+		builder.WriteString(fmt.Sprintf("error_summary: %q -> %q%s\n", d.Original.ErrorSummary, d.Replay.ErrorSummary, diffMark(d.ErrorChanged)))
+	}
+	builder.WriteString(fmt.Sprintf("stop_reason: %q -> %q%s\n", d.Original.StopReason, d.Replay.StopReason, diffMark(d.StopReasonChanged)))
+
+	builder.WriteString(fmt.Sprintf("tool_calls: %d -> %d%s\n", len(d.Original.ToolCalls), len(d.Replay.ToolCalls), diffMark(d.ToolCallsChanged)))
+	if d.ToolCallsChanged {
+		for _, call := range d.Original.ToolCalls {
+			builder.WriteString("  - " + call.Name + " " + call.Arguments + "\n")
+		}
+		for _, call := range d.Replay.ToolCalls {
+			builder.WriteString("  + " + call.Name + " " + call.Arguments + "\n")
+		}
+	}
+
+	builder.WriteString(fmt.Sprintf("text: %d -> %d chars%s\n", len([]rune(d.Original.Text)), len([]rune(d.Replay.Text)), diffMark(d.TextChanged)))
+	if d.TextChanged {
+		builder.WriteString(fmt.Sprintf("  diverges at char %d\n", d.TextDivergeAt))
+		builder.WriteString("  - " + textSnippet(d.Original.Text, d.TextDivergeAt) + "\n")
+		builder.WriteString("  + " + textSnippet(d.Replay.Text, d.TextDivergeAt) + "\n")
+	}
+	return builder.String()
+}
+
+func diffMark(changed bool) string {
+	if changed {
+		return " (changed)"
+	}
+	return " (same)"
+}
+
+// textSnippet 从分歧点前少量上下文开始截取，换行转义后单行展示。
+func textSnippet(text string, at int) string {
+	runes := []rune(text)
+	start := max(at-20, 0)
+	end := min(start+replayTextSnippet, len(runes))
+	snippet := strings.ReplaceAll(string(runes[start:end]), "\n", `\n`)
+	if start > 0 {
+		snippet = "..." + snippet
+	}
+	if end < len(runes) {
+		snippet += "..."
+	}
+	return snippet
+}
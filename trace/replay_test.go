@@ -0,0 +1,46 @@
+package trace
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffInteractions_NormalizesToolArguments(t *testing.T) {
+	t.Parallel()
+
+	original := InteractionOutcome{InteractionID: "ia_a", StatusCode: 200, StopReason: "tool_use", Text: "same",
+		ToolCalls: []TranscriptToolCall{{ID: "toolu_1", Name: "Read", Arguments: `{"b":1, "a":"x"}`}}}
+	replay := InteractionOutcome{InteractionID: "ia_b", StatusCode: 200, StopReason: "tool_use", Text: "same",
+		ToolCalls: []TranscriptToolCall{{ID: "toolu_2", Name: "Read", Arguments: `{"a":"x","b":1}`}}}
+
+	diff := DiffInteractions(original, replay)
+	require.False(t, diff.Changed())
+	require.Equal(t, -1, diff.TextDivergeAt)
+
+	replay.ToolCalls[0].Name = "Bash"
+	replay.Text = "same but longer"
+	replay.StatusCode = 502
+	diff = DiffInteractions(original, replay)
+	require.True(t, diff.ToolCallsChanged)
+	require.True(t, diff.StatusChanged)
+	require.Equal(t, 4, diff.TextDivergeAt)
+
+	report := FormatInteractionDiff(diff)
+	require.Contains(t, report, "status_code: 200 -> 502 (changed)")
+	require.Contains(t, report, `stop_reason: "tool_use" -> "tool_use" (same)`)
+	require.Contains(t, report, "  + Bash {\"a\":\"x\",\"b\":1}")
+	require.Contains(t, report, "diverges at char 4")
+}
+
+func TestReplayableRequest_DetectsTruncation(t *testing.T) {
+	t.Parallel()
+
+	_, err := ReplayableRequest([]InteractionEvent{{Kind: EventClientRequest, Body: "{", BodyTruncated: true}})
+	require.ErrorContains(t, err, "truncated")
+	_, err = ReplayableRequest([]InteractionEvent{{Kind: EventBackendRequest}})
+	require.Error(t, err)
+	got, err := ReplayableRequest([]InteractionEvent{{Kind: EventClientRequest, Body: "{}"}})
+	require.NoError(t, err)
+	require.Equal(t, "{}", got.Body)
+}
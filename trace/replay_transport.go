@@ -0,0 +1,260 @@
+package trace
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// Recording 是一对 backend_request / backend_response，可写成 JSONL fixture 供离线测试重放。
+type Recording struct {
+	InteractionID string      `json:"interaction_id"`
+	Method        string      `json:"method"`
+	URL           string      `json:"url"`
+	RequestBody   string      `json:"request_body"`
+	StatusCode    int         `json:"status_code"`
+	Header        http.Header `json:"header,omitempty"`
+	ResponseBody  string      `json:"response_body"`
+	// Truncated 表示请求或响应 body 在入库时被截断，这样的录制无法可靠重放。
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// LoadRecordings 按 seq 配对指定 interaction 的 backend 请求与响应；未收到响应的请求会被跳过。
+func (s *Store) LoadRecordings(ids ...string) ([]Recording, error) {
+	if s == nil || s.db == nil {
+		return nil, fmt.Errorf("trace store is nil")
+	}
+	var out []Recording
+	for _, id := range ids {
+		_, events, err := s.GetInteraction(id)
+		if err != nil {
+			return nil, fmt.Errorf("load interaction %s: %w", id, err)
+		}
+		out = append(out, recordingsFromEvents(id, events)...)
+	}
+	return out, nil
+}
+
+func recordingsFromEvents(interactionID string, events []InteractionEvent) []Recording {
+	var out []Recording
+	var pending []InteractionEvent
+	for _, event := range events {
+		switch event.Kind {
+		case EventBackendRequest:
+			pending = append(pending, event)
+		case EventBackendResponse:
+			// 传输层错误只有 summary，没有可重放的响应。
+			if len(pending) == 0 || event.StatusCode == 0 {
+				continue
+			}
+			req := pending[0]
+			pending = pending[1:]
+			out = append(out, Recording{
+				InteractionID: interactionID,
+				Method:        req.Method,
+				URL:           req.URL,
+				RequestBody:   req.Body,
+				StatusCode:    event.StatusCode,
+				Header:        parseHeadersJSON(event.HeadersJSON),
+				ResponseBody:  event.Body,
+				Truncated:     req.BodyTruncated || event.BodyTruncated,
+			})
+		}
+	}
+	return out
+}
+
+// WriteRecordings 以 JSONL 写出录制，每行一个 Recording。
+func WriteRecordings(w io.Writer, recordings []Recording) error {
+	bw := bufio.NewWriter(w)
+	for _, rec := range recordings {
+		line, err := json.Marshal(rec)
+		if err != nil {
+			return err
+		}
+		if _, err := bw.Write(append(line, '\n')); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// ReadRecordings 读取 WriteRecordings 生成的 JSONL fixture，忽略空行。
+func ReadRecordings(r io.Reader) ([]Recording, error) {
+	var out []Recording
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64<<10), 64<<20)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		var rec Recording
+		if err := json.Unmarshal([]byte(text), &rec); err != nil {
+			return nil, fmt.Errorf("recordings line %d: %w", line, err)
+		}
+		out = append(out, rec)
+	}
+	return out, scanner.Err()
+}
+
+// ReplayMatch 控制 ReplayTransport 如何把请求对应到录制。
+type ReplayMatch int
+
+const (
+	// ReplayStrict 要求 method、path 与规范化后的完整请求 JSON 一致，未命中时 RoundTrip 返回错误。
+	ReplayStrict ReplayMatch = iota
+	// ReplayLenient 只比较去掉 lenientIgnoredFields 与 IgnoreFields 后的请求 JSON；
+	// 仍未命中时按录制顺序返回下一条未使用的录制。
+	ReplayLenient
+)
+
+// lenientIgnoredFields 是宽松模式默认忽略的顶层字段：模型、指令与工具定义常随版本调整，
+// 但不影响对话走向。
+var lenientIgnoredFields = []string{"model", "instructions", "tools", "reasoning", "temperature", "top_p", "store", "stream"}
+
+type ReplayTransportOptions struct {
+	Match ReplayMatch
+	// IgnoreFields 为宽松模式额外忽略的顶层字段。
+	IgnoreFields []string
+}
+
+// ReplayTransport 是按请求 body 指纹返回录制响应的 http.RoundTripper，
+// 可直接放进 openaihttp.Config.HTTPClient 或 backend.ChatModelConfig.HTTPClient。
+type ReplayTransport struct {
+	opts       ReplayTransportOptions
+	recordings []Recording
+
+	mu     sync.Mutex
+	byKey  map[string][]int
+	served []bool
+}
+
+// NewReplayTransport 校验录制并建立指纹索引；存在被截断的录制时返回错误。
+func NewReplayTransport(recordings []Recording, opts ReplayTransportOptions) (*ReplayTransport, error) {
+	t := &ReplayTransport{
+		opts:       opts,
+		recordings: append([]Recording(nil), recordings...),
+		byKey:      make(map[string][]int),
+		served:     make([]bool, len(recordings)),
+	}
+	for i, rec := range t.recordings {
+		if rec.Truncated {
+			return nil, fmt.Errorf("recording %d (interaction %s) was truncated; capture it again with a larger --trace-max-body-bytes", i, rec.InteractionID)
+		}
+		key := t.fingerprint(rec.Method, rec.URL, []byte(rec.RequestBody))
+		t.byKey[key] = append(t.byKey[key], i)
+	}
+	return t, nil
+}
+
+func (t *ReplayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	body := readAndReplaceRequestBody(req)
+	key := t.fingerprint(req.Method, req.URL.String(), body)
+
+	t.mu.Lock()
+	idx, ok := t.next(key)
+	t.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("trace replay: no recording matches %s %s (fingerprint %s)", req.Method, req.URL.Path, key[:12])
+	}
+
+	rec := t.recordings[idx]
+	header := rec.Header.Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+	header.Del("Content-Length")
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", rec.StatusCode, http.StatusText(rec.StatusCode)),
+		StatusCode:    rec.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(strings.NewReader(rec.ResponseBody)),
+		ContentLength: int64(len(rec.ResponseBody)),
+		Request:       req,
+	}, nil
+}
+
+// next 优先返回同指纹中第一条未使用的录制；同指纹全部用过时重复最后一条，
+// 以兼容客户端对同一请求的重试。宽松模式下再退回到按顺序的下一条未使用录制。
+func (t *ReplayTransport) next(key string) (int, bool) {
+	if candidates := t.byKey[key]; len(candidates) > 0 {
+		for _, idx := range candidates {
+			if !t.served[idx] {
+				t.served[idx] = true
+				return idx, true
+			}
+		}
+		return candidates[len(candidates)-1], true
+	}
+	if t.opts.Match != ReplayLenient {
+		return 0, false
+	}
+	for idx, served := range t.served {
+		if !served {
+			t.served[idx] = true
+			return idx, true
+		}
+	}
+	return 0, false
+}
+
+// Unused 返回尚未被请求命中的录制，便于测试断言会话完整走完。
+func (t *ReplayTransport) Unused() []Recording {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var out []Recording
+	for idx, served := range t.served {
+		if !served {
+			out = append(out, t.recordings[idx])
+		}
+	}
+	return out
+}
+
+func (t *ReplayTransport) fingerprint(method, rawURL string, body []byte) string {
+	path := rawURL
+	if i := strings.Index(path, "://"); i >= 0 {
+		path = path[i+3:]
+		if j := strings.IndexByte(path, '/'); j >= 0 {
+			path = path[j:]
+		} else {
+			path = "/"
+		}
+	}
+	if i := strings.IndexByte(path, '?'); i >= 0 {
+		path = path[:i]
+	}
+
+	canonical := string(body)
+	var payload any
+	if err := json.Unmarshal(body, &payload); err == nil {
+		if obj, ok := payload.(map[string]any); ok && t.opts.Match == ReplayLenient {
+			for _, field := range lenientIgnoredFields {
+				delete(obj, field)
+			}
+			for _, field := range t.opts.IgnoreFields {
+				delete(obj, field)
+			}
+		}
+		// encoding/json 对 map 按 key 排序输出，得到与字段顺序无关的规范形式。
+		if data, err := json.Marshal(payload); err == nil {
+			canonical = string(data)
+		}
+	}
+	parts := []string{strings.ToUpper(method), canonical}
+	if t.opts.Match == ReplayStrict {
+		parts = append(parts, path)
+	}
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\n")))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,111 @@
+package trace
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func recordBackendSession(t *testing.T) []Recording {
+	t.Helper()
+
+	store, err := OpenStore(filepath.Join(t.TempDir(), "trace.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { require.NoError(t, store.Close()) })
+	require.NoError(t, store.StartInteraction(Interaction{InteractionID: "ia_rec", Path: "/v1/messages"}))
+
+	var calls atomic.Int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = io.WriteString(w, "data: {\"type\":\"response.output_text.delta\",\"delta\":\"turn "+string(rune('0'+calls.Add(1)))+"\"}\n\n")
+		_, _ = io.WriteString(w, "data: "+string(body)+"\n\n")
+	}))
+	t.Cleanup(backend.Close)
+
+	client := &http.Client{Transport: NewTracer(store, TracerOptions{}).WrapTransport(http.DefaultTransport)}
+	ctx := ContextWithInteractionID(context.Background(), "ia_rec")
+	for _, body := range []string{`{"model":"gpt-5.4","input":"first"}`, `{"model":"gpt-5.4","input":"second"}`} {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, backend.URL+"/backend-api/codex/responses", strings.NewReader(body))
+		require.NoError(t, err)
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		_, _ = io.ReadAll(resp.Body)
+		require.NoError(t, resp.Body.Close())
+	}
+	store.Flush()
+
+	recordings, err := store.LoadRecordings("ia_rec")
+	require.NoError(t, err)
+	require.Len(t, recordings, 2)
+
+	// 经过 JSONL fixture 往返后内容不变。
+	var buf bytes.Buffer
+	require.NoError(t, WriteRecordings(&buf, recordings))
+	loaded, err := ReadRecordings(&buf)
+	require.NoError(t, err)
+	require.Equal(t, recordings, loaded)
+	return loaded
+}
+
+func replayBody(t *testing.T, client *http.Client, body string) (string, error) {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodPost, "http://replay.invalid/backend-api/codex/responses", strings.NewReader(body))
+	require.NoError(t, err)
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	require.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	data, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return string(data), nil
+}
+
+func TestReplayTransport_StrictMatchesByFingerprint(t *testing.T) {
+	t.Parallel()
+
+	transport, err := NewReplayTransport(recordBackendSession(t), ReplayTransportOptions{Match: ReplayStrict})
+	require.NoError(t, err)
+	client := &http.Client{Transport: transport}
+
+	// 顺序与字段顺序都不同，仍按指纹命中。
+	got, err := replayBody(t, client, `{"input":"second","model":"gpt-5.4"}`)
+	require.NoError(t, err)
+	require.Contains(t, got, "turn 2")
+	got, err = replayBody(t, client, `{"model":"gpt-5.4","input":"first"}`)
+	require.NoError(t, err)
+	require.Contains(t, got, "turn 1")
+	require.Empty(t, transport.Unused())
+
+	_, err = replayBody(t, client, `{"model":"gpt-5.5","input":"first"}`)
+	require.ErrorContains(t, err, "no recording matches")
+}
+
+func TestReplayTransport_LenientIgnoresModelAndFallsBackToOrder(t *testing.T) {
+	t.Parallel()
+
+	transport, err := NewReplayTransport(recordBackendSession(t), ReplayTransportOptions{Match: ReplayLenient})
+	require.NoError(t, err)
+	client := &http.Client{Transport: transport}
+
+	got, err := replayBody(t, client, `{"model":"gpt-5.5","input":"second"}`)
+	require.NoError(t, err)
+	require.Contains(t, got, "turn 2")
+	got, err = replayBody(t, client, `{"model":"gpt-5.5","input":"something else"}`)
+	require.NoError(t, err)
+	require.Contains(t, got, "turn 1")
+	require.Empty(t, transport.Unused())
+
+	_, err = NewReplayTransport([]Recording{{InteractionID: "ia_cut", Truncated: true}}, ReplayTransportOptions{})
+	require.ErrorContains(t, err, "truncated")
+}
@@ -0,0 +1,278 @@
+package trace
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// pruneChunkSize 控制单个删除事务涉及的 interaction 数，避免长时间持有 SQLite 写锁阻塞在线请求。
+const pruneChunkSize = 500
+
+// RetentionPolicy 描述 trace 库的保留策略，零值字段表示不限制。
+type RetentionPolicy struct {
+	// MaxAge 删除 started_at 早于 now-MaxAge 的全部 interaction。
+	MaxAge time.Duration
+	// SuccessMaxAge 删除早于 now-SuccessMaxAge 的成功 interaction（2xx/3xx 且无 error_summary），
+	// 失败的 interaction 仍按 MaxAge 保留；通常设置得比 MaxAge 短。
+	SuccessMaxAge time.Duration
+	// MaxInteractions 只保留最新的 N 条 interaction。
+	MaxInteractions int
+	// MaxDBBytes 按已用页面估算库大小，超出时从最旧的 interaction 开始删除。
+	MaxDBBytes int64
+}
+
+func (p RetentionPolicy) IsZero() bool {
+	return p.MaxAge <= 0 && p.SuccessMaxAge <= 0 && p.MaxInteractions <= 0 && p.MaxDBBytes <= 0
+}
+
+// PruneResult 统计一次 Prune 删除的行数。
+type PruneResult struct {
+	Interactions int64
+	Events       int64
+}
+
+func (r *PruneResult) add(other PruneResult) {
+	r.Interactions += other.Interactions
+	r.Events += other.Events
+}
+
+// Prune 按策略删除过期 interaction 及其事件。删除只会把页面放回空闲列表，
+// 需要再调用 IncrementalVacuum 或 Vacuum 才会缩小文件。
+func (s *Store) Prune(policy RetentionPolicy, now time.Time) (PruneResult, error) {
+	var total PruneResult
+	if s == nil || s.db == nil {
+		return total, fmt.Errorf("trace store is nil")
+	}
+
+	if policy.MaxAge > 0 {
+		res, err := s.pruneWhere(s.db.Model(&Interaction{}).Where("julianday(started_at) < julianday(?)", now.Add(-policy.MaxAge).UTC()))
+		total.add(res)
+		if err != nil {
+			return total, err
+		}
+	}
+	if policy.SuccessMaxAge > 0 {
+		res, err := s.pruneWhere(s.db.Model(&Interaction{}).
+			Where("julianday(started_at) < julianday(?)", now.Add(-policy.SuccessMaxAge).UTC()).
+			Where("status_code >= ? AND status_code < ?", 200, 400).
+			Where("(error_summary IS NULL OR error_summary = '')"))
+		total.add(res)
+		if err != nil {
+			return total, err
+		}
+	}
+	if policy.MaxInteractions > 0 {
+		// 按 id 倒序跳过最新的 N 条，其余全部删除。
+		var cutoff Interaction
+		err := s.db.Order("id DESC").Offset(policy.MaxInteractions).Limit(1).Take(&cutoff).Error
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+		case err != nil:
+			return total, err
+		default:
+			res, err := s.pruneWhere(s.db.Model(&Interaction{}).Where("id <= ?", cutoff.ID))
+			total.add(res)
+			if err != nil {
+				return total, err
+			}
+		}
+	}
+	if policy.MaxDBBytes > 0 {
+		res, err := s.pruneToSize(policy.MaxDBBytes)
+		total.add(res)
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+func (s *Store) pruneWhere(query *gorm.DB) (PruneResult, error) {
+	var total PruneResult
+	for {
+		var ids []string
+		if err := query.Session(&gorm.Session{}).
+			Order("id ASC").
+			Limit(pruneChunkSize).
+			Pluck("interaction_id", &ids).Error; err != nil {
+			return total, err
+		}
+		if len(ids) == 0 {
+			return total, nil
+		}
+		res, err := s.deleteInteractions(ids)
+		total.add(res)
+		if err != nil {
+			return total, err
+		}
+		if len(ids) < pruneChunkSize {
+			return total, nil
+		}
+	}
+}
+
+// pruneToSize 按事件内容长度估算每条 interaction 的体积，从最旧的开始删除，
+// 直到已用空间低于 maxBytes 或库已清空。页面碎片会让估算偏小，因此循环复查。
+func (s *Store) pruneToSize(maxBytes int64) (PruneResult, error) {
+	var total PruneResult
+	for {
+		used, err := s.usedBytes()
+		if err != nil {
+			return total, err
+		}
+		if used <= maxBytes {
+			return total, nil
+		}
+
+		var rows []struct {
+			InteractionID string
+			Bytes         int64
+		}
+		if err := s.db.Raw(`SELECT i.interaction_id AS interaction_id,
+	COALESCE(SUM(IFNULL(LENGTH(CAST(e.body AS BLOB)), 0) + IFNULL(LENGTH(CAST(e.headers_json AS BLOB)), 0) +
+		IFNULL(LENGTH(CAST(e.summary AS BLOB)), 0) + IFNULL(LENGTH(CAST(e.url AS BLOB)), 0)), 0) AS bytes
+FROM interactions i
+LEFT JOIN interaction_events e ON e.interaction_id = i.interaction_id
+GROUP BY i.id
+ORDER BY i.id ASC
+LIMIT ?`, pruneChunkSize).Scan(&rows).Error; err != nil {
+			return total, err
+		}
+		if len(rows) == 0 {
+			return total, nil
+		}
+
+		excess := used - maxBytes
+		ids := make([]string, 0, len(rows))
+		var freed int64
+		for _, row := range rows {
+			ids = append(ids, row.InteractionID)
+			freed += row.Bytes
+			if freed >= excess {
+				break
+			}
+		}
+		res, err := s.deleteInteractions(ids)
+		total.add(res)
+		if err != nil {
+			return total, err
+		}
+	}
+}
+
+func (s *Store) deleteInteractions(ids []string) (PruneResult, error) {
+	var res PruneResult
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		events := tx.Where("interaction_id IN ?", ids).Delete(&InteractionEvent{})
+		if events.Error != nil {
+			return events.Error
+		}
+		interactions := tx.Where("interaction_id IN ?", ids).Delete(&Interaction{})
+		if interactions.Error != nil {
+			return interactions.Error
+		}
+		res.Events = events.RowsAffected
+		res.Interactions = interactions.RowsAffected
+		return nil
+	})
+	return res, err
+}
+
+// usedBytes 返回库中实际占用的字节数（总页数减去空闲页）。
+func (s *Store) usedBytes() (int64, error) {
+	var pageCount, freeCount, pageSize int64
+	if err := s.db.Raw("PRAGMA page_count").Scan(&pageCount).Error; err != nil {
+		return 0, err
+	}
+	if err := s.db.Raw("PRAGMA freelist_count").Scan(&freeCount).Error; err != nil {
+		return 0, err
+	}
+	if err := s.db.Raw("PRAGMA page_size").Scan(&pageSize).Error; err != nil {
+		return 0, err
+	}
+	return (pageCount - freeCount) * pageSize, nil
+}
+
+// FileBytes 返回 trace 库当前占用的文件大小（含空闲页）。
+func (s *Store) FileBytes() (int64, error) {
+	if s == nil || s.db == nil {
+		return 0, fmt.Errorf("trace store is nil")
+	}
+	var pageCount, pageSize int64
+	if err := s.db.Raw("PRAGMA page_count").Scan(&pageCount).Error; err != nil {
+		return 0, err
+	}
+	if err := s.db.Raw("PRAGMA page_size").Scan(&pageSize).Error; err != nil {
+		return 0, err
+	}
+	return pageCount * pageSize, nil
+}
+
+// IncrementalVacuum 归还空闲页；仅在 auto_vacuum=INCREMENTAL 的库上生效，其余情况为空操作。
+func (s *Store) IncrementalVacuum() error {
+	if s == nil || s.db == nil {
+		return fmt.Errorf("trace store is nil")
+	}
+	return s.db.Exec("PRAGMA incremental_vacuum").Error
+}
+
+// Vacuum 重建整个库并回收全部空闲页。旧库会在这一步切换为 auto_vacuum=INCREMENTAL。
+// VACUUM 期间会阻塞写入，适合在 CLI 或低峰期调用。
+func (s *Store) Vacuum() error {
+	if s == nil || s.db == nil {
+		return fmt.Errorf("trace store is nil")
+	}
+	if err := s.db.Exec("PRAGMA auto_vacuum = INCREMENTAL").Error; err != nil {
+		return err
+	}
+	return s.db.Exec("VACUUM").Error
+}
+
+// StartJanitor 在后台按 interval 执行 Prune + IncrementalVacuum，Store 关闭时自动退出。
+// policy 为零值时不启动。
+func (s *Store) StartJanitor(policy RetentionPolicy, interval time.Duration) {
+	if s == nil || s.db == nil || policy.IsZero() {
+		return
+	}
+	if interval <= 0 {
+		interval = 10 * time.Minute
+	}
+	s.workers.Add(1)
+	go func() {
+		defer s.workers.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.done:
+				return
+			default:
+			}
+			s.runJanitor(policy)
+			select {
+			case <-s.done:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (s *Store) runJanitor(policy RetentionPolicy) {
+	res, err := s.Prune(policy, time.Now())
+	if err != nil {
+		log.Printf("[gptb2o][trace] prune failed: %v", err)
+		return
+	}
+	if res.Interactions == 0 {
+		return
+	}
+	if err := s.IncrementalVacuum(); err != nil {
+		log.Printf("[gptb2o][trace] incremental vacuum failed: %v", err)
+	}
+	log.Printf("[gptb2o][trace] pruned interactions=%d events=%d", res.Interactions, res.Events)
+}
@@ -0,0 +1,107 @@
+package trace
+
+import (
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func seedRetentionInteraction(t *testing.T, store *Store, id string, startedAt time.Time, status int, errorSummary string, body string) {
+	t.Helper()
+	require.NoError(t, store.StartInteraction(Interaction{InteractionID: id, Path: "/v1/responses", StartedAt: startedAt}))
+	require.NoError(t, store.AppendEvent(InteractionEvent{InteractionID: id, Seq: 1, Kind: EventClientRequest, Body: body}))
+	require.NoError(t, store.FinishInteraction(id, status, errorSummary))
+}
+
+func remainingInteractionIDs(t *testing.T, store *Store) []string {
+	t.Helper()
+	items, err := store.ListInteractions(InteractionFilter{Limit: 1000})
+	require.NoError(t, err)
+	ids := make([]string, 0, len(items))
+	for _, item := range items {
+		ids = append(ids, item.InteractionID)
+	}
+	return ids
+}
+
+func TestStore_Prune_AgeAndSuccessWindow(t *testing.T) {
+	t.Parallel()
+
+	store, err := OpenStore(filepath.Join(t.TempDir(), "trace.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { require.NoError(t, store.Close()) })
+
+	now := time.Now()
+	seedRetentionInteraction(t, store, "ia_ancient_fail", now.Add(-10*24*time.Hour), http.StatusBadGateway, "api_error", "{}")
+	seedRetentionInteraction(t, store, "ia_old_ok", now.Add(-3*24*time.Hour), http.StatusOK, "", "{}")
+	seedRetentionInteraction(t, store, "ia_old_stream_err", now.Add(-3*24*time.Hour), http.StatusOK, "api_error: stream", "{}")
+	seedRetentionInteraction(t, store, "ia_old_fail", now.Add(-3*24*time.Hour), http.StatusBadRequest, "", "{}")
+	seedRetentionInteraction(t, store, "ia_new_ok", now.Add(-time.Hour), http.StatusOK, "", "{}")
+
+	res, err := store.Prune(RetentionPolicy{MaxAge: 7 * 24 * time.Hour, SuccessMaxAge: 24 * time.Hour}, now)
+	require.NoError(t, err)
+	require.Equal(t, PruneResult{Interactions: 2, Events: 2}, res)
+	require.ElementsMatch(t, []string{"ia_old_stream_err", "ia_old_fail", "ia_new_ok"}, remainingInteractionIDs(t, store))
+
+	var events int64
+	require.NoError(t, store.db.Model(&InteractionEvent{}).Count(&events).Error)
+	require.EqualValues(t, 3, events)
+}
+
+func TestStore_Prune_MaxInteractionsAndSize(t *testing.T) {
+	t.Parallel()
+
+	store, err := OpenStore(filepath.Join(t.TempDir(), "trace.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { require.NoError(t, store.Close()) })
+
+	now := time.Now()
+	body := strings.Repeat("x", 16<<10)
+	for i := 0; i < 20; i++ {
+		seedRetentionInteraction(t, store, fmt.Sprintf("ia_%02d", i), now.Add(time.Duration(i)*time.Second), http.StatusOK, "", body)
+	}
+
+	_, err = store.Prune(RetentionPolicy{MaxInteractions: 15}, now)
+	require.NoError(t, err)
+	ids := remainingInteractionIDs(t, store)
+	require.Len(t, ids, 15)
+	require.Equal(t, "ia_19", ids[0])
+	require.NotContains(t, ids, "ia_04")
+
+	before, err := store.FileBytes()
+	require.NoError(t, err)
+	_, err = store.Prune(RetentionPolicy{MaxDBBytes: 128 << 10}, now)
+	require.NoError(t, err)
+	used, err := store.usedBytes()
+	require.NoError(t, err)
+	require.LessOrEqual(t, used, int64(128<<10))
+	ids = remainingInteractionIDs(t, store)
+	require.NotEmpty(t, ids)
+	require.Equal(t, "ia_19", ids[0])
+
+	require.NoError(t, store.IncrementalVacuum())
+	after, err := store.FileBytes()
+	require.NoError(t, err)
+	require.Less(t, after, before)
+	require.NoError(t, store.Vacuum())
+}
+
+func TestStore_StartJanitor_StopsOnClose(t *testing.T) {
+	t.Parallel()
+
+	store, err := OpenStore(filepath.Join(t.TempDir(), "trace.db"))
+	require.NoError(t, err)
+	seedRetentionInteraction(t, store, "ia_expired", time.Now().Add(-2*time.Hour), http.StatusOK, "", "{}")
+
+	store.StartJanitor(RetentionPolicy{MaxAge: time.Hour}, 10*time.Millisecond)
+	require.Eventually(t, func() bool {
+		ids := remainingInteractionIDs(t, store)
+		return len(ids) == 0
+	}, 5*time.Second, 10*time.Millisecond)
+	require.NoError(t, store.Close())
+}
@@ -0,0 +1,189 @@
+package trace
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ErrInteractionNotFound 表示 Sink 中不存在指定的 interaction。
+var ErrInteractionNotFound = errors.New("interaction not found")
+
+// Sink 是 Tracer 的存储后端。写入方法在请求路径上调用，不返回错误也不应阻塞；
+// 失败由实现自行计数或记录日志。读取方法供 --show-interaction 与 /debug/traces 使用。
+//
+// 内置实现：*Store（SQLite）、*JSONLSink（滚动 JSONL 文件）与 *MemorySink（内存环形缓冲）。
+type Sink interface {
+	StartInteractionAsync(interaction Interaction)
+	// AppendEventAsync 在 event.Seq <= 0 时由 Sink 按 interaction 分配递增的 seq。
+	AppendEventAsync(event InteractionEvent)
+	FinishInteractionAsync(interactionID string, statusCode int, errorSummary string)
+	SetClientTimingAsync(interactionID string, timing StreamTiming)
+	SetBackendTimingAsync(interactionID string, timing StreamTiming)
+
+	// GetInteraction 返回 interaction 与按 seq 排序的事件；不存在时返回 ErrInteractionNotFound。
+	GetInteraction(interactionID string) (Interaction, []InteractionEvent, error)
+	ListInteractions(filter InteractionFilter) ([]Interaction, error)
+
+	// Flush 阻塞到此前的写入对 GetInteraction / ListInteractions 可见。
+	Flush()
+	Close() error
+}
+
+var (
+	_ Sink = (*Store)(nil)
+	_ Sink = (*JSONLSink)(nil)
+	_ Sink = (*MemorySink)(nil)
+)
+
+// finishedSeqRetention 为已结束 interaction 保留 seq 计数的条数，
+// 覆盖结束后才落下的 backend_response 等迟到事件。
+const finishedSeqRetention = 1024
+
+// seqAllocator 在内存中为每个 interaction 分配事件 seq，避免每条事件回查存储。
+type seqAllocator struct {
+	mu       sync.Mutex
+	seqs     map[string]int
+	finished []string
+	// lookup 在首次见到某个 interaction 时返回已落库的最大 seq；为 nil 时从 0 开始。
+	lookup func(interactionID string) (int, error)
+}
+
+func newSeqAllocator(lookup func(interactionID string) (int, error)) *seqAllocator {
+	return &seqAllocator{seqs: make(map[string]int), lookup: lookup}
+}
+
+// start 登记本进程新建的 interaction，计数从 0 开始，无需回查。
+func (a *seqAllocator) start(interactionID string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, ok := a.seqs[interactionID]; !ok {
+		a.seqs[interactionID] = 0
+	}
+}
+
+func (a *seqAllocator) next(interactionID string) (int, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	last, ok := a.seqs[interactionID]
+	if !ok && a.lookup != nil {
+		var err error
+		if last, err = a.lookup(interactionID); err != nil {
+			return 0, err
+		}
+	}
+	last++
+	a.seqs[interactionID] = last
+	return last, nil
+}
+
+// retire 把已结束的 interaction 放入 FIFO，超过 finishedSeqRetention 后释放其计数。
+func (a *seqAllocator) retire(interactionID string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.finished = append(a.finished, interactionID)
+	if len(a.finished) <= finishedSeqRetention {
+		return
+	}
+	evicted := a.finished[0]
+	a.finished = a.finished[1:]
+	delete(a.seqs, evicted)
+}
+
+// tracedInteraction 是非 SQLite Sink 在内存中重建的一条 interaction。
+type tracedInteraction struct {
+	interaction Interaction
+	events      []InteractionEvent
+}
+
+// listTraced 在内存中对 interaction 应用 InteractionFilter，语义与 Store.ListInteractions 一致。
+func listTraced(all []*tracedInteraction, filter InteractionFilter) []Interaction {
+	sorted := make([]*tracedInteraction, 0, len(all))
+	for _, item := range all {
+		if matchesFilter(item, filter) {
+			sorted = append(sorted, item)
+		}
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].interaction.StartedAt.After(sorted[j].interaction.StartedAt)
+	})
+
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = defaultListLimit
+	}
+	skip := max(filter.Offset, 0)
+	items := make([]Interaction, 0, min(limit, len(sorted)))
+	for _, item := range sorted {
+		recovery := summarizeClaudeRecovery(item.interaction, item.events)
+		if filter.HasRecovery && recovery == "" {
+			continue
+		}
+		if skip > 0 {
+			skip--
+			continue
+		}
+		interaction := item.interaction
+		interaction.RecoverySummary = recovery
+		items = append(items, interaction)
+		if len(items) == limit {
+			break
+		}
+	}
+	return items
+}
+
+func matchesFilter(item *tracedInteraction, filter InteractionFilter) bool {
+	interaction := item.interaction
+	if !filter.Since.IsZero() && interaction.StartedAt.Before(filter.Since) {
+		return false
+	}
+	if !filter.Until.IsZero() && !interaction.StartedAt.Before(filter.Until) {
+		return false
+	}
+	if clientAPI := strings.TrimSpace(filter.ClientAPI); clientAPI != "" && interaction.ClientAPI != clientAPI {
+		return false
+	}
+	// 与 SQLite LIKE 一致，子串匹配对 ASCII 不区分大小写。
+	if model := strings.TrimSpace(filter.Model); model != "" && !containsFold(interaction.Model, model) {
+		return false
+	}
+	if filter.StatusCode != 0 && interaction.StatusCode != filter.StatusCode {
+		return false
+	}
+	if filter.HasError && interaction.ErrorSummary == "" {
+		return false
+	}
+	if text := strings.TrimSpace(filter.Text); text != "" {
+		for _, event := range item.events {
+			if containsFold(event.Body, text) || containsFold(event.Summary, text) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+func containsFold(s, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
+
+// applyTiming 把流式时延写到 interaction 的 client_ 或 backend_ 列上。
+func applyTiming(interaction *Interaction, prefix string, timing StreamTiming) {
+	switch prefix {
+	case "client_":
+		interaction.ClientTiming = timing
+	case "backend_":
+		interaction.BackendTiming = timing
+	}
+}
+
+// sortedEvents 返回按 seq 排序的事件副本；异步写入下事件到达顺序可能与 seq 不一致。
+func sortedEvents(events []InteractionEvent) []InteractionEvent {
+	out := append([]InteractionEvent(nil), events...)
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Seq < out[j].Seq })
+	return out
+}
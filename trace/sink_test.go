@@ -0,0 +1,153 @@
+package trace
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// exerciseSink 经 Tracer 写入一次请求，校验各 Sink 的读写语义一致。
+func exerciseSink(t *testing.T, sink Sink) string {
+	t.Helper()
+
+	tracer := NewTracer(sink, TracerOptions{MaxBodyBytes: 256})
+	handler := tracer.WrapHTTP(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = w.Write([]byte("event: response.output_text.delta\ndata: {\"type\":\"response.output_text.delta\",\"delta\":\"hi\"}\n\n"))
+	}))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/responses", strings.NewReader(`{"model":"gpt-5.4","stream":true}`)))
+	interactionID := w.Header().Get(InteractionIDHeader)
+	require.NotEmpty(t, interactionID)
+
+	sink.Flush()
+	got, events, err := sink.GetInteraction(interactionID)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, got.StatusCode)
+	require.NotNil(t, got.FinishedAt)
+	require.Equal(t, 1, got.ClientTiming.SSEEvents)
+	require.Len(t, events, 2)
+	require.Equal(t, 1, events[0].Seq)
+	require.Equal(t, EventClientResponse, events[1].Kind)
+
+	items, err := sink.ListInteractions(InteractionFilter{Model: "GPT-5.4", Text: "output_text"})
+	require.NoError(t, err)
+	require.Len(t, items, 1)
+	require.Equal(t, interactionID, items[0].InteractionID)
+
+	items, err = sink.ListInteractions(InteractionFilter{HasError: true})
+	require.NoError(t, err)
+	require.Empty(t, items)
+
+	_, _, err = sink.GetInteraction("ia_missing")
+	require.ErrorIs(t, err, ErrInteractionNotFound)
+	return interactionID
+}
+
+func TestSinks_TracerRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	store, err := OpenStore(filepath.Join(t.TempDir(), "trace.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { require.NoError(t, store.Close()) })
+
+	jsonl, err := OpenJSONLSink(JSONLSinkOptions{Path: filepath.Join(t.TempDir(), "trace.jsonl")})
+	require.NoError(t, err)
+	t.Cleanup(func() { require.NoError(t, jsonl.Close()) })
+
+	for name, sink := range map[string]Sink{"sqlite": store, "jsonl": jsonl, "memory": NewMemorySink(10)} {
+		t.Run(name, func(t *testing.T) { exerciseSink(t, sink) })
+	}
+}
+
+func TestNewTracer_TypedNilSinkPassesThrough(t *testing.T) {
+	t.Parallel()
+
+	// 调用方自定义的 Sink 实现同样适用，不需要逐个列举具体类型。
+	type wrappedSink struct{ Sink }
+	for _, sink := range []Sink{(*Store)(nil), (*JSONLSink)(nil), (*wrappedSink)(nil)} {
+		tracer := NewTracer(sink, TracerOptions{})
+		w := httptest.NewRecorder()
+		tracer.WrapHTTP(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).
+			ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/models", nil))
+		require.Empty(t, w.Header().Get(InteractionIDHeader))
+	}
+}
+
+func TestMemorySink_EvictsOldestInteraction(t *testing.T) {
+	t.Parallel()
+
+	sink := NewMemorySink(2)
+	base := time.Date(2026, 10, 1, 12, 0, 0, 0, time.Local)
+	for i := 1; i <= 3; i++ {
+		id := fmt.Sprintf("ia_%d", i)
+		sink.StartInteractionAsync(Interaction{InteractionID: id, StartedAt: base.Add(time.Duration(i) * time.Minute)})
+		sink.AppendEventAsync(InteractionEvent{InteractionID: id, Kind: EventClientRequest})
+	}
+	// 已被淘汰的 interaction 上的迟到写入被丢弃。
+	sink.AppendEventAsync(InteractionEvent{InteractionID: "ia_1", Kind: EventBackendResponse})
+
+	_, _, err := sink.GetInteraction("ia_1")
+	require.ErrorIs(t, err, ErrInteractionNotFound)
+	require.Equal(t, uint64(1), sink.DroppedWrites())
+
+	items, err := sink.ListInteractions(InteractionFilter{})
+	require.NoError(t, err)
+	require.Len(t, items, 2)
+	require.Equal(t, "ia_3", items[0].InteractionID)
+
+	items, err = sink.ListInteractions(InteractionFilter{Limit: 1, Offset: 1})
+	require.NoError(t, err)
+	require.Len(t, items, 1)
+	require.Equal(t, "ia_2", items[0].InteractionID)
+}
+
+func TestJSONLSink_RotatesAndReadsAcrossFiles(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "trace.jsonl")
+	sink, err := OpenJSONLSink(JSONLSinkOptions{Path: path, MaxBytes: 2048, MaxFiles: 2})
+	require.NoError(t, err)
+
+	body := strings.Repeat("x", 600)
+	for i := 1; i <= 6; i++ {
+		id := fmt.Sprintf("ia_%d", i)
+		sink.StartInteractionAsync(Interaction{InteractionID: id, Path: "/v1/messages"})
+		sink.AppendEventAsync(InteractionEvent{InteractionID: id, Kind: EventClientRequest, Body: body})
+		sink.FinishInteractionAsync(id, http.StatusOK, "")
+	}
+	require.NoError(t, sink.Close())
+
+	for _, name := range []string{path, path + ".1", path + ".2"} {
+		_, err := os.Stat(name)
+		require.NoError(t, err, name)
+	}
+	_, err = os.Stat(path + ".3")
+	require.True(t, os.IsNotExist(err))
+
+	// 重新打开后可读取滚动前后的记录；最早的 interaction 已随最旧文件删除。
+	reopened, err := OpenJSONLSink(JSONLSinkOptions{Path: path, MaxBytes: 2048, MaxFiles: 2})
+	require.NoError(t, err)
+	t.Cleanup(func() { require.NoError(t, reopened.Close()) })
+
+	got, events, err := reopened.GetInteraction("ia_6")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, got.StatusCode)
+	require.Len(t, events, 1)
+	require.Equal(t, body, events[0].Body)
+
+	_, _, err = reopened.GetInteraction("ia_1")
+	require.ErrorIs(t, err, ErrInteractionNotFound)
+
+	items, err := reopened.ListInteractions(InteractionFilter{})
+	require.NoError(t, err)
+	require.NotEmpty(t, items)
+	require.Less(t, len(items), 6)
+}
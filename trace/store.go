@@ -9,6 +9,7 @@ import (
 	"regexp"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/glebarez/sqlite"
@@ -19,7 +20,19 @@ import (
 
 type Store struct {
 	db *gorm.DB
-	mu sync.Mutex
+
+	// seqs 在内存中分配每个 interaction 的 seq，只在首次见到已有 interaction 时回查数据库。
+	seqs *seqAllocator
+
+	// writes 是异步写入队列，由 writeLoop 批量落库；dropped 统计被丢弃的写入。
+	writes  chan writeOp
+	dropped atomic.Uint64
+	closed  atomic.Bool
+
+	closeOnce sync.Once
+	done      chan struct{}
+	// workers 跟踪写入与 janitor 等后台 goroutine，Close 时等待其退出后再关闭连接。
+	workers sync.WaitGroup
 }
 
 func OpenStore(path string) (*Store, error) {
@@ -37,16 +50,46 @@ func OpenStore(path string) (*Store, error) {
 	if err != nil {
 		return nil, fmt.Errorf("open trace db: %w", err)
 	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, fmt.Errorf("open trace db: %w", err)
+	}
+	// 后台写入、janitor 与查询会并发访问；单连接避免进程内的 database is locked，
+	// busy_timeout 让 trace prune 等另开进程的命令在写入期间等待而不是直接失败。
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.Exec("PRAGMA busy_timeout = 5000").Error; err != nil {
+		return nil, fmt.Errorf("configure trace db: %w", err)
+	}
+	// 新建的库直接启用增量 vacuum，janitor 删除数据后可以逐步归还空间；已有库需执行一次 Vacuum 才会切换。
+	if err := db.Exec("PRAGMA auto_vacuum = INCREMENTAL").Error; err != nil {
+		return nil, fmt.Errorf("configure trace db: %w", err)
+	}
+	// 旧库没有 recovery_summary 列，迁移后为已结束的 interaction 补算一次。
+	backfill := db.Migrator().HasTable(&Interaction{}) && !db.Migrator().HasColumn(&Interaction{}, "RecoverySummary")
 	if err := db.AutoMigrate(&Interaction{}, &InteractionEvent{}); err != nil {
 		return nil, fmt.Errorf("migrate trace db: %w", err)
 	}
-	return &Store{db: db}, nil
+	if backfill {
+		if err := backfillRecoverySummaries(db); err != nil {
+			return nil, fmt.Errorf("migrate trace db: %w", err)
+		}
+	}
+	store := &Store{db: db, done: make(chan struct{})}
+	store.seqs = newSeqAllocator(store.lastSeq)
+	store.startWriter(defaultWriteQueueSize)
+	return store, nil
 }
 
 func (s *Store) Close() error {
 	if s == nil || s.db == nil {
 		return nil
 	}
+	s.closeOnce.Do(func() {
+		// 先拒绝新的异步写入，再通知 writeLoop 写完队列剩余内容。
+		s.closed.Store(true)
+		close(s.done)
+		s.workers.Wait()
+	})
 	sqlDB, err := s.db.DB()
 	if err != nil {
 		return err
@@ -84,22 +127,11 @@ func (s *Store) AppendEvent(event InteractionEvent) error {
 		event.CreatedAt = time.Now()
 	}
 	if event.Seq <= 0 {
-		s.mu.Lock()
-		defer s.mu.Unlock()
-
-		var last InteractionEvent
-		err := s.db.Where("interaction_id = ?", event.InteractionID).
-			Order("seq DESC, id DESC").
-			Limit(1).
-			Take(&last).Error
-		switch {
-		case errors.Is(err, gorm.ErrRecordNotFound):
-			event.Seq = 1
-		case err != nil:
+		seq, err := s.seqs.next(event.InteractionID)
+		if err != nil {
 			return err
-		default:
-			event.Seq = last.Seq + 1
 		}
+		event.Seq = seq
 	}
 	return s.db.Create(&event).Error
 }
@@ -112,22 +144,26 @@ func (s *Store) FinishInteraction(interactionID string, statusCode int, errorSum
 	if interactionID == "" {
 		return fmt.Errorf("interaction_id is required")
 	}
-	finishedAt := time.Now()
-	return s.db.Model(&Interaction{}).
-		Where("interaction_id = ?", interactionID).
-		Updates(map[string]any{
-			"status_code":   statusCode,
-			"error_summary": errorSummary,
-			"finished_at":   &finishedAt,
-		}).Error
+	s.seqs.retire(interactionID)
+	return finishInteraction(s.db, finishUpdate{
+		interactionID: interactionID,
+		statusCode:    statusCode,
+		errorSummary:  errorSummary,
+		finishedAt:    time.Now(),
+	})
 }
 
+// GetInteraction 返回 interaction 及其按 seq 排序的事件；读取前先等待此前入队的异步写入落库。
 func (s *Store) GetInteraction(interactionID string) (Interaction, []InteractionEvent, error) {
 	if s == nil || s.db == nil {
 		return Interaction{}, nil, fmt.Errorf("trace store is nil")
 	}
+	s.Flush()
 	var interaction Interaction
 	if err := s.db.Where("interaction_id = ?", interactionID).Take(&interaction).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return Interaction{}, nil, ErrInteractionNotFound
+		}
 		return Interaction{}, nil, err
 	}
 	var events []InteractionEvent
@@ -141,25 +177,7 @@ func (s *Store) GetInteraction(interactionID string) (Interaction, []Interaction
 
 func FormatInteractionReport(interaction Interaction, events []InteractionEvent) string {
 	var builder strings.Builder
-	builder.WriteString("interaction_id: " + interaction.InteractionID + "\n")
-	builder.WriteString("method: " + interaction.Method + "\n")
-	builder.WriteString("path: " + interaction.Path + "\n")
-	builder.WriteString("client_api: " + interaction.ClientAPI + "\n")
-	builder.WriteString("model: " + interaction.Model + "\n")
-	builder.WriteString(fmt.Sprintf("stream: %t\n", interaction.Stream))
-	builder.WriteString(fmt.Sprintf("status_code: %d\n", interaction.StatusCode))
-	if interaction.ErrorSummary != "" {
-		builder.WriteString("error_summary: " + interaction.ErrorSummary + "\n")
-	}
-	if recoverySummary := summarizeClaudeRecovery(interaction, events); recoverySummary != "" {
-		builder.WriteString("recovery_summary: " + recoverySummary + "\n")
-	}
-	if !interaction.StartedAt.IsZero() {
-		builder.WriteString("started_at: " + interaction.StartedAt.Format(time.RFC3339Nano) + "\n")
-	}
-	if interaction.FinishedAt != nil {
-		builder.WriteString("finished_at: " + interaction.FinishedAt.Format(time.RFC3339Nano) + "\n")
-	}
+	writeInteractionHeader(&builder, interaction, events)
 	for _, event := range events {
 		builder.WriteString("\n")
 		builder.WriteString(fmt.Sprintf("[%d] %s\n", event.Seq, event.Kind))
@@ -194,6 +212,37 @@ func FormatInteractionReport(interaction Interaction, events []InteractionEvent)
 	return builder.String()
 }
 
+func writeInteractionHeader(builder *strings.Builder, interaction Interaction, events []InteractionEvent) {
+	builder.WriteString("interaction_id: " + interaction.InteractionID + "\n")
+	builder.WriteString("method: " + interaction.Method + "\n")
+	builder.WriteString("path: " + interaction.Path + "\n")
+	builder.WriteString("client_api: " + interaction.ClientAPI + "\n")
+	builder.WriteString("model: " + interaction.Model + "\n")
+	builder.WriteString(fmt.Sprintf("stream: %t\n", interaction.Stream))
+	builder.WriteString(fmt.Sprintf("status_code: %d\n", interaction.StatusCode))
+	if interaction.ErrorSummary != "" {
+		builder.WriteString("error_summary: " + interaction.ErrorSummary + "\n")
+	}
+	if recoverySummary := summarizeClaudeRecovery(interaction, events); recoverySummary != "" {
+		builder.WriteString("recovery_summary: " + recoverySummary + "\n")
+	}
+	if interaction.ReplayOf != "" {
+		builder.WriteString("replay_of: " + interaction.ReplayOf + "\n")
+	}
+	if !interaction.StartedAt.IsZero() {
+		builder.WriteString("started_at: " + interaction.StartedAt.Format(time.RFC3339Nano) + "\n")
+	}
+	if interaction.FinishedAt != nil {
+		builder.WriteString("finished_at: " + interaction.FinishedAt.Format(time.RFC3339Nano) + "\n")
+	}
+	if !interaction.ClientTiming.IsZero() {
+		builder.WriteString("client_timing: " + interaction.ClientTiming.String() + "\n")
+	}
+	if !interaction.BackendTiming.IsZero() {
+		builder.WriteString("backend_timing: " + interaction.BackendTiming.String() + "\n")
+	}
+}
+
 var (
 	missingTeamPattern  = regexp.MustCompile(`Team "([^"]+)" does not exist\. Call spawnTeam first to create the team\.`)
 	staleTeamPattern    = regexp.MustCompile(`Already leading team "([^"]+)"\.`)
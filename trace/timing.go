@@ -0,0 +1,204 @@
+package trace
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// maxTimingLineBytes 限制逐行解析 SSE 时缓存的单行长度；超长行（如 response.completed）只计数不解析。
+const maxTimingLineBytes = 64 << 10
+
+// StreamTiming 记录一次响应的流式时延，作为 interaction 的内嵌列保存。
+// 毫秒值均相对响应开始计时（client 侧为收到请求，backend 侧为发出请求）；nil 表示未观测到。
+type StreamTiming struct {
+	// FirstByteMs 为首个响应 body 字节到达/写出的时间。
+	FirstByteMs *int64 `json:"first_byte_ms"`
+	// FirstTokenMs 为首个文本增量事件的时间（output_text.delta / content_block_delta / chat delta.content）。
+	FirstTokenMs *int64 `json:"first_token_ms"`
+	// SSEEvents 为完整 SSE 事件数；非 SSE 响应为 0。
+	SSEEvents int `json:"sse_events"`
+	// MaxGapMs 为相邻两个 SSE 事件之间的最大间隔，也包括首字节到第一个事件的间隔。
+	MaxGapMs int64 `json:"max_gap_ms"`
+}
+
+func (t StreamTiming) IsZero() bool {
+	return t.FirstByteMs == nil && t.FirstTokenMs == nil && t.SSEEvents == 0 && t.MaxGapMs == 0
+}
+
+func (t StreamTiming) String() string {
+	return fmt.Sprintf("first_byte_ms=%s first_token_ms=%s sse_events=%d max_gap_ms=%d",
+		formatOptionalMs(t.FirstByteMs), formatOptionalMs(t.FirstTokenMs), t.SSEEvents, t.MaxGapMs)
+}
+
+func (t StreamTiming) columns(prefix string) map[string]any {
+	return map[string]any{
+		prefix + "first_byte_ms":  t.FirstByteMs,
+		prefix + "first_token_ms": t.FirstTokenMs,
+		prefix + "sse_events":     t.SSEEvents,
+		prefix + "max_gap_ms":     t.MaxGapMs,
+	}
+}
+
+func formatOptionalMs(ms *int64) string {
+	if ms == nil {
+		return "-"
+	}
+	return fmt.Sprintf("%d", *ms)
+}
+
+// StreamTimer 在 body 经过时逐行切分 SSE，统计首字节、首 token、事件数与最大间隔。
+// 首 token 找到后不再解析 JSON，只做换行扫描，开销与 body 长度线性相关。
+// Tracer 与 metrics 共用同一套判定，保证两边的首 token 口径一致。
+type StreamTimer struct {
+	startedAt time.Time
+	sse       bool
+
+	firstByte   time.Time
+	firstToken  time.Time
+	lastEvent   time.Time
+	maxGap      time.Duration
+	events      int
+	errorEvents int
+	line        []byte
+	lineTooLong bool
+	eventName   string
+	eventLines  int
+}
+
+func NewStreamTimer(startedAt time.Time, contentType string) *StreamTimer {
+	return &StreamTimer{
+		startedAt: startedAt,
+		sse:       strings.Contains(strings.ToLower(contentType), "text/event-stream"),
+	}
+}
+
+func (t *StreamTimer) Observe(p []byte, now time.Time) {
+	if len(p) == 0 {
+		return
+	}
+	if t.firstByte.IsZero() {
+		t.firstByte = now
+		t.lastEvent = now
+	}
+	if !t.sse {
+		return
+	}
+	for len(p) > 0 {
+		idx := bytes.IndexByte(p, '\n')
+		if idx < 0 {
+			t.appendLine(p)
+			return
+		}
+		t.appendLine(p[:idx])
+		t.endLine(now)
+		p = p[idx+1:]
+	}
+}
+
+func (t *StreamTimer) appendLine(p []byte) {
+	if t.lineTooLong {
+		return
+	}
+	if len(t.line)+len(p) > maxTimingLineBytes {
+		// 仍保留行首，以便识别 event:/data: 前缀。
+		if len(t.line) == 0 {
+			t.line = append(t.line, p[:min(len(p), 64)]...)
+		}
+		t.lineTooLong = true
+		return
+	}
+	t.line = append(t.line, p...)
+}
+
+func (t *StreamTimer) endLine(now time.Time) {
+	line := strings.TrimRight(string(t.line), "\r")
+	tooLong := t.lineTooLong
+	t.line = t.line[:0]
+	t.lineTooLong = false
+
+	switch {
+	case line == "":
+		if t.eventLines > 0 {
+			t.events++
+			if t.eventName == "error" {
+				t.errorEvents++
+			}
+			if gap := now.Sub(t.lastEvent); gap > t.maxGap {
+				t.maxGap = gap
+			}
+			t.lastEvent = now
+		}
+		t.eventName = ""
+		t.eventLines = 0
+	case strings.HasPrefix(line, "event:"):
+		t.eventName = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		t.eventLines++
+	case strings.HasPrefix(line, "data:"):
+		t.eventLines++
+		if t.firstToken.IsZero() && !tooLong && isTextDeltaEvent(t.eventName, strings.TrimSpace(strings.TrimPrefix(line, "data:"))) {
+			t.firstToken = now
+		}
+	}
+}
+
+// isTextDeltaEvent 识别三种协议的文本增量：Responses 的 response.output_text.delta、
+// Claude 的 content_block_delta(text_delta) 以及 Chat Completions 的 choices[].delta.content。
+func isTextDeltaEvent(eventName, data string) bool {
+	if data == "" || data == "[DONE]" {
+		return false
+	}
+	switch eventName {
+	case "response.output_text.delta":
+		return true
+	case "content_block_delta":
+		return strings.Contains(data, `"text_delta"`)
+	case "":
+	default:
+		return false
+	}
+	var payload struct {
+		Type    string `json:"type"`
+		Choices []struct {
+			Delta struct {
+				Content string `json:"content"`
+			} `json:"delta"`
+		} `json:"choices"`
+	}
+	if err := json.Unmarshal([]byte(data), &payload); err != nil {
+		return false
+	}
+	if payload.Type == "response.output_text.delta" {
+		return true
+	}
+	for _, choice := range payload.Choices {
+		if choice.Delta.Content != "" {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *StreamTimer) Timing() StreamTiming {
+	var timing StreamTiming
+	if !t.firstByte.IsZero() {
+		ms := t.firstByte.Sub(t.startedAt).Milliseconds()
+		timing.FirstByteMs = &ms
+	}
+	if !t.firstToken.IsZero() {
+		ms := t.firstToken.Sub(t.startedAt).Milliseconds()
+		timing.FirstTokenMs = &ms
+	}
+	timing.SSEEvents = t.events
+	if t.events > 0 {
+		timing.MaxGapMs = t.maxGap.Milliseconds()
+	}
+	return timing
+}
+
+// ErrorEvents 返回已完整接收的 `event: error` 事件数，即流中途下发给客户端的错误。
+func (t *StreamTimer) ErrorEvents() int {
+	return t.errorEvents
+}
@@ -0,0 +1,69 @@
+package trace
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStreamTimer_ResponsesSSE(t *testing.T) {
+	t.Parallel()
+
+	start := time.Unix(1700000000, 0)
+	timer := NewStreamTimer(start, "text/event-stream; charset=utf-8")
+	at := func(ms int) time.Time { return start.Add(time.Duration(ms) * time.Millisecond) }
+
+	timer.Observe([]byte("event: response.created\ndata: {\"type\":\"response.created\"}\n\n"), at(100))
+	// 事件被拆在两次 Read 中。
+	timer.Observe([]byte("event: response.output_text.delta\nda"), at(900))
+	timer.Observe([]byte("ta: {\"delta\":\"hi\"}\n\n"), at(950))
+	timer.Observe([]byte("event: response.output_text.delta\ndata: {\"delta\":\"!\"}\n\n"), at(1000))
+	timer.Observe([]byte("event: response.completed\ndata: {\"response\":{\"output\":\""+strings.Repeat("x", maxTimingLineBytes)+"\"}}\n\n"), at(1200))
+
+	got := timer.Timing()
+	require.NotNil(t, got.FirstByteMs)
+	require.Equal(t, int64(100), *got.FirstByteMs)
+	require.NotNil(t, got.FirstTokenMs)
+	require.Equal(t, int64(950), *got.FirstTokenMs)
+	require.Equal(t, 4, got.SSEEvents)
+	require.Equal(t, int64(850), got.MaxGapMs)
+	require.Equal(t, "first_byte_ms=100 first_token_ms=950 sse_events=4 max_gap_ms=850", got.String())
+	require.Zero(t, timer.ErrorEvents())
+
+	timer.Observe([]byte("event: error\ndata: {\"type\":\"error\",\"error\":{\"type\":\"api_error\"}}\n\n"), at(1300))
+	require.Equal(t, 1, timer.ErrorEvents())
+}
+
+func TestStreamTimer_ClientProtocols(t *testing.T) {
+	t.Parallel()
+
+	start := time.Unix(1700000000, 0)
+	cases := []struct {
+		name string
+		body string
+	}{
+		{name: "claude", body: "event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"delta\":{\"type\":\"input_json_delta\"}}\n\nevent: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"delta\":{\"type\":\"text_delta\",\"text\":\"hi\"}}\n\n"},
+		{name: "chat", body: "data: {\"choices\":[{\"delta\":{\"role\":\"assistant\",\"content\":\"\"}}]}\n\ndata: {\"choices\":[{\"delta\":{\"content\":\"hi\"}}]}\n\ndata: [DONE]\n\n"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			timer := NewStreamTimer(start, "text/event-stream")
+			lines := strings.SplitAfter(tc.body, "\n\n")
+			for i, chunk := range lines {
+				timer.Observe([]byte(chunk), start.Add(time.Duration(i+1)*10*time.Millisecond))
+			}
+			got := timer.Timing()
+			require.NotNil(t, got.FirstTokenMs)
+			require.Equal(t, int64(20), *got.FirstTokenMs)
+		})
+	}
+
+	jsonTimer := NewStreamTimer(start, "application/json")
+	jsonTimer.Observe([]byte(`{"ok":true}`+"\n\n"), start.Add(5*time.Millisecond))
+	got := jsonTimer.Timing()
+	require.Equal(t, int64(5), *got.FirstByteMs)
+	require.Nil(t, got.FirstTokenMs)
+	require.Zero(t, got.SSEEvents)
+}
@@ -0,0 +1,464 @@
+package trace
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Transcript 是从一条响应事件 body 重组出的最终结果，覆盖 backend Responses SSE、
+// Claude / Chat Completions / Responses 客户端 SSE 以及对应的非流式 JSON。
+type Transcript struct {
+	Text       string               `json:"text,omitempty"`
+	Reasoning  string               `json:"reasoning,omitempty"`
+	ToolCalls  []TranscriptToolCall `json:"tool_calls,omitempty"`
+	StopReason string               `json:"stop_reason,omitempty"`
+	Usage      *TranscriptUsage     `json:"usage,omitempty"`
+	Errors     []string             `json:"errors,omitempty"`
+	// SSEEvents 为解析到的 SSE 事件数，非流式响应为 0。
+	SSEEvents int `json:"sse_events"`
+	// Incomplete 表示 body 在入库时被截断，重组结果只覆盖前缀。
+	Incomplete bool `json:"incomplete,omitempty"`
+}
+
+type TranscriptToolCall struct {
+	ID        string `json:"id,omitempty"`
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+}
+
+type TranscriptUsage struct {
+	InputTokens  int64 `json:"input_tokens"`
+	OutputTokens int64 `json:"output_tokens"`
+}
+
+// transcriptBuilder 按 item_id / content block index / tool_calls index 聚合分片的工具调用参数。
+type transcriptBuilder struct {
+	out   Transcript
+	text  strings.Builder
+	think strings.Builder
+	order []string
+	calls map[string]*TranscriptToolCall
+}
+
+// BuildTranscript 重组 backend_response / client_response 事件的 body；
+// 其他事件或无法识别的 body 返回 false。
+func BuildTranscript(event InteractionEvent) (Transcript, bool) {
+	if event.Kind != EventBackendResponse && event.Kind != EventClientResponse {
+		return Transcript{}, false
+	}
+	body := strings.TrimSpace(event.Body)
+	if body == "" {
+		return Transcript{}, false
+	}
+	b := &transcriptBuilder{calls: make(map[string]*TranscriptToolCall)}
+	if strings.Contains(strings.ToLower(event.ContentType), "text/event-stream") ||
+		strings.HasPrefix(body, "event:") || strings.HasPrefix(body, "data:") {
+		b.consumeSSE(body)
+	} else {
+		var payload map[string]any
+		if err := json.Unmarshal([]byte(body), &payload); err != nil {
+			return Transcript{}, false
+		}
+		if !b.consumeJSON(payload) {
+			return Transcript{}, false
+		}
+	}
+	out := b.finish()
+	out.Incomplete = event.BodyTruncated
+	return out, true
+}
+
+func (b *transcriptBuilder) finish() Transcript {
+	out := b.out
+	out.Text = b.text.String()
+	out.Reasoning = b.think.String()
+	for _, key := range b.order {
+		out.ToolCalls = append(out.ToolCalls, *b.calls[key])
+	}
+	return out
+}
+
+func (b *transcriptBuilder) call(key string) *TranscriptToolCall {
+	if c, ok := b.calls[key]; ok {
+		return c
+	}
+	c := &TranscriptToolCall{}
+	b.calls[key] = c
+	b.order = append(b.order, key)
+	return c
+}
+
+func (b *transcriptBuilder) consumeSSE(body string) {
+	var eventName string
+	var data []string
+	dispatch := func() {
+		if len(data) > 0 {
+			b.out.SSEEvents++
+			payload := strings.Join(data, "\n")
+			if payload != "[DONE]" {
+				var obj map[string]any
+				if err := json.Unmarshal([]byte(payload), &obj); err == nil {
+					b.consumeStreamEvent(eventName, obj)
+				}
+			}
+		}
+		eventName = ""
+		data = data[:0]
+	}
+	for _, line := range strings.Split(body, "\n") {
+		line = strings.TrimRight(line, "\r")
+		switch {
+		case line == "":
+			dispatch()
+		case strings.HasPrefix(line, "event:"):
+			eventName = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			data = append(data, strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+	}
+	dispatch()
+}
+
+func (b *transcriptBuilder) consumeStreamEvent(eventName string, obj map[string]any) {
+	eventType := jsonStringAtPath(obj, "type")
+	if eventType == "" {
+		eventType = eventName
+	}
+	switch eventType {
+	// Responses（backend 与 /v1/responses 客户端）
+	case "response.output_text.delta":
+		b.text.WriteString(jsonStringAtPath(obj, "delta"))
+	case "response.reasoning_summary_text.delta", "response.reasoning_text.delta":
+		b.think.WriteString(jsonStringAtPath(obj, "delta"))
+	case "response.output_item.added", "response.output_item.done":
+		item, _ := obj["item"].(map[string]any)
+		if jsonStringAtPath(item, "type") == "function_call" {
+			b.responsesFunctionCall(item, eventType == "response.output_item.done")
+		}
+	case "response.function_call_arguments.delta":
+		c := b.call("item:" + jsonStringAtPath(obj, "item_id"))
+		c.Arguments += jsonStringAtPath(obj, "delta")
+	case "response.function_call_arguments.done":
+		c := b.call("item:" + jsonStringAtPath(obj, "item_id"))
+		c.Arguments = jsonStringAtPath(obj, "arguments")
+	case "response.completed", "response.incomplete", "response.failed":
+		if response, ok := obj["response"].(map[string]any); ok {
+			b.responsesStatus(response)
+		}
+
+	// Claude Messages
+	case "message_start":
+		if message, ok := obj["message"].(map[string]any); ok {
+			b.addUsage(message["usage"])
+		}
+	case "content_block_start":
+		block, _ := obj["content_block"].(map[string]any)
+		key := "block:" + jsonNumberString(obj["index"])
+		switch jsonStringAtPath(block, "type") {
+		case "tool_use", "server_tool_use":
+			c := b.call(key)
+			c.ID = jsonStringAtPath(block, "id")
+			c.Name = jsonStringAtPath(block, "name")
+			if input, ok := block["input"].(map[string]any); ok && len(input) > 0 {
+				raw, _ := json.Marshal(input)
+				c.Arguments = string(raw)
+			}
+		case "text":
+			b.text.WriteString(jsonStringAtPath(block, "text"))
+		}
+	case "content_block_delta":
+		delta, _ := obj["delta"].(map[string]any)
+		switch jsonStringAtPath(delta, "type") {
+		case "text_delta":
+			b.text.WriteString(jsonStringAtPath(delta, "text"))
+		case "thinking_delta":
+			b.think.WriteString(jsonStringAtPath(delta, "thinking"))
+		case "input_json_delta":
+			b.call("block:" + jsonNumberString(obj["index"])).Arguments += jsonStringAtPath(delta, "partial_json")
+		}
+	case "message_delta":
+		if reason := jsonStringAtPath(obj, "delta", "stop_reason"); reason != "" {
+			b.out.StopReason = reason
+		}
+		b.addUsage(obj["usage"])
+
+	case "error":
+		b.addError(obj)
+
+	// Chat Completions chunk 没有 type 字段
+	default:
+		if _, ok := obj["choices"]; ok {
+			b.chatChunk(obj)
+		} else if _, ok := obj["error"]; ok {
+			b.addError(obj)
+		}
+	}
+}
+
+func (b *transcriptBuilder) responsesFunctionCall(item map[string]any, done bool) {
+	c := b.call("item:" + jsonStringAtPath(item, "id"))
+	if id := jsonStringAtPath(item, "call_id"); id != "" {
+		c.ID = id
+	}
+	if name := jsonStringAtPath(item, "name"); name != "" {
+		c.Name = name
+	}
+	if args := jsonStringAtPath(item, "arguments"); args != "" && (done || c.Arguments == "") {
+		c.Arguments = args
+	}
+}
+
+func (b *transcriptBuilder) responsesStatus(response map[string]any) {
+	status := jsonStringAtPath(response, "status")
+	if reason := jsonStringAtPath(response, "incomplete_details", "reason"); reason != "" {
+		status += ": " + reason
+	}
+	if status != "" {
+		b.out.StopReason = status
+	}
+	if msg := jsonStringAtPath(response, "error", "message"); msg != "" {
+		b.out.Errors = append(b.out.Errors, msg)
+	}
+	b.addUsage(response["usage"])
+}
+
+func (b *transcriptBuilder) chatChunk(obj map[string]any) {
+	choices, _ := obj["choices"].([]any)
+	for _, raw := range choices {
+		choice, _ := raw.(map[string]any)
+		delta, _ := choice["delta"].(map[string]any)
+		b.text.WriteString(jsonStringAtPath(delta, "content"))
+		b.think.WriteString(jsonStringAtPath(delta, "reasoning_content"))
+		toolCalls, _ := delta["tool_calls"].([]any)
+		for _, rawCall := range toolCalls {
+			tc, _ := rawCall.(map[string]any)
+			c := b.call("chat:" + jsonNumberString(tc["index"]))
+			if id := jsonStringAtPath(tc, "id"); id != "" {
+				c.ID = id
+			}
+			if name := jsonStringAtPath(tc, "function", "name"); name != "" {
+				c.Name = name
+			}
+			c.Arguments += jsonStringAtPath(tc, "function", "arguments")
+		}
+		if reason := jsonStringAtPath(choice, "finish_reason"); reason != "" {
+			b.out.StopReason = reason
+		}
+	}
+	b.addUsage(obj["usage"])
+}
+
+// consumeJSON 处理非流式响应；无法识别的 JSON 返回 false。
+func (b *transcriptBuilder) consumeJSON(obj map[string]any) bool {
+	switch {
+	case jsonStringAtPath(obj, "type") == "message":
+		content, _ := obj["content"].([]any)
+		for i, raw := range content {
+			block, _ := raw.(map[string]any)
+			switch jsonStringAtPath(block, "type") {
+			case "text":
+				b.text.WriteString(jsonStringAtPath(block, "text"))
+			case "thinking":
+				b.think.WriteString(jsonStringAtPath(block, "thinking"))
+			case "tool_use", "server_tool_use":
+				c := b.call("block:" + strconv.Itoa(i))
+				c.ID = jsonStringAtPath(block, "id")
+				c.Name = jsonStringAtPath(block, "name")
+				raw, _ := json.Marshal(block["input"])
+				c.Arguments = string(raw)
+			}
+		}
+		b.out.StopReason = jsonStringAtPath(obj, "stop_reason")
+		b.addUsage(obj["usage"])
+	case jsonStringAtPath(obj, "object") == "chat.completion":
+		choices, _ := obj["choices"].([]any)
+		for _, raw := range choices {
+			choice, _ := raw.(map[string]any)
+			message, _ := choice["message"].(map[string]any)
+			b.text.WriteString(jsonStringAtPath(message, "content"))
+			toolCalls, _ := message["tool_calls"].([]any)
+			for i, rawCall := range toolCalls {
+				tc, _ := rawCall.(map[string]any)
+				c := b.call("chat:" + strconv.Itoa(i))
+				c.ID = jsonStringAtPath(tc, "id")
+				c.Name = jsonStringAtPath(tc, "function", "name")
+				c.Arguments = jsonStringAtPath(tc, "function", "arguments")
+			}
+			b.out.StopReason = jsonStringAtPath(choice, "finish_reason")
+		}
+		b.addUsage(obj["usage"])
+	case jsonStringAtPath(obj, "object") == "response":
+		output, _ := obj["output"].([]any)
+		for _, raw := range output {
+			item, _ := raw.(map[string]any)
+			switch jsonStringAtPath(item, "type") {
+			case "message":
+				parts, _ := item["content"].([]any)
+				for _, rawPart := range parts {
+					part, _ := rawPart.(map[string]any)
+					if jsonStringAtPath(part, "type") == "output_text" {
+						b.text.WriteString(jsonStringAtPath(part, "text"))
+					}
+				}
+			case "reasoning":
+				summary, _ := item["summary"].([]any)
+				for _, rawPart := range summary {
+					part, _ := rawPart.(map[string]any)
+					b.think.WriteString(jsonStringAtPath(part, "text"))
+				}
+			case "function_call":
+				b.responsesFunctionCall(item, true)
+			}
+		}
+		b.responsesStatus(obj)
+	case obj["error"] != nil:
+		b.addError(obj)
+	default:
+		return false
+	}
+	return true
+}
+
+func (b *transcriptBuilder) addError(obj map[string]any) {
+	msg := jsonStringAtPath(obj, "error", "message")
+	if errType := jsonStringAtPath(obj, "error", "type"); errType != "" {
+		if msg == "" {
+			msg = errType
+		} else {
+			msg = errType + ": " + msg
+		}
+	}
+	if msg == "" {
+		msg = jsonStringAtPath(obj, "message")
+	}
+	if msg != "" {
+		b.out.Errors = append(b.out.Errors, msg)
+	}
+}
+
+// addUsage 兼容 input_tokens/output_tokens（Responses、Claude）与 prompt_tokens/completion_tokens（Chat）。
+// Claude 的 message_delta 只带累计 output_tokens，因此非零值覆盖而不是累加。
+func (b *transcriptBuilder) addUsage(raw any) {
+	usage, ok := raw.(map[string]any)
+	if !ok {
+		return
+	}
+	if b.out.Usage == nil {
+		b.out.Usage = &TranscriptUsage{}
+	}
+	for _, key := range []string{"input_tokens", "prompt_tokens"} {
+		if n, ok := usage[key].(float64); ok && n > 0 {
+			b.out.Usage.InputTokens = int64(n)
+		}
+	}
+	for _, key := range []string{"output_tokens", "completion_tokens"} {
+		if n, ok := usage[key].(float64); ok && n > 0 {
+			b.out.Usage.OutputTokens = int64(n)
+		}
+	}
+}
+
+func jsonNumberString(raw any) string {
+	if n, ok := raw.(float64); ok {
+		return strconv.FormatInt(int64(n), 10)
+	}
+	return "0"
+}
+
+// FormatInteractionTranscript 输出精简回放：总览、每条事件一行摘要，以及响应事件重组后的文本、
+// 工具调用、stop reason 与 usage，不打印原始 body 与 headers。
+func FormatInteractionTranscript(interaction Interaction, events []InteractionEvent) string {
+	var builder strings.Builder
+	writeInteractionHeader(&builder, interaction, events)
+	for _, event := range events {
+		builder.WriteString("\n")
+		builder.WriteString(formatEventLine(event) + "\n")
+		transcript, ok := BuildTranscript(event)
+		if !ok {
+			continue
+		}
+		writeTranscript(&builder, transcript)
+	}
+	return builder.String()
+}
+
+func formatEventLine(event InteractionEvent) string {
+	parts := []string{fmt.Sprintf("[%d] %s", event.Seq, event.Kind)}
+	if event.StatusCode != 0 {
+		parts = append(parts, fmt.Sprintf("status=%d", event.StatusCode))
+	}
+	if event.DurationMs > 0 {
+		parts = append(parts, fmt.Sprintf("duration_ms=%d", event.DurationMs))
+	}
+	if event.Summary != "" {
+		parts = append(parts, "| "+event.Summary)
+	}
+	return strings.Join(parts, " ")
+}
+
+func writeTranscript(builder *strings.Builder, t Transcript) {
+	if t.Reasoning != "" {
+		builder.WriteString("reasoning:\n" + indentTranscript(t.Reasoning) + "\n")
+	}
+	if t.Text != "" {
+		builder.WriteString("text:\n" + indentTranscript(t.Text) + "\n")
+	}
+	for _, call := range t.ToolCalls {
+		line := "tool_call: " + call.Name
+		if call.ID != "" {
+			line += " id=" + call.ID
+		}
+		builder.WriteString(line + "\n")
+		builder.WriteString("  arguments: " + call.Arguments + "\n")
+	}
+	if t.StopReason != "" {
+		builder.WriteString("stop_reason: " + t.StopReason + "\n")
+	}
+	if t.Usage != nil {
+		builder.WriteString(fmt.Sprintf("usage: input_tokens=%d output_tokens=%d\n", t.Usage.InputTokens, t.Usage.OutputTokens))
+	}
+	for _, msg := range t.Errors {
+		builder.WriteString("error: " + msg + "\n")
+	}
+	if t.SSEEvents > 0 {
+		builder.WriteString(fmt.Sprintf("sse_events: %d\n", t.SSEEvents))
+	}
+	if t.Incomplete {
+		builder.WriteString("incomplete: body truncated, transcript covers a prefix only\n")
+	}
+}
+
+func indentTranscript(s string) string {
+	return "  " + strings.ReplaceAll(s, "\n", "\n  ")
+}
+
+// InteractionJSON 是 --format=json 的输出结构，事件附带重组后的 transcript。
+type InteractionJSON struct {
+	Interaction     Interaction            `json:"interaction"`
+	RecoverySummary string                 `json:"recovery_summary,omitempty"`
+	Events          []InteractionEventJSON `json:"events"`
+}
+
+type InteractionEventJSON struct {
+	InteractionEvent
+	Transcript *Transcript `json:"transcript,omitempty"`
+}
+
+// NewInteractionJSON 组装 json 输出，events 保持传入顺序（GetInteraction 已按 seq 排序）。
+func NewInteractionJSON(interaction Interaction, events []InteractionEvent) InteractionJSON {
+	out := InteractionJSON{
+		Interaction:     interaction,
+		RecoverySummary: summarizeClaudeRecovery(interaction, events),
+		Events:          make([]InteractionEventJSON, 0, len(events)),
+	}
+	for _, event := range events {
+		item := InteractionEventJSON{InteractionEvent: event}
+		if transcript, ok := BuildTranscript(event); ok {
+			item.Transcript = &transcript
+		}
+		out.Events = append(out.Events, item)
+	}
+	return out
+}
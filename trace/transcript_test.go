@@ -0,0 +1,149 @@
+package trace
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildTranscript_BackendResponsesSSE(t *testing.T) {
+	t.Parallel()
+
+	body := strings.Join([]string{
+		`event: response.created`,
+		`data: {"type":"response.created","response":{"id":"resp_1","status":"in_progress"}}`,
+		``,
+		`event: response.output_text.delta`,
+		`data: {"type":"response.output_text.delta","delta":"Hello"}`,
+		``,
+		`event: response.output_text.delta`,
+		`data: {"type":"response.output_text.delta","delta":", world"}`,
+		``,
+		`event: response.output_item.added`,
+		`data: {"type":"response.output_item.added","item":{"id":"fc_1","type":"function_call","call_id":"call_1","name":"get_weather","arguments":""}}`,
+		``,
+		`event: response.function_call_arguments.delta`,
+		`data: {"type":"response.function_call_arguments.delta","item_id":"fc_1","delta":"{\"city\":"}`,
+		``,
+		`event: response.function_call_arguments.delta`,
+		`data: {"type":"response.function_call_arguments.delta","item_id":"fc_1","delta":"\"Paris\"}"}`,
+		``,
+		`event: response.completed`,
+		`data: {"type":"response.completed","response":{"status":"completed","usage":{"input_tokens":12,"output_tokens":7}}}`,
+		``,
+	}, "\n")
+
+	got, ok := BuildTranscript(InteractionEvent{Kind: EventBackendResponse, ContentType: "text/event-stream", Body: body})
+	require.True(t, ok)
+	require.Equal(t, "Hello, world", got.Text)
+	require.Equal(t, []TranscriptToolCall{{ID: "call_1", Name: "get_weather", Arguments: `{"city":"Paris"}`}}, got.ToolCalls)
+	require.Equal(t, "completed", got.StopReason)
+	require.Equal(t, &TranscriptUsage{InputTokens: 12, OutputTokens: 7}, got.Usage)
+	require.Equal(t, 7, got.SSEEvents)
+}
+
+func TestBuildTranscript_ClaudeSSE(t *testing.T) {
+	t.Parallel()
+
+	body := strings.Join([]string{
+		`event: message_start`,
+		`data: {"type":"message_start","message":{"id":"msg_1","usage":{"input_tokens":30,"output_tokens":1}}}`,
+		``,
+		`event: content_block_start`,
+		`data: {"type":"content_block_start","index":0,"content_block":{"type":"thinking","thinking":""}}`,
+		``,
+		`event: content_block_delta`,
+		`data: {"type":"content_block_delta","index":0,"delta":{"type":"thinking_delta","thinking":"plan"}}`,
+		``,
+		`event: content_block_start`,
+		`data: {"type":"content_block_start","index":1,"content_block":{"type":"text","text":""}}`,
+		``,
+		`event: content_block_delta`,
+		`data: {"type":"content_block_delta","index":1,"delta":{"type":"text_delta","text":"Reading file"}}`,
+		``,
+		`event: content_block_start`,
+		`data: {"type":"content_block_start","index":2,"content_block":{"type":"tool_use","id":"toolu_1","name":"Read","input":{}}}`,
+		``,
+		`event: content_block_delta`,
+		`data: {"type":"content_block_delta","index":2,"delta":{"type":"input_json_delta","partial_json":"{\"file_path\":"}}`,
+		``,
+		`event: content_block_delta`,
+		`data: {"type":"content_block_delta","index":2,"delta":{"type":"input_json_delta","partial_json":"\"/tmp/a\"}"}}`,
+		``,
+		`event: message_delta`,
+		`data: {"type":"message_delta","delta":{"stop_reason":"tool_use"},"usage":{"output_tokens":25}}`,
+		``,
+		`event: error`,
+		`data: {"type":"error","error":{"type":"api_error","message":"backend recv down"}}`,
+		``,
+	}, "\n")
+
+	got, ok := BuildTranscript(InteractionEvent{Kind: EventClientResponse, ContentType: "text/event-stream", Body: body, BodyTruncated: true})
+	require.True(t, ok)
+	require.Equal(t, "Reading file", got.Text)
+	require.Equal(t, "plan", got.Reasoning)
+	require.Equal(t, []TranscriptToolCall{{ID: "toolu_1", Name: "Read", Arguments: `{"file_path":"/tmp/a"}`}}, got.ToolCalls)
+	require.Equal(t, "tool_use", got.StopReason)
+	require.Equal(t, &TranscriptUsage{InputTokens: 30, OutputTokens: 25}, got.Usage)
+	require.Equal(t, []string{"api_error: backend recv down"}, got.Errors)
+	require.True(t, got.Incomplete)
+}
+
+func TestBuildTranscript_ChatCompletionsAndJSON(t *testing.T) {
+	t.Parallel()
+
+	chat := strings.Join([]string{
+		`data: {"object":"chat.completion.chunk","choices":[{"index":0,"delta":{"role":"assistant","content":""}}]}`,
+		``,
+		`data: {"object":"chat.completion.chunk","choices":[{"index":0,"delta":{"content":"Hi"}}]}`,
+		``,
+		`data: {"object":"chat.completion.chunk","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"id":"call_9","type":"function","function":{"name":"bash","arguments":"{\"cmd\""}}]}}]}`,
+		``,
+		`data: {"object":"chat.completion.chunk","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":":\"ls\"}"}}]},"finish_reason":"tool_calls"}]}`,
+		``,
+		`data: [DONE]`,
+		``,
+	}, "\n")
+	got, ok := BuildTranscript(InteractionEvent{Kind: EventClientResponse, ContentType: "text/event-stream", Body: chat})
+	require.True(t, ok)
+	require.Equal(t, "Hi", got.Text)
+	require.Equal(t, []TranscriptToolCall{{ID: "call_9", Name: "bash", Arguments: `{"cmd":"ls"}`}}, got.ToolCalls)
+	require.Equal(t, "tool_calls", got.StopReason)
+
+	message := `{"id":"msg_1","type":"message","role":"assistant","content":[{"type":"text","text":"done"},{"type":"tool_use","id":"toolu_2","name":"Bash","input":{"command":"ls"}}],"stop_reason":"tool_use","usage":{"input_tokens":3,"output_tokens":4}}`
+	got, ok = BuildTranscript(InteractionEvent{Kind: EventClientResponse, ContentType: "application/json", Body: message})
+	require.True(t, ok)
+	require.Equal(t, "done", got.Text)
+	require.Equal(t, []TranscriptToolCall{{ID: "toolu_2", Name: "Bash", Arguments: `{"command":"ls"}`}}, got.ToolCalls)
+	require.Equal(t, "tool_use", got.StopReason)
+
+	_, ok = BuildTranscript(InteractionEvent{Kind: EventClientRequest, Body: message})
+	require.False(t, ok)
+	_, ok = BuildTranscript(InteractionEvent{Kind: EventClientResponse, ContentType: "application/json", Body: `{"ok":true}`})
+	require.False(t, ok)
+}
+
+func TestFormatInteractionTranscript_OmitsRawBodies(t *testing.T) {
+	t.Parallel()
+
+	interaction := Interaction{InteractionID: "ia_transcript", Method: "POST", Path: "/v1/responses", ClientAPI: "openai", StatusCode: 200}
+	events := []InteractionEvent{
+		{Seq: 1, Kind: EventClientRequest, Body: `{"input":"secret prompt"}`, Summary: "POST /v1/responses"},
+		{Seq: 2, Kind: EventBackendResponse, StatusCode: 200, ContentType: "text/event-stream", DurationMs: 120,
+			Body: "event: response.output_text.delta\ndata: {\"type\":\"response.output_text.delta\",\"delta\":\"line1\\nline2\"}\n\n"},
+	}
+
+	report := FormatInteractionTranscript(interaction, events)
+	require.Contains(t, report, "interaction_id: ia_transcript")
+	require.Contains(t, report, "[2] backend_response status=200 duration_ms=120")
+	require.Contains(t, report, "text:\n  line1\n  line2\n")
+	require.NotContains(t, report, "secret prompt")
+	require.NotContains(t, report, "response.output_text.delta")
+
+	raw, err := json.Marshal(NewInteractionJSON(interaction, events))
+	require.NoError(t, err)
+	require.Contains(t, string(raw), `"interaction_id":"ia_transcript"`)
+	require.Contains(t, string(raw), `"transcript":{"text":"line1\nline2","sse_events":1}`)
+}
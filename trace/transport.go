@@ -8,7 +8,7 @@ import (
 )
 
 func (t *Tracer) WrapTransport(base http.RoundTripper) http.RoundTripper {
-	if t == nil || t.store == nil {
+	if t == nil || t.sink == nil {
 		if base == nil {
 			return http.DefaultTransport
 		}
@@ -26,7 +26,7 @@ func (t *Tracer) WrapTransport(base http.RoundTripper) http.RoundTripper {
 		startedAt := time.Now()
 		bodyBytes := readAndReplaceRequestBody(req)
 		requestBody, requestTruncated := TruncateBody(bodyBytes, t.maxBodyBytes)
-		_ = t.store.AppendEvent(InteractionEvent{
+		t.sink.AppendEventAsync(InteractionEvent{
 			InteractionID: interactionID,
 			Kind:          EventBackendRequest,
 			Method:        req.Method,
@@ -42,7 +42,7 @@ func (t *Tracer) WrapTransport(base http.RoundTripper) http.RoundTripper {
 
 		resp, err := base.RoundTrip(req)
 		if err != nil {
-			_ = t.store.AppendEvent(InteractionEvent{
+			t.sink.AppendEventAsync(InteractionEvent{
 				InteractionID: interactionID,
 				Kind:          EventBackendResponse,
 				Method:        req.Method,
@@ -54,7 +54,7 @@ func (t *Tracer) WrapTransport(base http.RoundTripper) http.RoundTripper {
 			return nil, err
 		}
 		if resp.Body == nil {
-			_ = t.store.AppendEvent(InteractionEvent{
+			t.sink.AppendEventAsync(InteractionEvent{
 				InteractionID: interactionID,
 				Kind:          EventBackendResponse,
 				Method:        req.Method,
@@ -81,6 +81,7 @@ func (t *Tracer) WrapTransport(base http.RoundTripper) http.RoundTripper {
 			headersJSON:   headersJSON(resp.Header),
 			startedAt:     startedAt,
 			maxBodyBytes:  t.maxBodyBytes,
+			timer:         NewStreamTimer(startedAt, resp.Header.Get("Content-Type")),
 		}
 		return resp, nil
 	})
@@ -105,6 +106,7 @@ type responseBodyRecorder struct {
 	startedAt     time.Time
 	maxBodyBytes  int
 	bodyBuffer    limitedBuffer
+	timer         *StreamTimer
 	once          sync.Once
 }
 
@@ -113,6 +115,7 @@ func (r *responseBodyRecorder) Read(p []byte) (int, error) {
 	if n > 0 {
 		r.bodyBuffer.maxBytes = r.maxBodyBytes
 		r.bodyBuffer.Write(p[:n])
+		r.timer.Observe(p[:n], time.Now())
 	}
 	if err != nil {
 		r.record()
@@ -129,7 +132,7 @@ func (r *responseBodyRecorder) Close() error {
 func (r *responseBodyRecorder) record() {
 	r.once.Do(func() {
 		body, truncated := r.bodyBuffer.String()
-		_ = r.tracer.store.AppendEvent(InteractionEvent{
+		r.tracer.sink.AppendEventAsync(InteractionEvent{
 			InteractionID: r.interactionID,
 			Kind:          EventBackendResponse,
 			Method:        r.method,
@@ -143,6 +146,8 @@ func (r *responseBodyRecorder) record() {
 			Summary:       summarizeResponse("backend response", r.statusCode, len(body), truncated),
 			DurationMs:    time.Since(r.startedAt).Milliseconds(),
 		})
-		r.tracer.logf("interaction_id=%s stage=%s status=%d duration_ms=%d", r.interactionID, EventBackendResponse, r.statusCode, time.Since(r.startedAt).Milliseconds())
+		timing := r.timer.Timing()
+		r.tracer.sink.SetBackendTimingAsync(r.interactionID, timing)
+		r.tracer.logf("interaction_id=%s stage=%s status=%d duration_ms=%d %s", r.interactionID, EventBackendResponse, r.statusCode, time.Since(r.startedAt).Milliseconds(), timing)
 	})
 }
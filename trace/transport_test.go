@@ -55,6 +55,7 @@ func TestTracer_WrapTransport_RecordsBackendRequestAndResponse(t *testing.T) {
 	require.NoError(t, resp.Body.Close())
 	require.Contains(t, string(body), "response.completed")
 
+	store.Flush()
 	_, events, err := store.GetInteraction("ia_transport_1")
 	require.NoError(t, err)
 	require.Len(t, events, 2)
@@ -64,4 +65,9 @@ func TestTracer_WrapTransport_RecordsBackendRequestAndResponse(t *testing.T) {
 	require.Equal(t, EventBackendResponse, events[1].Kind)
 	require.Equal(t, http.StatusOK, events[1].StatusCode)
 	require.Contains(t, events[1].Body, "response.completed")
+
+	got, _, err := store.GetInteraction("ia_transport_1")
+	require.NoError(t, err)
+	require.NotNil(t, got.BackendTiming.FirstByteMs)
+	require.Equal(t, 1, got.BackendTiming.SSEEvents)
 }
@@ -0,0 +1,148 @@
+package trace
+
+import (
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultUIPath 是 gptb2o-server 挂载 trace 浏览页面的默认路径。
+const DefaultUIPath = "/debug/traces"
+
+const maxUIPageSize = 200
+
+//go:embed ui
+var uiAssets embed.FS
+
+// UIListResponse 是 api/interactions 的返回结构。
+type UIListResponse struct {
+	Items   []Interaction `json:"items"`
+	Offset  int           `json:"offset"`
+	Limit   int           `json:"limit"`
+	HasMore bool          `json:"has_more"`
+}
+
+// NewUIHandler 返回挂载在 prefix 下的只读 trace 浏览页面：
+//
+//	GET {prefix}/                           静态页面（内嵌资源）
+//	GET {prefix}/api/interactions           分页列表，参数与 trace list 的过滤参数对应
+//	GET {prefix}/api/interactions/{id}      NewInteractionJSON 结构的详情
+//
+// 页面会展示完整的请求/响应 body，只应在本机或受信任网络中开启。
+func NewUIHandler(sink Sink, prefix string) http.Handler {
+	prefix = "/" + strings.Trim(strings.TrimSpace(prefix), "/")
+	if prefix == "/" {
+		prefix = ""
+	}
+	static, err := fs.Sub(uiAssets, "ui")
+	if err != nil {
+		panic(err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/interactions", func(w http.ResponseWriter, r *http.Request) {
+		serveUIList(w, r, sink)
+	})
+	mux.HandleFunc("GET /api/interactions/{id}", func(w http.ResponseWriter, r *http.Request) {
+		serveUIInteraction(w, r, sink)
+	})
+	mux.Handle("GET /", http.FileServerFS(static))
+
+	stripped := http.StripPrefix(prefix, mux)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// 页面内使用相对路径请求 api 与静态资源，必须以 "/" 结尾访问。
+		if r.URL.Path == prefix {
+			http.Redirect(w, r, prefix+"/", http.StatusMovedPermanently)
+			return
+		}
+		stripped.ServeHTTP(w, r)
+	})
+}
+
+func serveUIList(w http.ResponseWriter, r *http.Request, sink Sink) {
+	filter, err := uiFilterFromQuery(r, time.Now())
+	if err != nil {
+		writeUIError(w, http.StatusBadRequest, err)
+		return
+	}
+	limit := filter.Limit
+	// 多取一条用于判断是否还有下一页。
+	filter.Limit++
+	items, err := sink.ListInteractions(filter)
+	if err != nil {
+		writeUIError(w, http.StatusInternalServerError, err)
+		return
+	}
+	resp := UIListResponse{Items: items, Offset: filter.Offset, Limit: limit}
+	if len(items) > limit {
+		resp.Items = items[:limit]
+		resp.HasMore = true
+	}
+	writeUIJSON(w, resp)
+}
+
+func serveUIInteraction(w http.ResponseWriter, r *http.Request, sink Sink) {
+	interaction, events, err := sink.GetInteraction(r.PathValue("id"))
+	if errors.Is(err, ErrInteractionNotFound) {
+		writeUIError(w, http.StatusNotFound, fmt.Errorf("interaction not found"))
+		return
+	}
+	if err != nil {
+		writeUIError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeUIJSON(w, NewInteractionJSON(interaction, events))
+}
+
+func uiFilterFromQuery(r *http.Request, now time.Time) (InteractionFilter, error) {
+	q := r.URL.Query()
+	filter := InteractionFilter{
+		ClientAPI:   q.Get("client_api"),
+		Model:       q.Get("model"),
+		Text:        q.Get("q"),
+		HasError:    q.Get("errors") == "1" || q.Get("errors") == "true",
+		HasRecovery: q.Get("recovery") == "1" || q.Get("recovery") == "true",
+		Limit:       defaultListLimit,
+	}
+	var err error
+	if filter.Since, err = ParseFilterTime(q.Get("since"), now); err != nil {
+		return filter, fmt.Errorf("invalid since: %w", err)
+	}
+	if filter.Until, err = ParseFilterTime(q.Get("until"), now); err != nil {
+		return filter, fmt.Errorf("invalid until: %w", err)
+	}
+	for name, dst := range map[string]*int{"status": &filter.StatusCode, "limit": &filter.Limit, "offset": &filter.Offset} {
+		raw := strings.TrimSpace(q.Get(name))
+		if raw == "" {
+			continue
+		}
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 0 {
+			return filter, fmt.Errorf("invalid %s %q", name, raw)
+		}
+		*dst = n
+	}
+	if filter.Limit <= 0 {
+		filter.Limit = defaultListLimit
+	}
+	filter.Limit = min(filter.Limit, maxUIPageSize)
+	return filter, nil
+}
+
+func writeUIJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeUIError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,278 @@
+"use strict";
+
+// 页面只通过相对路径访问 api/，因此可以挂在任意前缀下。
+(function () {
+  const $ = (sel) => document.querySelector(sel);
+  const listView = $("#list-view");
+  const detailView = $("#detail-view");
+  const errorBox = $("#error");
+  const form = $("#filters");
+
+  // el 只用 textContent 填充文本：trace body 来自客户端与 backend，不能当作 HTML。
+  function el(tag, attrs, ...children) {
+    const node = document.createElement(tag);
+    for (const [key, value] of Object.entries(attrs || {})) {
+      if (value === undefined || value === null || value === false) continue;
+      if (key === "class") node.className = value;
+      else if (key.startsWith("on")) node.addEventListener(key.slice(2), value);
+      else node.setAttribute(key, value === true ? "" : value);
+    }
+    for (const child of children.flat()) {
+      if (child === undefined || child === null || child === false) continue;
+      node.append(child instanceof Node ? child : document.createTextNode(String(child)));
+    }
+    return node;
+  }
+
+  function showError(err) {
+    errorBox.hidden = !err;
+    errorBox.textContent = err ? String(err.message || err) : "";
+  }
+
+  async function getJSON(url) {
+    const resp = await fetch(url, { headers: { Accept: "application/json" } });
+    const data = await resp.json().catch(() => ({}));
+    if (!resp.ok) throw new Error(data.error || resp.status + " " + resp.statusText);
+    return data;
+  }
+
+  function fmtTime(value) {
+    if (!value) return "-";
+    const d = new Date(value);
+    const pad = (n) => String(n).padStart(2, "0");
+    return `${d.getFullYear()}-${pad(d.getMonth() + 1)}-${pad(d.getDate())} ${pad(d.getHours())}:${pad(d.getMinutes())}:${pad(d.getSeconds())}`;
+  }
+
+  function durationMs(item) {
+    if (!item.finished_at) return null;
+    return new Date(item.finished_at) - new Date(item.started_at);
+  }
+
+  function statusCell(code) {
+    return el("span", { class: code >= 400 || code === 0 ? "status-err" : "status-ok" }, code || "-");
+  }
+
+  // ---- list ----
+
+  function currentListParams() {
+    const hash = location.hash.replace(/^#\/?/, "");
+    return new URLSearchParams(hash.startsWith("?") ? hash.slice(1) : "");
+  }
+
+  function fillForm(params) {
+    for (const input of form.elements) {
+      if (!input.name) continue;
+      if (input.type === "checkbox") input.checked = params.get(input.name) === "1";
+      else if (params.has(input.name)) input.value = params.get(input.name);
+      else if (input.tagName !== "SELECT") input.value = "";
+    }
+  }
+
+  function paramsFromForm(offset) {
+    const params = new URLSearchParams();
+    for (const input of form.elements) {
+      if (!input.name) continue;
+      if (input.type === "checkbox") {
+        if (input.checked) params.set(input.name, "1");
+      } else if (input.value.trim() !== "") {
+        params.set(input.name, input.value.trim());
+      }
+    }
+    if (offset > 0) params.set("offset", String(offset));
+    return params;
+  }
+
+  async function renderList(params) {
+    listView.hidden = false;
+    detailView.hidden = true;
+    $("#crumb").textContent = "";
+    fillForm(params);
+
+    const data = await getJSON("api/interactions?" + params.toString());
+    const tbody = $("#interactions tbody");
+    tbody.replaceChildren(...data.items.map((item) => {
+      const ms = durationMs(item);
+      const summary = [item.error_summary, item.recovery_summary].filter(Boolean).join(" | ");
+      return el("tr", { onclick: () => { location.hash = "#/i/" + encodeURIComponent(item.interaction_id); } },
+        el("td", { class: "mono" }, fmtTime(item.started_at)),
+        el("td", { class: "mono" }, item.interaction_id, item.replay_of ? el("div", { class: "muted" }, "replay of " + item.replay_of) : null),
+        el("td", {}, item.client_api),
+        el("td", {}, item.model),
+        el("td", {}, statusCell(item.status_code)),
+        el("td", {}, ms === null ? "-" : ms + "ms"),
+        el("td", { class: "mono" }, item.method + " " + item.path),
+        el("td", { class: "summary", title: summary }, summary));
+    }));
+    if (data.items.length === 0) {
+      tbody.append(el("tr", {}, el("td", { colspan: 8 }, "no interactions match")));
+    }
+
+    const offset = data.offset || 0;
+    $("#page-info").textContent = data.items.length
+      ? `${offset + 1}–${offset + data.items.length}`
+      : "";
+    $("#prev").disabled = offset === 0;
+    $("#next").disabled = !data.has_more;
+    $("#prev").onclick = () => { location.hash = "#/?" + paramsFromForm(Math.max(offset - data.limit, 0)); };
+    $("#next").onclick = () => { location.hash = "#/?" + paramsFromForm(offset + data.limit); };
+  }
+
+  form.addEventListener("submit", (e) => {
+    e.preventDefault();
+    location.hash = "#/?" + paramsFromForm(0);
+  });
+
+  // ---- detail ----
+
+  function prettyJSON(text) {
+    try {
+      return JSON.stringify(JSON.parse(text), null, 2);
+    } catch (_) {
+      return null;
+    }
+  }
+
+  // renderSSE 按空行切分事件，并把 data 中的 JSON 展开缩进。
+  function renderSSE(body) {
+    const blocks = body.split(/\r?\n\r?\n/).filter((b) => b.trim() !== "");
+    return el("pre", {}, blocks.map((block) => {
+      let name = "";
+      const data = [];
+      for (const line of block.split(/\r?\n/)) {
+        if (line.startsWith("event:")) name = line.slice(6).trim();
+        else if (line.startsWith("data:")) data.push(line.slice(5).replace(/^ /, ""));
+        else data.push(line);
+      }
+      const raw = data.join("\n");
+      return el("div", { class: "sse-event" },
+        name ? el("span", { class: "sse-name" }, "event: " + name + "\n") : null,
+        prettyJSON(raw) ?? raw);
+    }));
+  }
+
+  function renderBody(event) {
+    if (!event.body) return null;
+    const isSSE = /text\/event-stream/i.test(event.content_type || "") || /^(event|data):/.test(event.body.trimStart());
+    const label = `body (${event.body.length} bytes${event.body_truncated ? ", truncated" : ""}${isSSE ? ", SSE" : ""})`;
+    return el("details", {}, el("summary", {}, label),
+      isSSE ? renderSSE(event.body) : el("pre", {}, prettyJSON(event.body) ?? event.body));
+  }
+
+  function renderHeaders(event) {
+    if (!event.headers_json) return null;
+    return el("details", {}, el("summary", {}, "headers"), el("pre", {}, prettyJSON(event.headers_json) ?? event.headers_json));
+  }
+
+  function renderTranscript(transcript) {
+    if (!transcript) return null;
+    const parts = [];
+    if (transcript.reasoning) parts.push(el("div", {}, el("span", { class: "label" }, "reasoning"), el("pre", {}, transcript.reasoning)));
+    if (transcript.text) parts.push(el("div", {}, el("span", { class: "label" }, "text"), el("pre", {}, transcript.text)));
+    for (const call of transcript.tool_calls || []) {
+      parts.push(el("div", {},
+        el("span", { class: "label" }, `tool_call ${call.name}${call.id ? " (" + call.id + ")" : ""}`),
+        el("pre", {}, prettyJSON(call.arguments) ?? call.arguments)));
+    }
+    for (const message of transcript.errors || []) {
+      parts.push(el("div", { class: "error" }, "error: " + message));
+    }
+    const meta = [];
+    if (transcript.stop_reason) meta.push("stop_reason=" + transcript.stop_reason);
+    if (transcript.usage) meta.push(`usage in=${transcript.usage.input_tokens} out=${transcript.usage.output_tokens}`);
+    if (transcript.sse_events) meta.push("sse_events=" + transcript.sse_events);
+    if (transcript.incomplete) meta.push("incomplete (body truncated)");
+    if (meta.length) parts.push(el("div", { class: "label" }, meta.join("  ")));
+    return el("div", { class: "transcript" }, parts);
+  }
+
+  function fmtTiming(timing) {
+    if (!timing || (timing.first_byte_ms == null && !timing.sse_events)) return null;
+    const parts = [];
+    if (timing.first_byte_ms != null) parts.push(`first_byte=${timing.first_byte_ms}ms`);
+    if (timing.first_token_ms != null) parts.push(`first_token=${timing.first_token_ms}ms`);
+    if (timing.sse_events) parts.push(`sse_events=${timing.sse_events}`, `max_gap=${timing.max_gap_ms}ms`);
+    return parts.join(" ");
+  }
+
+  function renderTimeline(events) {
+    let attempt = 0;
+    const backendAttempts = events.filter((e) => e.kind === "backend_request").length;
+    return el("ol", { class: "timeline" }, events.map((event) => {
+      const side = event.kind.startsWith("client") ? "client" : "backend";
+      let attemptLabel = null;
+      let retry = false;
+      if (event.kind === "backend_request") {
+        attempt++;
+        retry = attempt > 1;
+        if (backendAttempts > 1) attemptLabel = `attempt ${attempt}/${backendAttempts}`;
+      } else if (event.kind === "backend_response" && backendAttempts > 1) {
+        retry = attempt > 1;
+        attemptLabel = `attempt ${attempt}/${backendAttempts}`;
+      }
+      return el("li", { class: side + (retry ? " retry" : "") },
+        el("div", { class: "event-head" },
+          el("span", { class: "mono muted" }, "#" + event.seq),
+          el("span", { class: "kind" }, event.kind),
+          attemptLabel ? el("span", { class: "attempt" }, attemptLabel) : null,
+          event.status_code ? statusCell(event.status_code) : null,
+          event.duration_ms ? el("span", { class: "muted" }, event.duration_ms + "ms") : null,
+          el("span", { class: "mono" }, [event.method, event.url || event.path].filter(Boolean).join(" "))),
+        event.summary ? el("div", { class: "muted" }, event.summary) : null,
+        event.transcript ? el("details", {}, el("summary", {}, "transcript"), renderTranscript(event.transcript)) : null,
+        renderHeaders(event),
+        renderBody(event));
+    }));
+  }
+
+  async function renderDetail(id) {
+    listView.hidden = true;
+    detailView.hidden = false;
+    $("#crumb").textContent = "/ " + id;
+    detailView.replaceChildren(el("p", { class: "muted" }, "loading…"));
+
+    const data = await getJSON("api/interactions/" + encodeURIComponent(id));
+    const ia = data.interaction;
+    const events = data.events || [];
+    const finalResponse = [...events].reverse().find((e) => e.kind === "client_response");
+    const ms = durationMs(ia);
+
+    const meta = [
+      ["interaction", ia.interaction_id],
+      ["request", `${ia.method} ${ia.path}${ia.query ? "?" + ia.query : ""}`],
+      ["client / model", `${ia.client_api} / ${ia.model || "-"}${ia.stream ? " (stream)" : ""}`],
+      ["status", statusCell(ia.status_code)],
+      ["started", fmtTime(ia.started_at)],
+      ["duration", ms === null ? "unfinished" : ms + "ms"],
+      ["client_timing", fmtTiming(ia.client_timing)],
+      ["backend_timing", fmtTiming(ia.backend_timing)],
+      ["replay_of", ia.replay_of ? el("a", { href: "#/i/" + encodeURIComponent(ia.replay_of) }, ia.replay_of) : null],
+    ].filter(([, value]) => value);
+
+    detailView.replaceChildren(
+      el("p", {}, el("a", { href: "#/" }, "← all interactions")),
+      data.recovery_summary ? el("div", { class: "banner recovery" }, el("strong", {}, "recovery_summary: "), data.recovery_summary) : null,
+      ia.error_summary ? el("div", { class: "banner failure" }, el("strong", {}, "error_summary: "), ia.error_summary) : null,
+      el("dl", { class: "meta" }, meta.map(([key, value]) => [el("dt", {}, key), el("dd", {}, value)])),
+      el("h2", {}, "Transcript"),
+      finalResponse && finalResponse.transcript
+        ? renderTranscript(finalResponse.transcript)
+        : el("p", { class: "muted" }, "no client response could be reassembled"),
+      el("h2", {}, `Timeline (${events.length} events)`),
+      renderTimeline(events));
+  }
+
+  async function route() {
+    showError(null);
+    const hash = location.hash || "#/";
+    try {
+      const match = hash.match(/^#\/i\/(.+)$/);
+      if (match) await renderDetail(decodeURIComponent(match[1]));
+      else await renderList(currentListParams());
+    } catch (err) {
+      showError(err);
+    }
+  }
+
+  window.addEventListener("hashchange", route);
+  route();
+})();
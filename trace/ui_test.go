@@ -0,0 +1,75 @@
+package trace
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUIHandler_ListDetailAndAssets(t *testing.T) {
+	t.Parallel()
+
+	store, err := OpenStore(filepath.Join(t.TempDir(), "trace.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { require.NoError(t, store.Close()) })
+
+	base := time.Date(2026, 10, 1, 12, 0, 0, 0, time.Local)
+	for i, id := range []string{"ia_1", "ia_2", "ia_3"} {
+		seedListInteraction(t, store, Interaction{
+			InteractionID: id, Method: http.MethodPost, Path: "/v1/responses",
+			ClientAPI: "openai", Model: "gpt-5.4", StartedAt: base.Add(time.Duration(i) * time.Minute),
+		}, http.StatusOK, "", `{"input":"hi"}`)
+	}
+	require.NoError(t, store.AppendEvent(InteractionEvent{
+		InteractionID: "ia_2", Seq: 2, Kind: EventClientResponse, StatusCode: http.StatusOK,
+		ContentType: "application/json",
+		Body:        `{"object":"response","status":"completed","output":[{"type":"message","content":[{"type":"output_text","text":"hello"}]}]}`,
+	}))
+
+	handler := NewUIHandler(store, DefaultUIPath)
+	get := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+
+	rec := get(DefaultUIPath)
+	require.Equal(t, http.StatusMovedPermanently, rec.Code)
+	require.Equal(t, DefaultUIPath+"/", rec.Header().Get("Location"))
+
+	rec = get(DefaultUIPath + "/")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Contains(t, rec.Body.String(), `<script src="app.js">`)
+	require.Equal(t, http.StatusOK, get(DefaultUIPath+"/app.js").Code)
+
+	rec = get(DefaultUIPath + "/api/interactions?limit=2")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var page UIListResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &page))
+	require.True(t, page.HasMore)
+	require.Len(t, page.Items, 2)
+	require.Equal(t, "ia_3", page.Items[0].InteractionID)
+
+	rec = get(DefaultUIPath + "/api/interactions?limit=2&offset=2")
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &page))
+	require.False(t, page.HasMore)
+	require.Len(t, page.Items, 1)
+	require.Equal(t, "ia_1", page.Items[0].InteractionID)
+
+	require.Equal(t, http.StatusBadRequest, get(DefaultUIPath+"/api/interactions?since=yesterday").Code)
+
+	rec = get(DefaultUIPath + "/api/interactions/ia_2")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var detail InteractionJSON
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &detail))
+	require.Len(t, detail.Events, 2)
+	require.NotNil(t, detail.Events[1].Transcript)
+	require.Equal(t, "hello", detail.Events[1].Transcript.Text)
+
+	require.Equal(t, http.StatusNotFound, get(DefaultUIPath+"/api/interactions/ia_missing").Code)
+}
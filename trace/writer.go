@@ -0,0 +1,311 @@
+package trace
+
+import (
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	defaultWriteQueueSize = 4096
+	writeBatchSize        = 256
+)
+
+type writeOpKind int
+
+const (
+	writeOpStart writeOpKind = iota
+	writeOpAppend
+	writeOpFinish
+	writeOpUpdate
+	writeOpFlush
+)
+
+type writeOp struct {
+	kind        writeOpKind
+	interaction Interaction
+	event       InteractionEvent
+	finish      finishUpdate
+	columns     map[string]any
+	flushed     chan struct{}
+}
+
+type finishUpdate struct {
+	interactionID string
+	statusCode    int
+	errorSummary  string
+	finishedAt    time.Time
+}
+
+// startWriter 启动后台批量写入 goroutine，由 OpenStore 调用。
+func (s *Store) startWriter(queueSize int) {
+	if queueSize <= 0 {
+		queueSize = defaultWriteQueueSize
+	}
+	s.writes = make(chan writeOp, queueSize)
+	s.workers.Add(1)
+	go func() {
+		defer s.workers.Done()
+		s.writeLoop()
+	}()
+}
+
+func (s *Store) writeLoop() {
+	batch := make([]writeOp, 0, writeBatchSize)
+	for {
+		select {
+		case op := <-s.writes:
+			batch = append(batch[:0], op)
+		case <-s.done:
+			// 关闭时写完队列中剩余的操作再退出。
+			for {
+				batch = batch[:0]
+				s.drainWrites(&batch)
+				if len(batch) == 0 {
+					return
+				}
+				s.writeBatch(batch)
+			}
+		}
+		s.drainWrites(&batch)
+		s.writeBatch(batch)
+	}
+}
+
+func (s *Store) drainWrites(batch *[]writeOp) {
+	for len(*batch) < writeBatchSize {
+		select {
+		case op := <-s.writes:
+			*batch = append(*batch, op)
+		default:
+			return
+		}
+	}
+}
+
+// writeBatch 在一个事务里按入队顺序写入；flush 标记在其之前的操作落库后才会释放。
+// 事务失败时逐条重试，只丢弃仍然失败的操作，避免一条坏数据拖累整批。
+func (s *Store) writeBatch(batch []writeOp) {
+	var flushes []chan struct{}
+	for _, op := range batch {
+		if op.kind == writeOpFlush {
+			flushes = append(flushes, op.flushed)
+		}
+	}
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		for _, op := range batch {
+			if err := applyWriteOp(tx, op); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		failed := uint64(0)
+		var lastErr error
+		for _, op := range batch {
+			if err := applyWriteOp(s.db, op); err != nil {
+				failed++
+				lastErr = err
+			}
+		}
+		if failed > 0 {
+			s.dropped.Add(failed)
+			log.Printf("[gptb2o][trace] batch write failed: dropped=%d err=%v", failed, lastErr)
+		}
+	}
+	for _, ch := range flushes {
+		close(ch)
+	}
+}
+
+func applyWriteOp(db *gorm.DB, op writeOp) error {
+	switch op.kind {
+	case writeOpStart:
+		interaction := op.interaction
+		return db.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "interaction_id"}},
+			DoNothing: true,
+		}).Create(&interaction).Error
+	case writeOpAppend:
+		event := op.event
+		return db.Create(&event).Error
+	case writeOpFinish:
+		return finishInteraction(db, op.finish)
+	case writeOpUpdate:
+		return db.Model(&Interaction{}).
+			Where("interaction_id = ?", op.interaction.InteractionID).
+			Updates(op.columns).Error
+	}
+	return nil
+}
+
+// enqueue 非阻塞入队；队列满或 Store 已关闭时丢弃并计数，不拖慢请求。
+func (s *Store) enqueue(op writeOp) {
+	if s.closed.Load() {
+		s.dropped.Add(1)
+		return
+	}
+	select {
+	case s.writes <- op:
+	default:
+		// 只在丢弃数为 2 的幂时打印，避免日志刷屏。
+		if n := s.dropped.Add(1); n&(n-1) == 0 {
+			log.Printf("[gptb2o][trace] write queue full, dropped=%d", n)
+		}
+	}
+}
+
+// StartInteractionAsync 与 StartInteraction 相同，但由后台 goroutine 批量落库。
+func (s *Store) StartInteractionAsync(interaction Interaction) {
+	if s == nil || s.db == nil || strings.TrimSpace(interaction.InteractionID) == "" {
+		return
+	}
+	if interaction.StartedAt.IsZero() {
+		interaction.StartedAt = time.Now()
+	}
+	s.seqs.start(interaction.InteractionID)
+	s.enqueue(writeOp{kind: writeOpStart, interaction: interaction})
+}
+
+// AppendEventAsync 在内存中分配 seq 后入队，调用方不会等待 SQLite。
+func (s *Store) AppendEventAsync(event InteractionEvent) {
+	if s == nil || s.db == nil || strings.TrimSpace(event.InteractionID) == "" || event.Kind == "" {
+		return
+	}
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now()
+	}
+	if event.Seq <= 0 {
+		seq, err := s.seqs.next(event.InteractionID)
+		if err != nil {
+			s.dropped.Add(1)
+			return
+		}
+		event.Seq = seq
+	}
+	s.enqueue(writeOp{kind: writeOpAppend, event: event})
+}
+
+// FinishInteractionAsync 与 FinishInteraction 相同，但异步落库。
+func (s *Store) FinishInteractionAsync(interactionID string, statusCode int, errorSummary string) {
+	interactionID = strings.TrimSpace(interactionID)
+	if s == nil || s.db == nil || interactionID == "" {
+		return
+	}
+	s.seqs.retire(interactionID)
+	s.enqueue(writeOp{kind: writeOpFinish, finish: finishUpdate{
+		interactionID: interactionID,
+		statusCode:    statusCode,
+		errorSummary:  errorSummary,
+		finishedAt:    time.Now(),
+	}})
+}
+
+// SetClientTimingAsync 异步写入客户端响应的流式时延列。
+func (s *Store) SetClientTimingAsync(interactionID string, timing StreamTiming) {
+	s.setTimingAsync(interactionID, "client_", timing)
+}
+
+// SetBackendTimingAsync 异步写入 backend 响应的流式时延列；backend 重试时以最后一次为准。
+func (s *Store) SetBackendTimingAsync(interactionID string, timing StreamTiming) {
+	s.setTimingAsync(interactionID, "backend_", timing)
+}
+
+func (s *Store) setTimingAsync(interactionID string, prefix string, timing StreamTiming) {
+	interactionID = strings.TrimSpace(interactionID)
+	if s == nil || s.db == nil || interactionID == "" {
+		return
+	}
+	s.enqueue(writeOp{
+		kind:        writeOpUpdate,
+		interaction: Interaction{InteractionID: interactionID},
+		columns:     timing.columns(prefix),
+	})
+}
+
+// Flush 阻塞到此前入队的异步写入全部落库。
+func (s *Store) Flush() {
+	if s == nil || s.db == nil || s.closed.Load() {
+		return
+	}
+	flushed := make(chan struct{})
+	select {
+	case s.writes <- writeOp{kind: writeOpFlush, flushed: flushed}:
+	case <-s.done:
+		return
+	}
+	select {
+	case <-flushed:
+	case <-s.done:
+	}
+}
+
+// DroppedWrites 返回因队列满、写入失败或 Store 已关闭而丢弃的异步写入数。
+func (s *Store) DroppedWrites() uint64 {
+	if s == nil {
+		return 0
+	}
+	return s.dropped.Load()
+}
+
+// lastSeq 返回库中 interaction 已有的最大 seq，供 seqAllocator 在首次见到时作为起点。
+func (s *Store) lastSeq(interactionID string) (int, error) {
+	var event InteractionEvent
+	err := s.db.Where("interaction_id = ?", interactionID).
+		Order("seq DESC, id DESC").
+		Limit(1).
+		Take(&event).Error
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return 0, nil
+	case err != nil:
+		return 0, err
+	}
+	return event.Seq, nil
+}
+
+// finishInteraction 写入结束状态，并一次性计算 recovery_summary，避免列表查询时逐条读取事件。
+func finishInteraction(db *gorm.DB, update finishUpdate) error {
+	finishedAt := update.finishedAt
+	columns := map[string]any{
+		"status_code":   update.statusCode,
+		"error_summary": update.errorSummary,
+		"finished_at":   &finishedAt,
+	}
+	var interaction Interaction
+	err := db.Select("interaction_id", "client_api", "path").
+		Where("interaction_id = ?", update.interactionID).
+		Take(&interaction).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	if err == nil {
+		recovery, err := loadRecoverySummary(db, interaction)
+		if err != nil {
+			return err
+		}
+		columns["recovery_summary"] = recovery
+	}
+	return db.Model(&Interaction{}).
+		Where("interaction_id = ?", update.interactionID).
+		Updates(columns).Error
+}
+
+// loadRecoverySummary 读取事件计算 recovery_summary；只有 Claude /v1/messages 需要读取事件。
+func loadRecoverySummary(db *gorm.DB, interaction Interaction) (string, error) {
+	if interaction.ClientAPI != "claude" || interaction.Path != "/v1/messages" {
+		return "", nil
+	}
+	var events []InteractionEvent
+	if err := db.Where("interaction_id = ?", interaction.InteractionID).
+		Order("seq ASC, id ASC").
+		Find(&events).Error; err != nil {
+		return "", err
+	}
+	return summarizeClaudeRecovery(interaction, events), nil
+}
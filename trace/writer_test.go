@@ -0,0 +1,108 @@
+package trace
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStore_AsyncWrites_AssignSeqAndFlush(t *testing.T) {
+	t.Parallel()
+
+	store, err := OpenStore(filepath.Join(t.TempDir(), "trace.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { require.NoError(t, store.Close()) })
+
+	store.StartInteractionAsync(Interaction{InteractionID: "ia_async", Path: "/v1/responses"})
+	store.AppendEventAsync(InteractionEvent{InteractionID: "ia_async", Kind: EventClientRequest, Body: "req"})
+	store.AppendEventAsync(InteractionEvent{InteractionID: "ia_async", Kind: EventClientResponse, Body: "resp"})
+	store.FinishInteractionAsync("ia_async", 200, "")
+	// 结束后才到达的事件仍沿用内存中的计数。
+	store.AppendEventAsync(InteractionEvent{InteractionID: "ia_async", Kind: EventBackendResponse, Body: "late"})
+	store.Flush()
+
+	got, events, err := store.GetInteraction("ia_async")
+	require.NoError(t, err)
+	require.Equal(t, 200, got.StatusCode)
+	require.NotNil(t, got.FinishedAt)
+	require.Len(t, events, 3)
+	for i, event := range events {
+		require.Equal(t, i+1, event.Seq)
+	}
+	require.Equal(t, "late", events[2].Body)
+	require.Zero(t, store.DroppedWrites())
+}
+
+func TestStore_AsyncWrites_CloseFlushesQueueAndDropsAfterClose(t *testing.T) {
+	t.Parallel()
+
+	dbPath := filepath.Join(t.TempDir(), "trace.db")
+	store, err := OpenStore(dbPath)
+	require.NoError(t, err)
+
+	store.StartInteractionAsync(Interaction{InteractionID: "ia_close", Path: "/v1/messages"})
+	for i := 0; i < 50; i++ {
+		store.AppendEventAsync(InteractionEvent{InteractionID: "ia_close", Kind: EventBackendResponse, Body: "chunk"})
+	}
+	require.NoError(t, store.Close())
+
+	store.AppendEventAsync(InteractionEvent{InteractionID: "ia_close", Kind: EventBackendResponse, Body: "after close"})
+	require.Equal(t, uint64(1), store.DroppedWrites())
+
+	reopened, err := OpenStore(dbPath)
+	require.NoError(t, err)
+	t.Cleanup(func() { require.NoError(t, reopened.Close()) })
+	_, events, err := reopened.GetInteraction("ia_close")
+	require.NoError(t, err)
+	require.Len(t, events, 50)
+
+	// 新进程对已有 interaction 追加事件时，从库里的最大 seq 继续。
+	require.NoError(t, reopened.AppendEvent(InteractionEvent{InteractionID: "ia_close", Kind: EventClientResponse}))
+	_, events, err = reopened.GetInteraction("ia_close")
+	require.NoError(t, err)
+	require.Equal(t, 51, events[len(events)-1].Seq)
+}
+
+func TestStore_WriteBatch_RetriesOpsIndividually(t *testing.T) {
+	t.Parallel()
+
+	store, err := OpenStore(filepath.Join(t.TempDir(), "trace.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { require.NoError(t, store.Close()) })
+
+	// 直接调用 writeBatch，使坏操作与正常操作落在同一个事务里。
+	store.writeBatch([]writeOp{
+		{kind: writeOpStart, interaction: Interaction{InteractionID: "ia_retry", Path: "/v1/responses", StartedAt: time.Now()}},
+		{kind: writeOpUpdate, interaction: Interaction{InteractionID: "ia_retry"}, columns: map[string]any{"no_such_column": 1}},
+		{kind: writeOpAppend, event: InteractionEvent{InteractionID: "ia_retry", Seq: 1, Kind: EventClientRequest, Body: "req", CreatedAt: time.Now()}},
+	})
+
+	_, events, err := store.GetInteraction("ia_retry")
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	require.Equal(t, uint64(1), store.DroppedWrites())
+}
+
+func TestStore_ReadsSeePendingAsyncWrites(t *testing.T) {
+	t.Parallel()
+
+	store, err := OpenStore(filepath.Join(t.TempDir(), "trace.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { require.NoError(t, store.Close()) })
+
+	store.StartInteractionAsync(Interaction{InteractionID: "ia_pending", Path: "/v1/messages"})
+	store.AppendEventAsync(InteractionEvent{InteractionID: "ia_pending", Kind: EventClientRequest, Body: "req"})
+	store.FinishInteractionAsync("ia_pending", 200, "")
+
+	// 不调用 Flush：读接口自己等待已入队的写入。
+	items, err := store.ListInteractions(InteractionFilter{})
+	require.NoError(t, err)
+	require.Len(t, items, 1)
+	require.Equal(t, 200, items[0].StatusCode)
+
+	_, events, err := store.GetInteraction("ia_pending")
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+}